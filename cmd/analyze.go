@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"mrshanahan.com/notes-indexer/internal/config"
+	"mrshanahan.com/notes-indexer/pkg/analysis"
+	"mrshanahan.com/notes-indexer/pkg/index"
+	"mrshanahan.com/notes-indexer/pkg/tokenizer"
+)
+
+// One token as read by the tokenizer, with what each filter after it turned
+// it into.
+type analyzedToken struct {
+	Text   string       `json:"text"` // What it was read from
+	Start  int          `json:"start"`
+	End    int          `json:"end"`
+	Type   string       `json:"type"`
+	Stages []stageTerms `json:"stages"`
+}
+
+type stageTerms struct {
+	Name  string   `json:"name"`
+	Terms []string `json:"terms"` // Empty if it was removed
+}
+
+type analyzeOutput struct {
+	Analyzer string          `json:"analyzer"`
+	Field    string          `json:"field,omitempty"`
+	Stages   []string        `json:"stages"`
+	Tokens   []analyzedToken `json:"tokens"`
+	Terms    []string        `json:"terms"` // What's indexed or searched for
+}
+
+// Shows every stage of analyzing some text: what the tokenizer reads, and what
+// each filter after it makes of that. For working out why a note does or
+// doesn't match a query.
+func analyzeText(cfg config.Config, args []string) {
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	analyzerName := flags.String("analyzer", orDefault(cfg.DefaultAnalyzer, "english"), "the analyzer to use: "+strings.Join(analysis.Names(), ", "))
+	field := flags.String("field", "", "use the analyzer of a field of the index instead")
+	indexDir := flags.String("index", defaultIndexDir(cfg), "with -field, the index whose mapping to use (the config's mapping if there isn't one)")
+	query := flags.Bool("query", false, "with -field, analyze as a query against it rather than as indexed")
+	synonyms := flags.String("synonyms", "", "file of synonyms to expand, before any stemming")
+	synonymsFormat := flags.String("synonyms-format", analysis.SYNONYM_FORMAT_SOLR, "format of the synonyms file: solr or wordnet")
+	file := flags.String("file", "", "file to analyze, instead of the text given or stdin")
+	format := flags.String("format", FORMAT_TABLE, "output format: table or json")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: notes-indexer analyze [flags] [text]")
+		flags.PrintDefaults()
+	}
+	positional := parseFlags(flags, args)
+	if *format != FORMAT_TABLE && *format != FORMAT_JSON {
+		fmt.Fprintf(os.Stderr, "error: invalid format: %s\n", *format)
+		os.Exit(EXIT_USAGE)
+	}
+	if *file != "" && len(positional) > 0 {
+		flags.Usage()
+		os.Exit(EXIT_USAGE)
+	}
+
+	var text string
+	if len(positional) > 0 {
+		text = strings.Join(positional, " ")
+	} else {
+		var bs []byte
+		var err error
+		if *file != "" {
+			bs, err = os.ReadFile(*file)
+		} else {
+			bs, err = io.ReadAll(os.Stdin)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(EXIT_ERROR)
+		}
+		text = string(bs)
+	}
+
+	var a *analysis.Analyzer
+	var err error
+	if *field != "" {
+		*analyzerName, a, err = fieldAnalyzer(cfg, *indexDir, *field, *query)
+	} else {
+		a, err = analysis.Get(*analyzerName)
+	}
+	if err == nil && *synonyms != "" {
+		var m *analysis.SynonymMap
+		if m, err = analysis.LoadSynonyms(*synonyms, *synonymsFormat, true); err != nil {
+			err = fmt.Errorf("failed to load synonyms: %w", err)
+		} else {
+			a = a.WithSynonyms(m)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+	stages, err := a.Stages(text)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+
+	output := newAnalyzeOutput(text, stages)
+	output.Analyzer, output.Field = strings.ToLower(*analyzerName), *field
+	if *format == FORMAT_JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(output)
+	} else {
+		err = printAnalyzeTable(os.Stdout, output)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+}
+
+// The name of the analyzer a field of an index uses, and the analyzer itself
+// along with any synonyms the mapping has for the field.
+func fieldAnalyzer(cfg config.Config, indexDir, field string, query bool) (string, *analysis.Analyzer, error) {
+	mapping, err := cfg.Mapping()
+	if err != nil {
+		return "", nil, err
+	} else if mapping == nil {
+		mapping = index.DefaultMapping()
+	}
+	if index.Exists(indexDir) {
+		if ix, err := index.OpenReadOnly(indexDir); err == nil {
+			mapping = ix.Mapping()
+		}
+	}
+	name := mapping.DefaultAnalyzer
+	if f, ok := mapping.Field(field); ok {
+		name = f.Analyzer
+		if query && f.SearchAnalyzer != "" {
+			name = f.SearchAnalyzer
+		}
+	}
+	a, err := mapping.FieldAnalyzer(field, query)
+	return name, a, err
+}
+
+// Lines up the tokens of each stage with the token the tokenizer read them
+// from: by where in the text they came from if the tokenizer says, otherwise
+// by position.
+func newAnalyzeOutput(text string, stages []analysis.Stage) analyzeOutput {
+	output := analyzeOutput{Stages: []string{}, Tokens: []analyzedToken{}, Terms: []string{}}
+	raw := stages[0].Tokens
+	offsets := len(raw) > 0 && raw[len(raw)-1].End > 0
+	for _, t := range raw {
+		at := analyzedToken{Start: t.Start, End: t.End, Type: tokenizer.TokenTypeNames[t.Type], Stages: []stageTerms{}}
+		if offsets {
+			at.Text = text[t.Start:t.End]
+		}
+		output.Tokens = append(output.Tokens, at)
+	}
+
+	for _, stage := range stages {
+		output.Stages = append(output.Stages, stage.Name)
+		for i := range output.Tokens {
+			output.Tokens[i].Stages = append(output.Tokens[i].Stages, stageTerms{Name: stage.Name, Terms: []string{}})
+		}
+		for _, t := range stage.Tokens {
+			i := 0
+			for j, r := range raw {
+				if (offsets && r.Start <= t.Start) || (!offsets && r.Position <= t.Position) {
+					i = j
+				}
+			}
+			terms := &output.Tokens[i].Stages[len(output.Stages)-1].Terms
+			*terms = append(*terms, t.Value)
+		}
+	}
+	for _, t := range stages[len(stages)-1].Tokens {
+		output.Terms = append(output.Terms, t.Value)
+	}
+	return output
+}
+
+func printAnalyzeTable(w io.Writer, output analyzeOutput) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "text\toffsets\ttype\t%s\n", strings.Join(output.Stages, "\t"))
+	for _, t := range output.Tokens {
+		cells := []string{t.Text, fmt.Sprintf("%d-%d", t.Start, t.End), t.Type}
+		for _, stage := range t.Stages {
+			if len(stage.Terms) == 0 {
+				cells = append(cells, "-")
+			} else {
+				cells = append(cells, strings.Join(stage.Terms, " "))
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s terms: %s\n", output.Analyzer, strings.Join(output.Terms, " "))
+	return err
+}
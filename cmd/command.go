@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"mrshanahan.com/notes-indexer/internal/config"
+	"mrshanahan.com/notes-indexer/pkg/index"
+)
+
+// Exit codes
+const (
+	EXIT_OK    int = 0
+	EXIT_ERROR int = 1 // Something failed
+	EXIT_USAGE int = 2 // The command line was wrong
+)
+
+// A subcommand. Each parses its own flags, taking their defaults from the
+// config, and exits with one of the exit codes if it fails.
+type command struct {
+	name    string
+	summary string
+	run     func(cfg config.Config, args []string)
+}
+
+var commands []command
+
+// Set here rather than where declared, as help refers back to them.
+func init() {
+	commands = []command{
+		{"index", "index the notes in a directory", indexNotes},
+		{"watch", "index the notes in a directory and keep them indexed as they change", watchNotes},
+		{"sync", "index the notes in notes-api", syncNotes},
+		{"search", "search an index", search},
+		{"repl", "search an index interactively", repl},
+		{"serve", "serve an index over HTTP", serve},
+		{"inspect", "show what's inside an index", inspect},
+		{"analyze", "show how an analyzer turns text into terms", analyzeText},
+		{"markdown", "parse or lint markdown", parseMarkdown},
+		{"tokenizer", "split text into tokens", tokenize},
+		{"stemmer", "stem words", stem},
+		{"lemmatizer", "lemmatize words", lemmatize},
+		{"config", "show the config in effect", showConfig},
+		{"help", "show help for a command", help},
+	}
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == strings.ToLower(name) {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+func main() {
+	flags := flag.NewFlagSet("notes-indexer", flag.ContinueOnError)
+	configFile := flags.String("config", "", "config file to use (default $"+config.ENV_CONFIG+", or "+strings.Join(config.FileNames, " or ")+" in the working or user config directory)")
+	flags.Usage = func() { usage(flags.Output(), flags) }
+	if err := flags.Parse(os.Args[1:]); err == flag.ErrHelp {
+		os.Exit(EXIT_OK)
+	} else if err != nil {
+		os.Exit(EXIT_USAGE)
+	}
+	args := flags.Args()
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "error: expected command")
+		usage(os.Stderr, flags)
+		os.Exit(EXIT_USAGE)
+	}
+	c, ok := findCommand(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "error: unknown command: %s\n", args[0])
+		usage(os.Stderr, flags)
+		os.Exit(EXIT_USAGE)
+	}
+	// Which doesn't need the config to be valid
+	if c.name == "help" && len(args) == 1 {
+		flags.SetOutput(os.Stdout)
+		usage(os.Stdout, flags)
+		return
+	}
+
+	file := *configFile
+	if file == "" {
+		file = config.Find()
+	}
+	cfg, err := config.Load(file, os.Environ())
+	if err != nil && c.name != "help" && !asksForHelp(args[1:]) {
+		fmt.Fprintln(os.Stderr, "error: failed to load config:", err)
+		os.Exit(EXIT_ERROR)
+	} else if err != nil {
+		// Help is still shown, with the defaults it would have without one
+		fmt.Fprintln(os.Stderr, "warning: failed to load config:", err)
+		cfg = config.Config{}
+	}
+	c.run(cfg, args[1:])
+}
+
+// Whether a command's arguments include a help flag, which makes it show its
+// usage and nothing else.
+func asksForHelp(args []string) bool {
+	for _, arg := range args {
+		switch arg {
+		case "--":
+			return false
+		case "-h", "--h", "-help", "--help":
+			return true
+		}
+	}
+	return false
+}
+
+func usage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintln(w, "usage: notes-indexer [-config file] <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "flags:")
+	flags.PrintDefaults()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, `Run "notes-indexer help <command>" for a command's flags.`)
+}
+
+// Shows the usage of a command, by running it with -h.
+func help(cfg config.Config, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: notes-indexer help [command]")
+		os.Exit(EXIT_USAGE)
+	}
+	c, ok := findCommand(args[0])
+	if !ok {
+		fmt.Fprintf(os.Stderr, "error: unknown command: %s\n", args[0])
+		os.Exit(EXIT_USAGE)
+	}
+	if c.name == "help" {
+		fmt.Println("usage: notes-indexer help [command]")
+		return
+	}
+	c.run(cfg, []string{"-h"})
+}
+
+// Prints the config loaded, with any overrides from the environment, as JSON.
+func showConfig(cfg config.Config, args []string) {
+	flags := flag.NewFlagSet("config", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: notes-indexer config")
+		fmt.Fprintln(flags.Output(), "Shows the config in effect, from the config file and $"+config.ENV_PREFIX+"* variables.")
+	}
+	if positional := parseFlags(flags, args); len(positional) > 0 {
+		flags.Usage()
+		os.Exit(EXIT_USAGE)
+	}
+	if cfg.Sync.Token != "" {
+		cfg.Sync.Token = "(hidden)"
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cfg); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+}
+
+// The index to use unless given one: the config's, otherwise the one in the
+// working directory.
+func defaultIndexDir(cfg config.Config) string {
+	if cfg.Index != "" {
+		return cfg.Index
+	}
+	return DEFAULT_INDEX_DIR
+}
+
+// The index to use for the notes in root unless given one: the config's,
+// otherwise the one in root.
+func rootIndexDir(cfg config.Config, root string) string {
+	if cfg.Index != "" {
+		return cfg.Index
+	}
+	return filepath.Join(root, DEFAULT_INDEX_DIR)
+}
+
+// A setting from the config, or def if it isn't set.
+func orDefault[T comparable](setting, def T) T {
+	var zero T
+	if setting == zero {
+		return def
+	}
+	return setting
+}
+
+// Opens an index for writing, creating it with the config's mapping if it
+// doesn't exist yet.
+func openIndex(cfg config.Config, dir string) (*index.Index, error) {
+	mapping, err := cfg.Mapping()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return index.Open(dir, mapping)
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+// A flag that can be given more than once.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string { return strings.Join(*f, ",") }
+
+func (f *stringsFlag) Set(s string) error {
+	*f = append(*f, s)
+	return nil
+}
+
+// Parses flags wherever they are among args, rather than stopping at the
+// first argument that isn't one, and returns the arguments that aren't. As
+// usual, anything after "--" isn't a flag.
+func parseFlags(flags *flag.FlagSet, args []string) []string {
+	positional := []string{}
+	for {
+		flags.Parse(args)
+		rest := flags.Args()
+		if parsed := len(args) - len(rest); parsed > 0 && args[parsed-1] == "--" {
+			return append(positional, rest...)
+		}
+		if len(rest) == 0 {
+			return positional
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"mrshanahan.com/notes-indexer/internal/config"
+	"mrshanahan.com/notes-indexer/pkg/index"
+)
+
+// DEFAULT_INDEX_DIR is where a directory's index goes unless told otherwise,
+// relative to the directory.
+const DEFAULT_INDEX_DIR string = ".notes-index"
+
+// Indexes the notes in a directory, only reprocessing those that have changed
+// since the last time.
+func indexNotes(cfg config.Config, args []string) {
+	flags := flag.NewFlagSet("index", flag.ExitOnError)
+	indexDir := flags.String("index", "", "where to keep the index (default the config's, or <dir>/"+DEFAULT_INDEX_DIR+")")
+	ignore := stringsFlag{}
+	flags.Var(&ignore, "ignore", "glob of files to leave out, on top of hidden ones (repeatable)")
+	quiet := flags.Bool("quiet", false, "only print errors and the summary")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: notes-indexer index [flags] [dir]")
+		flags.PrintDefaults()
+	}
+	positional := parseFlags(flags, args)
+
+	root := "."
+	if len(positional) > 1 {
+		flags.Usage()
+		os.Exit(EXIT_USAGE)
+	} else if len(positional) == 1 {
+		root = positional[0]
+	}
+	if *indexDir == "" {
+		*indexDir = rootIndexDir(cfg, root)
+	}
+
+	ix, err := openIndex(cfg, *indexDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+
+	// Progress overwrites itself on a terminal, and is left out otherwise so as
+	// not to flood a log
+	progress := newProgressLine(os.Stderr)
+	opts := index.IndexDirOptions{
+		Ignore: append(append(append(index.Ignore{}, index.DefaultIgnore...), cfg.Ignore...), ignore...),
+		Progress: func(p index.Progress) {
+			if p.Err != nil {
+				progress.clear()
+				fmt.Fprintf(os.Stderr, "error: failed to index %s: %v\n", p.Path, p.Err)
+				return
+			}
+			for _, w := range p.Warnings {
+				progress.clear()
+				fmt.Fprintf(os.Stderr, "warning: %s: %s\n", p.Path, w)
+			}
+			if !*quiet {
+				progress.show(fmt.Sprintf("[%d/%d] %s %s", p.Done, p.Total, p.Status, p.Path))
+			}
+		},
+	}
+	summary, err := index.IndexDir(ix, root, opts)
+	progress.clear()
+	if closeErr := ix.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+
+	fmt.Printf("indexed %d files (%d added, %d updated, %d unchanged, %d deleted, %d failed) in %v\n",
+		summary.Files, summary.Added, summary.Updated, summary.Unchanged, summary.Deleted, summary.Failed,
+		summary.Elapsed.Round(time.Millisecond))
+	fmt.Printf("%d documents, %d terms, %s read\n", summary.Docs, summary.Terms, formatBytes(summary.Bytes))
+	if summary.Failed > 0 {
+		os.Exit(EXIT_ERROR)
+	}
+}
+
+// A line of progress on a terminal, rewritten in place.
+type progressLine struct {
+	f        *os.File
+	terminal bool
+	width    int
+}
+
+func newProgressLine(f *os.File) *progressLine {
+	return &progressLine{f: f, terminal: isTerminal(f)}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+func (p *progressLine) show(line string) {
+	if !p.terminal {
+		return
+	}
+	pad := ""
+	if len(line) < p.width {
+		pad = strings.Repeat(" ", p.width-len(line))
+	}
+	fmt.Fprint(p.f, "\r"+line+pad)
+	p.width = len(line)
+}
+
+func (p *progressLine) clear() {
+	if p.terminal && p.width > 0 {
+		fmt.Fprint(p.f, "\r"+strings.Repeat(" ", p.width)+"\r")
+		p.width = 0
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
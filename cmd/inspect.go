@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"mrshanahan.com/notes-indexer/internal/config"
+	"mrshanahan.com/notes-indexer/pkg/index"
+)
+
+type inspectOutput struct {
+	Dir      string            `json:"dir"`
+	Stats    index.Stats       `json:"stats"`
+	Files    []index.FileStats `json:"files"`
+	TopTerms []index.TermStats `json:"top_terms"`
+}
+
+type inspectTermOutput struct {
+	Term     string              `json:"term"`
+	Terms    []string            `json:"terms,omitempty"` // What it was analyzed into, if it wasn't found as given
+	Postings []index.TermPosting `json:"postings"`
+}
+
+type inspectDocOutput struct {
+	Document index.Document `json:"document"`
+	Stats    index.DocStats `json:"stats"`
+}
+
+// Shows what's inside an index, for working out why it ranks notes as it
+// does: its statistics and biggest terms, the postings of a term, or the
+// stored fields of a document. Reads the index as committed, so it works
+// whether or not anything has it open.
+func inspect(cfg config.Config, args []string) {
+	flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+	indexDir := flags.String("index", defaultIndexDir(cfg), "the index to inspect")
+	top := flags.Int("top", 10, "how many of the terms in the most documents to list")
+	field := flags.String("field", "", "only list terms, or postings, from this field")
+	term := flags.String("term", "", "show the postings of a term, analyzed as a query if it isn't found as given")
+	doc := flags.String("doc", "", "show the stored fields of the document with this ID")
+	format := flags.String("format", FORMAT_TABLE, "output format: table or json")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: notes-indexer inspect [flags]")
+		flags.PrintDefaults()
+	}
+	if positional := parseFlags(flags, args); len(positional) > 0 || (*term != "" && *doc != "") {
+		flags.Usage()
+		os.Exit(EXIT_USAGE)
+	}
+	if *format != FORMAT_TABLE && *format != FORMAT_JSON {
+		fmt.Fprintf(os.Stderr, "error: invalid format: %s\n", *format)
+		os.Exit(EXIT_USAGE)
+	}
+
+	ix, err := index.OpenReadOnly(*indexDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+
+	var output any
+	var print func(io.Writer) error
+	switch {
+	case *term != "":
+		o, err := inspectTerm(ix, *field, *term)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(EXIT_ERROR)
+		}
+		output, print = o, func(w io.Writer) error { return printInspectTerm(w, o) }
+	case *doc != "":
+		d, ok := ix.Get(*doc)
+		stats, _ := ix.DocStats(*doc)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "error: no document %s\n", *doc)
+			os.Exit(EXIT_ERROR)
+		}
+		o := inspectDocOutput{Document: d, Stats: stats}
+		output, print = o, func(w io.Writer) error { return printInspectDoc(w, o) }
+	default:
+		files, err := index.DiskUsage(*indexDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(EXIT_ERROR)
+		}
+		o := inspectOutput{Dir: *indexDir, Stats: ix.Stats(), Files: files, TopTerms: []index.TermStats{}}
+		if *top > 0 {
+			o.TopTerms = ix.TopTerms(*field, *top)
+		}
+		output, print = o, func(w io.Writer) error { return printInspect(w, o) }
+	}
+
+	if *format == FORMAT_JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(output)
+	} else {
+		err = print(os.Stdout)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+}
+
+// Finds the postings of a term as given, or failing that of the terms it's
+// analyzed into by each field a query would search.
+func inspectTerm(ix *index.Index, field, term string) (inspectTermOutput, error) {
+	output := inspectTermOutput{Term: term, Postings: ix.Postings(field, term)}
+	if len(output.Postings) > 0 {
+		return output, nil
+	}
+
+	fields := []string{field}
+	if field == "" {
+		fields = sortedKeys(ix.Stats().Fields)
+	}
+	seen := map[string]bool{}
+	for _, f := range fields {
+		tokens, err := ix.Mapping().AnalyzeQuery(f, term)
+		if err != nil {
+			return output, err
+		}
+		for _, t := range tokens {
+			if !seen[t.Value] {
+				seen[t.Value] = true
+				output.Terms = append(output.Terms, t.Value)
+			}
+			output.Postings = append(output.Postings, ix.Postings(f, t.Value)...)
+		}
+	}
+	return output, nil
+}
+
+func printInspect(w io.Writer, output inspectOutput) error {
+	stats := output.Stats
+	fmt.Fprintf(w, "%s: generation %d\n", output.Dir, stats.Generation)
+	fmt.Fprintf(w, "%d documents (%d deleted), %d unique terms\n\n", stats.Docs, stats.Deleted, stats.Terms)
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "field\tdocs\tterms\tavg length")
+	for _, f := range sortedKeys(stats.Fields) {
+		fs := stats.Fields[f]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\n", f, fs.Docs, fs.Terms, fs.AverageLength)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "segment\tdocs\tdeleted")
+	for _, s := range stats.Segments {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", s.Name, s.Docs, s.Deleted)
+	}
+	fmt.Fprintln(tw)
+
+	var total int64
+	fmt.Fprintln(tw, "files\tcount\tsize")
+	for _, fs := range output.Files {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", fs.Type, fs.Files, formatBytes(fs.Bytes))
+		total += fs.Bytes
+	}
+	fmt.Fprintf(tw, "total\t\t%s\n", formatBytes(total))
+
+	if len(output.TopTerms) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "term\tfield\tdocs\toccurrences")
+		for _, ts := range output.TopTerms {
+			fmt.Fprintf(tw, "%s\t%s\t%d\t%d\n", ts.Term, ts.Field, ts.DocFreq, ts.Freq)
+		}
+	}
+	return tw.Flush()
+}
+
+func printInspectTerm(w io.Writer, output inspectTermOutput) error {
+	if len(output.Terms) > 0 {
+		fmt.Fprintf(w, "%s isn't indexed as given; analyzed as: %s\n", output.Term, strings.Join(output.Terms, " "))
+	}
+	if len(output.Postings) == 0 {
+		_, err := fmt.Fprintln(w, "no postings")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "field\tid\tsegment\tpositions")
+	for _, p := range output.Postings {
+		positions := make([]string, len(p.Positions))
+		for i, pos := range p.Positions {
+			positions[i] = fmt.Sprint(pos)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", p.Field, p.ID, p.Segment, strings.Join(positions, ","))
+	}
+	return tw.Flush()
+}
+
+func printInspectDoc(w io.Writer, output inspectDocOutput) error {
+	d := output.Document
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "id\t%s\n", d.ID)
+	fmt.Fprintf(tw, "type\t%s\n", d.Type)
+	fmt.Fprintf(tw, "title\t%s\n", d.Title)
+	fmt.Fprintf(tw, "tags\t%s\n", strings.Join(d.Tags, ", "))
+	fmt.Fprintf(tw, "links\t%s\n", strings.Join(d.Links, ", "))
+	fmt.Fprintf(tw, "hash\t%s\n", d.Hash)
+	fmt.Fprintf(tw, "size\t%s\n", formatBytes(d.Size))
+	fmt.Fprintf(tw, "modified\t%s\n", d.ModTime.Format("2006-01-02 15:04:05 -0700"))
+	fmt.Fprintf(tw, "segment\t%s\n", output.Stats.Segment)
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	// Source fields hold the text, and every field analyzed from them has a
+	// length, so show both
+	fields := map[string]bool{}
+	for f := range d.Fields {
+		fields[f] = true
+	}
+	for f := range output.Stats.Lengths {
+		fields[f] = true
+	}
+	for _, f := range sortedKeys(fields) {
+		fmt.Fprintf(w, "\n[%s] %d terms\n", f, output.Stats.Lengths[f])
+		if text, ok := d.Fields[f]; ok {
+			fmt.Fprintln(w, strings.TrimRight(text, "\n"))
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"mrshanahan.com/notes-indexer/internal/config"
+	"mrshanahan.com/notes-indexer/pkg/markdown"
+)
+
+// How a markdown document is shown, in JSON.
+type markdownOutput struct {
+	File        string                `json:"file"`
+	Meta        *markdownMeta         `json:"meta,omitempty"`
+	Tokens      []markdownToken       `json:"tokens,omitempty"`
+	Tree        []markdown.MDTreeNode `json:"tree,omitempty"`
+	Diagnostics []markdownDiagnostic  `json:"diagnostics"`
+}
+
+type markdownMeta struct {
+	Format string         `json:"format"`
+	Fields map[string]any `json:"fields"`
+}
+
+type markdownToken struct {
+	Type  string          `json:"type"`
+	Span  markdown.MDSpan `json:"span"`
+	Token string          `json:"token"`
+}
+
+type markdownDiagnostic struct {
+	Type     string          `json:"type"`
+	Severity string          `json:"severity"`
+	Message  string          `json:"message"`
+	Span     markdown.MDSpan `json:"span"`
+}
+
+// Parses markdown files, or stdin if there aren't any, and shows their
+// tokens, syntax tree or HTML.
+func parseMarkdown(cfg config.Config, args []string) {
+	if len(args) > 0 && strings.ToLower(args[0]) == "lint" {
+		lintMarkdown(args[1:])
+		return
+	}
+
+	flags := flag.NewFlagSet("markdown", flag.ExitOnError)
+	tokens := flags.Bool("tokens", false, "show the tokens lexed")
+	tree := flags.Bool("tree", false, "show the syntax tree, indented (the default)")
+	asJSON := flags.Bool("json", false, "show the syntax tree, or with -tokens the tokens, as JSON; an array of them for more than one file")
+	html := flags.Bool("html", false, "show the document rendered as HTML")
+	strict := flags.Bool("strict", false, "exit with an error if there are any diagnostics")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: notes-indexer markdown [flags] [file ...]")
+		fmt.Fprintln(flags.Output(), "       notes-indexer markdown lint [file ...]")
+		flags.PrintDefaults()
+	}
+	files := parseFlags(flags, args)
+	if (*tokens && *tree) || (*html && (*tokens || *tree || *asJSON)) {
+		fmt.Fprintln(os.Stderr, "error: only one of -tokens, -tree and -html can be given, and -json goes with -tokens or -tree")
+		os.Exit(EXIT_USAGE)
+	}
+
+	inputs := files
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+	outputs := []markdownOutput{}
+	failed, diagnosed := false, false
+	for i, f := range inputs {
+		name, text, err := readMarkdown(f)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			failed = true
+			continue
+		}
+
+		toks, meta, metaErr := markdown.LexDocument(text)
+		doc, diagnostics, _ := markdown.ParseDocumentDiagnostics(text)
+		if metaErr != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to parse front matter in %s: %v\n", name, metaErr)
+			failed = true
+		}
+		for _, d := range diagnostics {
+			fmt.Fprintf(os.Stderr, "%s:%v\n", name, d)
+		}
+		diagnosed = diagnosed || len(diagnostics) > 0
+
+		if *asJSON {
+			outputs = append(outputs, newMarkdownOutput(name, meta, toks, doc, diagnostics, *tokens))
+			continue
+		}
+		if len(inputs) > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("==> %s <==\n", name)
+		}
+		switch {
+		case *tokens:
+			for _, t := range toks {
+				fmt.Printf("%v\t%v\n", t.GetSpan(), t)
+			}
+		case *html:
+			fmt.Print(markdown.RenderHTML(doc))
+		default:
+			fmt.Print(markdown.DumpTree(doc))
+		}
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.SetEscapeHTML(false)
+		var err error
+		if len(inputs) == 1 && len(outputs) == 1 {
+			err = enc.Encode(outputs[0])
+		} else {
+			err = enc.Encode(outputs)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(EXIT_ERROR)
+		}
+	}
+	if failed || (*strict && diagnosed) {
+		os.Exit(EXIT_ERROR)
+	}
+}
+
+// Reads a file, or stdin for "-", returning what to call it.
+func readMarkdown(file string) (string, string, error) {
+	if file == "-" {
+		bs, err := io.ReadAll(os.Stdin)
+		return "<stdin>", string(bs), err
+	}
+	bs, err := os.ReadFile(file)
+	if err != nil {
+		return file, "", fmt.Errorf("failed to read file %s: %w", file, err)
+	}
+	return file, string(bs), nil
+}
+
+func newMarkdownOutput(name string, meta *markdown.MDMetadata, tokens []markdown.MDToken, tree markdown.MDSyntaxTree, diagnostics []markdown.MDDiagnostic, showTokens bool) markdownOutput {
+	output := markdownOutput{File: name, Diagnostics: []markdownDiagnostic{}}
+	if meta != nil {
+		output.Meta = &markdownMeta{Format: meta.Format, Fields: meta.Fields}
+	}
+	if showTokens {
+		output.Tokens = []markdownToken{}
+		for _, t := range tokens {
+			output.Tokens = append(output.Tokens, markdownToken{Type: t.GetType().String(), Span: t.GetSpan(), Token: fmt.Sprint(t)})
+		}
+	} else {
+		output.Tree = markdown.TreeNodes(tree)
+	}
+	for _, d := range diagnostics {
+		output.Diagnostics = append(output.Diagnostics, markdownDiagnostic{
+			Type:     d.Type.String(),
+			Severity: d.Severity.String(),
+			Message:  d.Message,
+			Span:     d.Span,
+		})
+	}
+	return output
+}
+
+// Prints the diagnostics for each of files, or for stdin if there aren't any,
+// exiting with an error if any are warnings or worse.
+func lintMarkdown(files []string) {
+	failed := false
+	lint := func(name, text string) {
+		_, diagnostics, err := markdown.ParseDocumentDiagnostics(text)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to parse front matter in %s: %v\n", name, err)
+			failed = true
+		}
+		for _, d := range diagnostics {
+			fmt.Printf("%s:%v\n", name, d)
+			if d.Severity >= markdown.SEVERITY_WARNING {
+				failed = true
+			}
+		}
+	}
+
+	if len(files) == 0 {
+		bs, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(EXIT_ERROR)
+		}
+		lint("<stdin>", string(bs))
+	}
+	for _, f := range files {
+		bs, err := os.ReadFile(f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: failed to read file %s: %v\n", f, err)
+			failed = true
+			continue
+		}
+		lint(f, string(bs))
+	}
+
+	if failed {
+		os.Exit(EXIT_ERROR)
+	}
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"mrshanahan.com/notes-indexer/internal/config"
+	"mrshanahan.com/notes-indexer/pkg/index"
+	"mrshanahan.com/notes-indexer/pkg/server"
+)
+
+// How many entries of history are kept.
+const HISTORY_SIZE int = 1000
+
+const replHelp string = `Type a query to search, or one of:
+  :analyze [field:]<text>  show the terms text is analyzed into for each field
+  :explain <id>            show how the last query scored a document
+  :set [name=value ...]    show or change settings: k1, b, limit, fields
+  :stats                   show statistics of the index
+  :reload                  reopen the index, to see changes since it was opened
+  :history                 list past entries; !<n> runs one again, !! the last
+  :help                    show this
+  :quit                    leave (as does end of input)
+`
+
+// Searches an index interactively, for tuning relevance.
+func repl(cfg config.Config, args []string) {
+	flags := flag.NewFlagSet("repl", flag.ExitOnError)
+	indexDir := flags.String("index", defaultIndexDir(cfg), "the index to search")
+	historyFile := flags.String("history", defaultHistoryFile(), "where to keep history of past entries, or empty for none")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: notes-indexer repl [flags]")
+		flags.PrintDefaults()
+	}
+	if positional := parseFlags(flags, args); len(positional) > 0 {
+		flags.Usage()
+		os.Exit(EXIT_USAGE)
+	}
+
+	ix, err := index.OpenReadOnly(*indexDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+	history, err := loadHistory(*historyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error: failed to load history:", err)
+	}
+
+	r := &replSession{
+		ix: ix,
+		opts: index.SearchOptions{
+			Limit:  orDefault(cfg.Search.Limit, 10),
+			Fields: cfg.Search.Fields,
+			Boosts: cfg.Boosts,
+			BM25:   cfg.BM25(),
+		},
+		history:  history,
+		out:      os.Stdout,
+		terminal: isTerminal(os.Stdin),
+	}
+	if r.terminal {
+		fmt.Fprintf(r.out, "%s: %d documents. Type :help for help.\n", *indexDir, ix.Len())
+	}
+	if err := r.run(os.Stdin); err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+}
+
+type replSession struct {
+	ix        *index.Index
+	opts      index.SearchOptions
+	lastQuery string // Raw text of the last query run, for :explain
+	history   *history
+	out       io.Writer
+	terminal  bool
+}
+
+func (r *replSession) run(in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	for {
+		if r.terminal {
+			fmt.Fprint(r.out, "> ")
+		}
+		if !scanner.Scan() {
+			if r.terminal {
+				fmt.Fprintln(r.out)
+			}
+			return scanner.Err()
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "!") {
+			recalled, err := r.history.recall(line)
+			if err != nil {
+				fmt.Fprintln(r.out, "error:", err)
+				continue
+			}
+			line = recalled
+			fmt.Fprintln(r.out, line)
+		}
+		if err := r.history.add(line); err != nil {
+			fmt.Fprintln(r.out, "error: failed to save history:", err)
+		}
+		if quit := r.eval(line); quit {
+			return nil
+		}
+	}
+}
+
+// Runs one entry, returning whether to quit.
+func (r *replSession) eval(line string) bool {
+	if !strings.HasPrefix(line, ":") {
+		r.search(line)
+		return false
+	}
+
+	command, arg := line, ""
+	if i := strings.IndexAny(line, " \t"); i >= 0 {
+		command, arg = line[:i], strings.TrimSpace(line[i+1:])
+	}
+	var err error
+	switch command {
+	case ":analyze", ":a":
+		err = r.analyze(arg)
+	case ":explain", ":e":
+		err = r.explain(arg)
+	case ":set":
+		err = r.set(arg)
+	case ":stats":
+		r.stats()
+	case ":reload":
+		err = r.reload()
+	case ":history":
+		for i, entry := range r.history.entries {
+			fmt.Fprintf(r.out, "%5d  %s\n", i+1, entry)
+		}
+	case ":help", ":h", ":?":
+		fmt.Fprint(r.out, replHelp)
+	case ":quit", ":q", ":exit":
+		return true
+	default:
+		err = fmt.Errorf("unknown command %s (see :help)", command)
+	}
+	if err != nil {
+		fmt.Fprintln(r.out, "error:", err)
+	}
+	return false
+}
+
+func (r *replSession) search(query string) {
+	q, err := index.ParseQuery(query)
+	if err != nil {
+		fmt.Fprintf(r.out, "error: invalid query: %v\n", err)
+		return
+	}
+	result, err := r.ix.Search(q, r.opts)
+	if err != nil {
+		fmt.Fprintln(r.out, "error:", err)
+		return
+	}
+	r.lastQuery = query
+	printSearchTable(server.NewSearchResponse(r.ix, query, r.opts.Offset, result))
+}
+
+// Shows the terms text is analyzed into for each field searched, as a query
+// would be.
+func (r *replSession) analyze(arg string) error {
+	if arg == "" {
+		return errors.New("usage: :analyze [field:]<text>")
+	}
+	fields := r.searchFields()
+	if i := strings.Index(arg, ":"); i > 0 && !strings.ContainsAny(arg[:i], " \t\"") {
+		fields, arg = []string{arg[:i]}, arg[i+1:]
+	}
+
+	w := tabwriter.NewWriter(r.out, 0, 4, 2, ' ', 0)
+	mapping := r.ix.Mapping()
+	for _, field := range fields {
+		tokens, err := mapping.AnalyzeQuery(field, arg)
+		if err != nil {
+			return err
+		}
+		terms := make([]string, len(tokens))
+		for i, t := range tokens {
+			terms[i] = fmt.Sprintf("%s@%d", t.Value, t.Position)
+			if t.End > t.Start {
+				terms[i] += fmt.Sprintf("[%d:%d]", t.Start, t.End)
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\n", field, strings.Join(terms, " "))
+	}
+	return w.Flush()
+}
+
+// The fields a query without fields of its own searches.
+func (r *replSession) searchFields() []string {
+	if len(r.opts.Fields) > 0 {
+		return r.opts.Fields
+	}
+	fields := make([]string, 0, len(index.DefaultFields))
+	for f := range index.DefaultFields {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// Shows how the last query scored a document, whether or not it was among the
+// hits shown.
+func (r *replSession) explain(id string) error {
+	if id == "" {
+		return errors.New("usage: :explain <id>")
+	}
+	if r.lastQuery == "" {
+		return errors.New("no query to explain yet")
+	}
+	if _, ok := r.ix.Get(id); !ok {
+		return fmt.Errorf("no document %s", id)
+	}
+	q, err := index.ParseQuery(r.lastQuery)
+	if err != nil {
+		return err
+	}
+	opts := r.opts
+	opts.Limit, opts.Offset, opts.Explain = 0, 0, true
+	result, err := r.ix.Search(q, opts)
+	if err != nil {
+		return err
+	}
+	for i, h := range result.Hits {
+		if h.ID == id {
+			fmt.Fprintf(r.out, "%s ranks %d of %d for %s\n", id, i+1, result.Total, r.lastQuery)
+			fmt.Fprint(r.out, h.Explanation.String())
+			return nil
+		}
+	}
+	fmt.Fprintf(r.out, "%s doesn't match %s\n", id, r.lastQuery)
+	return nil
+}
+
+// Changes settings given as name=value, or shows them all.
+func (r *replSession) set(arg string) error {
+	for _, setting := range strings.Fields(arg) {
+		name, value, ok := strings.Cut(setting, "=")
+		if !ok {
+			return fmt.Errorf("expected name=value, got %q", setting)
+		}
+		name = strings.ToLower(name)
+		switch name {
+		case "k1", "b":
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil || f < 0 || (name == "b" && f > 1) {
+				return fmt.Errorf("invalid %s: %s", name, value)
+			}
+			if name == "b" {
+				r.opts.BM25.B = f
+			} else {
+				r.opts.BM25.K1 = f
+			}
+		case "limit":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid limit: %s", value)
+			}
+			r.opts.Limit = n
+		case "fields":
+			r.opts.Fields = nil
+			for _, f := range strings.Split(value, ",") {
+				if f = strings.TrimSpace(f); f != "" {
+					r.opts.Fields = append(r.opts.Fields, f)
+				}
+			}
+		default:
+			return fmt.Errorf("unknown setting %s", name)
+		}
+	}
+
+	fields := "(default)"
+	if len(r.opts.Fields) > 0 {
+		fields = strings.Join(r.opts.Fields, ",")
+	}
+	fmt.Fprintf(r.out, "k1=%g b=%g limit=%d fields=%s\n", r.opts.BM25.K1, r.opts.BM25.B, r.opts.Limit, fields)
+	return nil
+}
+
+func (r *replSession) stats() {
+	stats := r.ix.Stats()
+	fmt.Fprintf(r.out, "%d documents (%d deleted), %d terms, %d segments, generation %d\n",
+		stats.Docs, stats.Deleted, stats.Terms, len(stats.Segments), stats.Generation)
+
+	fields := make([]string, 0, len(stats.Fields))
+	for f := range stats.Fields {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	w := tabwriter.NewWriter(r.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "field\tdocs\tterms\tavg length")
+	for _, f := range fields {
+		fs := stats.Fields[f]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.1f\n", f, fs.Docs, fs.Terms, fs.AverageLength)
+	}
+	w.Flush()
+}
+
+func (r *replSession) reload() error {
+	ix, err := index.OpenReadOnly(r.ix.Dir())
+	if err != nil {
+		return err
+	}
+	r.ix = ix
+	fmt.Fprintf(r.out, "%d documents\n", ix.Len())
+	return nil
+}
+
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".notes_indexer_history")
+}
+
+// Past entries, oldest first, kept in a file one per line so they last
+// between sessions.
+type history struct {
+	file    string
+	entries []string
+}
+
+func loadHistory(file string) (*history, error) {
+	h := &history{file: file}
+	if file == "" {
+		return h, nil
+	}
+	bs, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return h, nil
+	} else if err != nil {
+		return h, err
+	}
+	for _, line := range strings.Split(string(bs), "\n") {
+		if line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	return h, nil
+}
+
+func (h *history) add(entry string) error {
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry {
+		return nil
+	}
+	h.entries = append(h.entries, entry)
+	if h.file == "" {
+		return nil
+	}
+	// Rewritten when it's grown well past its size, and appended to otherwise
+	if len(h.entries) > HISTORY_SIZE+HISTORY_SIZE/10 {
+		h.entries = append([]string{}, h.entries[len(h.entries)-HISTORY_SIZE:]...)
+		return os.WriteFile(h.file, []byte(strings.Join(h.entries, "\n")+"\n"), 0600)
+	}
+	f, err := os.OpenFile(h.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, entry); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Finds the entry "!<n>" or "!!" refers to.
+func (h *history) recall(ref string) (string, error) {
+	if len(h.entries) == 0 {
+		return "", errors.New("no history")
+	}
+	if ref == "!!" {
+		return h.entries[len(h.entries)-1], nil
+	}
+	n, err := strconv.Atoi(ref[1:])
+	if err != nil || n < 1 || n > len(h.entries) {
+		return "", fmt.Errorf("no history entry %s", ref[1:])
+	}
+	return h.entries[n-1], nil
+}
@@ -2,73 +2,30 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"strings"
 
+	"mrshanahan.com/notes-indexer/internal/config"
 	"mrshanahan.com/notes-indexer/internal/util"
+	"mrshanahan.com/notes-indexer/pkg/lemmatizer"
 	"mrshanahan.com/notes-indexer/pkg/stemmer"
 	"mrshanahan.com/notes-indexer/pkg/tokenizer"
 )
 
-func main() {
-	if len(os.Args) < 2 {
-		fmt.Fprintf(os.Stderr, "error: expected command")
-		os.Exit(1)
+// Prints the tokens of the text given, or of stdin, one per line.
+func tokenize(cfg config.Config, args []string) {
+	flags := flag.NewFlagSet("tokenizer", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: notes-indexer tokenizer [text]")
 	}
+	positional := parseFlags(flags, args)
 
-	command := os.Args[1]
-	if strings.ToLower(command) == "stemmer" {
-		stem()
-	} else if strings.ToLower(command) == "tokenizer" {
-		tokenize()
-	} else if strings.ToLower(command) == "markdown" {
-		parseMarkdown()
-	} else {
-		fmt.Fprintf(os.Stderr, "error: invalid command: %s", command)
-		os.Exit(1)
-	}
-}
-
-func parseMarkdown() {
-	// if len(os.Args) > 2 {
-	// 	for _, f := range os.Args[2:] {
-	// 		bs, err := os.ReadFile(f)
-	// 		if err != nil {
-	// 			log.Fatalf("error: failed to read file %s: %v", f, err)
-	// 		}
-	// 		text := string(bs)
-	// 		doc, err := markdown.Parse(text)
-	// 		if err != nil {
-	// 			log.Fatalf("error: failed to parse document in %s: %v", f, err)
-	// 		}
-	// 		log.Printf("%v", doc)
-	// 	}
-	// } else {
-	// 	scanner := bufio.NewScanner(os.Stdin)
-	// 	lines := []string{}
-
-	// 	for scanner.Scan() {
-	// 		lines = append(lines, scanner.Text())
-	// 	}
-	// 	if err := scanner.Err(); err != nil {
-	// 		log.Fatalf("error: failed to read from stdin: %v", err)
-	// 	}
-
-	// 	text := strings.Join(lines, "\n")
-	// 	doc, err := markdown.Parse(text)
-	// 	if err != nil {
-	// 		log.Fatalf("error: failed to parse document: %v", err)
-	// 	}
-	// 	log.Printf("%v", doc)
-	// }
-}
-
-func tokenize() {
 	var text string
-	if len(os.Args) > 2 {
-		text = strings.Join(os.Args[2:], " ")
+	if len(positional) > 0 {
+		text = strings.Join(positional, " ")
 	} else {
 		scanner := bufio.NewScanner(os.Stdin)
 		lines := []string{}
@@ -78,7 +35,7 @@ func tokenize() {
 		}
 		if err := scanner.Err(); err != nil {
 			fmt.Fprintln(os.Stderr, "error:", err)
-			os.Exit(1)
+			os.Exit(EXIT_ERROR)
 		}
 
 		text = strings.Join(lines, "\n")
@@ -93,9 +50,16 @@ func tokenize() {
 	fmt.Println(output)
 }
 
-func stem() {
-	if len(os.Args) > 2 {
-		for _, t := range os.Args[2:] {
+// Prints the stem of each word given, or of each line of stdin.
+func stem(cfg config.Config, args []string) {
+	flags := flag.NewFlagSet("stemmer", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: notes-indexer stemmer [word ...]")
+	}
+	positional := parseFlags(flags, args)
+
+	if len(positional) > 0 {
+		for _, t := range positional {
 			stemmed := stemmer.Stem(t)
 			fmt.Println(stemmed)
 		}
@@ -109,7 +73,35 @@ func stem() {
 		}
 		if err := scanner.Err(); err != nil {
 			fmt.Fprintln(os.Stderr, "error:", err)
-			os.Exit(1)
+			os.Exit(EXIT_ERROR)
+		}
+	}
+}
+
+// Prints the lemma of each word given, or of each line of stdin.
+func lemmatize(cfg config.Config, args []string) {
+	flags := flag.NewFlagSet("lemmatizer", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: notes-indexer lemmatizer [word ...]")
+	}
+	positional := parseFlags(flags, args)
+
+	if len(positional) > 0 {
+		for _, t := range positional {
+			lemma := lemmatizer.Lemmatize(strings.ToLower(t))
+			fmt.Println(lemma)
+		}
+	} else {
+		scanner := bufio.NewScanner(os.Stdin)
+
+		for scanner.Scan() {
+			line := scanner.Text()
+			lemma := lemmatizer.Lemmatize(strings.ToLower(line))
+			fmt.Println(lemma)
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(EXIT_ERROR)
 		}
 	}
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"mrshanahan.com/notes-indexer/internal/config"
+	"mrshanahan.com/notes-indexer/pkg/index"
+	"mrshanahan.com/notes-indexer/pkg/server"
+)
+
+const (
+	FORMAT_TABLE string = "table"
+	FORMAT_JSON  string = "json"
+	FORMAT_JSONL string = "jsonl"
+)
+
+// Searches an index, printing the best hits.
+func search(cfg config.Config, args []string) {
+	flags := flag.NewFlagSet("search", flag.ExitOnError)
+	indexDir := flags.String("index", defaultIndexDir(cfg), "the index to search")
+	limit := flags.Int("limit", orDefault(cfg.Search.Limit, 10), "how many hits to show")
+	offset := flags.Int("offset", 0, "how many of the best hits to skip")
+	fields := flags.String("fields", strings.Join(cfg.Search.Fields, ","), "comma-separated fields to search, for terms without a field of their own (default all)")
+	explain := flags.Bool("explain", false, "show how each score was worked out")
+	format := flags.String("format", FORMAT_TABLE, "output format: table, json or jsonl")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: notes-indexer search [flags] <query>")
+		flags.PrintDefaults()
+	}
+	positional := parseFlags(flags, args)
+	if len(positional) == 0 {
+		flags.Usage()
+		os.Exit(EXIT_USAGE)
+	}
+	if *format != FORMAT_TABLE && *format != FORMAT_JSON && *format != FORMAT_JSONL {
+		fmt.Fprintf(os.Stderr, "error: invalid format: %s\n", *format)
+		os.Exit(EXIT_USAGE)
+	}
+	if *limit < 0 || *offset < 0 {
+		fmt.Fprintln(os.Stderr, "error: -limit and -offset can't be negative")
+		os.Exit(EXIT_USAGE)
+	}
+
+	query := strings.Join(positional, " ")
+	q, err := index.ParseQuery(query)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: invalid query: %v\n", err)
+		os.Exit(EXIT_USAGE)
+	}
+	opts := index.SearchOptions{Limit: *limit, Offset: *offset, Boosts: cfg.Boosts, BM25: cfg.BM25(), Explain: *explain}
+	if *fields != "" {
+		for _, f := range strings.Split(*fields, ",") {
+			opts.Fields = append(opts.Fields, strings.TrimSpace(f))
+		}
+	}
+
+	ix, err := index.OpenReadOnly(*indexDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+	result, err := ix.Search(q, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+
+	output := server.NewSearchResponse(ix, query, *offset, result)
+	switch *format {
+	case FORMAT_JSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(output)
+	case FORMAT_JSONL:
+		enc := json.NewEncoder(os.Stdout)
+		for _, h := range output.Hits {
+			if err = enc.Encode(h); err != nil {
+				break
+			}
+		}
+	default:
+		printSearchTable(output)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+}
+
+// Prints each hit's rank, score, path & title on one line, followed by its
+// snippet and if asked for the explanation of its score. The path has the
+// line & column of the first highlight after it, where that's known, for
+// editors to jump to. Highlights are bold on a terminal.
+func printSearchTable(output server.SearchResponse) {
+	pre, post := "", ""
+	if isTerminal(os.Stdout) {
+		pre, post = "\x1b[1m", "\x1b[0m"
+	}
+	width := len(fmt.Sprint(output.Offset + len(output.Hits)))
+	indent := strings.Repeat(" ", width+2)
+	for _, h := range output.Hits {
+		location := h.Path
+		if len(h.Snippet.Highlights) > 0 && h.Snippet.Highlights[0].Source != nil {
+			location += ":" + h.Snippet.Highlights[0].Source.Start.String()
+		}
+		fmt.Printf("%*d. %.3f  %s  %s\n", width, h.Rank, h.Score, location, h.Title)
+		if h.Snippet.Text != "" {
+			fmt.Printf("%s%s\n", indent, h.Snippet.Marked(pre, post))
+		}
+		if h.Explanation != nil {
+			for _, line := range strings.Split(strings.TrimSuffix(h.Explanation.String(), "\n"), "\n") {
+				fmt.Printf("%s%s\n", indent, line)
+			}
+		}
+	}
+
+	if output.Total == 0 {
+		fmt.Printf("no results (%.1fms)\n", output.TookMS)
+	} else if len(output.Hits) == 0 {
+		fmt.Printf("no results past the first %d of %d (%.1fms)\n", output.Offset, output.Total, output.TookMS)
+	} else {
+		fmt.Printf("%d-%d of %d results (%.1fms)\n", output.Offset+1, output.Offset+len(output.Hits), output.Total, output.TookMS)
+	}
+}
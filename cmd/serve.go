@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"mrshanahan.com/notes-indexer/internal/config"
+	"mrshanahan.com/notes-indexer/pkg/server"
+	"mrshanahan.com/notes-indexer/pkg/watch"
+)
+
+const DEFAULT_ADDR string = "localhost:7070"
+
+// Serves an index over HTTP until interrupted.
+func serve(cfg config.Config, args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	indexDir := flags.String("index", defaultIndexDir(cfg), "the index to serve, which is created if need be")
+	addr := flags.String("addr", orDefault(cfg.Serve.Addr, DEFAULT_ADDR), "address to listen on")
+	timeout := flags.Duration("timeout", orDefault(cfg.Serve.Timeout, server.DEFAULT_REQUEST_TIMEOUT), "how long each request can take")
+	watchRoot := flags.String("watch", "", "a directory of notes to index, and keep indexed as they change while serving")
+	ignore := stringsFlag{}
+	flags.Var(&ignore, "ignore", "with -watch, glob of files to leave out, on top of hidden ones (repeatable)")
+	poll := flags.Bool("poll", false, "with -watch, poll for changes rather than being notified of them")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: notes-indexer serve [flags]")
+		flags.PrintDefaults()
+	}
+	if positional := parseFlags(flags, args); len(positional) > 0 {
+		flags.Usage()
+		os.Exit(EXIT_USAGE)
+	}
+
+	ix, err := openIndex(cfg, *indexDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+	l, err := net.Listen("tcp", *addr)
+	if err != nil {
+		ix.Close()
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	logger.Printf("serving %s on http://%s", *indexDir, l.Addr())
+	srv := server.New(ix, server.Options{
+		RequestTimeout: *timeout,
+		BM25:           cfg.BM25(),
+		Boosts:         cfg.Boosts,
+		Logger:         logger,
+	})
+
+	// The watch writes to the same index being served, as only one process
+	// can have it open for writing
+	watched := make(chan error, 1)
+	if *watchRoot != "" {
+		go func() {
+			err := watchDir(ctx, ix, *watchRoot, append(append([]string{}, cfg.Ignore...), ignore...), watch.Options{Poll: *poll}, logger)
+			if err != nil {
+				logger.Printf("error: %v", err)
+				stop()
+			}
+			watched <- err
+		}()
+	} else {
+		watched <- nil
+	}
+	err = srv.Serve(ctx, l)
+	stop()
+	if watchErr := <-watched; err == nil {
+		err = watchErr
+	}
+	logger.Printf("shutting down")
+	if closeErr := ix.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+}
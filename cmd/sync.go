@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"mrshanahan.com/notes-indexer/internal/config"
+	"mrshanahan.com/notes-indexer/pkg/notesapi"
+)
+
+// Syncs the notes in notes-api into an index.
+func syncNotes(cfg config.Config, args []string) {
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	indexDir := flags.String("index", defaultIndexDir(cfg), "the index to sync into, which is created if need be")
+	url := flags.String("url", cfg.Sync.URL, "base URL of notes-api")
+	token := flags.String("token", orDefault(cfg.Sync.Token, os.Getenv("NOTES_API_TOKEN")), "token to authenticate with (default the config's, or $NOTES_API_TOKEN)")
+	full := flags.Bool("full", false, "sync every note rather than only those changed since the last sync, deleting any no longer listed")
+	prefix := flags.String("prefix", orDefault(cfg.Sync.Prefix, notesapi.DEFAULT_ID_PREFIX), "what to prefix the IDs of notes with in the index")
+	quiet := flags.Bool("quiet", false, "only print errors and the summary")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: notes-indexer sync -url <url> [flags]")
+		flags.PrintDefaults()
+	}
+	if positional := parseFlags(flags, args); len(positional) > 0 || *url == "" {
+		flags.Usage()
+		os.Exit(EXIT_USAGE)
+	}
+
+	ix, err := openIndex(cfg, *indexDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	progress := newProgressLine(os.Stderr)
+	client := &notesapi.Client{BaseURL: *url, Token: *token}
+	summary, err := notesapi.Sync(ctx, client, ix, notesapi.SyncOptions{
+		IDPrefix: *prefix,
+		Full:     *full,
+		Progress: func(n notesapi.Note, status string) {
+			if !*quiet {
+				progress.show(fmt.Sprintf("%s %s", status, n.ID))
+			}
+		},
+	})
+	progress.clear()
+	if closeErr := ix.Close(); err == nil {
+		err = closeErr
+	}
+
+	for _, w := range summary.Warnings {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+	for _, noteErr := range summary.Errors {
+		fmt.Fprintln(os.Stderr, "error:", noteErr)
+	}
+	fmt.Printf("synced %d notes over %d pages (%d added, %d updated, %d unchanged, %d deleted, %d failed) in %v\n",
+		summary.Listed, summary.Pages, summary.Added, summary.Updated, summary.Unchanged, summary.Deleted, summary.Failed,
+		summary.Elapsed.Round(time.Millisecond))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+	if summary.Failed > 0 {
+		os.Exit(EXIT_ERROR)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"mrshanahan.com/notes-indexer/internal/config"
+	"mrshanahan.com/notes-indexer/pkg/index"
+	"mrshanahan.com/notes-indexer/pkg/watch"
+)
+
+// Indexes the notes in a directory, then keeps the index up to date as they
+// change until interrupted.
+func watchNotes(cfg config.Config, args []string) {
+	flags := flag.NewFlagSet("watch", flag.ExitOnError)
+	indexDir := flags.String("index", "", "where to keep the index (default the config's, or <dir>/"+DEFAULT_INDEX_DIR+")")
+	ignore := stringsFlag{}
+	flags.Var(&ignore, "ignore", "glob of files to leave out, on top of hidden ones (repeatable)")
+	poll := flags.Bool("poll", false, "poll for changes rather than being notified of them")
+	debounce := flags.Duration("debounce", watch.DEFAULT_DEBOUNCE, "how long to wait for changes to settle before indexing them")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: notes-indexer watch [flags] [dir]")
+		flags.PrintDefaults()
+	}
+	positional := parseFlags(flags, args)
+
+	root := "."
+	if len(positional) > 1 {
+		flags.Usage()
+		os.Exit(EXIT_USAGE)
+	} else if len(positional) == 1 {
+		root = positional[0]
+	}
+	if *indexDir == "" {
+		*indexDir = rootIndexDir(cfg, root)
+	}
+	ix, err := openIndex(cfg, *indexDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = watchDir(ctx, ix, root, append(append([]string{}, cfg.Ignore...), ignore...), watch.Options{Poll: *poll, Debounce: *debounce}, logger)
+	if closeErr := ix.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(EXIT_ERROR)
+	}
+}
+
+// Indexes the notes under root, then keeps them indexed as they change until
+// ctx is done. Each batch of changes is committed as it's indexed, so
+// anything searching ix sees them straight away.
+func watchDir(ctx context.Context, ix *index.Index, root string, ignore []string, opts watch.Options, logger *log.Logger) error {
+	indexOpts := index.IndexDirOptions{
+		Ignore: append(append(index.Ignore{}, index.DefaultIgnore...), ignore...),
+		Progress: func(p index.Progress) {
+			if p.Err != nil {
+				logger.Printf("error: failed to index %s: %v", p.Path, p.Err)
+			}
+			for _, w := range p.Warnings {
+				logger.Printf("warning: %s: %s", p.Path, w)
+			}
+		},
+	}
+	summary, err := index.IndexDir(ix, root, indexOpts)
+	if err != nil {
+		return err
+	}
+	logger.Printf("indexed %d files (%d added, %d updated, %d unchanged, %d deleted, %d failed) in %v",
+		summary.Files, summary.Added, summary.Updated, summary.Unchanged, summary.Deleted, summary.Failed,
+		summary.Elapsed.Round(time.Millisecond))
+
+	// The index's own files change with every commit, so it's left out if
+	// it's in the directory
+	indexRel := ""
+	if rel, err := filepath.Rel(root, ix.Dir()); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		indexRel = filepath.ToSlash(rel)
+	}
+	opts.Skip = func(rel string, dir bool) bool {
+		return rel == indexRel || indexOpts.Ignore.Match(rel, dir)
+	}
+
+	logger.Printf("watching %s for changes", root)
+	return watch.Watch(ctx, root, opts, func(paths []string) {
+		summary, err := index.UpdatePaths(ix, root, paths, indexOpts)
+		if err != nil {
+			// Left for the next change to pick up, rather than stopping
+			logger.Printf("error: failed to update index: %v", err)
+			return
+		}
+		if summary.Added+summary.Updated+summary.Deleted > 0 {
+			logger.Printf("updated index (%d added, %d updated, %d deleted) in %v",
+				summary.Added, summary.Updated, summary.Deleted, summary.Elapsed.Round(time.Millisecond))
+		}
+	})
+}
@@ -0,0 +1,505 @@
+// Package config reads the config file of notes-indexer, which sets defaults
+// for its commands, along with any overrides of it from the environment.
+//
+// The file is TOML or YAML, e.g.
+//
+//	index = "~/notes/.notes-index"
+//	ignore = ["drafts/"]
+//	default_analyzer = "english"
+//
+//	[analyzers]
+//	code = "simple"
+//
+//	[boosts]
+//	title = 3
+//
+//	[synonyms]
+//	file = "synonyms.txt"
+//	format = "solr"
+//	at = "both"
+//	fields = ["title", "body"]
+//
+//	[search]
+//	limit = 20
+//	fields = ["title", "body"]
+//	k1 = 1.5
+//	b = 0.75
+//
+//	[serve]
+//	addr = "localhost:8080"
+//	timeout = "30s"
+//
+//	[sync]
+//	url = "https://notes.example.com/api"
+//	token = "..."
+//	prefix = "notes-api/"
+//
+// The analyzers and synonyms only apply to an index as it's created, as an
+// index keeps the mapping it was created with.
+//
+// Every key can be overridden by an environment variable named after it,
+// prefixed with NOTES_INDEXER_ and with dots as underscores: e.g.
+// NOTES_INDEXER_SEARCH_LIMIT=5, or NOTES_INDEXER_BOOSTS_TITLE=3. Lists are
+// comma-separated.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"mrshanahan.com/notes-indexer/internal/toml"
+	"mrshanahan.com/notes-indexer/pkg/analysis"
+	"mrshanahan.com/notes-indexer/pkg/index"
+)
+
+const (
+	ENV_PREFIX string = "NOTES_INDEXER_"
+
+	// Names the config file to use, instead of looking for one
+	ENV_CONFIG string = "NOTES_INDEXER_CONFIG"
+)
+
+// FileNames are what a config file is looked for as, in order, first in the
+// working directory and then in the user's config directory.
+var FileNames []string = []string{"notes-indexer.toml", "notes-indexer.yaml", "notes-indexer.yml"}
+
+// Config holds defaults for the commands. Anything left as the zero value
+// means the command's own default.
+type Config struct {
+	File string `json:"file,omitempty"` // What it was loaded from, if anything
+
+	Index  string   `json:"index,omitempty"` // Relative to the config file
+	Ignore []string `json:"ignore,omitempty"`
+
+	// How the fields of a new index are analyzed, on top of
+	// index.DefaultMapping
+	DefaultAnalyzer string            `json:"default_analyzer,omitempty"`
+	Analyzers       map[string]string `json:"analyzers,omitempty"`
+
+	// Sibling fields to index along with each source field, by kind (see
+	// analysis.SiblingField), e.g. "prefix" to search "body.prefix" as you
+	// type
+	Siblings map[string][]string `json:"siblings,omitempty"`
+
+	Boosts map[string]float64 `json:"boosts,omitempty"`
+
+	Synonyms Synonyms `json:"synonyms"`
+	Search   Search   `json:"search"`
+	Serve    Serve    `json:"serve"`
+	Sync     Sync     `json:"sync"`
+}
+
+// Synonyms are expanded in the fields given, or every field analyzed with
+// the default analyzer if none are, when At says.
+type Synonyms struct {
+	File   string   `json:"file,omitempty"`   // Relative to the config file
+	Format string   `json:"format,omitempty"` // analysis.SYNONYM_FORMAT_*, default Solr
+	At     string   `json:"at,omitempty"`     // analysis.SYNONYMS_*, default query
+	Fields []string `json:"fields,omitempty"`
+}
+
+type Search struct {
+	Limit  int      `json:"limit,omitempty"`
+	Fields []string `json:"fields,omitempty"`
+	K1     float64  `json:"k1,omitempty"`
+	B      float64  `json:"b,omitempty"`
+}
+
+type Serve struct {
+	Addr    string        `json:"addr,omitempty"`
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+type Sync struct {
+	URL    string `json:"url,omitempty"`
+	Token  string `json:"token,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// Find looks for a config file: the one named by $NOTES_INDEXER_CONFIG,
+// otherwise the first of FileNames in the working directory or the user's
+// config directory. It returns "" if there isn't one.
+func Find() string {
+	if file := os.Getenv(ENV_CONFIG); file != "" {
+		return file
+	}
+	dirs := []string{"."}
+	if dir, err := os.UserConfigDir(); err == nil {
+		dirs = append(dirs, filepath.Join(dir, "notes-indexer"))
+	}
+	for _, dir := range dirs {
+		for _, name := range FileNames {
+			file := filepath.Join(dir, name)
+			if info, err := os.Stat(file); err == nil && info.Mode().IsRegular() {
+				return file
+			}
+		}
+	}
+	return ""
+}
+
+// Load reads a config file, or just the environment if file is "", and then
+// applies the overrides in environ (as from os.Environ) to it.
+func Load(file string, environ []string) (Config, error) {
+	c := Config{File: file}
+	if file != "" {
+		bs, err := os.ReadFile(file)
+		if err != nil {
+			return c, err
+		}
+		values, err := parse(string(bs), filepath.Ext(file))
+		if err != nil {
+			return c, fmt.Errorf("%s: %w", file, err)
+		}
+		for _, key := range sortedKeys(values) {
+			if err := c.set(key, values[key]); err != nil {
+				return c, fmt.Errorf("%s: %w", file, err)
+			}
+		}
+		if c.Index != "" {
+			c.Index = resolvePath(filepath.Dir(file), c.Index)
+		}
+		if c.Synonyms.File != "" {
+			c.Synonyms.File = resolvePath(filepath.Dir(file), c.Synonyms.File)
+		}
+	}
+
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, ENV_PREFIX) || name == ENV_CONFIG {
+			continue
+		}
+		key := envKey(strings.TrimPrefix(name, ENV_PREFIX))
+		if err := c.set(key, value); err != nil {
+			return c, fmt.Errorf("$%s: %w", name, err)
+		}
+		if key == "index" {
+			c.Index = resolvePath(".", c.Index)
+		} else if key == "synonyms.file" {
+			c.Synonyms.File = resolvePath(".", c.Synonyms.File)
+		}
+	}
+	return c, nil
+}
+
+// Decodes a file into keys with dots between the names of the tables they're
+// in, e.g. "search.limit".
+func parse(text, ext string) (map[string]any, error) {
+	var doc map[string]any
+	switch strings.ToLower(ext) {
+	case ".toml":
+		var err error
+		if doc, err = toml.Parse(text); err != nil {
+			return nil, err
+		}
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal([]byte(text), &doc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown config format %q, expected .toml, .yaml or .yml", ext)
+	}
+	values := map[string]any{}
+	flatten(values, "", doc)
+	return values, nil
+}
+
+func flatten(values map[string]any, prefix string, doc map[string]any) {
+	for k, v := range doc {
+		if m, ok := v.(map[string]any); ok {
+			flatten(values, prefix+k+".", m)
+		} else {
+			values[prefix+k] = v
+		}
+	}
+}
+
+// Turns the name of an environment variable, less the prefix, into a key.
+// Fields of the maps can have underscores, e.g. BOOSTS_BODY_PHONETIC.
+func envKey(name string) string {
+	key := strings.ToLower(name)
+	for _, section := range []string{"analyzers_", "boosts_", "siblings_"} {
+		if strings.HasPrefix(key, section) {
+			return strings.TrimSuffix(section, "_") + "." + strings.TrimPrefix(key, section)
+		}
+	}
+	if key == "default_analyzer" {
+		return key
+	}
+	if section, rest, ok := strings.Cut(key, "_"); ok && (section == "synonyms" || section == "search" || section == "serve" || section == "sync") {
+		return section + "." + rest
+	}
+	return key
+}
+
+func (c *Config) set(key string, value any) error {
+	var err error
+	switch key {
+	case "index":
+		c.Index, err = toString(value)
+	case "ignore":
+		c.Ignore, err = toStrings(value)
+	case "default_analyzer":
+		c.DefaultAnalyzer, err = toString(value)
+	case "synonyms.file":
+		c.Synonyms.File, err = toString(value)
+	case "synonyms.format":
+		c.Synonyms.Format, err = toString(value)
+	case "synonyms.at":
+		if c.Synonyms.At, err = toString(value); err == nil {
+			switch c.Synonyms.At {
+			case analysis.SYNONYMS_INDEX, analysis.SYNONYMS_QUERY, analysis.SYNONYMS_BOTH:
+			default:
+				err = fmt.Errorf("expected %s, %s or %s, got %s", analysis.SYNONYMS_INDEX, analysis.SYNONYMS_QUERY, analysis.SYNONYMS_BOTH, c.Synonyms.At)
+			}
+		}
+	case "synonyms.fields":
+		c.Synonyms.Fields, err = toStrings(value)
+	case "search.limit":
+		c.Search.Limit, err = toInt(value)
+	case "search.fields":
+		c.Search.Fields, err = toStrings(value)
+	case "search.k1":
+		c.Search.K1, err = toFloat(value)
+	case "search.b":
+		c.Search.B, err = toFloat(value)
+	case "serve.addr":
+		c.Serve.Addr, err = toString(value)
+	case "serve.timeout":
+		c.Serve.Timeout, err = toDuration(value)
+	case "sync.url":
+		c.Sync.URL, err = toString(value)
+	case "sync.token":
+		c.Sync.Token, err = toString(value)
+	case "sync.prefix":
+		c.Sync.Prefix, err = toString(value)
+	default:
+		switch {
+		case strings.HasPrefix(key, "analyzers."):
+			var name string
+			if name, err = toString(value); err == nil {
+				if c.Analyzers == nil {
+					c.Analyzers = map[string]string{}
+				}
+				c.Analyzers[strings.TrimPrefix(key, "analyzers.")] = name
+			}
+		case strings.HasPrefix(key, "siblings."):
+			var kinds []string
+			if kinds, err = toStrings(value); err == nil {
+				source := strings.TrimPrefix(key, "siblings.")
+				for _, kind := range kinds {
+					if _, err = analysis.SiblingField(source, kind); err != nil {
+						break
+					}
+				}
+				if c.Siblings == nil {
+					c.Siblings = map[string][]string{}
+				}
+				c.Siblings[source] = kinds
+			}
+		case strings.HasPrefix(key, "boosts."):
+			var boost float64
+			if boost, err = toFloat(value); err == nil {
+				if c.Boosts == nil {
+					c.Boosts = map[string]float64{}
+				}
+				c.Boosts[strings.TrimPrefix(key, "boosts.")] = boost
+			}
+		default:
+			return fmt.Errorf("unknown key %s", key)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", key, err)
+	}
+	return nil
+}
+
+// Mapping is how to analyze the fields of a new index, or nil for
+// index.DefaultMapping. It reads the synonyms file, if there is one.
+func (c Config) Mapping() (*analysis.Mapping, error) {
+	if c.DefaultAnalyzer == "" && len(c.Analyzers) == 0 && len(c.Siblings) == 0 && c.Synonyms.File == "" {
+		return nil, nil
+	}
+	m := index.DefaultMapping()
+	if c.DefaultAnalyzer != "" {
+		m.DefaultAnalyzer = c.DefaultAnalyzer
+	}
+	for _, name := range append([]string{m.DefaultAnalyzer}, mapValues(c.Analyzers)...) {
+		if _, err := analysis.Get(name); err != nil {
+			return nil, err
+		}
+	}
+	for _, field := range sortedKeys(c.Analyzers) {
+		replaced := false
+		for i, f := range m.Fields {
+			if f.Name == field {
+				m.Fields[i].Analyzer, m.Fields[i].SearchAnalyzer = c.Analyzers[field], ""
+				replaced = true
+			}
+		}
+		if !replaced {
+			m.Fields = append(m.Fields, analysis.Field{Name: field, Analyzer: c.Analyzers[field]})
+		}
+	}
+	for _, source := range sortedKeys(c.Siblings) {
+		for _, kind := range c.Siblings[source] {
+			f, err := analysis.SiblingField(source, kind)
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := m.Field(f.Name); !ok {
+				m.Fields = append(m.Fields, f)
+			}
+		}
+	}
+
+	if c.Synonyms.File != "" {
+		synonyms, err := analysis.LoadSynonyms(c.Synonyms.File, c.Synonyms.Format, true)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load synonyms: %w", err)
+		}
+		m.Synonyms = synonyms.Rules()
+		at := c.Synonyms.At
+		if at == "" {
+			at = analysis.SYNONYMS_QUERY
+		}
+		if len(c.Synonyms.Fields) == 0 {
+			m.DefaultSynonyms = at
+		}
+		for _, field := range c.Synonyms.Fields {
+			if f, ok := m.Field(field); ok {
+				for i := range m.Fields {
+					if m.Fields[i].Name == f.Name {
+						m.Fields[i].Synonyms = at
+					}
+				}
+			} else {
+				m.Fields = append(m.Fields, analysis.Field{Name: field, Analyzer: m.DefaultAnalyzer, Synonyms: at})
+			}
+		}
+	}
+	return m, nil
+}
+
+// BM25 is how to score searches, defaulting whatever isn't set.
+func (c Config) BM25() index.BM25 {
+	bm25 := index.DefaultBM25
+	if c.Search.K1 != 0 {
+		bm25.K1 = c.Search.K1
+	}
+	if c.Search.B != 0 {
+		bm25.B = c.Search.B
+	}
+	return bm25
+}
+
+// Makes a path relative to dir, expanding a leading "~/" to the home
+// directory.
+func resolvePath(dir, path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+func toString(v any) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("expected a string, got %v", v)
+	}
+	return s, nil
+}
+
+// Takes a list of strings, or a comma-separated string.
+func toStrings(v any) ([]string, error) {
+	switch v := v.(type) {
+	case string:
+		ss := []string{}
+		for _, s := range strings.Split(v, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				ss = append(ss, s)
+			}
+		}
+		return ss, nil
+	case []any:
+		ss := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("expected a list of strings, got %v", item)
+			}
+			ss[i] = s
+		}
+		return ss, nil
+	}
+	return nil, fmt.Errorf("expected a list of strings, got %v", v)
+}
+
+func toInt(v any) (int, error) {
+	switch v := v.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case string:
+		return strconv.Atoi(v)
+	}
+	return 0, fmt.Errorf("expected an integer, got %v", v)
+}
+
+func toFloat(v any) (float64, error) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		return strconv.ParseFloat(v, 64)
+	}
+	return 0, fmt.Errorf("expected a number, got %v", v)
+}
+
+// Takes a duration like "30s", or a number of seconds.
+func toDuration(v any) (time.Duration, error) {
+	if s, ok := v.(string); ok {
+		if d, err := time.ParseDuration(s); err == nil {
+			return d, nil
+		}
+	}
+	seconds, err := toFloat(v)
+	if err != nil {
+		return 0, fmt.Errorf("expected a duration, got %v", v)
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func mapValues(m map[string]string) []string {
+	values := []string{}
+	for _, k := range sortedKeys(m) {
+		values = append(values, m[k])
+	}
+	return values
+}
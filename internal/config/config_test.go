@@ -0,0 +1,208 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mrshanahan.com/notes-indexer/pkg/analysis"
+	"mrshanahan.com/notes-indexer/pkg/index"
+)
+
+func writeConfig(t *testing.T, name, text string) string {
+	file := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(file, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadTOML(t *testing.T) {
+	file := writeConfig(t, "notes-indexer.toml", `
+index = "notes/.notes-index"
+ignore = ["drafts/", "*.tmp"]
+default_analyzer = "simple"
+
+[analyzers]
+title = "english"
+
+[boosts]
+title = 3
+body = 0.5
+
+[search]
+limit = 20
+fields = ["title", "body"]
+k1 = 1.5
+
+[serve]
+addr = "localhost:8080"
+timeout = "45s"
+
+[sync]
+url = "http://localhost:8000"
+`)
+	c, err := Load(file, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Config{
+		File:            file,
+		Index:           filepath.Join(filepath.Dir(file), "notes/.notes-index"),
+		Ignore:          []string{"drafts/", "*.tmp"},
+		DefaultAnalyzer: "simple",
+		Analyzers:       map[string]string{"title": "english"},
+		Boosts:          map[string]float64{"title": 3, "body": 0.5},
+		Search:          Search{Limit: 20, Fields: []string{"title", "body"}, K1: 1.5},
+		Serve:           Serve{Addr: "localhost:8080", Timeout: 45 * time.Second},
+		Sync:            Sync{URL: "http://localhost:8000"},
+	}, c)
+}
+
+func TestLoadYAML(t *testing.T) {
+	file := writeConfig(t, "notes-indexer.yaml", `
+index: /var/notes-index
+boosts:
+  title: 2
+search:
+  limit: 5
+serve:
+  timeout: 10
+`)
+	c, err := Load(file, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "/var/notes-index", c.Index)
+	assert.Equal(t, map[string]float64{"title": 2}, c.Boosts)
+	assert.Equal(t, 5, c.Search.Limit)
+	assert.Equal(t, 10*time.Second, c.Serve.Timeout)
+}
+
+func TestLoadEnvironment(t *testing.T) {
+	file := writeConfig(t, "notes-indexer.toml", `
+[search]
+limit = 20
+b = 0.5
+`)
+	c, err := Load(file, []string{
+		"HOME=/home/someone",
+		"NOTES_INDEXER_SEARCH_LIMIT=5",
+		"NOTES_INDEXER_SEARCH_FIELDS=title, tags",
+		"NOTES_INDEXER_BOOSTS_BODY_PHONETIC=0.2",
+		"NOTES_INDEXER_ANALYZERS_TITLE=simple",
+		"NOTES_INDEXER_DEFAULT_ANALYZER=english",
+		"NOTES_INDEXER_SYNC_TOKEN=secret",
+		"NOTES_INDEXER_CONFIG=" + file,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, Search{Limit: 5, Fields: []string{"title", "tags"}, B: 0.5}, c.Search)
+	assert.Equal(t, map[string]float64{"body_phonetic": 0.2}, c.Boosts)
+	assert.Equal(t, map[string]string{"title": "simple"}, c.Analyzers)
+	assert.Equal(t, "english", c.DefaultAnalyzer)
+	assert.Equal(t, "secret", c.Sync.Token)
+
+	// Without a file
+	c, err = Load("", []string{"NOTES_INDEXER_INDEX=/tmp/index"})
+	assert.NoError(t, err)
+	assert.Equal(t, Config{Index: "/tmp/index"}, c)
+}
+
+func TestLoadErrors(t *testing.T) {
+	_, err := Load(writeConfig(t, "notes-indexer.toml", `indx = "x"`), nil)
+	assert.ErrorContains(t, err, "unknown key indx")
+
+	_, err = Load(writeConfig(t, "notes-indexer.toml", "[search]\nlimit = \"many\""), nil)
+	assert.ErrorContains(t, err, "invalid search.limit")
+
+	_, err = Load(writeConfig(t, "notes-indexer.json", `{}`), nil)
+	assert.ErrorContains(t, err, "unknown config format")
+
+	_, err = Load("", []string{"NOTES_INDEXER_SERVE_TIMEOUT=soon"})
+	assert.ErrorContains(t, err, "$NOTES_INDEXER_SERVE_TIMEOUT")
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.toml"), nil)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestMapping(t *testing.T) {
+	m, err := Config{}.Mapping()
+	assert.NoError(t, err)
+	assert.Nil(t, m)
+
+	m, err = Config{DefaultAnalyzer: "simple", Analyzers: map[string]string{index.FIELD_TITLE: "simple", "summary": "english"}}.Mapping()
+	assert.NoError(t, err)
+	assert.Equal(t, "simple", m.DefaultAnalyzer)
+	title, _ := m.Field(index.FIELD_TITLE)
+	assert.Equal(t, "simple", title.Analyzer)
+	summary, _ := m.Field("summary")
+	assert.Equal(t, analysis.Field{Name: "summary", Analyzer: "english"}, summary)
+
+	_, err = Config{Analyzers: map[string]string{"title": "klingon"}}.Mapping()
+	assert.Error(t, err)
+}
+
+func TestMappingSiblings(t *testing.T) {
+	file := writeConfig(t, "notes-indexer.toml", `
+[siblings]
+body = ["prefix", "infix"]
+`)
+	c, err := Load(file, []string{"NOTES_INDEXER_SIBLINGS_TITLE=prefix,phonetic"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"body": {"prefix", "infix"}, "title": {"prefix", "phonetic"}}, c.Siblings)
+
+	m, err := c.Mapping()
+	assert.NoError(t, err)
+	bodyFields := []string{}
+	for _, f := range m.FieldsFor("body") {
+		bodyFields = append(bodyFields, f.Name)
+	}
+	assert.Equal(t, []string{"body", "body.prefix", "body.infix"}, bodyFields)
+	prefix, _ := m.Field("title.prefix")
+	assert.Equal(t, analysis.PrefixField("title"), prefix)
+	phonetic, _ := m.Field("title.phonetic")
+	assert.Equal(t, analysis.PhoneticField("title"), phonetic)
+
+	_, err = Load("", []string{"NOTES_INDEXER_SIBLINGS_BODY=suffix"})
+	assert.ErrorContains(t, err, "invalid siblings.body: unknown sibling field suffix")
+}
+
+func TestMappingSynonyms(t *testing.T) {
+	file := writeConfig(t, "notes-indexer.toml", `
+[synonyms]
+file = "synonyms.txt"
+at = "both"
+fields = ["title", "tags"]
+`)
+	assert.Nil(t, os.WriteFile(filepath.Join(filepath.Dir(file), "synonyms.txt"), []byte("k8s, kubernetes\n"), 0644))
+	c, err := Load(file, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(filepath.Dir(file), "synonyms.txt"), c.Synonyms.File)
+
+	m, err := c.Mapping()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"k8s => k8s, kubernetes", "kubernetes => k8s, kubernetes"}, m.Synonyms)
+	assert.Equal(t, "", m.DefaultSynonyms)
+	title, _ := m.Field(index.FIELD_TITLE)
+	assert.Equal(t, analysis.Field{Name: index.FIELD_TITLE, Analyzer: "english", Synonyms: analysis.SYNONYMS_BOTH}, title)
+	tags, _ := m.Field(index.FIELD_TAGS)
+	assert.Equal(t, analysis.SYNONYMS_BOTH, tags.Synonyms)
+	analyzed, err := m.AnalyzeQuery(index.FIELD_TAGS, "kubernetes")
+	assert.NoError(t, err)
+	assert.Len(t, analyzed, 2)
+
+	// Every field with the default analyzer, at query time, by default
+	c, err = Load("", []string{"NOTES_INDEXER_SYNONYMS_FILE=" + c.Synonyms.File})
+	assert.NoError(t, err)
+	m, err = c.Mapping()
+	assert.NoError(t, err)
+	assert.Equal(t, analysis.SYNONYMS_QUERY, m.DefaultSynonyms)
+
+	_, err = Load("", []string{"NOTES_INDEXER_SYNONYMS_AT=sometimes"})
+	assert.ErrorContains(t, err, "invalid synonyms.at")
+	_, err = Config{Synonyms: Synonyms{File: filepath.Join(t.TempDir(), "missing.txt")}}.Mapping()
+	assert.ErrorContains(t, err, "failed to load synonyms")
+}
+
+func TestBM25(t *testing.T) {
+	assert.Equal(t, index.DefaultBM25, Config{}.BM25())
+	assert.Equal(t, index.BM25{K1: 2, B: index.DefaultBM25.B}, Config{Search: Search{K1: 2}}.BM25())
+}
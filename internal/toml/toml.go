@@ -0,0 +1,535 @@
+package toml
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Parse decodes a TOML 1.0 document into nested maps. It covers what front
+// matter and config files use in practice: tables & arrays of tables, dotted
+// and quoted keys, all four kinds of string, integers, floats, booleans,
+// date-times, arrays and inline tables.
+//
+// Values come out as string, int64, float64, bool, time.Time, []any or
+// map[string]any. Local dates, date-times and times are in UTC, and a local
+// time is on the zero date.
+//
+// It's more lenient than the spec in a few ways, none of which change what a
+// valid document decodes to: control characters are allowed in strings,
+// underscores in numbers needn't be between digits, the seconds of a time can
+// be left out, and a static array can be appended to with [[array]].
+func Parse(text string) (map[string]any, error) {
+	p := &parser{src: text, line: 1, defined: map[uintptr]bool{}, inline: map[uintptr]bool{}}
+	root := map[string]any{}
+	current := root
+	for {
+		p.skipBlank()
+		if p.eof() {
+			return root, nil
+		}
+
+		var err error
+		if p.peek() == '[' {
+			current, err = p.parseTableHeader(root)
+		} else {
+			err = p.parseKeyValue(current)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := p.endOfLine(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+type parser struct {
+	src  string
+	pos  int
+	line int
+
+	// Tables can only be defined once: by a header, or by dotted keys. And
+	// inline tables can't be added to at all.
+	defined map[uintptr]bool
+	inline  map[uintptr]bool
+}
+
+func tableID(t map[string]any) uintptr { return reflect.ValueOf(t).Pointer() }
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("line %d: %s", p.line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) eof() bool { return p.pos >= len(p.src) }
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) next() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.pos++
+	}
+}
+
+func (p *parser) skipComment() {
+	if p.peek() == '#' {
+		for !p.eof() && p.peek() != '\n' {
+			p.pos++
+		}
+	}
+}
+
+// Skips whitespace, comments and newlines.
+func (p *parser) skipBlank() {
+	for !p.eof() {
+		p.skipSpace()
+		p.skipComment()
+		if p.peek() == '\n' || p.peek() == '\r' {
+			p.next()
+			continue
+		}
+		return
+	}
+}
+
+func (p *parser) endOfLine() error {
+	p.skipSpace()
+	p.skipComment()
+	if p.eof() {
+		return nil
+	}
+	if strings.HasPrefix(p.src[p.pos:], "\r\n") {
+		p.pos++
+	}
+	if p.peek() != '\n' {
+		return p.errorf("expected end of line, found %q", p.peek())
+	}
+	p.next()
+	return nil
+}
+
+func (p *parser) parseTableHeader(root map[string]any) (map[string]any, error) {
+	p.pos++
+	array := p.peek() == '['
+	if array {
+		p.pos++
+	}
+	p.skipSpace()
+	path, err := p.parseKey()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	closing := "]"
+	if array {
+		closing = "]]"
+	}
+	if !strings.HasPrefix(p.src[p.pos:], closing) {
+		return nil, p.errorf("unterminated table header")
+	}
+	p.pos += len(closing)
+
+	parent, err := p.table(root, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+	if !array {
+		t, err := p.table(parent, []string{last})
+		if err != nil {
+			return nil, err
+		}
+		if p.defined[tableID(t)] {
+			return nil, p.errorf("table %s is defined more than once", strings.Join(path, "."))
+		}
+		p.defined[tableID(t)] = true
+		return t, nil
+	}
+	t := map[string]any{}
+	p.defined[tableID(t)] = true
+	switch existing := parent[last].(type) {
+	case nil:
+		parent[last] = []any{t}
+	case []any:
+		parent[last] = append(existing, t)
+	default:
+		return nil, p.errorf("%s is not an array of tables", strings.Join(path, "."))
+	}
+	return t, nil
+}
+
+// Returns the table at path under t, creating any tables along the way. A
+// path through an array of tables goes to its last table.
+func (p *parser) table(t map[string]any, path []string) (map[string]any, error) {
+	for _, k := range path {
+		switch v := t[k].(type) {
+		case nil:
+			next := map[string]any{}
+			t[k] = next
+			t = next
+		case map[string]any:
+			if p.inline[tableID(v)] {
+				return nil, p.errorf("%s is an inline table", k)
+			}
+			t = v
+		case []any:
+			last, ok := v[len(v)-1].(map[string]any)
+			if !ok {
+				return nil, p.errorf("%s is not a table", k)
+			}
+			t = last
+		default:
+			return nil, p.errorf("%s is not a table", k)
+		}
+	}
+	return t, nil
+}
+
+func (p *parser) parseKeyValue(t map[string]any) error {
+	path, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	p.skipSpace()
+	if p.peek() != '=' {
+		return p.errorf("expected '=' after key %s", strings.Join(path, "."))
+	}
+	p.pos++
+	p.skipSpace()
+	v, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+
+	parent := t
+	for _, k := range path[:len(path)-1] {
+		if parent, err = p.table(parent, []string{k}); err != nil {
+			return err
+		}
+		p.defined[tableID(parent)] = true
+	}
+	last := path[len(path)-1]
+	if _, ok := parent[last]; ok {
+		return p.errorf("duplicate key %s", strings.Join(path, "."))
+	}
+	parent[last] = v
+	return nil
+}
+
+var bareKeyPatt *regexp.Regexp = regexp.MustCompile(`^[A-Za-z0-9_-]+`)
+
+func (p *parser) parseKey() ([]string, error) {
+	path := []string{}
+	for {
+		p.skipSpace()
+		switch p.peek() {
+		case '"':
+			k, err := p.parseBasicString()
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, k)
+		case '\'':
+			k, err := p.parseLiteralString()
+			if err != nil {
+				return nil, err
+			}
+			path = append(path, k)
+		default:
+			m := bareKeyPatt.FindString(p.src[p.pos:])
+			if m == "" {
+				return nil, p.errorf("invalid key")
+			}
+			p.pos += len(m)
+			path = append(path, m)
+		}
+		p.skipSpace()
+		if p.peek() != '.' {
+			return path, nil
+		}
+		p.pos++
+	}
+}
+
+func (p *parser) parseValue() (any, error) {
+	rest := p.src[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, `"""`):
+		return p.parseMultilineString(`"""`)
+	case strings.HasPrefix(rest, "'''"):
+		return p.parseMultilineString("'''")
+	case p.peek() == '"':
+		return p.parseBasicString()
+	case p.peek() == '\'':
+		return p.parseLiteralString()
+	case p.peek() == '[':
+		return p.parseArray()
+	case p.peek() == '{':
+		return p.parseInlineTable()
+	case strings.HasPrefix(rest, "true"):
+		p.pos += 4
+		return true, nil
+	case strings.HasPrefix(rest, "false"):
+		p.pos += 5
+		return false, nil
+	}
+	return p.parseScalar()
+}
+
+func (p *parser) parseBasicString() (string, error) {
+	p.pos++
+	var sb strings.Builder
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", p.errorf("unterminated string")
+		}
+		c := p.next()
+		switch c {
+		case '"':
+			return sb.String(), nil
+		case '\\':
+			if err := p.parseEscape(&sb); err != nil {
+				return "", err
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+}
+
+func (p *parser) parseLiteralString() (string, error) {
+	p.pos++
+	end := strings.IndexAny(p.src[p.pos:], "'\n")
+	if end < 0 || p.src[p.pos+end] != '\'' {
+		return "", p.errorf("unterminated string")
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+func (p *parser) parseMultilineString(delim string) (string, error) {
+	p.pos += len(delim)
+	// A newline right after the opening delimiter isn't part of the string
+	if strings.HasPrefix(p.src[p.pos:], "\r\n") {
+		p.pos++
+	}
+	if p.peek() == '\n' {
+		p.next()
+	}
+	var sb strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf("unterminated string")
+		}
+		if strings.HasPrefix(p.src[p.pos:], delim) {
+			// Up to two quotes can come right before the closing ones
+			run := len(delim)
+			for run < len(delim)+2 && p.pos+run < len(p.src) && p.src[p.pos+run] == delim[0] {
+				run++
+			}
+			sb.WriteString(p.src[p.pos : p.pos+run-len(delim)])
+			p.pos += run
+			return sb.String(), nil
+		}
+		c := p.next()
+		if c == '\\' && delim == `"""` {
+			if p.peek() == '\n' || p.peek() == '\r' || p.peek() == ' ' {
+				// Line-ending backslash - trim up to the next non-space
+				for !p.eof() && strings.IndexByte(" \t\r\n", p.peek()) >= 0 {
+					p.next()
+				}
+				continue
+			}
+			if err := p.parseEscape(&sb); err != nil {
+				return "", err
+			}
+			continue
+		}
+		sb.WriteByte(c)
+	}
+}
+
+func (p *parser) parseEscape(sb *strings.Builder) error {
+	if p.eof() {
+		return p.errorf("unterminated escape")
+	}
+	c := p.next()
+	switch c {
+	case 'b':
+		sb.WriteByte('\b')
+	case 't':
+		sb.WriteByte('\t')
+	case 'n':
+		sb.WriteByte('\n')
+	case 'f':
+		sb.WriteByte('\f')
+	case 'r':
+		sb.WriteByte('\r')
+	case '"', '\\':
+		sb.WriteByte(c)
+	case 'u', 'U':
+		n := 4
+		if c == 'U' {
+			n = 8
+		}
+		if p.pos+n > len(p.src) {
+			return p.errorf("invalid unicode escape")
+		}
+		code, err := strconv.ParseUint(p.src[p.pos:p.pos+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(code)) {
+			return p.errorf("invalid unicode escape")
+		}
+		sb.WriteRune(rune(code))
+		p.pos += n
+	default:
+		return p.errorf("invalid escape \\%c", c)
+	}
+	return nil
+}
+
+func (p *parser) parseArray() ([]any, error) {
+	p.pos++
+	arr := []any{}
+	for {
+		p.skipBlank()
+		if p.peek() == ']' {
+			p.pos++
+			return arr, nil
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, v)
+		p.skipBlank()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, p.errorf("expected ',' or ']' in array")
+		}
+	}
+}
+
+func (p *parser) parseInlineTable() (map[string]any, error) {
+	p.pos++
+	t := map[string]any{}
+	p.skipSpace()
+	if p.peek() == '}' {
+		p.pos++
+		p.inline[tableID(t)] = true
+		return t, nil
+	}
+	for {
+		p.skipSpace()
+		if err := p.parseKeyValue(t); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			p.inline[tableID(t)] = true
+			return t, nil
+		default:
+			return nil, p.errorf("expected ',' or '}' in inline table")
+		}
+	}
+}
+
+var (
+	scalarPatt *regexp.Regexp = regexp.MustCompile(`^[0-9A-Za-z_:.+-]+`)
+
+	// A space can separate the date & time of a date-time
+	dateTimePatt *regexp.Regexp = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}([Tt ]\d{2}:\d{2}(:\d{2}(\.\d+)?)?([Zz]|[+-]\d{2}:\d{2})?)?`)
+	timePatt     *regexp.Regexp = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}(\.\d+)?`)
+
+	// No leading zeros, and no sign on hex, octal or binary
+	decimalPatt  *regexp.Regexp = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)$`)
+	prefixedPatt *regexp.Regexp = regexp.MustCompile(`^(0x[0-9A-Fa-f]+|0o[0-7]+|0b[01]+)$`)
+	floatPatt    *regexp.Regexp = regexp.MustCompile(`^[+-]?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+	dateTimeLayouts []string = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02T15:04",
+		"2006-01-02",
+		"15:04:05.999999999",
+	}
+)
+
+func (p *parser) parseScalar() (any, error) {
+	if m := dateTimePatt.FindString(p.src[p.pos:]); m != "" {
+		p.pos += len(m)
+		s := strings.Replace(strings.ToUpper(m), " ", "T", 1)
+		for _, layout := range dateTimeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return nil, p.errorf("invalid date-time %s", m)
+	}
+	if m := timePatt.FindString(p.src[p.pos:]); m != "" {
+		p.pos += len(m)
+		t, err := time.Parse("15:04:05.999999999", m)
+		if err != nil {
+			return nil, p.errorf("invalid time %s", m)
+		}
+		return t, nil
+	}
+
+	s := scalarPatt.FindString(p.src[p.pos:])
+	if s == "" {
+		return nil, p.errorf("invalid value")
+	}
+	p.pos += len(s)
+	switch strings.TrimLeft(s, "+-") {
+	case "inf":
+		if s[0] == '-' {
+			return math.Inf(-1), nil
+		}
+		return math.Inf(1), nil
+	case "nan":
+		return math.NaN(), nil
+	}
+
+	clean := strings.ReplaceAll(s, "_", "")
+	switch {
+	case decimalPatt.MatchString(clean), prefixedPatt.MatchString(clean):
+		i, err := strconv.ParseInt(clean, 0, 64)
+		if err != nil {
+			return nil, p.errorf("integer %s out of range", s)
+		}
+		return i, nil
+	case floatPatt.MatchString(clean):
+		f, err := strconv.ParseFloat(clean, 64)
+		if err != nil {
+			return nil, p.errorf("float %s out of range", s)
+		}
+		return f, nil
+	}
+	return nil, p.errorf("invalid value %s", s)
+}
@@ -0,0 +1,189 @@
+package toml
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	doc := `
+# A comment
+title = "Weekly \"sync\" notes" # trailing comment
+path = 'C:\notes'
+count = 1_000
+hex = 0xff
+ratio = 0.5
+big = 1e3
+neg = -inf
+draft = false
+date = 2024-03-01
+updated = 1979-05-27 07:32:00Z
+tags = [
+  "meeting", # first
+  'planning',
+]
+owner.name = "Mark"
+point = { x = 1, y = "two" }
+body = """
+Line one
+Line \
+  two"""
+
+[index]
+path = ".index"
+
+[index.boosts]
+title = 2.5
+
+[[feeds]]
+url = "a"
+
+[[feeds]]
+url = "b"
+`
+	actual, err := Parse(doc)
+	assert.Nil(t, err)
+
+	assert.Equal(t, `Weekly "sync" notes`, actual["title"])
+	assert.Equal(t, `C:\notes`, actual["path"])
+	assert.Equal(t, int64(1000), actual["count"])
+	assert.Equal(t, int64(255), actual["hex"])
+	assert.Equal(t, 0.5, actual["ratio"])
+	assert.Equal(t, 1000.0, actual["big"])
+	assert.True(t, math.IsInf(actual["neg"].(float64), -1))
+	assert.Equal(t, false, actual["draft"])
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), actual["date"])
+	assert.Equal(t, time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC), actual["updated"])
+	assert.Equal(t, []any{"meeting", "planning"}, actual["tags"])
+	assert.Equal(t, map[string]any{"name": "Mark"}, actual["owner"])
+	assert.Equal(t, map[string]any{"x": int64(1), "y": "two"}, actual["point"])
+	assert.Equal(t, "Line one\nLine two", actual["body"])
+	assert.Equal(t, map[string]any{"path": ".index", "boosts": map[string]any{"title": 2.5}}, actual["index"])
+	assert.Equal(t, []any{map[string]any{"url": "a"}, map[string]any{"url": "b"}}, actual["feeds"])
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		err  string
+	}{
+		{"missing-equals", "key value", "line 1: expected '=' after key key"},
+		{"duplicate-key", "a = 1\na = 2", "line 2: duplicate key a"},
+		{"unterminated-string", "a = \"open\nb = 1", "line 1: unterminated string"},
+		{"trailing-garbage", "a = 1 2", "line 1: expected end of line, found '2'"},
+		{"bad-array", "a = [1 2]", "line 1: expected ',' or ']' in array"},
+		{"not-a-table", "a = 1\n[a.b]", "line 2: a is not a table"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(test.doc)
+			if assert.NotNil(t, err) {
+				assert.Equal(t, test.err, err.Error())
+			}
+		})
+	}
+}
+
+// Examples from the TOML 1.0 spec, https://toml.io/en/v1.0.0
+func TestParseSpec(t *testing.T) {
+	tests := []struct {
+		name     string
+		doc      string
+		expected map[string]any
+	}{
+		{"bare-keys", "key = 1\nbare_key = 2\nbare-key = 3\n1234 = 4", map[string]any{"key": int64(1), "bare_key": int64(2), "bare-key": int64(3), "1234": int64(4)}},
+		{"quoted-keys", "\"127.0.0.1\" = \"value\"\n\"ʎǝʞ\" = \"value\"\n'quoted \"value\"' = \"value\"\n\"\" = \"blank\"", map[string]any{"127.0.0.1": "value", "ʎǝʞ": "value", `quoted "value"`: "value", "": "blank"}},
+		{"dotted-keys", "fruit. color = \"yellow\"\nfruit . flavor = \"banana\"\n3.14159 = \"pi\"", map[string]any{"fruit": map[string]any{"color": "yellow", "flavor": "banana"}, "3": map[string]any{"14159": "pi"}}},
+		{"dotted-keys-out-of-order", "apple.type = \"fruit\"\norange.type = \"fruit\"\napple.skin = \"thin\"", map[string]any{"apple": map[string]any{"type": "fruit", "skin": "thin"}, "orange": map[string]any{"type": "fruit"}}},
+		{"escapes", `str = "I'm a string. \"You can quote me\". Name\tJos\u00E9\nLocation\tSF."`, map[string]any{"str": "I'm a string. \"You can quote me\". Name\tJosé\nLocation\tSF."}},
+		{"multiline-trimmed", "str = \"\"\"\\\n  The quick brown \\\n\n\n  fox jumps over \\\n    the lazy dog.\\\n  \"\"\"", map[string]any{"str": "The quick brown fox jumps over the lazy dog."}},
+		{"multiline-quotes", `str4 = """Here are two quotation marks: "". Simple enough."""` + "\n" + `str5 = """"This," she said, "is just a pointless statement.""""`, map[string]any{"str4": `Here are two quotation marks: "". Simple enough.`, "str5": `"This," she said, "is just a pointless statement."`}},
+		{"literal-strings", `winpath = 'C:\Users\nodejs\templates'` + "\n" + `regex = '<\i\c*\s*>'` + "\n" + "quot15 = '''Here are fifteen quotation marks: \"\"\"\"\"\"\"\"\"\"\"\"\"\"\"'''\n" + "str = ''''That,' she said, 'is still pointless.''''", map[string]any{"winpath": `C:\Users\nodejs\templates`, "regex": `<\i\c*\s*>`, "quot15": `Here are fifteen quotation marks: """""""""""""""`, "str": "'That,' she said, 'is still pointless.'"}},
+		{"integers", "int1 = +99\nint2 = 42\nint3 = 0\nint4 = -17\nint5 = 1_000\nhex = 0xDEADBEEF\noct = 0o755\nbin = 0b11010110", map[string]any{"int1": int64(99), "int2": int64(42), "int3": int64(0), "int4": int64(-17), "int5": int64(1000), "hex": int64(0xDEADBEEF), "oct": int64(0755), "bin": int64(214)}},
+		{"floats", "flt1 = +1.0\nflt2 = 3.1415\nflt3 = -0.01\nflt4 = 5e+22\nflt5 = 1e06\nflt6 = -2E-2\nflt7 = 6.626e-34\nflt8 = 224_617.445_991_228", map[string]any{"flt1": 1.0, "flt2": 3.1415, "flt3": -0.01, "flt4": 5e+22, "flt5": 1e06, "flt6": -2e-2, "flt7": 6.626e-34, "flt8": 224617.445991228}},
+		{"date-times", "odt1 = 1979-05-27T07:32:00Z\nodt2 = 1979-05-27T00:32:00-07:00\nodt3 = 1979-05-27 07:32:00Z\nldt = 1979-05-27T00:32:00.999999\nld = 1979-05-27\nlt = 00:32:00.999999", map[string]any{
+			"odt1": time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC),
+			"odt2": time.Date(1979, 5, 27, 0, 32, 0, 0, time.FixedZone("", -7*60*60)),
+			"odt3": time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC),
+			"ldt":  time.Date(1979, 5, 27, 0, 32, 0, 999999000, time.UTC),
+			"ld":   time.Date(1979, 5, 27, 0, 0, 0, 0, time.UTC),
+			"lt":   time.Date(0, 1, 1, 0, 32, 0, 999999000, time.UTC),
+		}},
+		{"arrays", "integers = [ 1, 2, 3 ]\nnested_mixed_array = [ [ 1, 2 ], [\"a\", \"b\", \"c\"] ]\ncontributors = [\n  \"Foo Bar <foo@example.com>\",\n  { name = \"Baz Qux\", url = \"https://example.com/bazqux\" }\n]\ninteger3 = [\n  1,\n  2, # this is ok\n]", map[string]any{
+			"integers":           []any{int64(1), int64(2), int64(3)},
+			"nested_mixed_array": []any{[]any{int64(1), int64(2)}, []any{"a", "b", "c"}},
+			"contributors":       []any{"Foo Bar <foo@example.com>", map[string]any{"name": "Baz Qux", "url": "https://example.com/bazqux"}},
+			"integer3":           []any{int64(1), int64(2)},
+		}},
+		{"tables", "[dog.\"tater.man\"]\ntype.name = \"pug\"\n\n[ j . \"ʞ\" . 'l' ]\n\n# [x] [x.y] [x.y.z] need not be defined first\n[x.y.z.w]\n[x]", map[string]any{
+			"dog": map[string]any{"tater.man": map[string]any{"type": map[string]any{"name": "pug"}}},
+			"j":   map[string]any{"ʞ": map[string]any{"l": map[string]any{}}},
+			"x":   map[string]any{"y": map[string]any{"z": map[string]any{"w": map[string]any{}}}},
+		}},
+		{"sub-table-of-dotted-keys", "[fruit]\napple.color = \"red\"\napple.taste.sweet = true\n\n[fruit.apple.texture]\nsmooth = true", map[string]any{
+			"fruit": map[string]any{"apple": map[string]any{"color": "red", "taste": map[string]any{"sweet": true}, "texture": map[string]any{"smooth": true}}},
+		}},
+		{"inline-tables", "name = { first = \"Tom\", last = \"Preston-Werner\" }\nanimal = { type.name = \"pug\" }", map[string]any{
+			"name":   map[string]any{"first": "Tom", "last": "Preston-Werner"},
+			"animal": map[string]any{"type": map[string]any{"name": "pug"}},
+		}},
+		{"arrays-of-tables", "[[fruits]]\nname = \"apple\"\n\n[fruits.physical]\ncolor = \"red\"\n\n[[fruits.varieties]]\nname = \"red delicious\"\n\n[[fruits.varieties]]\nname = \"granny smith\"\n\n[[fruits]]\nname = \"banana\"", map[string]any{
+			"fruits": []any{
+				map[string]any{
+					"name":      "apple",
+					"physical":  map[string]any{"color": "red"},
+					"varieties": []any{map[string]any{"name": "red delicious"}, map[string]any{"name": "granny smith"}},
+				},
+				map[string]any{"name": "banana"},
+			},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := Parse(test.doc)
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestParseSpecInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		err  string
+	}{
+		{"no-value", "key = # INVALID", "line 1: invalid value"},
+		{"two-pairs-on-a-line", `first = "Tom" last = "Preston-Werner"`, "line 1: expected end of line, found 'l'"},
+		{"no-key", `= "no key name"`, "line 1: invalid key"},
+		{"duplicate-quoted-key", "spelling = \"favorite\"\n\"spelling\" = \"favourite\"", "line 2: duplicate key spelling"},
+		{"value-then-table", "fruit.apple = 1\nfruit.apple.smooth = true", "line 2: apple is not a table"},
+		{"table-twice", "[fruit]\napple = \"red\"\n\n[fruit]\norange = \"orange\"", "line 4: table fruit is defined more than once"},
+		{"table-after-sub-table", "[fruit]\napple = \"red\"\n\n[fruit.apple]\ntexture = \"smooth\"", "line 4: apple is not a table"},
+		{"table-of-dotted-keys", "[fruit]\napple.color = \"red\"\n\n[fruit.apple]", "line 4: table fruit.apple is defined more than once"},
+		{"add-to-inline-table", "[product]\ntype = { name = \"Nail\" }\ntype.edible = false", "line 3: type is an inline table"},
+		{"table-in-inline-table", "[product]\ntype = { name = \"Nail\" }\n\n[product.type]", "line 4: type is an inline table"},
+		{"table-after-array-of-tables", "[[fruits]]\nname = \"apple\"\n\n[fruits]", "line 4: table fruits is defined more than once"},
+		{"leading-zero", "a = 012", "line 1: invalid value 012"},
+		{"signed-hex", "a = +0xff", "line 1: invalid value +0xff"},
+		{"integer-overflow", "a = 9_223_372_036_854_775_808", "line 1: integer 9_223_372_036_854_775_808 out of range"},
+		{"float-without-leading-digit", "a = .7", "line 1: invalid value .7"},
+		{"float-without-trailing-digit", "a = 7.", "line 1: invalid value 7."},
+		{"float-exponent-after-dot", "a = 3.e+20", "line 1: invalid value 3.e+20"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := Parse(test.doc)
+			if assert.NotNil(t, err) {
+				assert.Equal(t, test.err, err.Error())
+			}
+		})
+	}
+}
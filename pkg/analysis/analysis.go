@@ -0,0 +1,131 @@
+package analysis
+
+import (
+	"mrshanahan.com/notes-indexer/pkg/tokenizer"
+)
+
+// Token is a single term produced by an Analyzer. Position is the ordinal
+// position of the token in the original stream; filters that drop tokens leave
+// gaps in the positions rather than renumbering, so that phrases still line up.
+// PositionLength is the number of positions the token spans, which is more
+// than one only when a filter (e.g. synonyms) turns the stream into a graph.
+// Start and End are byte offsets into the analyzed text, when the tokenizer
+// reports them, and Quoted marks tokens that fell inside double quotes.
+type Token struct {
+	Value          string
+	Type           int
+	Position       int
+	PositionLength int
+	Start          int
+	End            int
+	Quoted         bool
+}
+
+type Filter interface {
+	Filter(tokens []Token) []Token
+}
+
+type FilterFunc func(tokens []Token) []Token
+
+func (f FilterFunc) Filter(tokens []Token) []Token { return f(tokens) }
+
+// Analyzer turns text into a stream of terms by running it through a
+// tokenizer and then each of its filters, in order.
+type Analyzer struct {
+	Tokenizer tokenizer.Tokenizer
+	Filters   []Filter
+}
+
+func New(t tokenizer.Tokenizer, filters ...Filter) *Analyzer {
+	return &Analyzer{
+		Tokenizer: t,
+		Filters:   filters,
+	}
+}
+
+func (a *Analyzer) Analyze(text string) ([]Token, error) {
+	tokens, err := a.tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range a.Filters {
+		tokens = f.Filter(tokens)
+	}
+	return tokens, nil
+}
+
+// Stage is the tokens of a stream after one step of an analyzer: Name is
+// "tokenizer" for the first, then the FilterName of each filter in turn.
+type Stage struct {
+	Name   string
+	Tokens []Token
+}
+
+// Stages analyzes text the same as Analyze, but keeps the tokens after every
+// step, for seeing why text turns into the terms it does.
+func (a *Analyzer) Stages(text string) ([]Stage, error) {
+	tokens, err := a.tokenize(text)
+	if err != nil {
+		return nil, err
+	}
+	stages := []Stage{{"tokenizer", tokens}}
+	for _, f := range a.Filters {
+		// Copied in case a filter changes tokens in place
+		tokens = f.Filter(append([]Token{}, tokens...))
+		stages = append(stages, Stage{FilterName(f), tokens})
+	}
+	return stages, nil
+}
+
+func (a *Analyzer) tokenize(text string) ([]Token, error) {
+	var raw []tokenizer.Token
+	var offsets []tokenizer.Offset
+	var err error
+	if ot, ok := a.Tokenizer.(tokenizer.OffsetTokenizer); ok {
+		raw, offsets, err = ot.TokenizeWithOffsets(text)
+	} else {
+		raw, err = a.Tokenizer.Tokenize(text)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]Token, len(raw))
+	for i, t := range raw {
+		tokens[i] = Token{Value: t.Value, Type: t.Type, Position: i, PositionLength: 1}
+	}
+	if offsets != nil {
+		quotes := quotedRanges(text)
+		for i, o := range offsets {
+			tokens[i].Start, tokens[i].End = o.Start, o.End
+			tokens[i].Quoted = inRanges(quotes, o.Start)
+		}
+	}
+	return tokens, nil
+}
+
+// quotedRanges finds the byte ranges enclosed by matching pairs of double
+// quotes. An unterminated quote doesn't start a range.
+func quotedRanges(text string) []tokenizer.Offset {
+	ranges := []tokenizer.Offset{}
+	open := -1
+	for i, r := range text {
+		switch {
+		case open < 0 && (r == '"' || r == '\u201c'):
+			open = i
+		case open >= 0 && (r == '"' || r == '\u201d'):
+			ranges = append(ranges, tokenizer.Offset{Start: open, End: i})
+			open = -1
+		}
+	}
+	return ranges
+}
+
+func inRanges(ranges []tokenizer.Offset, i int) bool {
+	for _, r := range ranges {
+		if i > r.Start && i < r.End {
+			return true
+		}
+	}
+	return false
+}
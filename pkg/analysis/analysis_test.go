@@ -0,0 +1,103 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mrshanahan.com/notes-indexer/pkg/tokenizer"
+)
+
+func TestAnalyzeWithStemFilter(t *testing.T) {
+	a := New(tokenizer.NewDefault(), StemFilter)
+
+	actual, err := a.Analyze("Pondering generalizations")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Token{
+		{Value: "ponder", Type: tokenizer.TOKEN_TYPE_GENERIC, Position: 0, PositionLength: 1, Start: 0, End: 9},
+		{Value: "gener", Type: tokenizer.TOKEN_TYPE_GENERIC, Position: 1, PositionLength: 1, Start: 10, End: 25},
+	}, actual)
+}
+
+func TestAnalyzeWithLemmaFilter(t *testing.T) {
+	a := New(tokenizer.NewDefault(), LemmaFilter)
+
+	actual, err := a.Analyze("The mice went pondering generalizations")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"the", "mouse", "go", "ponder", "generalization"}, values(actual))
+}
+
+func TestTermFilterSkipsMarkup(t *testing.T) {
+	a := New(tokenizer.NewXmlTokenizer(), LemmaFilter)
+
+	actual, err := a.Analyze("<b>Running</b> mice")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"<b>", "run", "</b>", "mouse"}, values(actual))
+}
+
+func TestGetFilter(t *testing.T) {
+	for _, name := range []string{"stem", "LEMMA", "lowercase"} {
+		f, err := GetFilter(name)
+		assert.Nil(t, err)
+		assert.NotNil(t, f)
+	}
+
+	_, err := GetFilter("nonexistent")
+	assert.NotNil(t, err)
+}
+
+func TestRegistry(t *testing.T) {
+	a, err := Get("lemma")
+	assert.Nil(t, err)
+
+	actual, _ := a.Analyze("geese")
+	assert.Equal(t, []string{"goose"}, values(actual))
+	_, err = a.Analyze("The U.S. office")
+	assert.Nil(t, err)
+
+	_, err = Get("nonexistent")
+	assert.NotNil(t, err)
+}
+
+func TestStages(t *testing.T) {
+	a, _ := Get("english")
+
+	stages, err := a.Stages("The running foxes")
+
+	assert.Nil(t, err)
+	names := []string{}
+	for _, s := range stages {
+		names = append(names, s.Name)
+	}
+	assert.Equal(t, []string{"tokenizer", "stop", "stem"}, names)
+	assert.Equal(t, []string{"the", "running", "foxes"}, values(stages[0].Tokens))
+	assert.Equal(t, []string{"running", "foxes"}, values(stages[1].Tokens))
+	assert.Equal(t, []string{"run", "fox"}, values(stages[2].Tokens))
+	final, _ := a.Analyze("The running foxes")
+	assert.Equal(t, final, stages[2].Tokens)
+}
+
+func TestFilterName(t *testing.T) {
+	tests := map[string]Filter{
+		"lowercase":        LowercaseFilter,
+		"stem":             StemFilter,
+		"stop":             mustStopFilter("english", false),
+		"synonyms":         NewSynonymFilter(NewSynonymMap()),
+		"edge_ngram":       EdgeNGramFilter(1, 2),
+		"double_metaphone": mustPhoneticFilter(PHONETIC_DOUBLE_METAPHONE),
+		"filter":           FilterFunc(func(tokens []Token) []Token { return tokens }),
+	}
+	for expected, f := range tests {
+		assert.Equal(t, expected, FilterName(f))
+	}
+}
+
+func values(tokens []Token) []string {
+	vs := []string{}
+	for _, t := range tokens {
+		vs = append(vs, t.Value)
+	}
+	return vs
+}
@@ -0,0 +1,101 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"mrshanahan.com/notes-indexer/pkg/lemmatizer"
+	"mrshanahan.com/notes-indexer/pkg/stemmer"
+	"mrshanahan.com/notes-indexer/pkg/tokenizer"
+)
+
+var (
+	LowercaseFilter Filter = Named("lowercase", TermFilter(strings.ToLower))
+
+	StemFilter Filter = Named("stem", TermFilter(stemmer.Stem))
+
+	LemmaFilter Filter = Named("lemma", TermFilter(lemmatizer.Lemmatize))
+)
+
+type namedFilter struct {
+	name   string
+	filter Filter
+}
+
+func (f *namedFilter) Filter(tokens []Token) []Token { return f.filter.Filter(tokens) }
+
+// Named gives a filter a name, which is what FilterName reports for it.
+func Named(name string, f Filter) Filter {
+	return &namedFilter{name, f}
+}
+
+// FilterName describes what kind of filter f is, for showing the stages of an
+// analyzer: the name it was given with Named, "stop" or "synonyms" for those
+// filters, and otherwise just "filter".
+func FilterName(f Filter) string {
+	switch f := f.(type) {
+	case *namedFilter:
+		return f.name
+	case *StopFilter:
+		return "stop"
+	case *SynonymFilter:
+		return "synonyms"
+	default:
+		return "filter"
+	}
+}
+
+// TermFilter applies f to the value of every generic token. Markup tokens
+// (e.g. XML elements) are passed through untouched, and tokens that f maps
+// to the empty string are dropped.
+func TermFilter(f func(string) string) Filter {
+	return FilterFunc(func(tokens []Token) []Token {
+		filtered := make([]Token, 0, len(tokens))
+		for _, t := range tokens {
+			if t.Type == tokenizer.TOKEN_TYPE_GENERIC {
+				t.Value = f(t.Value)
+				if t.Value == "" {
+					continue
+				}
+			}
+			filtered = append(filtered, t)
+		}
+		return filtered
+	})
+}
+
+var filters map[string]Filter = map[string]Filter{
+	"lowercase":  LowercaseFilter,
+	"stem":       StemFilter,
+	"lemma":      LemmaFilter,
+	"stop":       mustStopFilter("english", false),
+	"ngram":      NGramFilter(DefaultInfixGram, DefaultInfixGram),
+	"edge_ngram": EdgeNGramFilter(DefaultPrefixMinGram, DefaultPrefixMaxGram),
+}
+
+func init() {
+	for _, lang := range StopwordLanguages() {
+		filters["stop_"+lang] = mustStopFilter(lang, false)
+	}
+	for _, encoding := range PhoneticEncodings {
+		filters[encoding] = mustPhoneticFilter(encoding)
+	}
+}
+
+func GetFilter(name string) (Filter, error) {
+	f, ok := filters[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown token filter: %s", name)
+	}
+	return f, nil
+}
+
+func FilterNames() []string {
+	names := make([]string, 0, len(filters))
+	for n := range filters {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,207 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// When a field's synonyms are expanded: as it's indexed, as it's searched,
+// or both.
+const (
+	SYNONYMS_INDEX string = "index"
+	SYNONYMS_QUERY string = "query"
+	SYNONYMS_BOTH  string = "both"
+)
+
+// Field describes how one indexed field is analyzed. A field with a Source is
+// a sibling field: rather than having text of its own, it indexes the text of
+// its source field with a different analyzer. This is how e.g. "body.phonetic"
+// gets sound-alike terms without them ever mixing with the exact terms in
+// "body", so a query only matches sound-alikes when it asks for them.
+type Field struct {
+	Name   string
+	Source string
+
+	// Analyzer is used at index time, and SearchAnalyzer (if set) at query
+	// time - e.g. to expand synonyms on only one side.
+	Analyzer       string
+	SearchAnalyzer string
+
+	// When the mapping's synonyms are expanded in the field, if ever
+	Synonyms string `json:",omitempty"`
+}
+
+func (f Field) source() string {
+	if f.Source == "" {
+		return f.Name
+	}
+	return f.Source
+}
+
+func (f Field) searchAnalyzer() string {
+	if f.SearchAnalyzer == "" {
+		return f.Analyzer
+	}
+	return f.SearchAnalyzer
+}
+
+// Mapping is the set of fields a document's text is indexed into. Source
+// fields without an entry of their own are analyzed with DefaultAnalyzer, and
+// have synonyms expanded as DefaultSynonyms says.
+//
+// Synonyms are rules in the Solr format (see ParseSolrSynonyms), kept in the
+// mapping rather than read from a file so that an index is always searched
+// with the synonyms it was built with.
+type Mapping struct {
+	DefaultAnalyzer string
+	Fields          []Field
+
+	Synonyms        []string `json:",omitempty"`
+	DefaultSynonyms string   `json:",omitempty"`
+}
+
+// Parsed synonyms, by their rules joined with newlines, as they're needed for
+// every document and query.
+var synonymMaps sync.Map
+
+func (m *Mapping) synonymMap() (*SynonymMap, error) {
+	key := strings.Join(m.Synonyms, "\n")
+	if sm, ok := synonymMaps.Load(key); ok {
+		return sm.(*SynonymMap), nil
+	}
+	sm, err := ParseSolrSynonyms(strings.NewReader(key), true)
+	if err != nil {
+		return nil, fmt.Errorf("synonyms: %w", err)
+	}
+	synonymMaps.Store(key, sm)
+	return sm, nil
+}
+
+// FieldAnalyzer returns the analyzer of a field, as it's indexed or as a
+// query is matched against it, including any synonyms.
+func (m *Mapping) FieldAnalyzer(field string, query bool) (*Analyzer, error) {
+	f, ok := m.Field(field)
+	if !ok {
+		f = m.defaultField(field)
+	}
+	return m.analyzer(f, query)
+}
+
+func (m *Mapping) analyzer(f Field, query bool) (*Analyzer, error) {
+	name, at := f.Analyzer, SYNONYMS_INDEX
+	if query {
+		name, at = f.searchAnalyzer(), SYNONYMS_QUERY
+	}
+	a, err := Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("field %s: %w", f.Name, err)
+	}
+	if len(m.Synonyms) == 0 || (f.Synonyms != at && f.Synonyms != SYNONYMS_BOTH) {
+		return a, nil
+	}
+	sm, err := m.synonymMap()
+	if err != nil {
+		return nil, err
+	}
+	return a.WithSynonyms(sm), nil
+}
+
+func (m *Mapping) defaultField(name string) Field {
+	return Field{Name: name, Analyzer: m.DefaultAnalyzer, Synonyms: m.DefaultSynonyms}
+}
+
+func (m *Mapping) Field(name string) (Field, bool) {
+	for _, f := range m.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// FieldsFor lists the fields built from the text of source: source itself,
+// followed by any of its sibling fields.
+func (m *Mapping) FieldsFor(source string) []Field {
+	f, ok := m.Field(source)
+	if !ok {
+		f = m.defaultField(source)
+	}
+	fields := []Field{f}
+	for _, sf := range m.Fields {
+		if sf.Source == source && sf.Name != source {
+			fields = append(fields, sf)
+		}
+	}
+	return fields
+}
+
+// Analyze runs the text of a source field through the analyzers of every
+// field built from it, keyed by field name.
+func (m *Mapping) Analyze(source, text string) (map[string][]Token, error) {
+	analyzed := map[string][]Token{}
+	for _, f := range m.FieldsFor(source) {
+		a, err := m.analyzer(f, false)
+		if err != nil {
+			return nil, err
+		}
+		tokens, err := a.Analyze(text)
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name, err)
+		}
+		analyzed[f.Name] = tokens
+	}
+	return analyzed, nil
+}
+
+// AnalyzeQuery analyzes query text the way it should be matched against the
+// given field.
+func (m *Mapping) AnalyzeQuery(field, text string) ([]Token, error) {
+	a, err := m.FieldAnalyzer(field, true)
+	if err != nil {
+		return nil, err
+	}
+	return a.Analyze(text)
+}
+
+// SourceOf returns the field whose text the named field is built from.
+func (m *Mapping) SourceOf(field string) string {
+	if f, ok := m.Field(field); ok {
+		return f.source()
+	}
+	return field
+}
+
+// The kinds of sibling field SiblingField can make, by name.
+var siblingFields map[string]func(string) Field = map[string]func(string) Field{
+	"prefix":   PrefixField,
+	"infix":    InfixField,
+	"phonetic": PhoneticField,
+}
+
+// SiblingKinds lists the kinds of sibling field SiblingField can make.
+func SiblingKinds() []string {
+	kinds := make([]string, 0, len(siblingFields))
+	for kind := range siblingFields {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// SiblingField returns the sibling field of the given kind for source, e.g.
+// "prefix" for PrefixField.
+func SiblingField(source, kind string) (Field, error) {
+	f, ok := siblingFields[kind]
+	if !ok {
+		return Field{}, fmt.Errorf("unknown sibling field %s, expected one of %s", kind, strings.Join(SiblingKinds(), ", "))
+	}
+	return f(source), nil
+}
+
+// PhoneticField returns a sibling field that indexes sound-alike codes for
+// source, named "<source>.phonetic".
+func PhoneticField(source string) Field {
+	return Field{Name: source + ".phonetic", Source: source, Analyzer: "phonetic"}
+}
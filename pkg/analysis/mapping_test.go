@@ -0,0 +1,93 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testMapping() *Mapping {
+	return &Mapping{
+		DefaultAnalyzer: "simple",
+		Fields: []Field{
+			{Name: "body", Analyzer: "english"},
+			PhoneticField("body"),
+			{Name: "title", Analyzer: "simple", SearchAnalyzer: "lemma"},
+		},
+	}
+}
+
+func TestMappingAnalyzesSiblingFields(t *testing.T) {
+	m := testMapping()
+
+	actual, err := m.Analyze("body", "Meeting with Shannahan")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"meet", "shannahan"}, values(actual["body"]))
+	assert.Equal(t, []string{"MTNK", "XNHN"}, values(actual["body.phonetic"]))
+	assert.Len(t, actual, 2)
+}
+
+func TestMappingDefaultAnalyzer(t *testing.T) {
+	m := testMapping()
+
+	actual, err := m.Analyze("author", "The Authors")
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string][]string{"author": {"the", "authors"}}, map[string][]string{"author": values(actual["author"])})
+}
+
+func TestMappingAnalyzeQuery(t *testing.T) {
+	m := testMapping()
+
+	actual, _ := m.AnalyzeQuery("title", "Mice")
+	assert.Equal(t, []string{"mouse"}, values(actual))
+
+	actual, _ = m.AnalyzeQuery("body.phonetic", "Shanahan")
+	assert.Equal(t, []string{"XNHN"}, values(actual))
+}
+
+func TestMappingSynonyms(t *testing.T) {
+	m := &Mapping{
+		DefaultAnalyzer: "english",
+		Fields: []Field{
+			{Name: "title", Analyzer: "english", Synonyms: SYNONYMS_INDEX},
+			{Name: "tags", Analyzer: "simple"},
+		},
+		Synonyms:        []string{"k8s => k8s, kubernetes"},
+		DefaultSynonyms: SYNONYMS_QUERY,
+	}
+
+	analyzed, err := m.Analyze("title", "Upgrading k8s")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"upgrad", "k8", "kubernet"}, values(analyzed["title"]))
+	analyzed, _ = m.Analyze("body", "Upgrading k8s")
+	assert.Equal(t, []string{"upgrad", "k8"}, values(analyzed["body"]))
+
+	actual, _ := m.AnalyzeQuery("body", "k8s")
+	assert.Equal(t, []string{"k8", "kubernet"}, values(actual))
+	actual, _ = m.AnalyzeQuery("title", "k8s")
+	assert.Equal(t, []string{"k8"}, values(actual))
+	actual, _ = m.AnalyzeQuery("tags", "k8s")
+	assert.Equal(t, []string{"k8s"}, values(actual))
+
+	m.Synonyms = []string{"=> nothing"}
+	_, err = m.AnalyzeQuery("body", "k8s")
+	assert.NotNil(t, err)
+}
+
+func TestMappingSourceOf(t *testing.T) {
+	m := testMapping()
+
+	assert.Equal(t, "body", m.SourceOf("body.phonetic"))
+	assert.Equal(t, "body", m.SourceOf("body"))
+	assert.Equal(t, "other", m.SourceOf("other"))
+}
+
+func TestMappingUnknownAnalyzer(t *testing.T) {
+	m := &Mapping{Fields: []Field{{Name: "body", Analyzer: "nonexistent"}}}
+
+	_, err := m.Analyze("body", "text")
+
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,88 @@
+package analysis
+
+import (
+	"unicode"
+
+	"mrshanahan.com/notes-indexer/pkg/tokenizer"
+)
+
+const (
+	DefaultPrefixMinGram int = 1
+	DefaultPrefixMaxGram int = 20
+	DefaultInfixGram     int = 3
+)
+
+// NGramFilter replaces each token with its character n-grams. All n-grams of
+// a token share its position. A token of several words, as from a tokenizer
+// that doesn't split on spaces, is split into n-grams word by word, so no
+// n-gram spans a space.
+func NGramFilter(min, max int) Filter {
+	return Named("ngram", nGramFilter(min, max, false))
+}
+
+// EdgeNGramFilter replaces each token with its prefixes of min to max
+// characters, which is what search-as-you-type matches against: "kube" is one
+// of the terms indexed for "kubernetes".
+func EdgeNGramFilter(min, max int) Filter {
+	return Named("edge_ngram", nGramFilter(min, max, true))
+}
+
+func nGramFilter(min, max int, edge bool) Filter {
+	return FilterFunc(func(tokens []Token) []Token {
+		filtered := make([]Token, 0, len(tokens))
+		for _, t := range tokens {
+			if t.Type != tokenizer.TOKEN_TYPE_GENERIC {
+				filtered = append(filtered, t)
+				continue
+			}
+			// Only map offsets through when the value is still the text it
+			// was read from; otherwise every gram gets the token's offsets
+			exact := t.End-t.Start == len(t.Value)
+			for _, w := range words(t.Value) {
+				for _, g := range tokenizer.NGrams(t.Value[w.Start:w.End], min, max, edge) {
+					start, end := w.Start+g.Start, w.Start+g.End
+					gram := t
+					gram.Value = t.Value[start:end]
+					if exact {
+						gram.Start, gram.End = t.Start+start, t.Start+end
+					}
+					filtered = append(filtered, gram)
+				}
+			}
+		}
+		return filtered
+	})
+}
+
+// The byte ranges of the runs of non-space characters in s.
+func words(s string) []tokenizer.Offset {
+	ranges := []tokenizer.Offset{}
+	start := -1
+	for i, r := range s {
+		switch {
+		case unicode.IsSpace(r) && start >= 0:
+			ranges = append(ranges, tokenizer.Offset{Start: start, End: i})
+			start = -1
+		case !unicode.IsSpace(r) && start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		ranges = append(ranges, tokenizer.Offset{Start: start, End: len(s)})
+	}
+	return ranges
+}
+
+// PrefixField returns a sibling field for search-as-you-type on source,
+// named "<source>.prefix". Queries against it aren't n-grammed, so a partial
+// word matches as a single term.
+func PrefixField(source string) Field {
+	return Field{Name: source + ".prefix", Source: source, Analyzer: "edge_ngram", SearchAnalyzer: "simple"}
+}
+
+// InfixField returns a sibling field for substring search on source, named
+// "<source>.infix". Both sides are split into trigrams, so "ingest" matches
+// "reingestion" as the phrase "ing nge ges est".
+func InfixField(source string) Field {
+	return Field{Name: source + ".infix", Source: source, Analyzer: "ngram"}
+}
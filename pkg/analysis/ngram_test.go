@@ -0,0 +1,56 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mrshanahan.com/notes-indexer/pkg/tokenizer"
+)
+
+func TestEdgeNGramFilter(t *testing.T) {
+	actual, _ := New(tokenizer.NewDefault(), EdgeNGramFilter(2, 4)).Analyze("Kube ops")
+
+	assert.Equal(t, []string{"ku", "kub", "kube", "op", "ops"}, values(actual))
+	assert.Equal(t, []int{0, 0, 0, 1, 1}, positions(actual))
+	assert.Equal(t, 0, actual[1].Start)
+	assert.Equal(t, 3, actual[1].End)
+}
+
+func TestNGramFilter(t *testing.T) {
+	actual, _ := New(tokenizer.NewDefault(), NGramFilter(3, 3)).Analyze("ingest")
+
+	assert.Equal(t, []string{"ing", "nge", "ges", "est"}, values(actual))
+	assert.Equal(t, []int{0, 0, 0, 0}, positions(actual))
+	assert.Equal(t, 3, actual[3].Start)
+}
+
+func TestNGramFilterWords(t *testing.T) {
+	// Tokens holding a space are split into n-grams word by word
+	actual, _ := New(tokenizer.NewDefaultWithSeparators(","), NGramFilter(2, 3)).Analyze("foo wo, bar")
+
+	assert.Equal(t, []string{"fo", "foo", "oo", "wo", "ba", "bar", "ar"}, values(actual))
+	assert.Equal(t, 4, actual[3].Start)
+	assert.Equal(t, 6, actual[3].End)
+
+	actual, _ = New(tokenizer.NewDefaultWithSeparators(","), EdgeNGramFilter(1, 2)).Analyze("foo wo")
+	assert.Equal(t, []string{"f", "fo", "w", "wo"}, values(actual))
+}
+
+func TestPrefixAndInfixFields(t *testing.T) {
+	m := &Mapping{
+		DefaultAnalyzer: "simple",
+		Fields:          []Field{{Name: "body", Analyzer: "simple"}, PrefixField("body"), InfixField("body")},
+	}
+
+	fields, err := m.Analyze("body", "Reingestion of kubernetes")
+	assert.Nil(t, err)
+	assert.Contains(t, values(fields["body.prefix"]), "kube")
+	assert.Contains(t, values(fields["body.infix"]), "nge")
+
+	query, _ := m.AnalyzeQuery("body.prefix", "Kube")
+	assert.Equal(t, []string{"kube"}, values(query))
+
+	query, _ = m.AnalyzeQuery("body.infix", "ingest")
+	assert.Equal(t, []string{"ing", "nge", "ges", "est"}, values(query))
+	assert.Equal(t, []int{0, 1, 2, 3}, positions(query))
+}
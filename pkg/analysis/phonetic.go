@@ -0,0 +1,68 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	"mrshanahan.com/notes-indexer/pkg/phonetic"
+	"mrshanahan.com/notes-indexer/pkg/tokenizer"
+)
+
+const (
+	PHONETIC_SOUNDEX          string = "soundex"
+	PHONETIC_METAPHONE        string = "metaphone"
+	PHONETIC_DOUBLE_METAPHONE string = "double_metaphone"
+	PHONETIC_NYSIIS           string = "nysiis"
+)
+
+var PhoneticEncodings []string = []string{PHONETIC_SOUNDEX, PHONETIC_METAPHONE, PHONETIC_DOUBLE_METAPHONE, PHONETIC_NYSIIS}
+
+// PhoneticFilter replaces each token with its phonetic code, so that
+// sound-alikes like "Shanahan" and "Shannahan" become the same term. Tokens
+// without a code (e.g. numbers) are dropped. For Double Metaphone the
+// alternate code is emitted at the same position as the primary one, when
+// the two differ.
+func PhoneticFilter(encoding string) (Filter, error) {
+	switch encoding = strings.ToLower(encoding); encoding {
+	case PHONETIC_SOUNDEX:
+		return Named(encoding, TermFilter(phonetic.Soundex)), nil
+	case PHONETIC_METAPHONE:
+		return Named(encoding, TermFilter(phonetic.Metaphone)), nil
+	case PHONETIC_NYSIIS:
+		return Named(encoding, TermFilter(phonetic.NYSIIS)), nil
+	case PHONETIC_DOUBLE_METAPHONE:
+		return Named(encoding, FilterFunc(doubleMetaphoneFilter)), nil
+	default:
+		return nil, fmt.Errorf("unknown phonetic encoding: %s", encoding)
+	}
+}
+
+func doubleMetaphoneFilter(tokens []Token) []Token {
+	filtered := make([]Token, 0, len(tokens))
+	for _, t := range tokens {
+		if t.Type != tokenizer.TOKEN_TYPE_GENERIC {
+			filtered = append(filtered, t)
+			continue
+		}
+		primary, alternate := phonetic.DoubleMetaphone(t.Value)
+		if primary != "" {
+			p := t
+			p.Value = primary
+			filtered = append(filtered, p)
+		}
+		if alternate != "" && alternate != primary {
+			a := t
+			a.Value = alternate
+			filtered = append(filtered, a)
+		}
+	}
+	return filtered
+}
+
+func mustPhoneticFilter(encoding string) Filter {
+	f, err := PhoneticFilter(encoding)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
@@ -0,0 +1,42 @@
+package analysis
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mrshanahan.com/notes-indexer/pkg/tokenizer"
+)
+
+func TestPhoneticFilters(t *testing.T) {
+	tests := []struct {
+		encoding string
+		expected []string
+	}{
+		{PHONETIC_SOUNDEX, []string{"S550", "S550", "N320"}},
+		{PHONETIC_METAPHONE, []string{"XNHN", "XNHN", "NTS"}},
+		{PHONETIC_NYSIIS, []string{"SANAHAN", "SANAHAN", "NAT"}},
+		{PHONETIC_DOUBLE_METAPHONE, []string{"XNHN", "XNHN", "NTS"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.encoding, func(t *testing.T) {
+			f, err := PhoneticFilter(test.encoding)
+			assert.Nil(t, err)
+
+			actual, _ := New(tokenizer.NewDefault(), f).Analyze("Shanahan Shannahan notes")
+			assert.Equal(t, test.expected, values(actual))
+		})
+	}
+
+	_, err := PhoneticFilter("klingon")
+	assert.NotNil(t, err)
+}
+
+func TestDoubleMetaphoneAlternates(t *testing.T) {
+	f, _ := PhoneticFilter(PHONETIC_DOUBLE_METAPHONE)
+
+	actual, _ := New(tokenizer.NewDefault(), f).Analyze("Smith 2024 met")
+
+	assert.Equal(t, []string{"SM0", "XMT", "MT"}, values(actual))
+	assert.Equal(t, []int{0, 0, 2}, positions(actual))
+}
@@ -0,0 +1,57 @@
+package analysis
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"mrshanahan.com/notes-indexer/pkg/tokenizer"
+)
+
+var (
+	analyzersMu sync.RWMutex
+	analyzers   map[string]*Analyzer = map[string]*Analyzer{}
+)
+
+func init() {
+	Register("simple", New(tokenizer.NewDefault()))
+	Register("stem", New(tokenizer.NewDefault(), StemFilter))
+	Register("lemma", New(tokenizer.NewDefault(), LemmaFilter))
+	Register("english", New(tokenizer.NewDefault(), mustStopFilter("english", false), StemFilter))
+	Register("phonetic", New(tokenizer.NewDefault(), mustStopFilter("english", false), mustPhoneticFilter(PHONETIC_DOUBLE_METAPHONE)))
+	for _, encoding := range PhoneticEncodings {
+		Register(encoding, New(tokenizer.NewDefault(), mustPhoneticFilter(encoding)))
+	}
+	Register("ngram", New(tokenizer.NewNGram(DefaultInfixGram, DefaultInfixGram)))
+	Register("edge_ngram", New(tokenizer.NewDefault(), EdgeNGramFilter(DefaultPrefixMinGram, DefaultPrefixMaxGram)))
+}
+
+// Register makes an analyzer available by name, replacing any analyzer
+// previously registered under the same name.
+func Register(name string, a *Analyzer) {
+	analyzersMu.Lock()
+	defer analyzersMu.Unlock()
+	analyzers[strings.ToLower(name)] = a
+}
+
+func Get(name string) (*Analyzer, error) {
+	analyzersMu.RLock()
+	defer analyzersMu.RUnlock()
+	a, ok := analyzers[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown analyzer: %s", name)
+	}
+	return a, nil
+}
+
+func Names() []string {
+	analyzersMu.RLock()
+	defer analyzersMu.RUnlock()
+	names := make([]string, 0, len(analyzers))
+	for n := range analyzers {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,105 @@
+package analysis
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"mrshanahan.com/notes-indexer/pkg/tokenizer"
+)
+
+//go:embed stopwords/*.txt
+var stopwordFiles embed.FS
+
+// StopFilter removes stopwords from a token stream. Removed tokens leave a
+// gap in the positions of the tokens that follow them, so a phrase like
+// "state of the art" still matches with "state" and "art" three positions
+// apart.
+type StopFilter struct {
+	Words map[string]bool
+
+	// KeepQuoted keeps stopwords that appear between double quotes in the
+	// analyzed text, for when the exact wording of a phrase matters.
+	KeepQuoted bool
+}
+
+func NewStopFilter(words []string, keepQuoted bool) *StopFilter {
+	ws := make(map[string]bool, len(words))
+	for _, w := range words {
+		ws[strings.ToLower(w)] = true
+	}
+	return &StopFilter{ws, keepQuoted}
+}
+
+func (f *StopFilter) Filter(tokens []Token) []Token {
+	filtered := make([]Token, 0, len(tokens))
+	for _, t := range tokens {
+		if t.Type == tokenizer.TOKEN_TYPE_GENERIC && f.Words[t.Value] && !(f.KeepQuoted && t.Quoted) {
+			continue
+		}
+		filtered = append(filtered, t)
+	}
+	return filtered
+}
+
+// Stopwords returns the bundled stopword list for a language, e.g. "english".
+func Stopwords(language string) ([]string, error) {
+	f, err := stopwordFiles.Open(path.Join("stopwords", strings.ToLower(language)+".txt"))
+	if err != nil {
+		return nil, fmt.Errorf("no stopword list for language: %s", language)
+	}
+	defer f.Close()
+	return readStopwords(f)
+}
+
+func StopwordLanguages() []string {
+	entries, _ := stopwordFiles.ReadDir("stopwords")
+	languages := make([]string, 0, len(entries))
+	for _, e := range entries {
+		languages = append(languages, strings.TrimSuffix(e.Name(), ".txt"))
+	}
+	sort.Strings(languages)
+	return languages
+}
+
+// LoadStopwords reads a custom stopword list: one word per line, with '#'
+// starting a comment. The Snowball '|' comment style is accepted as well.
+func LoadStopwords(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readStopwords(f)
+}
+
+func readStopwords(r io.Reader) ([]string, error) {
+	words := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#|"); i >= 0 {
+			line = line[:i]
+		}
+		for _, w := range strings.Fields(line) {
+			words = append(words, w)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return words, nil
+}
+
+func mustStopFilter(language string, keepQuoted bool) *StopFilter {
+	words, err := Stopwords(language)
+	if err != nil {
+		panic(err)
+	}
+	return NewStopFilter(words, keepQuoted)
+}
@@ -0,0 +1,76 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mrshanahan.com/notes-indexer/pkg/tokenizer"
+)
+
+func TestStopFilterLeavesPositionGaps(t *testing.T) {
+	a := New(tokenizer.NewDefault(), mustStopFilter("english", false))
+
+	actual, err := a.Analyze("The state of the art")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []Token{
+		{Value: "state", Type: tokenizer.TOKEN_TYPE_GENERIC, Position: 1, PositionLength: 1, Start: 4, End: 9},
+		{Value: "art", Type: tokenizer.TOKEN_TYPE_GENERIC, Position: 4, PositionLength: 1, Start: 17, End: 20},
+	}, actual)
+}
+
+func TestStopFilterKeepQuoted(t *testing.T) {
+	a := New(tokenizer.NewDefault(), mustStopFilter("english", true))
+
+	actual, err := a.Analyze(`The best of "the state of the art" and the rest`)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"best", "the", "state", "of", "the", "art", "rest"}, values(actual))
+	assert.Equal(t, []int{1, 3, 4, 5, 6, 7, 10}, positions(actual))
+}
+
+func TestStopFilterUnterminatedQuote(t *testing.T) {
+	a := New(tokenizer.NewDefault(), mustStopFilter("english", true))
+
+	actual, _ := a.Analyze(`the "state of the art`)
+
+	assert.Equal(t, []string{"state", "art"}, values(actual))
+}
+
+func TestBundledStopwords(t *testing.T) {
+	for _, lang := range []string{"english", "french", "german", "spanish", "italian", "portuguese", "dutch"} {
+		words, err := Stopwords(lang)
+		assert.Nil(t, err, lang)
+		assert.NotEmpty(t, words, lang)
+	}
+
+	_, err := Stopwords("klingon")
+	assert.NotNil(t, err)
+}
+
+func TestLoadStopwords(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "custom.txt")
+	contents := "# Custom list\nfoo\nbar  | snowball-style comment\n\n  baz\n"
+	if err := os.WriteFile(filename, []byte(contents), 0644); err != nil {
+		t.Fatalf("failed to write stopword file: %s", err)
+	}
+
+	words, err := LoadStopwords(filename)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"foo", "bar", "baz"}, words)
+
+	a := New(tokenizer.NewDefault(), NewStopFilter(words, false))
+	actual, _ := a.Analyze("foo fighters and bar tabs")
+	assert.Equal(t, []string{"fighters", "and", "tabs"}, values(actual))
+}
+
+func positions(tokens []Token) []int {
+	ps := []int{}
+	for _, t := range tokens {
+		ps = append(ps, t.Position)
+	}
+	return ps
+}
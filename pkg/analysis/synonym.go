@@ -0,0 +1,413 @@
+package analysis
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"mrshanahan.com/notes-indexer/pkg/tokenizer"
+)
+
+const (
+	SYNONYM_FORMAT_SOLR    string = "solr"
+	SYNONYM_FORMAT_WORDNET string = "wordnet"
+
+	// Caps the number of paths Paths will enumerate through a token graph, so
+	// a query with many overlapping synonyms can't blow up.
+	maxGraphPaths int = 64
+)
+
+// SynonymMap maps sequences of words to the sequences they should be
+// expanded to. Multi-word entries are stored with their words joined by a
+// single space.
+type SynonymMap struct {
+	rules  map[string][][]string
+	maxLen int
+}
+
+func NewSynonymMap() *SynonymMap {
+	return &SynonymMap{rules: map[string][][]string{}}
+}
+
+// Add registers a rule mapping input to each of outputs. If input should also
+// be kept in the stream it has to be included in outputs. Adding a rule for an
+// input that already has one merges the outputs.
+func (m *SynonymMap) Add(input []string, outputs [][]string) {
+	key := strings.Join(input, " ")
+	existing := m.rules[key]
+	for _, o := range outputs {
+		if !containsWords(existing, o) {
+			existing = append(existing, o)
+		}
+	}
+	m.rules[key] = existing
+	if len(input) > m.maxLen {
+		m.maxLen = len(input)
+	}
+}
+
+func (m *SynonymMap) Len() int { return len(m.rules) }
+
+// Rules returns every rule as a one-way Solr rule, e.g. "pr => pr, pull
+// request", sorted. Parsing them with ParseSolrSynonyms gives back the same
+// map, however it was made.
+func (m *SynonymMap) Rules() []string {
+	rules := make([]string, 0, len(m.rules))
+	for input, outputs := range m.rules {
+		alts := make([]string, len(outputs))
+		for i, o := range outputs {
+			alts[i] = strings.Join(o, " ")
+		}
+		rules = append(rules, input+" => "+strings.Join(alts, ", "))
+	}
+	sort.Strings(rules)
+	return rules
+}
+
+// ParseSolrSynonyms reads rules in the Solr synonyms.txt format:
+//
+//	# comment
+//	k8s, kubernetes          (equivalent terms)
+//	pr => pull request       (one-way mapping)
+//
+// With expand set, each equivalent term maps to every term in its line;
+// otherwise they all map to the first term. One-way mappings replace the
+// input, as in Solr.
+func ParseSolrSynonyms(r io.Reader, expand bool) (*SynonymMap, error) {
+	m := NewSynonymMap()
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if lhs, rhs, ok := strings.Cut(line, "=>"); ok {
+			inputs, outputs := splitSynonyms(lhs), splitSynonyms(rhs)
+			if len(inputs) == 0 || len(outputs) == 0 {
+				return nil, fmt.Errorf("invalid synonym rule on line %d: %s", lineno, line)
+			}
+			for _, in := range inputs {
+				m.Add(in, outputs)
+			}
+		} else {
+			addEquivalent(m, splitSynonyms(line), expand)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ParseWordNetSynonyms reads the s(...) facts of a WordNet prolog file
+// (wn_s.pl), treating all words of a synset as equivalent.
+//
+//	s(100001740,1,'entity',n,1,11).
+func ParseWordNetSynonyms(r io.Reader, expand bool) (*SynonymMap, error) {
+	synsets := map[string][][]string{}
+	order := []string{}
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "s(") {
+			continue
+		}
+		id, word, err := parseWordNetFact(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid wordnet fact on line %d: %s", lineno, err)
+		}
+		if _, ok := synsets[id]; !ok {
+			order = append(order, id)
+		}
+		synsets[id] = append(synsets[id], strings.Fields(strings.ToLower(word)))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	m := NewSynonymMap()
+	for _, id := range order {
+		addEquivalent(m, synsets[id], expand)
+	}
+	return m, nil
+}
+
+func LoadSynonyms(filename, format string, expand bool) (*SynonymMap, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(format) {
+	case SYNONYM_FORMAT_SOLR, "":
+		return ParseSolrSynonyms(f, expand)
+	case SYNONYM_FORMAT_WORDNET:
+		return ParseWordNetSynonyms(f, expand)
+	default:
+		return nil, fmt.Errorf("unknown synonym format: %s", format)
+	}
+}
+
+func addEquivalent(m *SynonymMap, group [][]string, expand bool) {
+	if len(group) < 2 {
+		return
+	}
+	for _, in := range group {
+		if expand {
+			m.Add(in, group)
+		} else {
+			m.Add(in, group[:1])
+		}
+	}
+}
+
+func splitSynonyms(s string) [][]string {
+	entries := [][]string{}
+	for _, e := range strings.Split(s, ",") {
+		words := strings.Fields(strings.ToLower(e))
+		if len(words) > 0 {
+			entries = append(entries, words)
+		}
+	}
+	return entries
+}
+
+// Parses the synset id & word out of: s(100001740,1,'entity',n,1,11).
+func parseWordNetFact(line string) (string, string, error) {
+	body := strings.TrimSuffix(strings.TrimPrefix(line, "s("), ").")
+	id, rest, ok := strings.Cut(body, ",")
+	if !ok {
+		return "", "", fmt.Errorf("missing synset id")
+	}
+	start := strings.Index(rest, "'")
+	if start < 0 {
+		return "", "", fmt.Errorf("missing word")
+	}
+	var word strings.Builder
+	for i := start + 1; i < len(rest); i++ {
+		if rest[i] == '\'' {
+			// Quotes are escaped by doubling them, e.g. 'hell''s kitchen'
+			if i+1 < len(rest) && rest[i+1] == '\'' {
+				word.WriteByte('\'')
+				i++
+				continue
+			}
+			return id, strings.ReplaceAll(word.String(), "_", " "), nil
+		}
+		word.WriteByte(rest[i])
+	}
+	return "", "", fmt.Errorf("unterminated word")
+}
+
+// SynonymFilter expands matching (possibly multi-word) sequences into all of
+// their synonyms. The result is a token graph: every alternative starts at
+// the position of the matched input, and the last token of each alternative
+// spans however many positions it takes to end where the longest alternative
+// ends. Tokens after a match are shifted to make room, so for the rule
+// "pr => pr, pull request":
+//
+//	pr merged  ->  pr(0, len 2) pull(0) request(1) merged(2)
+//
+// This should run before any stemming, since rules are matched against the
+// token values as they come in.
+type SynonymFilter struct {
+	Synonyms *SynonymMap
+}
+
+func NewSynonymFilter(m *SynonymMap) *SynonymFilter {
+	return &SynonymFilter{m}
+}
+
+func (f *SynonymFilter) Filter(tokens []Token) []Token {
+	out := make([]Token, 0, len(tokens))
+	shift := 0
+	for i := 0; i < len(tokens); {
+		n, alts := f.match(tokens, i)
+		if n == 0 {
+			t := tokens[i]
+			t.Position += shift
+			out = append(out, t)
+			i++
+			continue
+		}
+
+		span := 0
+		for _, alt := range alts {
+			if len(alt) > span {
+				span = len(alt)
+			}
+		}
+
+		input := tokens[i : i+n]
+		base := input[0].Position + shift
+		for _, alt := range alts {
+			if wordsEqual(alt, tokenValues(input)) {
+				// The input itself - keep the original tokens & their offsets
+				for j, t := range input {
+					t.Position = base + j
+					t.PositionLength = lastSpan(j, n, span)
+					out = append(out, t)
+				}
+				continue
+			}
+			for j, w := range alt {
+				out = append(out, Token{
+					Value:          w,
+					Type:           tokenizer.TOKEN_TYPE_GENERIC,
+					Position:       base + j,
+					PositionLength: lastSpan(j, len(alt), span),
+					Start:          input[0].Start,
+					End:            input[n-1].End,
+					Quoted:         input[0].Quoted,
+				})
+			}
+		}
+		shift += span - n
+		i += n
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Position < out[j].Position })
+	return out
+}
+
+// WithSynonyms returns a copy of a that expands synonyms from m, with the
+// filter put where it should go: after lowercasing and stopwords, and before
+// anything (e.g. stemming) that changes the words the rules are matched
+// against.
+func (a *Analyzer) WithSynonyms(m *SynonymMap) *Analyzer {
+	filters := []Filter{}
+	added := false
+	for _, f := range a.Filters {
+		if name := FilterName(f); !added && name != "lowercase" && name != "stop" {
+			filters = append(filters, NewSynonymFilter(m))
+			added = true
+		}
+		filters = append(filters, f)
+	}
+	if !added {
+		filters = append(filters, NewSynonymFilter(m))
+	}
+	return New(a.Tokenizer, filters...)
+}
+
+// Finds the longest rule matching the tokens starting at i. Only runs of
+// generic tokens at consecutive positions can match.
+func (f *SynonymFilter) match(tokens []Token, i int) (int, [][]string) {
+	m := f.Synonyms
+	for n := m.maxLen; n > 0; n-- {
+		if i+n > len(tokens) || !isRun(tokens[i:i+n]) {
+			continue
+		}
+		if alts, ok := m.rules[strings.Join(tokenValues(tokens[i:i+n]), " ")]; ok {
+			return n, alts
+		}
+	}
+	return 0, nil
+}
+
+func isRun(tokens []Token) bool {
+	for i, t := range tokens {
+		if t.Type != tokenizer.TOKEN_TYPE_GENERIC {
+			return false
+		}
+		if i > 0 && t.Position != tokens[i-1].Position+1 {
+			return false
+		}
+	}
+	return true
+}
+
+func lastSpan(j, n, span int) int {
+	if j == n-1 {
+		return span - n + 1
+	}
+	return 1
+}
+
+// Paths enumerates the linear token sequences through a token graph, e.g. to
+// turn a query containing synonyms into a set of alternative phrases. Tokens
+// keep their original positions, so gaps left by removed tokens are preserved.
+func Paths(tokens []Token) [][]Token {
+	if len(tokens) == 0 {
+		return [][]Token{}
+	}
+
+	starts := map[int][]Token{}
+	positions := []int{}
+	for _, t := range tokens {
+		if _, ok := starts[t.Position]; !ok {
+			positions = append(positions, t.Position)
+		}
+		starts[t.Position] = append(starts[t.Position], t)
+	}
+	sort.Ints(positions)
+
+	paths := [][]Token{}
+	var walk func(pos int, path []Token)
+	walk = func(pos int, path []Token) {
+		if len(paths) >= maxGraphPaths {
+			return
+		}
+		// Skip over any gap to the next position that has tokens
+		next := -1
+		for _, p := range positions {
+			if p >= pos {
+				next = p
+				break
+			}
+		}
+		if next < 0 {
+			paths = append(paths, append([]Token{}, path...))
+			return
+		}
+		for _, t := range starts[next] {
+			length := t.PositionLength
+			if length < 1 {
+				length = 1
+			}
+			walk(next+length, append(path, t))
+		}
+	}
+	walk(positions[0], []Token{})
+	return paths
+}
+
+func tokenValues(tokens []Token) []string {
+	vs := make([]string, len(tokens))
+	for i, t := range tokens {
+		vs[i] = t.Value
+	}
+	return vs
+}
+
+func wordsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func containsWords(entries [][]string, words []string) bool {
+	for _, e := range entries {
+		if wordsEqual(e, words) {
+			return true
+		}
+	}
+	return false
+}
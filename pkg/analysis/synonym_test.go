@@ -0,0 +1,188 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mrshanahan.com/notes-indexer/pkg/tokenizer"
+)
+
+const testSynonyms string = `
+# Aliases used around the team
+k8s, kubernetes
+db, database
+pr => pr, pull request
+psql => postgres
+`
+
+func TestParseSolrSynonyms(t *testing.T) {
+	m, err := ParseSolrSynonyms(strings.NewReader(testSynonyms), true)
+
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"k8s"}, {"kubernetes"}}, m.rules["k8s"])
+	assert.Equal(t, [][]string{{"k8s"}, {"kubernetes"}}, m.rules["kubernetes"])
+	assert.Equal(t, [][]string{{"pr"}, {"pull", "request"}}, m.rules["pr"])
+	assert.Equal(t, [][]string{{"postgres"}}, m.rules["psql"])
+	assert.NotContains(t, m.rules, "pull request")
+}
+
+func TestParseSolrSynonymsWithoutExpand(t *testing.T) {
+	m, err := ParseSolrSynonyms(strings.NewReader("k8s, kubernetes, kube"), false)
+
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"k8s"}}, m.rules["kubernetes"])
+	assert.Equal(t, [][]string{{"k8s"}}, m.rules["kube"])
+}
+
+func TestParseSolrSynonymsInvalid(t *testing.T) {
+	_, err := ParseSolrSynonyms(strings.NewReader("foo =>"), true)
+	assert.NotNil(t, err)
+}
+
+func TestParseWordNetSynonyms(t *testing.T) {
+	wn := `s(100001740,1,'entity',n,1,11).
+s(102084071,1,'dog',n,1,42).
+s(102084071,2,'domestic_dog',n,1,0).
+s(102084071,3,'canis familiaris',n,1,0).
+s(103000000,1,'hell''s kitchen',n,1,0).
+`
+	m, err := ParseWordNetSynonyms(strings.NewReader(wn), true)
+
+	assert.Nil(t, err)
+	assert.Equal(t, [][]string{{"dog"}, {"domestic", "dog"}, {"canis", "familiaris"}}, m.rules["domestic dog"])
+	assert.NotContains(t, m.rules, "entity")
+	assert.NotContains(t, m.rules, "hell's kitchen")
+}
+
+func TestSynonymFilterSingleWord(t *testing.T) {
+	a := synonymAnalyzer(t)
+
+	actual, _ := a.Analyze("k8s cluster")
+
+	assert.Equal(t, []string{"k8s", "kubernetes", "cluster"}, values(actual))
+	assert.Equal(t, []int{0, 0, 1}, positions(actual))
+	assert.Equal(t, []int{1, 1, 1}, positionLengths(actual))
+}
+
+func TestSynonymFilterSingleToMultiWord(t *testing.T) {
+	a := synonymAnalyzer(t)
+
+	actual, _ := a.Analyze("PR merged today")
+
+	assert.Equal(t, []Token{
+		{Value: "pr", Type: tokenizer.TOKEN_TYPE_GENERIC, Position: 0, PositionLength: 2, Start: 0, End: 2},
+		{Value: "pull", Type: tokenizer.TOKEN_TYPE_GENERIC, Position: 0, PositionLength: 1, Start: 0, End: 2},
+		{Value: "request", Type: tokenizer.TOKEN_TYPE_GENERIC, Position: 1, PositionLength: 1, Start: 0, End: 2},
+		{Value: "merged", Type: tokenizer.TOKEN_TYPE_GENERIC, Position: 2, PositionLength: 1, Start: 3, End: 9},
+		{Value: "today", Type: tokenizer.TOKEN_TYPE_GENERIC, Position: 3, PositionLength: 1, Start: 10, End: 15},
+	}, actual)
+}
+
+func TestSynonymFilterMultiToSingleWord(t *testing.T) {
+	m, _ := ParseSolrSynonyms(strings.NewReader("pull request, pr"), true)
+	a := New(tokenizer.NewDefault(), NewSynonymFilter(m))
+
+	actual, _ := a.Analyze("my pull request merged")
+
+	assert.Equal(t, []string{"my", "pull", "pr", "request", "merged"}, values(actual))
+	assert.Equal(t, []int{0, 1, 1, 2, 3}, positions(actual))
+	assert.Equal(t, []int{1, 1, 2, 1, 1}, positionLengths(actual))
+}
+
+func TestSynonymFilterOneWayReplaces(t *testing.T) {
+	a := synonymAnalyzer(t)
+
+	actual, _ := a.Analyze("psql shell")
+
+	assert.Equal(t, []string{"postgres", "shell"}, values(actual))
+	assert.Equal(t, []int{0, 1}, positions(actual))
+}
+
+func TestSynonymFilterAfterStopwords(t *testing.T) {
+	m, _ := ParseSolrSynonyms(strings.NewReader("db, database"), true)
+	a := New(tokenizer.NewDefault(), mustStopFilter("english", false), NewSynonymFilter(m))
+
+	actual, _ := a.Analyze("the db of record")
+
+	assert.Equal(t, []string{"db", "database", "record"}, values(actual))
+	assert.Equal(t, []int{1, 1, 3}, positions(actual))
+}
+
+func TestPaths(t *testing.T) {
+	a := synonymAnalyzer(t)
+	tokens, _ := a.Analyze("PR merged")
+
+	paths := Paths(tokens)
+
+	actual := [][]string{}
+	for _, p := range paths {
+		actual = append(actual, values(p))
+	}
+	assert.Equal(t, [][]string{{"pr", "merged"}, {"pull", "request", "merged"}}, actual)
+	assert.Equal(t, []int{0, 2}, positions(paths[0]))
+	assert.Equal(t, []int{0, 1, 2}, positions(paths[1]))
+}
+
+func TestPathsAcrossGaps(t *testing.T) {
+	a := New(tokenizer.NewDefault(), mustStopFilter("english", false))
+	tokens, _ := a.Analyze("state of the art")
+
+	paths := Paths(tokens)
+
+	assert.Len(t, paths, 1)
+	assert.Equal(t, []int{0, 3}, positions(paths[0]))
+}
+
+func TestSynonymMapRules(t *testing.T) {
+	m, err := ParseSolrSynonyms(strings.NewReader("k8s, kubernetes\npr => pull request\n"), true)
+	assert.Nil(t, err)
+
+	rules := m.Rules()
+	assert.Equal(t, []string{"k8s => k8s, kubernetes", "kubernetes => k8s, kubernetes", "pr => pull request"}, rules)
+	again, err := ParseSolrSynonyms(strings.NewReader(strings.Join(rules, "\n")), false)
+	assert.Nil(t, err)
+	assert.Equal(t, m, again)
+}
+
+func TestAnalyzerWithSynonyms(t *testing.T) {
+	m, _ := ParseSolrSynonyms(strings.NewReader("running, jogging"), true)
+	a, _ := Get("english")
+
+	// Before stemming, so the rules match the words as written
+	actual, err := a.WithSynonyms(m).Analyze("The running dog")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"run", "jog", "dog"}, values(actual))
+}
+
+func TestLoadSynonyms(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "synonyms.txt")
+	if err := os.WriteFile(filename, []byte(testSynonyms), 0644); err != nil {
+		t.Fatalf("failed to write synonym file: %s", err)
+	}
+
+	m, err := LoadSynonyms(filename, SYNONYM_FORMAT_SOLR, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, m.Len())
+
+	_, err = LoadSynonyms(filename, "csv", true)
+	assert.NotNil(t, err)
+}
+
+func synonymAnalyzer(t *testing.T) *Analyzer {
+	m, err := ParseSolrSynonyms(strings.NewReader(testSynonyms), true)
+	if err != nil {
+		t.Fatalf("failed to parse synonyms: %s", err)
+	}
+	return New(tokenizer.NewDefault(), NewSynonymFilter(m))
+}
+
+func positionLengths(tokens []Token) []int {
+	ls := []int{}
+	for _, t := range tokens {
+		ls = append(ls, t.PositionLength)
+	}
+	return ls
+}
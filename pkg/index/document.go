@@ -0,0 +1,242 @@
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"html"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"mrshanahan.com/notes-indexer/pkg/markdown"
+)
+
+const (
+	DOC_TYPE_MARKDOWN string = "markdown"
+	DOC_TYPE_PLAIN    string = "plain"
+	DOC_TYPE_HTML     string = "html"
+)
+
+// Source fields every document has, on top of those its text is split into
+// (see markdown.TextSegments). Plain text & HTML only have markdown.FIELD_BODY.
+const (
+	FIELD_TITLE string = "title"
+	FIELD_TAGS  string = "tags"
+)
+
+// Document is a note as it's stored in the index. Fields holds the text of
+// each of its source fields, which is what gets analyzed into terms; the rest
+// is kept as-is for showing in results.
+type Document struct {
+	// Unique within the index, e.g. the note's path relative to the
+	// directory being indexed
+	ID string `json:"id"`
+
+	Type    string    `json:"type"`
+	Title   string    `json:"title"`
+	Tags    []string  `json:"tags"`
+	Links   []string  `json:"links"`
+	Hash    string    `json:"hash"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+
+	Fields map[string]string `json:"fields"`
+
+	// Where each source field's text came from in a markdown note, so a
+	// match can be pointed to in the file. See SourceSpan.
+	Sources map[string][]SourceRun `json:"sources,omitempty"`
+
+	// Problems with the note that didn't stop it being indexed, like front
+	// matter that couldn't be decoded
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// SourceRun maps bytes Start to End of a field's text back to Span in the
+// note. An exact run is the same bytes as the note has at Span, so any part
+// of it maps back too.
+type SourceRun struct {
+	Start int             `json:"start"`
+	End   int             `json:"end"`
+	Span  markdown.MDSpan `json:"span"`
+	Exact bool            `json:"exact,omitempty"`
+}
+
+var docTypeExtensions map[string]string = map[string]string{
+	".md":       DOC_TYPE_MARKDOWN,
+	".markdown": DOC_TYPE_MARKDOWN,
+	".mdown":    DOC_TYPE_MARKDOWN,
+	".txt":      DOC_TYPE_PLAIN,
+	".text":     DOC_TYPE_PLAIN,
+	".html":     DOC_TYPE_HTML,
+	".htm":      DOC_TYPE_HTML,
+}
+
+// IndexableName reports whether a file could be indexed going by its name
+// alone: it has to have one of the known extensions, or none at all.
+func IndexableName(name string) bool {
+	ext := strings.ToLower(path.Ext(name))
+	_, ok := docTypeExtensions[ext]
+	return ok || ext == ""
+}
+
+// DetectType works out what kind of document a file is from its extension,
+// or if it has none by sniffing its content. It returns "" for anything that
+// can't be indexed.
+func DetectType(name string, content []byte) string {
+	if ext := strings.ToLower(path.Ext(name)); ext != "" {
+		return docTypeExtensions[ext]
+	}
+	switch strings.SplitN(http.DetectContentType(content), ";", 2)[0] {
+	case "text/html":
+		return DOC_TYPE_HTML
+	case "text/plain":
+		if utf8.Valid(content) {
+			return DOC_TYPE_PLAIN
+		}
+	}
+	return ""
+}
+
+// Hash returns the hash a document's content is compared by to tell whether
+// it has changed.
+func Hash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// NewDocument builds the document for content of the given type, extracting
+// its title & text. A document without a title of its own is titled after
+// the last element of id.
+//
+// A markdown note whose front matter can't be decoded is still indexed by its
+// markdown, without any metadata, and the error is kept in the document's
+// Warnings.
+func NewDocument(id, typ string, content []byte) (Document, error) {
+	doc := Document{
+		ID:     id,
+		Type:   typ,
+		Hash:   Hash(content),
+		Size:   int64(len(content)),
+		Tags:   []string{},
+		Links:  []string{},
+		Fields: map[string]string{},
+	}
+	text := string(content)
+	switch typ {
+	case DOC_TYPE_MARKDOWN:
+		tree, _, err := markdown.ParseDocumentDiagnostics(text)
+		if err != nil {
+			doc.Warnings = append(doc.Warnings, err.Error())
+		}
+		doc.Sources = map[string][]SourceRun{}
+		for _, seg := range markdown.TextSegments(tree) {
+			if doc.Fields[seg.Field] != "" {
+				doc.Fields[seg.Field] += "\n"
+			}
+			base := len(doc.Fields[seg.Field])
+			doc.Fields[seg.Field] += seg.Text
+			for _, r := range seg.SourceRuns() {
+				doc.Sources[seg.Field] = append(doc.Sources[seg.Field], SourceRun{base + r.Start, base + r.End, r.Span, r.Exact})
+			}
+		}
+		doc.Title = markdownTitle(tree)
+		doc.Tags = append(doc.Tags, tree.Tags()...)
+		for _, l := range tree.Links() {
+			doc.Links = append(doc.Links, l.Ref())
+		}
+	case DOC_TYPE_HTML:
+		doc.Title, doc.Fields[markdown.FIELD_BODY] = htmlText(text)
+	default:
+		doc.Fields[markdown.FIELD_BODY] = text
+	}
+
+	if doc.Title == "" {
+		base := path.Base(id)
+		doc.Title = strings.TrimSuffix(base, path.Ext(base))
+	}
+	doc.Fields[FIELD_TITLE] = doc.Title
+	if len(doc.Tags) > 0 {
+		doc.Fields[FIELD_TAGS] = strings.Join(doc.Tags, " ")
+	}
+	return doc, nil
+}
+
+// SourceSpan maps bytes start to end of one of the document's source fields
+// back to where they came from in the note. It returns false if they can't
+// be, as for anything but a markdown note's text.
+func (d Document) SourceSpan(field string, start, end int) (markdown.MDSpan, bool) {
+	text := d.Fields[field]
+	var span markdown.MDSpan
+	found := false
+	for _, r := range d.Sources[field] {
+		if r.End <= start || r.Start >= end || r.End > len(text) {
+			continue
+		}
+		part := r.Span
+		if r.Exact {
+			from, to := start, end
+			if from < r.Start {
+				from = r.Start
+			}
+			if to > r.End {
+				to = r.End
+			}
+			part.Start = advance(r.Span.Start, text[r.Start:from])
+			part.End = advance(r.Span.Start, text[r.Start:to])
+		}
+		if !found {
+			span = markdown.MDSpan{Start: part.Start}
+		}
+		span.End = part.End
+		found = true
+	}
+	return span, found
+}
+
+// The position after s, which starts at pos and has no line endings.
+func advance(pos markdown.MDPosition, s string) markdown.MDPosition {
+	pos.Offset += len(s)
+	pos.Column += utf8.RuneCountInString(s)
+	return pos
+}
+
+// The title from a note's front matter, or else its first header.
+func markdownTitle(tree markdown.MDSyntaxTree) string {
+	if tree.Meta != nil && tree.Meta.Title != "" {
+		return tree.Meta.Title
+	}
+	title := ""
+	tree.Walk(func(n markdown.MDSyntaxNode) bool {
+		if h, ok := n.(*markdown.MDHeader); ok && title == "" {
+			title = strings.TrimSpace(markdown.PlainText(h.Content))
+		}
+		return title == ""
+	})
+	return title
+}
+
+var (
+	htmlTitlePatt   *regexp.Regexp = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>|<h1[^>]*>(.*?)</h1>`)
+	htmlSkippedPatt *regexp.Regexp = regexp.MustCompile(`(?is)<(script|style|head)[^>]*>.*?</(script|style|head)>|<!--.*?-->`)
+	htmlBlockPatt   *regexp.Regexp = regexp.MustCompile(`(?i)<(br|p|div|li|tr|h[1-6]|pre|blockquote)[\s/>]`)
+	htmlTagPatt     *regexp.Regexp = regexp.MustCompile(`<[^>]*>`)
+	blankLinesPatt  *regexp.Regexp = regexp.MustCompile(`\n\s*\n\s*`)
+)
+
+// Extracts the title & text of an HTML page: tags are dropped, along with
+// anything that isn't shown like scripts, and entities are decoded.
+func htmlText(text string) (string, string) {
+	title := ""
+	if m := htmlTitlePatt.FindStringSubmatch(text); m != nil {
+		title = m[1] + m[2]
+		title = strings.Join(strings.Fields(html.UnescapeString(htmlTagPatt.ReplaceAllString(title, ""))), " ")
+	}
+	body := htmlSkippedPatt.ReplaceAllString(text, "")
+	body = htmlBlockPatt.ReplaceAllStringFunc(body, func(s string) string { return "\n" + s })
+	body = html.UnescapeString(htmlTagPatt.ReplaceAllString(body, ""))
+	body = blankLinesPatt.ReplaceAllString(strings.TrimSpace(body), "\n\n")
+	return title, body
+}
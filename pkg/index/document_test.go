@@ -0,0 +1,130 @@
+package index
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mrshanahan.com/notes-indexer/pkg/markdown"
+)
+
+func TestNewDocumentMarkdown(t *testing.T) {
+	content := "# Weekly review\n\nPlanning for #work, see [[Board#Q3|the board]].\n\n- ship the indexer\n"
+
+	doc, err := NewDocument("notes/review.md", DOC_TYPE_MARKDOWN, []byte(content))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "Weekly review", doc.Title)
+	assert.Equal(t, []string{"work"}, doc.Tags)
+	assert.Equal(t, []string{"Board#Q3"}, doc.Links)
+	assert.Equal(t, Hash([]byte(content)), doc.Hash)
+	assert.Equal(t, int64(len(content)), doc.Size)
+	assert.Equal(t, "Weekly review", doc.Fields[FIELD_TITLE])
+	assert.Equal(t, "work", doc.Fields[FIELD_TAGS])
+	assert.Equal(t, "ship the indexer", doc.Fields[markdown.FIELD_LIST])
+	assert.Contains(t, doc.Fields[markdown.FIELD_BODY], "Planning for")
+}
+
+func TestDocumentSourceSpan(t *testing.T) {
+	content := "---\ntitle: Spans\n---\n# Notes\r\n\r\nSome **bold**\ttext\r\nand more.\r\n\r\nA second paragraph.\r\n"
+
+	doc, err := NewDocument("a.md", DOC_TYPE_MARKDOWN, []byte(content))
+	assert.Nil(t, err)
+
+	source := func(field, text string) (string, int, int) {
+		start := strings.Index(doc.Fields[field], text)
+		span, ok := doc.SourceSpan(field, start, start+len(text))
+		assert.True(t, ok, text)
+		return content[span.Start.Offset:span.End.Offset], span.Start.Line, span.Start.Column
+	}
+	for _, test := range []struct {
+		field, text, source string
+		line, column        int
+	}{
+		{markdown.FIELD_HEADER, "Notes", "Notes", 4, 3},
+		{markdown.FIELD_BODY, "bold", "bold", 6, 8},
+		{markdown.FIELD_BODY, "text", "text", 6, 15},
+		{markdown.FIELD_BODY, "more", "more", 7, 5},
+		// Spanning formatting & line endings
+		{markdown.FIELD_BODY, "Some bold", "Some **bold", 6, 1},
+		// In a segment after the first
+		{markdown.FIELD_BODY, "second", "second", 9, 3},
+	} {
+		actual, line, column := source(test.field, test.text)
+		assert.Equal(t, test.source, actual)
+		assert.Equal(t, test.line, line, test.text)
+		assert.Equal(t, test.column, column, test.text)
+	}
+
+	// The title came from the front matter, and isn't mapped
+	_, ok := doc.SourceSpan(FIELD_TITLE, 0, 5)
+	assert.False(t, ok)
+
+	plain, _ := NewDocument("a.txt", DOC_TYPE_PLAIN, []byte("plain text"))
+	_, ok = plain.SourceSpan(markdown.FIELD_BODY, 0, 5)
+	assert.False(t, ok)
+}
+
+func TestNewDocumentFrontMatterTitle(t *testing.T) {
+	content := "---\ntitle: From the front\n---\n# Not this\n"
+
+	doc, err := NewDocument("a.md", DOC_TYPE_MARKDOWN, []byte(content))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "From the front", doc.Title)
+}
+
+func TestNewDocumentInvalidFrontMatter(t *testing.T) {
+	content := "---\ntitle: Notes: week 3\n---\n# Week 3\n\nShip the indexer\n"
+
+	doc, err := NewDocument("a.md", DOC_TYPE_MARKDOWN, []byte(content))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "Week 3", doc.Title)
+	assert.Equal(t, "Ship the indexer", doc.Fields[markdown.FIELD_BODY])
+	if assert.Len(t, doc.Warnings, 1) {
+		assert.Contains(t, doc.Warnings[0], "invalid yaml front matter")
+	}
+}
+
+func TestNewDocumentTitleFromID(t *testing.T) {
+	doc, err := NewDocument("dir/shopping list.txt", DOC_TYPE_PLAIN, []byte("eggs\nmilk\n"))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "shopping list", doc.Title)
+	assert.Equal(t, "eggs\nmilk\n", doc.Fields[markdown.FIELD_BODY])
+	assert.NotContains(t, doc.Fields, FIELD_TAGS)
+}
+
+func TestNewDocumentHTML(t *testing.T) {
+	content := `<html><head><title>Trip &amp; plans</title><style>p { color: red }</style></head>
+<body><h1>Itinerary</h1><p>Fly to <b>Lisbon</b>.</p><script>alert(1)</script><p>Then rest.</p></body></html>`
+
+	doc, err := NewDocument("trip.html", DOC_TYPE_HTML, []byte(content))
+
+	assert.Nil(t, err)
+	assert.Equal(t, "Trip & plans", doc.Title)
+	assert.Equal(t, "Itinerary\nFly to Lisbon.\nThen rest.", doc.Fields[markdown.FIELD_BODY])
+}
+
+func TestDetectType(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"notes.md", "", DOC_TYPE_MARKDOWN},
+		{"NOTES.MARKDOWN", "", DOC_TYPE_MARKDOWN},
+		{"todo.txt", "", DOC_TYPE_PLAIN},
+		{"page.htm", "", DOC_TYPE_HTML},
+		{"image.png", "", ""},
+		{"README", "just some text", DOC_TYPE_PLAIN},
+		{"index", "<!DOCTYPE html><html></html>", DOC_TYPE_HTML},
+		{"binary", "\x00\x01\x02\x03", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, DetectType(test.name, []byte(test.content)))
+		})
+	}
+}
@@ -0,0 +1,509 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"mrshanahan.com/notes-indexer/pkg/analysis"
+	"mrshanahan.com/notes-indexer/pkg/markdown"
+)
+
+var ErrReadOnly error = errors.New("index is open read-only")
+
+// Segments are merged in tiers, so each document is only rewritten a few
+// times however often the index is committed: once the newest segments
+// include this many of about the same size, committing merges them into one.
+// Sizes are compared as powers of mergeFactor.
+const mergeFactor int = 8
+
+// DefaultMapping is how documents' fields are analyzed unless an index is
+// created with a mapping of its own: code & tags are kept as written, and
+// everything else is English text.
+func DefaultMapping() *analysis.Mapping {
+	return &analysis.Mapping{
+		DefaultAnalyzer: "english",
+		Fields: []analysis.Field{
+			{Name: markdown.FIELD_CODE, Analyzer: "simple"},
+			{Name: FIELD_TAGS, Analyzer: "simple"},
+		},
+	}
+}
+
+// Posting is where a term appears in one document: the document's number
+// within its segment, and the positions of the term in the field. Lengths is
+// how many positions the term spans at each of them, when a filter (e.g.
+// synonyms) made the field a token graph; it's nil if they're all 1.
+type Posting struct {
+	Doc       int
+	Positions []int
+	Lengths   []int
+}
+
+// Length returns how many positions the term spans at its i'th position.
+func (p Posting) Length(i int) int {
+	if p.Lengths == nil || p.Lengths[i] < 1 {
+		return 1
+	}
+	return p.Lengths[i]
+}
+
+// A segment is a batch of documents along with their terms. Segments are
+// written once and never changed, bar which of their documents have since
+// been deleted; a document that's updated is deleted from its old segment
+// and added to a new one.
+type segment struct {
+	name string
+	docs []Document
+
+	// Field -> term -> postings, in order of document
+	postings map[string]map[string][]Posting
+
+	// The number of terms in each field of each document
+	lengths []map[string]int
+
+	deleted map[int]bool
+
+	// Whether the segment has been written, and whether its deletions have
+	// changed since they were. deletesFile is where they were written.
+	saved        bool
+	deletesDirty bool
+	deletesFile  string
+}
+
+func newSegment(name string) *segment {
+	return &segment{
+		name:     name,
+		docs:     []Document{},
+		postings: map[string]map[string][]Posting{},
+		lengths:  []map[string]int{},
+		deleted:  map[int]bool{},
+	}
+}
+
+func (s *segment) live() int { return len(s.docs) - len(s.deleted) }
+
+// Adds a document along with its analyzed fields.
+func (s *segment) add(doc Document, fields map[string][]analysis.Token) {
+	n := len(s.docs)
+	s.docs = append(s.docs, doc)
+	lengths := map[string]int{}
+	for field, tokens := range fields {
+		lengths[field] = len(tokens)
+		terms := s.postings[field]
+		if terms == nil {
+			terms = map[string][]Posting{}
+			s.postings[field] = terms
+		}
+		byTerm := map[string][]analysis.Token{}
+		for _, t := range tokens {
+			byTerm[t.Value] = append(byTerm[t.Value], t)
+		}
+		for term, ts := range byTerm {
+			sort.SliceStable(ts, func(i, j int) bool { return ts[i].Position < ts[j].Position })
+			p := Posting{Doc: n, Positions: make([]int, len(ts))}
+			for i, t := range ts {
+				p.Positions[i] = t.Position
+				if t.PositionLength > 1 {
+					if p.Lengths == nil {
+						p.Lengths = make([]int, len(ts))
+						for j := range p.Lengths {
+							p.Lengths[j] = 1
+						}
+					}
+					p.Lengths[i] = t.PositionLength
+				}
+			}
+			terms[term] = append(terms[term], p)
+		}
+	}
+	s.lengths = append(s.lengths, lengths)
+}
+
+type docRef struct {
+	seg *segment
+	doc int
+}
+
+// Index is an inverted index of documents, kept in a directory. All of it is
+// held in memory once opened. Changes are visible straight away, but are only
+// written out by Commit.
+//
+// An index can be opened for writing by one process at a time, and read by
+// any number with OpenReadOnly. It's safe for concurrent use.
+type Index struct {
+	dir      string
+	readOnly bool
+	lock     *indexLock
+
+	mu          sync.RWMutex
+	mapping     *analysis.Mapping
+	generation  int
+	nextSegment int
+	segments    []*segment
+	ids         map[string]docRef
+
+	// Whatever else a user of the index wants to commit along with it
+	meta      map[string]string
+	metaDirty bool
+}
+
+// Open opens the index in dir for writing, creating it with mapping if it
+// doesn't exist yet. An existing index keeps the mapping it was created with.
+// A nil mapping means DefaultMapping.
+func Open(dir string, mapping *analysis.Mapping) (*Index, error) {
+	lock, err := acquireLock(dir)
+	if err != nil {
+		return nil, err
+	}
+	ix, err := load(dir, false)
+	if err != nil {
+		lock.release()
+		return nil, err
+	}
+	ix.lock = lock
+	if ix.mapping == nil {
+		if mapping == nil {
+			mapping = DefaultMapping()
+		}
+		ix.mapping = mapping
+	}
+	return ix, nil
+}
+
+// OpenReadOnly opens an existing index for reading only, as of its last
+// commit. It doesn't need the index to be closed by whoever is writing it.
+func OpenReadOnly(dir string) (*Index, error) {
+	if !Exists(dir) {
+		return nil, fmt.Errorf("no index in %s", dir)
+	}
+	return load(dir, true)
+}
+
+// Close commits any changes and, for an index open for writing, lets others
+// open it.
+func (ix *Index) Close() error {
+	if ix.readOnly {
+		return nil
+	}
+	err := ix.Commit()
+	if lockErr := ix.lock.release(); err == nil {
+		err = lockErr
+	}
+	return err
+}
+
+func (ix *Index) Dir() string { return ix.dir }
+
+func (ix *Index) Mapping() *analysis.Mapping { return ix.mapping }
+
+// Put adds a document, replacing any with the same ID.
+func (ix *Index) Put(doc Document) error {
+	_, err := ix.Replace(doc)
+	return err
+}
+
+// Replace is Put, also reporting whether there was a document with the same
+// ID to replace.
+func (ix *Index) Replace(doc Document) (bool, error) {
+	if ix.readOnly {
+		return false, ErrReadOnly
+	}
+	fields := map[string][]analysis.Token{}
+	for source, text := range doc.Fields {
+		analyzed, err := ix.mapping.Analyze(source, text)
+		if err != nil {
+			return false, fmt.Errorf("failed to analyze %s: %w", doc.ID, err)
+		}
+		for field, tokens := range analyzed {
+			fields[field] = tokens
+		}
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	replaced := ix.deleteLocked(doc.ID)
+	seg := ix.openSegment()
+	seg.add(doc, fields)
+	ix.ids[doc.ID] = docRef{seg, len(seg.docs) - 1}
+	return replaced, nil
+}
+
+// Delete removes the document with the given ID, reporting whether there was
+// one.
+func (ix *Index) Delete(id string) (bool, error) {
+	if ix.readOnly {
+		return false, ErrReadOnly
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	return ix.deleteLocked(id), nil
+}
+
+func (ix *Index) deleteLocked(id string) bool {
+	ref, ok := ix.ids[id]
+	if !ok {
+		return false
+	}
+	ref.seg.deleted[ref.doc] = true
+	ref.seg.deletesDirty = true
+	delete(ix.ids, id)
+	return true
+}
+
+// Returns the segment new documents go in, which is the last one if it
+// hasn't been written yet.
+func (ix *Index) openSegment() *segment {
+	if n := len(ix.segments); n > 0 && !ix.segments[n-1].saved {
+		return ix.segments[n-1]
+	}
+	seg := newSegment(fmt.Sprintf("_%d", ix.nextSegment))
+	ix.nextSegment++
+	ix.segments = append(ix.segments, seg)
+	return seg
+}
+
+// Meta returns the value of key as of the last SetMeta.
+func (ix *Index) Meta(key string) string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return ix.meta[key]
+}
+
+// SetMeta keeps a value along with the index, e.g. to track what's been
+// indexed from elsewhere. It's committed along with the documents, so the
+// two never disagree. An empty value removes key.
+func (ix *Index) SetMeta(key, value string) error {
+	if ix.readOnly {
+		return ErrReadOnly
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if value == "" {
+		delete(ix.meta, key)
+	} else {
+		ix.meta[key] = value
+	}
+	ix.metaDirty = true
+	return nil
+}
+
+// Get returns the document with the given ID.
+func (ix *Index) Get(id string) (Document, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	ref, ok := ix.ids[id]
+	if !ok {
+		return Document{}, false
+	}
+	return ref.seg.docs[ref.doc], true
+}
+
+// IDs returns the IDs of every document, sorted.
+func (ix *Index) IDs() []string {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	ids := make([]string, 0, len(ix.ids))
+	for id := range ix.ids {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Len returns the number of documents.
+func (ix *Index) Len() int {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	return len(ix.ids)
+}
+
+// Commit writes out any changes since the last commit, merging segments as
+// they add up (see mergeFactor).
+func (ix *Index) Commit() error {
+	if ix.readOnly {
+		return ErrReadOnly
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+
+	changed := ix.metaDirty
+	live := []*segment{}
+	for _, seg := range ix.segments {
+		changed = changed || !seg.saved || seg.deletesDirty
+		if seg.live() > 0 {
+			live = append(live, seg)
+		}
+	}
+	if !changed && Exists(ix.dir) {
+		return nil
+	}
+	ix.segments = live
+	for from := ix.mergeFrom(); from >= 0; from = ix.mergeFrom() {
+		ix.merge(from)
+	}
+
+	for _, seg := range ix.segments {
+		if !seg.saved {
+			if err := writeSegment(ix.dir, seg); err != nil {
+				return err
+			}
+		}
+	}
+	ix.generation++
+	for _, seg := range ix.segments {
+		if seg.deletesDirty {
+			if err := writeDeletes(ix.dir, seg, ix.generation); err != nil {
+				return err
+			}
+		}
+	}
+	if err := writeManifest(ix.dir, ix.manifest()); err != nil {
+		return err
+	}
+	for _, seg := range ix.segments {
+		seg.saved, seg.deletesDirty = true, false
+	}
+	ix.metaDirty = false
+	return removeUnused(ix.dir, ix.manifest())
+}
+
+// Returns where the newest segments that should be merged start, or -1 if
+// none should be: the newest segment along with those before it that are no
+// bigger a tier, if there are mergeFactor of them.
+func (ix *Index) mergeFrom() int {
+	n := len(ix.segments)
+	if n < mergeFactor {
+		return -1
+	}
+	top := segmentTier(ix.segments[n-1])
+	from := n - 1
+	for from > 0 && segmentTier(ix.segments[from-1]) <= top {
+		from--
+	}
+	if n-from < mergeFactor {
+		return -1
+	}
+	return from
+}
+
+// Which power of mergeFactor a segment's live documents come to.
+func segmentTier(seg *segment) int {
+	tier := 0
+	for size := seg.live(); size >= mergeFactor; size /= mergeFactor {
+		tier++
+	}
+	return tier
+}
+
+// Merges the segments from the given one on into one, leaving out deleted
+// documents. The merged segment isn't written yet.
+func (ix *Index) merge(from int) {
+	merged := newSegment(fmt.Sprintf("_%d", ix.nextSegment))
+	ix.nextSegment++
+	for _, seg := range ix.segments[from:] {
+		remap := map[int]int{}
+		for i, doc := range seg.docs {
+			if seg.deleted[i] {
+				continue
+			}
+			remap[i] = len(merged.docs)
+			merged.docs = append(merged.docs, doc)
+			merged.lengths = append(merged.lengths, seg.lengths[i])
+			ix.ids[doc.ID] = docRef{merged, remap[i]}
+		}
+		for field, terms := range seg.postings {
+			mergedTerms := merged.postings[field]
+			if mergedTerms == nil {
+				mergedTerms = map[string][]Posting{}
+				merged.postings[field] = mergedTerms
+			}
+			for term, ps := range terms {
+				for _, p := range ps {
+					if n, ok := remap[p.Doc]; ok {
+						mergedTerms[term] = append(mergedTerms[term], Posting{Doc: n, Positions: p.Positions, Lengths: p.Lengths})
+					}
+				}
+			}
+		}
+	}
+	ix.segments = append(ix.segments[:from], merged)
+}
+
+// Stats describes what's in an index.
+type Stats struct {
+	Docs       int                   `json:"docs"`
+	Deleted    int                   `json:"deleted"`
+	Terms      int                   `json:"terms"` // Distinct terms, counting each field separately
+	Generation int                   `json:"generation"`
+	Fields     map[string]FieldStats `json:"fields"`
+	Segments   []SegmentStats        `json:"segments"`
+}
+
+type FieldStats struct {
+	Docs          int     `json:"docs"` // Documents with any terms in the field
+	Terms         int     `json:"terms"`
+	AverageLength float64 `json:"average_length"`
+}
+
+type SegmentStats struct {
+	Name    string `json:"name"`
+	Docs    int    `json:"docs"`
+	Deleted int    `json:"deleted"`
+	Saved   bool   `json:"saved"`
+}
+
+func (ix *Index) Stats() Stats {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	stats := Stats{Docs: len(ix.ids), Generation: ix.generation, Fields: map[string]FieldStats{}, Segments: []SegmentStats{}}
+	terms := map[string]map[string]bool{}
+	totals := map[string]int{}
+	for _, seg := range ix.segments {
+		stats.Deleted += len(seg.deleted)
+		stats.Segments = append(stats.Segments, SegmentStats{Name: seg.name, Docs: seg.live(), Deleted: len(seg.deleted), Saved: seg.saved})
+		for i, lengths := range seg.lengths {
+			if seg.deleted[i] {
+				continue
+			}
+			for field, n := range lengths {
+				if n == 0 {
+					continue
+				}
+				fs := stats.Fields[field]
+				fs.Docs++
+				stats.Fields[field] = fs
+				totals[field] += n
+			}
+		}
+		for field, ts := range seg.postings {
+			for term, ps := range ts {
+				if !anyLive(seg, ps) {
+					continue
+				}
+				if terms[field] == nil {
+					terms[field] = map[string]bool{}
+				}
+				terms[field][term] = true
+			}
+		}
+	}
+	for field, fs := range stats.Fields {
+		fs.Terms = len(terms[field])
+		fs.AverageLength = float64(totals[field]) / float64(fs.Docs)
+		stats.Fields[field] = fs
+		stats.Terms += fs.Terms
+	}
+	return stats
+}
+
+func anyLive(seg *segment, ps []Posting) bool {
+	for _, p := range ps {
+		if !seg.deleted[p.Doc] {
+			return true
+		}
+	}
+	return false
+}
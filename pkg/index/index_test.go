@@ -0,0 +1,204 @@
+package index
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testDocument(t *testing.T, id, content string) Document {
+	doc, err := NewDocument(id, DOC_TYPE_MARKDOWN, []byte(content))
+	assert.Nil(t, err)
+	return doc
+}
+
+func TestIndexPutGetDelete(t *testing.T) {
+	ix, err := Open(t.TempDir(), nil)
+	assert.Nil(t, err)
+	defer ix.Close()
+
+	assert.Nil(t, ix.Put(testDocument(t, "a.md", "# Apples\n\nRed ones.\n")))
+	assert.Nil(t, ix.Put(testDocument(t, "b.md", "# Bananas\n")))
+	assert.Nil(t, ix.Put(testDocument(t, "a.md", "# Apricots\n")))
+
+	doc, ok := ix.Get("a.md")
+	assert.True(t, ok)
+	assert.Equal(t, "Apricots", doc.Title)
+	assert.Equal(t, []string{"a.md", "b.md"}, ix.IDs())
+	assert.Equal(t, 2, ix.Len())
+
+	deleted, err := ix.Delete("b.md")
+	assert.Nil(t, err)
+	assert.True(t, deleted)
+	deleted, err = ix.Delete("b.md")
+	assert.Nil(t, err)
+	assert.False(t, deleted)
+	_, ok = ix.Get("b.md")
+	assert.False(t, ok)
+}
+
+func TestIndexCommitAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	ix, err := Open(dir, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, ix.Put(testDocument(t, "a.md", "# Apples\n")))
+	assert.Nil(t, ix.Put(testDocument(t, "b.md", "# Bananas\n")))
+	assert.Nil(t, ix.Commit())
+	_, err = ix.Delete("a.md")
+	assert.Nil(t, err)
+	assert.Nil(t, ix.Close())
+
+	ix, err = Open(dir, nil)
+	assert.Nil(t, err)
+	defer ix.Close()
+
+	assert.Equal(t, []string{"b.md"}, ix.IDs())
+	doc, ok := ix.Get("b.md")
+	assert.True(t, ok)
+	assert.Equal(t, "Bananas", doc.Title)
+	assert.Equal(t, "english", ix.Mapping().DefaultAnalyzer)
+	assert.Equal(t, 2, ix.Stats().Generation)
+}
+
+func TestIndexOpenTwice(t *testing.T) {
+	dir := t.TempDir()
+	ix, err := Open(dir, nil)
+	assert.Nil(t, err)
+
+	_, err = Open(dir, nil)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, ix.Close())
+	ix, err = Open(dir, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, ix.Close())
+}
+
+func TestIndexReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	_, err := OpenReadOnly(dir)
+	assert.NotNil(t, err)
+
+	ix, err := Open(dir, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, ix.Put(testDocument(t, "a.md", "# Apples\n")))
+	assert.Nil(t, ix.Commit())
+	assert.Nil(t, ix.Put(testDocument(t, "b.md", "# Bananas\n")))
+	defer ix.Close()
+
+	ro, err := OpenReadOnly(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.md"}, ro.IDs())
+	assert.Equal(t, ErrReadOnly, ro.Put(testDocument(t, "c.md", "")))
+	_, err = ro.Delete("a.md")
+	assert.Equal(t, ErrReadOnly, err)
+	assert.Nil(t, ro.Close())
+}
+
+func TestIndexMergesSegments(t *testing.T) {
+	dir := t.TempDir()
+	ix, err := Open(dir, nil)
+	assert.Nil(t, err)
+	for i := 0; i < mergeFactor; i++ {
+		assert.Nil(t, ix.Put(testDocument(t, "a.md", "# Apples\n")))
+		assert.Nil(t, ix.Put(testDocument(t, string(rune('b'+i))+".md", "# Bananas\n")))
+		assert.Nil(t, ix.Commit())
+	}
+	assert.Nil(t, ix.Close())
+
+	ix, err = Open(dir, nil)
+	assert.Nil(t, err)
+	defer ix.Close()
+	stats := ix.Stats()
+	assert.Equal(t, mergeFactor+1, stats.Docs)
+	assert.Equal(t, 0, stats.Deleted)
+	assert.Len(t, stats.Segments, 1)
+}
+
+func TestIndexMergesSegmentsInTiers(t *testing.T) {
+	ix, err := Open(t.TempDir(), nil)
+	assert.Nil(t, err)
+	defer ix.Close()
+	for i := 0; i < mergeFactor; i++ {
+		assert.Nil(t, ix.Put(testDocument(t, fmt.Sprintf("big%d.md", i), "# Big\n")))
+	}
+	assert.Nil(t, ix.Commit())
+	big := ix.Stats().Segments[0].Name
+
+	// Small commits are merged with each other, leaving the big segment be
+	for i := 0; i < mergeFactor; i++ {
+		assert.Nil(t, ix.Put(testDocument(t, fmt.Sprintf("small%d.md", i), "# Small\n")))
+		assert.Nil(t, ix.Commit())
+		if i < mergeFactor-1 {
+			assert.Len(t, ix.Stats().Segments, i+2)
+		}
+	}
+
+	stats := ix.Stats()
+	if assert.Len(t, stats.Segments, 2) {
+		assert.Equal(t, big, stats.Segments[0].Name)
+		assert.Equal(t, mergeFactor, stats.Segments[1].Docs)
+	}
+	assert.Equal(t, 2*mergeFactor, stats.Docs)
+}
+
+func TestIndexReplace(t *testing.T) {
+	ix, err := Open(t.TempDir(), nil)
+	assert.Nil(t, err)
+	defer ix.Close()
+
+	replaced, err := ix.Replace(testDocument(t, "a.md", "# Apples\n"))
+	assert.Nil(t, err)
+	assert.False(t, replaced)
+	replaced, err = ix.Replace(testDocument(t, "a.md", "# Avocados\n"))
+	assert.Nil(t, err)
+	assert.True(t, replaced)
+	assert.Equal(t, 1, ix.Len())
+}
+
+func TestIndexStats(t *testing.T) {
+	ix, err := Open(t.TempDir(), nil)
+	assert.Nil(t, err)
+	defer ix.Close()
+	assert.Nil(t, ix.Put(testDocument(t, "a.md", "# Apples\n\nRed apples and green apples.\n")))
+	assert.Nil(t, ix.Put(testDocument(t, "b.md", "# Bananas\n\nYellow.\n")))
+	assert.Nil(t, ix.Put(testDocument(t, "c.md", "# Cherries\n")))
+	_, err = ix.Delete("c.md")
+	assert.Nil(t, err)
+
+	stats := ix.Stats()
+
+	assert.Equal(t, 2, stats.Docs)
+	assert.Equal(t, 1, stats.Deleted)
+	assert.Equal(t, FieldStats{Docs: 2, Terms: 2, AverageLength: 1}, stats.Fields[FIELD_TITLE])
+	assert.Equal(t, FieldStats{Docs: 2, Terms: 4, AverageLength: 2.5}, stats.Fields["body"])
+	assert.Equal(t, 8, stats.Terms)
+}
+
+func TestIndexMeta(t *testing.T) {
+	dir := t.TempDir()
+	ix, err := Open(dir, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "", ix.Meta("cursor"))
+	assert.Nil(t, ix.SetMeta("cursor", "42"))
+	assert.Nil(t, ix.SetMeta("other", "x"))
+	assert.Nil(t, ix.SetMeta("other", ""))
+	assert.Equal(t, "42", ix.Meta("cursor"))
+
+	ro, err := OpenReadOnly(dir)
+	assert.NotNil(t, err) // Not committed yet
+	assert.Nil(t, ro)
+	assert.Nil(t, ix.Commit())
+	ro, err = OpenReadOnly(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, "42", ro.Meta("cursor"))
+	assert.Equal(t, ErrReadOnly, ro.SetMeta("cursor", "43"))
+	assert.Nil(t, ix.Close())
+
+	ix, err = Open(dir, nil)
+	assert.Nil(t, err)
+	defer ix.Close()
+	assert.Equal(t, "42", ix.Meta("cursor"))
+	assert.Equal(t, "", ix.Meta("other"))
+}
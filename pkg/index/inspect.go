@@ -0,0 +1,206 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Types of file in an index directory, as DiskUsage breaks them down.
+const (
+	FILE_TYPE_MANIFEST string = "manifest"
+	FILE_TYPE_DOCS     string = "docs"
+	FILE_TYPE_POSTINGS string = "postings"
+	FILE_TYPE_LENGTHS  string = "lengths"
+	FILE_TYPE_DELETES  string = "deletes"
+	FILE_TYPE_LOCK     string = "lock"
+	FILE_TYPE_OTHER    string = "other"
+)
+
+var fileTypeExtensions map[string]string = map[string]string{
+	EXT_DOCS:     FILE_TYPE_DOCS,
+	EXT_POSTINGS: FILE_TYPE_POSTINGS,
+	EXT_LENGTHS:  FILE_TYPE_LENGTHS,
+	EXT_DELETES:  FILE_TYPE_DELETES,
+}
+
+// TermStats is how common a term is in a field, counting only documents that
+// haven't been deleted.
+type TermStats struct {
+	Field   string `json:"field"`
+	Term    string `json:"term"`
+	DocFreq int    `json:"doc_freq"` // Documents it's in
+	Freq    int    `json:"freq"`     // Times it's in them
+}
+
+// TopTerms returns the limit terms in the most documents, most first, from
+// field or from every field if it's "". Ties are sorted by field then term. A
+// limit of 0 means all of them.
+func (ix *Index) TopTerms(field string, limit int) []TermStats {
+	ix.mu.RLock()
+	type key struct{ field, term string }
+	counts := map[key]*TermStats{}
+	for _, seg := range ix.segments {
+		for f, terms := range seg.postings {
+			if field != "" && f != field {
+				continue
+			}
+			for term, ps := range terms {
+				for _, p := range ps {
+					if seg.deleted[p.Doc] {
+						continue
+					}
+					ts := counts[key{f, term}]
+					if ts == nil {
+						ts = &TermStats{Field: f, Term: term}
+						counts[key{f, term}] = ts
+					}
+					ts.DocFreq++
+					ts.Freq += len(p.Positions)
+				}
+			}
+		}
+	}
+	ix.mu.RUnlock()
+
+	top := make([]TermStats, 0, len(counts))
+	for _, ts := range counts {
+		top = append(top, *ts)
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].DocFreq != top[j].DocFreq {
+			return top[i].DocFreq > top[j].DocFreq
+		}
+		if top[i].Field != top[j].Field {
+			return top[i].Field < top[j].Field
+		}
+		return top[i].Term < top[j].Term
+	})
+	if limit > 0 && len(top) > limit {
+		top = top[:limit]
+	}
+	return top
+}
+
+// TermPosting is where a term is in a field of one document.
+type TermPosting struct {
+	Field     string `json:"field"`
+	ID        string `json:"id"`
+	Segment   string `json:"segment"`
+	Positions []int  `json:"positions"`
+}
+
+// Postings returns where a term is in field, or in every field if it's "",
+// sorted by field then document ID. The term is matched as indexed, i.e.
+// after analysis.
+func (ix *Index) Postings(field, term string) []TermPosting {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	postings := []TermPosting{}
+	for _, seg := range ix.segments {
+		for f, terms := range seg.postings {
+			if field != "" && f != field {
+				continue
+			}
+			for _, p := range terms[term] {
+				if seg.deleted[p.Doc] {
+					continue
+				}
+				postings = append(postings, TermPosting{Field: f, ID: seg.docs[p.Doc].ID, Segment: seg.name, Positions: p.Positions})
+			}
+		}
+	}
+	sort.Slice(postings, func(i, j int) bool {
+		if postings[i].Field != postings[j].Field {
+			return postings[i].Field < postings[j].Field
+		}
+		return postings[i].ID < postings[j].ID
+	})
+	return postings
+}
+
+// DocStats is where a document is kept, and how many terms each of its
+// fields was analyzed into.
+type DocStats struct {
+	ID      string         `json:"id"`
+	Segment string         `json:"segment"`
+	Lengths map[string]int `json:"lengths"`
+}
+
+// DocStats returns where the document with the given ID is kept, and the
+// lengths of its fields as scoring sees them.
+func (ix *Index) DocStats(id string) (DocStats, bool) {
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+	ref, ok := ix.ids[id]
+	if !ok {
+		return DocStats{}, false
+	}
+	lengths := map[string]int{}
+	for f, n := range ref.seg.lengths[ref.doc] {
+		lengths[f] = n
+	}
+	return DocStats{ID: id, Segment: ref.seg.name, Lengths: lengths}, true
+}
+
+// FileStats is how much of an index directory one type of file takes up.
+type FileStats struct {
+	Type  string `json:"type"`
+	Files int    `json:"files"`
+	Bytes int64  `json:"bytes"`
+}
+
+// DiskUsage breaks down the size of the files in an index directory by type,
+// largest first. It reads the directory only, so it doesn't matter whether
+// the index is open.
+func DiskUsage(dir string) ([]FileStats, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	byType := map[string]*FileStats{}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if os.IsNotExist(err) {
+			// Removed by a commit since being listed
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		t := fileType(e.Name())
+		fs := byType[t]
+		if fs == nil {
+			fs = &FileStats{Type: t}
+			byType[t] = fs
+		}
+		fs.Files++
+		fs.Bytes += info.Size()
+	}
+
+	usage := make([]FileStats, 0, len(byType))
+	for _, fs := range byType {
+		usage = append(usage, *fs)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		if usage[i].Bytes != usage[j].Bytes {
+			return usage[i].Bytes > usage[j].Bytes
+		}
+		return usage[i].Type < usage[j].Type
+	})
+	return usage, nil
+}
+
+func fileType(name string) string {
+	switch {
+	case name == MANIFEST_FILE:
+		return FILE_TYPE_MANIFEST
+	case name == LOCK_FILE:
+		return FILE_TYPE_LOCK
+	case IsIndexFile(name):
+		return fileTypeExtensions[filepath.Ext(name)]
+	}
+	return FILE_TYPE_OTHER
+}
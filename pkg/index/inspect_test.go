@@ -0,0 +1,94 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func inspectIndex(t *testing.T, dir string) *Index {
+	ix, err := Open(dir, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, ix.Put(testDocument(t, "a.md", "# Apples\n\nRed apples and green apples.\n")))
+	assert.Nil(t, ix.Put(testDocument(t, "b.md", "# Bananas\n\nYellow, unlike apples.\n")))
+	assert.Nil(t, ix.Put(testDocument(t, "c.md", "# Apples again\n")))
+	_, err = ix.Delete("c.md")
+	assert.Nil(t, err)
+	return ix
+}
+
+func TestTopTerms(t *testing.T) {
+	ix := inspectIndex(t, t.TempDir())
+	defer ix.Close()
+
+	assert.Equal(t, []TermStats{
+		{Field: "body", Term: "appl", DocFreq: 2, Freq: 3},
+		{Field: "body", Term: "green", DocFreq: 1, Freq: 1},
+	}, ix.TopTerms("", 2))
+	// The deleted document's terms don't count
+	assert.Equal(t, []TermStats{
+		{Field: FIELD_TITLE, Term: "appl", DocFreq: 1, Freq: 1},
+		{Field: FIELD_TITLE, Term: "banana", DocFreq: 1, Freq: 1},
+	}, ix.TopTerms(FIELD_TITLE, 0))
+	assert.Empty(t, ix.TopTerms("nope", 10))
+}
+
+func TestPostings(t *testing.T) {
+	ix := inspectIndex(t, t.TempDir())
+	defer ix.Close()
+
+	assert.Equal(t, []TermPosting{
+		{Field: "body", ID: "a.md", Segment: "_0", Positions: []int{1, 4}},
+		{Field: "body", ID: "b.md", Segment: "_0", Positions: []int{2}},
+		{Field: "header", ID: "a.md", Segment: "_0", Positions: []int{0}},
+		{Field: FIELD_TITLE, ID: "a.md", Segment: "_0", Positions: []int{0}},
+	}, ix.Postings("", "appl"))
+	assert.Len(t, ix.Postings("body", "appl"), 2)
+	// Terms are matched as indexed
+	assert.Empty(t, ix.Postings("", "apples"))
+}
+
+func TestDocStats(t *testing.T) {
+	ix := inspectIndex(t, t.TempDir())
+	defer ix.Close()
+
+	stats, ok := ix.DocStats("a.md")
+	assert.True(t, ok)
+	assert.Equal(t, "_0", stats.Segment)
+	assert.Equal(t, 1, stats.Lengths[FIELD_TITLE])
+	assert.Equal(t, 4, stats.Lengths["body"])
+	_, ok = ix.DocStats("c.md")
+	assert.False(t, ok)
+}
+
+func TestDiskUsage(t *testing.T) {
+	dir := t.TempDir()
+	ix := inspectIndex(t, dir)
+	assert.Nil(t, ix.Commit())
+	assert.Nil(t, ix.Close())
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hi"), 0644))
+
+	usage, err := DiskUsage(dir)
+	assert.Nil(t, err)
+	files := map[string]int{}
+	for _, fs := range usage {
+		files[fs.Type] = fs.Files
+		if fs.Type != FILE_TYPE_LOCK {
+			assert.Greater(t, fs.Bytes, int64(0))
+		}
+	}
+	assert.Equal(t, map[string]int{
+		FILE_TYPE_MANIFEST: 1,
+		FILE_TYPE_DOCS:     1,
+		FILE_TYPE_POSTINGS: 1,
+		FILE_TYPE_LENGTHS:  1,
+		FILE_TYPE_DELETES:  1,
+		FILE_TYPE_LOCK:     1,
+		FILE_TYPE_OTHER:    1,
+	}, files)
+
+	_, err = DiskUsage(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,37 @@
+//go:build !unix
+
+package index
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// The lock held on an index by the process writing it. Without flock, the
+// lock file existing is the lock, so one left behind by a process that didn't
+// exit cleanly has to be removed by hand.
+type indexLock struct {
+	path string
+}
+
+func acquireLock(dir string) (*indexLock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, LOCK_FILE)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, fmt.Errorf("index in %s is open for writing elsewhere (if not, remove %s)", dir, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &indexLock{path}, f.Close()
+}
+
+func (l *indexLock) release() error {
+	return os.Remove(l.path)
+}
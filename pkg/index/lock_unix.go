@@ -0,0 +1,36 @@
+//go:build unix
+
+package index
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// The lock held on an index by the process writing it. It's released when
+// the process exits, however that happens.
+type indexLock struct {
+	f *os.File
+}
+
+func acquireLock(dir string) (*indexLock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, LOCK_FILE), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("index in %s is open for writing elsewhere", dir)
+	}
+	return &indexLock{f}, nil
+}
+
+func (l *indexLock) release() error {
+	syscall.Flock(int(l.f.Fd()), syscall.LOCK_UN)
+	return l.f.Close()
+}
@@ -0,0 +1,236 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type QueryType int
+
+const (
+	QUERY_MATCH QueryType = iota
+	QUERY_PHRASE
+	QUERY_BOOL
+)
+
+var queryTypeName map[QueryType]string = map[QueryType]string{
+	QUERY_MATCH:  "match",
+	QUERY_PHRASE: "phrase",
+	QUERY_BOOL:   "bool",
+}
+
+func (t QueryType) String() string { return queryTypeName[t] }
+
+func (t QueryType) MarshalText() ([]byte, error) {
+	name, ok := queryTypeName[t]
+	if !ok {
+		return nil, fmt.Errorf("invalid query type: %d", t)
+	}
+	return []byte(name), nil
+}
+
+func (t *QueryType) UnmarshalText(text []byte) error {
+	for typ, name := range queryTypeName {
+		if name == string(text) {
+			*t = typ
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown query type: %s", text)
+}
+
+// Query is what to search an index for. It's either:
+//
+//   - QUERY_MATCH, which matches documents with any of the terms of Text in
+//     Field, scoring those with more of them (and rarer ones) higher;
+//   - QUERY_PHRASE, which only matches documents with all the terms of Text
+//     in Field, in order & next to each other; or
+//   - QUERY_BOOL, which combines other queries. A document has to match
+//     every one of Must and none of MustNot. If there's no Must, it has to
+//     match at least one of Should, otherwise Should only adds to the score.
+//     With only MustNot, every other document matches.
+//
+// A query with no Field searches the default fields of the search. Text is
+// analyzed the way each field it's matched against is, and a clause whose
+// text turns out to have no terms at all (e.g. only stopwords) is ignored.
+//
+// Queries marshal to & from JSON as e.g.
+//
+//	{"type": "bool", "must": [{"type": "match", "field": "title", "text": "todo"}]}
+type Query struct {
+	Type  QueryType `json:"type"`
+	Field string    `json:"field,omitempty"`
+	Text  string    `json:"text,omitempty"`
+
+	// Multiplies the query's score; zero means 1
+	Boost float64 `json:"boost,omitempty"`
+
+	Must    []Query `json:"must,omitempty"`
+	Should  []Query `json:"should,omitempty"`
+	MustNot []Query `json:"must_not,omitempty"`
+}
+
+func MatchQuery(field, text string) Query {
+	return Query{Type: QUERY_MATCH, Field: field, Text: text}
+}
+
+func PhraseQuery(field, text string) Query {
+	return Query{Type: QUERY_PHRASE, Field: field, Text: text}
+}
+
+func (q Query) boost() float64 {
+	if q.Boost == 0 {
+		return 1
+	}
+	return q.Boost
+}
+
+// String returns the query in the syntax ParseQuery takes, as near as it can.
+func (q Query) String() string {
+	s := ""
+	switch q.Type {
+	case QUERY_MATCH:
+		s = q.Text
+		if strings.ContainsAny(s, " \t\n\"") {
+			s = "(" + s + ")"
+		}
+	case QUERY_PHRASE:
+		s = `"` + strings.ReplaceAll(q.Text, `"`, "") + `"`
+	case QUERY_BOOL:
+		clauses := []string{}
+		for _, c := range q.Must {
+			clauses = append(clauses, "+"+c.String())
+		}
+		for _, c := range q.Should {
+			clauses = append(clauses, c.String())
+		}
+		for _, c := range q.MustNot {
+			clauses = append(clauses, "-"+c.String())
+		}
+		s = "(" + strings.Join(clauses, " ") + ")"
+	}
+	if q.Field != "" {
+		s = q.Field + ":" + s
+	}
+	if q.Boost != 0 && q.Boost != 1 {
+		s += "^" + strconv.FormatFloat(q.Boost, 'g', -1, 64)
+	}
+	return s
+}
+
+var ErrEmptyQuery error = errors.New("empty query")
+
+// ParseQuery parses a query string, which is a list of clauses separated by
+// spaces, each of which is a word or a "quoted phrase". A clause can be:
+//
+//   - prefixed with a field name & a colon to only search that field, as in
+//     title:todo or tags:"work project";
+//   - prefixed with + if documents have to match it, or - if they mustn't;
+//     and
+//   - followed by ^ and a number to weight it, as in title:todo^2.
+//
+// A document has to match at least one clause that isn't prefixed, and the
+// more it matches the higher it scores.
+func ParseQuery(s string) (Query, error) {
+	p := queryParser{s: s}
+	q := Query{Type: QUERY_BOOL}
+	for {
+		p.skipSpace()
+		if p.done() {
+			break
+		}
+		occur := p.s[p.i]
+		if occur == '+' || occur == '-' {
+			p.i++
+		}
+		clause, err := p.clause()
+		if err != nil {
+			return Query{}, err
+		}
+		switch occur {
+		case '+':
+			q.Must = append(q.Must, clause)
+		case '-':
+			q.MustNot = append(q.MustNot, clause)
+		default:
+			q.Should = append(q.Should, clause)
+		}
+	}
+
+	if len(q.Must)+len(q.Should)+len(q.MustNot) == 0 {
+		return Query{}, ErrEmptyQuery
+	}
+	if len(q.Should) == 1 && len(q.Must)+len(q.MustNot) == 0 {
+		return q.Should[0], nil
+	}
+	return q, nil
+}
+
+type queryParser struct {
+	s string
+	i int
+}
+
+func (p *queryParser) done() bool { return p.i >= len(p.s) }
+
+func (p *queryParser) skipSpace() {
+	for !p.done() && isQuerySpace(p.s[p.i]) {
+		p.i++
+	}
+}
+
+func isQuerySpace(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' }
+
+func (p *queryParser) clause() (Query, error) {
+	start := p.i
+	field := ""
+	for !p.done() && isFieldChar(rune(p.s[p.i])) {
+		p.i++
+	}
+	if p.i > start && !p.done() && p.s[p.i] == ':' && p.i+1 < len(p.s) && !isQuerySpace(p.s[p.i+1]) {
+		field = p.s[start:p.i]
+		p.i++
+	} else {
+		p.i = start
+	}
+
+	q := Query{}
+	if !p.done() && p.s[p.i] == '"' {
+		end := strings.IndexByte(p.s[p.i+1:], '"')
+		if end < 0 {
+			return Query{}, fmt.Errorf("unterminated quote at %d", p.i)
+		}
+		q = PhraseQuery(field, p.s[p.i+1:p.i+1+end])
+		p.i += end + 2
+	} else {
+		start := p.i
+		for !p.done() && !isQuerySpace(p.s[p.i]) && p.s[p.i] != '^' {
+			p.i++
+		}
+		if p.i == start {
+			return Query{}, fmt.Errorf("expected a term at %d", p.i)
+		}
+		q = MatchQuery(field, p.s[start:p.i])
+	}
+
+	if !p.done() && p.s[p.i] == '^' {
+		p.i++
+		start := p.i
+		for !p.done() && !isQuerySpace(p.s[p.i]) {
+			p.i++
+		}
+		boost, err := strconv.ParseFloat(p.s[start:p.i], 64)
+		if err != nil || boost < 0 {
+			return Query{}, fmt.Errorf("invalid boost at %d: %q", start, p.s[start:p.i])
+		}
+		q.Boost = boost
+	}
+	return q, nil
+}
+
+func isFieldChar(c rune) bool {
+	return c == '_' || c == '.' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
@@ -0,0 +1,87 @@
+package index
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected Query
+	}{
+		{"term", "apples", MatchQuery("", "apples")},
+		{"field", "title:apples", MatchQuery("title", "apples")},
+		{"phrase", `"red apples"`, PhraseQuery("", "red apples")},
+		{"field-phrase", `tags:"work project"`, PhraseQuery("tags", "work project")},
+		{"boost", "title:apples^2.5", Query{Type: QUERY_MATCH, Field: "title", Text: "apples", Boost: 2.5}},
+		{"not-a-field", "12:30 meeting", Query{Type: QUERY_BOOL, Should: []Query{MatchQuery("12", "30"), MatchQuery("", "meeting")}}},
+		{"colon-at-end", "todo:", MatchQuery("", "todo:")},
+		{
+			"occurs",
+			`apples +"pie crust" -tags:done pears`,
+			Query{
+				Type:    QUERY_BOOL,
+				Must:    []Query{PhraseQuery("", "pie crust")},
+				Should:  []Query{MatchQuery("", "apples"), MatchQuery("", "pears")},
+				MustNot: []Query{MatchQuery("tags", "done")},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := ParseQuery(test.input)
+
+			assert.Nil(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", "empty query"},
+		{"   ", "empty query"},
+		{`"unclosed`, "unterminated quote at 0"},
+		{"apples^x", `invalid boost at 7: "x"`},
+		{"+ apples", "expected a term at 1"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			_, err := ParseQuery(test.input)
+
+			assert.EqualError(t, err, test.expected)
+		})
+	}
+}
+
+func TestQueryJSON(t *testing.T) {
+	q := Query{
+		Type:    QUERY_BOOL,
+		Must:    []Query{PhraseQuery("", "pie crust")},
+		MustNot: []Query{{Type: QUERY_MATCH, Field: "tags", Text: "done", Boost: 2}},
+	}
+
+	data, err := json.Marshal(q)
+	assert.Nil(t, err)
+	assert.Equal(t, `{"type":"bool","must":[{"type":"phrase","text":"pie crust"}],"must_not":[{"type":"match","field":"tags","text":"done","boost":2}]}`, string(data))
+
+	actual := Query{}
+	assert.Nil(t, json.Unmarshal(data, &actual))
+	assert.Equal(t, q, actual)
+
+	assert.NotNil(t, json.Unmarshal([]byte(`{"type":"fuzzy"}`), &actual))
+}
+
+func TestQueryString(t *testing.T) {
+	q, err := ParseQuery(`apples +"pie crust" -tags:done title:pears^2`)
+	assert.Nil(t, err)
+
+	assert.Equal(t, `(+"pie crust" apples title:pears^2 -tags:done)`, q.String())
+}
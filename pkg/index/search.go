@@ -0,0 +1,658 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"mrshanahan.com/notes-indexer/pkg/analysis"
+	"mrshanahan.com/notes-indexer/pkg/markdown"
+)
+
+// BM25 is how matches are scored: each term a document matches scores
+//
+//	idf * freq / (freq + K1 * (1 - B + B * length / average length))
+//
+// so rarer terms count for more, repeats of a term count for less & less
+// (faster with a lower K1), and matches in shorter fields count for more
+// (more so with a higher B, up to 1).
+type BM25 struct {
+	K1 float64
+	B  float64
+}
+
+var DefaultBM25 BM25 = BM25{K1: 1.2, B: 0.75}
+
+// DefaultFields are the fields a query without a field of its own searches,
+// along with how much a match in each is weighted.
+var DefaultFields map[string]float64 = map[string]float64{
+	FIELD_TITLE:           2,
+	FIELD_TAGS:            1.5,
+	markdown.FIELD_HEADER: 1.5,
+	markdown.FIELD_BODY:   1,
+	markdown.FIELD_LIST:   1,
+	markdown.FIELD_QUOTE:  1,
+	markdown.FIELD_LINK:   1,
+	markdown.FIELD_CODE:   1,
+}
+
+type SearchOptions struct {
+	Limit  int // Zero means no limit
+	Offset int
+
+	// The fields searched by a query without a field of its own, instead of
+	// DefaultFields. Any of these that are in DefaultFields keep its weight.
+	Fields []string
+
+	// How much a match in a field searched is weighted, for any that
+	// shouldn't be as in DefaultFields. Boosting a field doesn't make it
+	// searched.
+	Boosts map[string]float64
+
+	// Zero means DefaultBM25
+	BM25 BM25
+
+	// Whether to explain how each hit's score was worked out
+	Explain bool
+}
+
+type SearchResult struct {
+	Total int // Hits, before Limit & Offset
+	Hits  []Hit
+	Took  time.Duration
+}
+
+type Hit struct {
+	ID    string
+	Score float64
+	Doc   Document
+
+	// The terms matched in each field, sorted
+	Matches map[string][]string
+
+	Explanation *Explanation
+}
+
+// Explanation breaks a score down into what it was worked out from.
+type Explanation struct {
+	Value       float64       `json:"value"`
+	Description string        `json:"description"`
+	Details     []Explanation `json:"details,omitempty"`
+}
+
+func (e Explanation) String() string {
+	b := strings.Builder{}
+	e.write(&b, 0)
+	return b.String()
+}
+
+func (e Explanation) write(b *strings.Builder, depth int) {
+	fmt.Fprintf(b, "%s%.4g = %s\n", strings.Repeat("  ", depth), e.Value, e.Description)
+	for _, d := range e.Details {
+		d.write(b, depth+1)
+	}
+}
+
+// Search runs a query, returning hits in order of score, best first.
+// Documents that score the same are ordered by ID.
+func (ix *Index) Search(q Query, opts SearchOptions) (SearchResult, error) {
+	if opts.Limit < 0 || opts.Offset < 0 {
+		return SearchResult{}, fmt.Errorf("limit and offset can't be negative, got %d and %d", opts.Limit, opts.Offset)
+	}
+	start := time.Now()
+	ix.mu.RLock()
+	defer ix.mu.RUnlock()
+
+	s := ix.newSearcher(opts)
+	hits := []Hit{}
+	for _, seg := range ix.segments {
+		matches, _, err := s.evaluate(q, seg)
+		if err != nil {
+			return SearchResult{}, err
+		}
+		for doc, m := range matches {
+			hit := Hit{ID: seg.docs[doc].ID, Score: m.score, Doc: seg.docs[doc], Matches: map[string][]string{}}
+			for field, terms := range m.terms {
+				for term := range terms {
+					hit.Matches[field] = append(hit.Matches[field], term)
+				}
+				sort.Strings(hit.Matches[field])
+			}
+			if opts.Explain {
+				hit.Explanation = &m.explanation
+			}
+			hits = append(hits, hit)
+		}
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	result := SearchResult{Total: len(hits)}
+	if opts.Offset < len(hits) {
+		hits = hits[opts.Offset:]
+	} else {
+		hits = []Hit{}
+	}
+	if opts.Limit > 0 && opts.Limit < len(hits) {
+		hits = hits[:opts.Limit]
+	}
+	result.Hits = hits
+	result.Took = time.Since(start)
+	return result, nil
+}
+
+// A searcher scores matches for one search, caching the statistics of the
+// index it needs along the way. The index has to stay locked while it's used.
+type searcher struct {
+	ix      *Index
+	bm25    BM25
+	fields  map[string]float64
+	explain bool
+
+	docs    int
+	lengths map[string]float64 // Average length of each field
+	dfs     map[string]map[string]int
+}
+
+func (ix *Index) newSearcher(opts SearchOptions) *searcher {
+	s := &searcher{
+		ix:      ix,
+		bm25:    opts.BM25,
+		fields:  DefaultFields,
+		explain: opts.Explain,
+		docs:    len(ix.ids),
+		lengths: map[string]float64{},
+		dfs:     map[string]map[string]int{},
+	}
+	if s.bm25 == (BM25{}) {
+		s.bm25 = DefaultBM25
+	}
+	if len(opts.Fields) > 0 {
+		s.fields = map[string]float64{}
+		for _, f := range opts.Fields {
+			s.fields[f] = 1
+			if boost, ok := DefaultFields[f]; ok {
+				s.fields[f] = boost
+			}
+		}
+	}
+	if len(opts.Boosts) > 0 {
+		fields := s.fields
+		s.fields = map[string]float64{}
+		for f, boost := range fields {
+			s.fields[f] = boost
+			if b, ok := opts.Boosts[f]; ok {
+				s.fields[f] = b
+			}
+		}
+	}
+	return s
+}
+
+// The number of live documents a term appears in.
+func (s *searcher) df(field, term string) int {
+	if s.dfs[field] == nil {
+		s.dfs[field] = map[string]int{}
+	}
+	if n, ok := s.dfs[field][term]; ok {
+		return n
+	}
+	n := 0
+	for _, seg := range s.ix.segments {
+		for _, p := range seg.postings[field][term] {
+			if !seg.deleted[p.Doc] {
+				n++
+			}
+		}
+	}
+	s.dfs[field][term] = n
+	return n
+}
+
+// The average length of a field, over the live documents that have it.
+func (s *searcher) averageLength(field string) float64 {
+	if avg, ok := s.lengths[field]; ok {
+		return avg
+	}
+	total, docs := 0, 0
+	for _, seg := range s.ix.segments {
+		for i, lengths := range seg.lengths {
+			if !seg.deleted[i] && lengths[field] > 0 {
+				total += lengths[field]
+				docs++
+			}
+		}
+	}
+	avg := 0.0
+	if docs > 0 {
+		avg = float64(total) / float64(docs)
+	}
+	s.lengths[field] = avg
+	return avg
+}
+
+// What a query matched in one document.
+type docMatch struct {
+	score       float64
+	terms       map[string]map[string]bool
+	explanation Explanation
+}
+
+func (m *docMatch) addTerms(field string, terms ...string) {
+	if m.terms[field] == nil {
+		m.terms[field] = map[string]bool{}
+	}
+	for _, t := range terms {
+		m.terms[field][t] = true
+	}
+}
+
+// Adds the score & terms of another match of the same document.
+func (m *docMatch) add(other *docMatch) {
+	m.score += other.score
+	for field, terms := range other.terms {
+		for t := range terms {
+			m.addTerms(field, t)
+		}
+	}
+	m.explanation.Details = append(m.explanation.Details, other.explanation)
+}
+
+func newDocMatch(description string) *docMatch {
+	return &docMatch{terms: map[string]map[string]bool{}, explanation: Explanation{Description: description}}
+}
+
+// Finds the live documents in a segment that match a query. It also reports
+// whether the query had any terms, since one that didn't is left out of a
+// QUERY_BOOL rather than matching nothing.
+func (s *searcher) evaluate(q Query, seg *segment) (map[int]*docMatch, bool, error) {
+	var matches map[int]*docMatch
+	var hasTerms bool
+	var err error
+	switch q.Type {
+	case QUERY_MATCH, QUERY_PHRASE:
+		matches, hasTerms, err = s.evaluateFields(q, seg)
+	case QUERY_BOOL:
+		matches, hasTerms, err = s.evaluateBool(q, seg)
+	default:
+		err = fmt.Errorf("invalid query type: %d", q.Type)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if boost := q.boost(); boost != 1 {
+		for _, m := range matches {
+			m.score *= boost
+			m.explanation = Explanation{
+				Value:       m.score,
+				Description: fmt.Sprintf("boost %g of:", boost),
+				Details:     []Explanation{m.explanation},
+			}
+		}
+	}
+	return matches, hasTerms, nil
+}
+
+// Evaluates a match or phrase query against each of the fields it searches,
+// adding up the scores of each.
+func (s *searcher) evaluateFields(q Query, seg *segment) (map[int]*docMatch, bool, error) {
+	fields := map[string]float64{q.Field: 1}
+	if q.Field == "" {
+		fields = s.fields
+	}
+	matches := map[int]*docMatch{}
+	hasTerms := false
+	for _, field := range sortedKeys(fields) {
+		tokens, err := s.ix.mapping.AnalyzeQuery(field, q.Text)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(tokens) == 0 {
+			continue
+		}
+		hasTerms = true
+
+		var fieldMatches map[int]*docMatch
+		if q.Type == QUERY_PHRASE && len(tokens) > 1 {
+			fieldMatches = s.phrase(field, fields[field], tokens, seg)
+		} else {
+			fieldMatches = s.terms(field, fields[field], tokens, seg)
+		}
+		for doc, m := range fieldMatches {
+			if matches[doc] == nil {
+				matches[doc] = newDocMatch("sum of:")
+			}
+			matches[doc].add(m)
+		}
+	}
+	for _, m := range matches {
+		m.explanation.Value = m.score
+		if len(m.explanation.Details) == 1 {
+			m.explanation = m.explanation.Details[0]
+		}
+	}
+	return matches, hasTerms, nil
+}
+
+// Scores each of the terms of tokens that a document has in a field.
+func (s *searcher) terms(field string, boost float64, tokens []analysis.Token, seg *segment) map[int]*docMatch {
+	matches := map[int]*docMatch{}
+	seen := map[string]bool{}
+	for _, t := range tokens {
+		if seen[t.Value] {
+			continue
+		}
+		seen[t.Value] = true
+		idf := s.idf(field, t.Value)
+		for _, p := range seg.postings[field][t.Value] {
+			if seg.deleted[p.Doc] {
+				continue
+			}
+			m := newDocMatch("")
+			m.addTerms(field, t.Value)
+			m.score, m.explanation = s.score(fmt.Sprintf("%s:%s", field, t.Value), boost, idf, len(p.Positions), seg.lengths[p.Doc][field], field)
+			if matches[p.Doc] == nil {
+				matches[p.Doc] = newDocMatch("sum of:")
+			}
+			matches[p.Doc].add(m)
+		}
+	}
+	for _, m := range matches {
+		m.explanation.Value = m.score
+		if len(m.explanation.Details) == 1 {
+			m.explanation = m.explanation.Details[0]
+		}
+	}
+	return matches
+}
+
+// Scores the documents that have the terms of tokens next to each other in a
+// field. Both the query and the field can be token graphs: tokens at the same
+// position (e.g. synonyms) are alternatives, and one that spans more than one
+// position (e.g. "pr" for "pull request") is followed by whatever comes after
+// the positions it spans. Gaps between positions (e.g. where stopwords were)
+// have to be there in the document too.
+func (s *searcher) phrase(field string, boost float64, tokens []analysis.Token, seg *segment) map[int]*docMatch {
+	// The tokens starting at each position of the query
+	q := phraseGraph{starts: map[int][]analysis.Token{}}
+	for _, t := range tokens {
+		if _, ok := q.starts[t.Position]; !ok {
+			q.positions = append(q.positions, t.Position)
+		}
+		q.starts[t.Position] = append(q.starts[t.Position], t)
+		if end := t.Position + tokenLength(t); end > q.end {
+			q.end = end
+		}
+	}
+	sort.Ints(q.positions)
+
+	// Document -> position -> the terms of the phrase starting there
+	docs := map[int]map[int][]docTerm{}
+	seen := map[string]bool{}
+	for _, t := range tokens {
+		if seen[t.Value] {
+			continue
+		}
+		seen[t.Value] = true
+		for _, p := range seg.postings[field][t.Value] {
+			if seg.deleted[p.Doc] {
+				continue
+			}
+			if docs[p.Doc] == nil {
+				docs[p.Doc] = map[int][]docTerm{}
+			}
+			for i, pos := range p.Positions {
+				docs[p.Doc][pos] = append(docs[p.Doc][pos], docTerm{t.Value, p.Length(i)})
+			}
+		}
+	}
+
+	idf := 0.0
+	idfs := []Explanation{}
+	description := []string{}
+	for _, pos := range q.positions {
+		alternatives := []string{}
+		for _, t := range q.starts[pos] {
+			termIDF := s.idf(field, t.Value)
+			idf += termIDF.Value
+			idfs = append(idfs, termIDF)
+			alternatives = append(alternatives, t.Value)
+		}
+		description = append(description, strings.Join(alternatives, "|"))
+	}
+	combinedIDF := Explanation{Value: idf, Description: "idf, sum of:", Details: idfs}
+	name := fmt.Sprintf(`%s:"%s"`, field, strings.Join(description, " "))
+
+	matches := map[int]*docMatch{}
+	for doc, terms := range docs {
+		freq := 0
+		matched := map[string]bool{}
+		memo := map[[2]int]bool{}
+		for start := range terms {
+			if q.match(terms, q.positions[0], start, matched, memo) {
+				freq++
+			}
+		}
+		if freq == 0 {
+			continue
+		}
+		m := newDocMatch("")
+		for t := range matched {
+			m.addTerms(field, t)
+		}
+		m.score, m.explanation = s.score(name, boost, combinedIDF, freq, seg.lengths[doc][field], field)
+		matches[doc] = m
+	}
+	return matches
+}
+
+// A phrase as a token graph: the tokens starting at each of its positions,
+// and the position just past its last token.
+type phraseGraph struct {
+	positions []int
+	starts    map[int][]analysis.Token
+	end       int
+}
+
+// A term of a document, and how many positions it spans.
+type docTerm struct {
+	term   string
+	length int
+}
+
+// Reports whether the rest of the phrase, from its position at, is in the
+// document from position pos on, adding the terms that match to matched.
+// What's already been worked out for each pair of positions is kept in memo,
+// so that many alternatives at each position don't multiply.
+func (g phraseGraph) match(terms map[int][]docTerm, at, pos int, matched map[string]bool, memo map[[2]int]bool) bool {
+	if at >= g.end {
+		return true
+	}
+	if len(g.starts[at]) == 0 {
+		// A gap, which has to be in the document too
+		next := g.end
+		for _, p := range g.positions {
+			if p > at {
+				next = p
+				break
+			}
+		}
+		return g.match(terms, next, pos+next-at, matched, memo)
+	}
+	key := [2]int{at, pos}
+	if found, ok := memo[key]; ok {
+		return found
+	}
+	found := false
+	for _, t := range g.starts[at] {
+		for _, dt := range terms[pos] {
+			if dt.term != t.Value || !g.match(terms, at+tokenLength(t), pos+dt.length, matched, memo) {
+				continue
+			}
+			matched[dt.term] = true
+			found = true
+		}
+	}
+	memo[key] = found
+	return found
+}
+
+func tokenLength(t analysis.Token) int {
+	if t.PositionLength < 1 {
+		return 1
+	}
+	return t.PositionLength
+}
+
+func (s *searcher) idf(field, term string) Explanation {
+	df := s.df(field, term)
+	idf := math.Log(1 + (float64(s.docs)-float64(df)+0.5)/(float64(df)+0.5))
+	return Explanation{
+		Value:       idf,
+		Description: fmt.Sprintf("idf of %s:%s, computed as log(1 + (N - n + 0.5) / (n + 0.5)) from:", field, term),
+		Details: []Explanation{
+			{Value: float64(df), Description: "n, number of documents containing term"},
+			{Value: float64(s.docs), Description: "N, total number of documents"},
+		},
+	}
+}
+
+// Scores a term (or phrase) that appears freq times in a field of a given
+// length.
+func (s *searcher) score(name string, boost float64, idf Explanation, freq, length int, field string) (float64, Explanation) {
+	avg := s.averageLength(field)
+	norm := 1 - s.bm25.B
+	if avg > 0 {
+		norm += s.bm25.B * float64(length) / avg
+	}
+	tf := float64(freq) / (float64(freq) + s.bm25.K1*norm)
+	score := boost * idf.Value * tf
+	if !s.explain {
+		return score, Explanation{}
+	}
+	return score, Explanation{
+		Value:       score,
+		Description: fmt.Sprintf("weight(%s), computed as boost * idf * tf from:", name),
+		Details: []Explanation{
+			{Value: boost, Description: "boost"},
+			idf,
+			{
+				Value:       tf,
+				Description: "tf, computed as freq / (freq + k1 * (1 - b + b * dl / avgdl)) from:",
+				Details: []Explanation{
+					{Value: float64(freq), Description: "freq, occurrences of term within document"},
+					{Value: s.bm25.K1, Description: "k1, term saturation parameter"},
+					{Value: s.bm25.B, Description: "b, length normalization parameter"},
+					{Value: float64(length), Description: "dl, length of field"},
+					{Value: avg, Description: "avgdl, average length of field"},
+				},
+			},
+		},
+	}
+}
+
+// Combines the clauses of a QUERY_BOOL.
+func (s *searcher) evaluateBool(q Query, seg *segment) (map[int]*docMatch, bool, error) {
+	var matches map[int]*docMatch
+	hasTerms := false
+	for _, clause := range q.Must {
+		clauseMatches, clauseHasTerms, err := s.evaluate(clause, seg)
+		if err != nil {
+			return nil, false, err
+		}
+		if !clauseHasTerms {
+			continue
+		}
+		hasTerms = true
+		if matches == nil {
+			matches = map[int]*docMatch{}
+			for doc, m := range clauseMatches {
+				matches[doc] = newDocMatch("sum of:")
+				matches[doc].add(m)
+			}
+			continue
+		}
+		for doc, m := range matches {
+			if other, ok := clauseMatches[doc]; ok {
+				m.add(other)
+			} else {
+				delete(matches, doc)
+			}
+		}
+	}
+
+	required := matches != nil
+	should := map[int]*docMatch{}
+	for _, clause := range q.Should {
+		clauseMatches, clauseHasTerms, err := s.evaluate(clause, seg)
+		if err != nil {
+			return nil, false, err
+		}
+		hasTerms = hasTerms || clauseHasTerms
+		for doc, m := range clauseMatches {
+			if should[doc] == nil {
+				should[doc] = newDocMatch("sum of:")
+			}
+			should[doc].add(m)
+		}
+	}
+	if required {
+		for doc, m := range matches {
+			if other, ok := should[doc]; ok {
+				m.add(other)
+			}
+		}
+	} else if hasTerms {
+		matches = should
+	}
+
+	excluded := map[int]bool{}
+	for _, clause := range q.MustNot {
+		clauseMatches, clauseHasTerms, err := s.evaluate(clause, seg)
+		if err != nil {
+			return nil, false, err
+		}
+		hasTerms = hasTerms || clauseHasTerms
+		for doc := range clauseMatches {
+			excluded[doc] = true
+		}
+	}
+	// With nothing to match, everything does
+	if matches == nil {
+		matches = map[int]*docMatch{}
+		if hasTerms {
+			for doc := range seg.docs {
+				if !seg.deleted[doc] {
+					matches[doc] = newDocMatch("match all, excluding:")
+				}
+			}
+		}
+	}
+	for doc := range excluded {
+		delete(matches, doc)
+	}
+
+	for _, m := range matches {
+		m.explanation.Value = m.score
+		if len(m.explanation.Details) == 1 {
+			m.explanation = m.explanation.Details[0]
+		}
+	}
+	return matches, hasTerms, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
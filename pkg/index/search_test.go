@@ -0,0 +1,249 @@
+package index
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mrshanahan.com/notes-indexer/pkg/analysis"
+	"mrshanahan.com/notes-indexer/pkg/markdown"
+	"mrshanahan.com/notes-indexer/pkg/tokenizer"
+)
+
+func testIndex(t *testing.T, notes map[string]string) *Index {
+	ix, err := Open(t.TempDir(), nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() { ix.Close() })
+	for _, id := range sortedKeys(notes) {
+		assert.Nil(t, ix.Put(testDocument(t, id, notes[id])))
+	}
+	return ix
+}
+
+func searchIDs(t *testing.T, ix *Index, query string, opts SearchOptions) []string {
+	q, err := ParseQuery(query)
+	assert.Nil(t, err)
+	result, err := ix.Search(q, opts)
+	assert.Nil(t, err)
+	ids := []string{}
+	for _, h := range result.Hits {
+		ids = append(ids, h.ID)
+	}
+	return ids
+}
+
+var fruitNotes map[string]string = map[string]string{
+	"apples.md":  "# Apples\n\nRed apples and green apples make a good pie.\n",
+	"pie.md":     "# Baking\n\nA pie crust needs butter. Apple pie is the best pie.\n",
+	"pears.md":   "# Pears\n\nPears are green, and ripen after picking. #done\n",
+	"recipes.md": "# Recipes\n\n- pie crust\n- apple crumble\n",
+}
+
+func TestSearchRanking(t *testing.T) {
+	ix := testIndex(t, fruitNotes)
+
+	// Matches in short fields count for more, and recipes.md is the only
+	// note with a list, which makes its terms rarer there
+	assert.Equal(t, []string{"apples.md", "recipes.md", "pie.md"}, searchIDs(t, ix, "apples", SearchOptions{}))
+	assert.Equal(t, []string{"recipes.md", "pie.md", "apples.md"}, searchIDs(t, ix, "pie", SearchOptions{}))
+	assert.Equal(t, []string{}, searchIDs(t, ix, "bananas", SearchOptions{}))
+}
+
+func TestSearchPhrase(t *testing.T) {
+	ix := testIndex(t, fruitNotes)
+
+	assert.Equal(t, []string{"recipes.md", "pie.md"}, searchIDs(t, ix, `"pie crust"`, SearchOptions{}))
+	assert.Equal(t, []string{}, searchIDs(t, ix, `"crust pie"`, SearchOptions{}))
+	// "is the" leaves a gap the document has to have too
+	assert.Equal(t, []string{"pie.md"}, searchIDs(t, ix, `"apple pie is the best pie"`, SearchOptions{}))
+	assert.Equal(t, []string{}, searchIDs(t, ix, `"apple pie best pie"`, SearchOptions{}))
+}
+
+func TestSearchPhraseSynonyms(t *testing.T) {
+	synonyms := analysis.NewSynonymMap()
+	synonyms.Add([]string{"pr"}, [][]string{{"pr"}, {"pull", "request"}})
+	synonyms.Add([]string{"pull", "request"}, [][]string{{"pr"}, {"pull", "request"}})
+	analysis.Register("test_phrase_synonyms", analysis.New(tokenizer.NewDefault(), analysis.NewSynonymFilter(synonyms)))
+	mapping := &analysis.Mapping{DefaultAnalyzer: "simple"}
+
+	// Synonyms expanded as indexed: "pr" spans both positions of "pull
+	// request", so whatever follows either is after it
+	mapping.Fields = []analysis.Field{{Name: "body", Analyzer: "test_phrase_synonyms", SearchAnalyzer: "simple"}}
+	ix, err := Open(t.TempDir(), mapping)
+	assert.Nil(t, err)
+	defer ix.Close()
+	assert.Nil(t, ix.Put(testDocument(t, "pr.md", "# Notes\n\nPR merged today.\n")))
+	assert.Nil(t, ix.Put(testDocument(t, "pull.md", "# Notes\n\nThe pull request merged today.\n")))
+	assert.Equal(t, []string{"pr.md", "pull.md"}, sortedStrings(searchIDs(t, ix, `body:"pr merged"`, SearchOptions{})))
+	assert.Equal(t, []string{"pr.md", "pull.md"}, sortedStrings(searchIDs(t, ix, `body:"pull request merged"`, SearchOptions{})))
+	assert.Equal(t, []string{}, searchIDs(t, ix, `body:"pr request"`, SearchOptions{}))
+
+	// And as searched for
+	mapping.Fields = []analysis.Field{{Name: "body", Analyzer: "simple", SearchAnalyzer: "test_phrase_synonyms"}}
+	ix2, err := Open(t.TempDir(), mapping)
+	assert.Nil(t, err)
+	defer ix2.Close()
+	assert.Nil(t, ix2.Put(testDocument(t, "pr.md", "# Notes\n\nPR merged today.\n")))
+	assert.Nil(t, ix2.Put(testDocument(t, "pull.md", "# Notes\n\nThe pull request merged today.\n")))
+	assert.Equal(t, []string{"pr.md", "pull.md"}, sortedStrings(searchIDs(t, ix2, `body:"pr merged"`, SearchOptions{})))
+	assert.Equal(t, []string{"pr.md", "pull.md"}, sortedStrings(searchIDs(t, ix2, `body:"pull request merged"`, SearchOptions{})))
+	assert.Equal(t, []string{}, searchIDs(t, ix2, `body:"pr today"`, SearchOptions{}))
+}
+
+func TestSearchMappingSynonyms(t *testing.T) {
+	notes := map[string]string{
+		"k8s.md": "# Cluster\n\nUpgraded k8s today.\n",
+		"pr.md":  "# Review\n\nThe pull request merged.\n",
+		"other":  "# Other\n\nNothing to see.\n",
+	}
+	for _, at := range []string{analysis.SYNONYMS_INDEX, analysis.SYNONYMS_QUERY, analysis.SYNONYMS_BOTH} {
+		t.Run(at, func(t *testing.T) {
+			mapping := DefaultMapping()
+			mapping.Synonyms = []string{"k8s, kubernetes", "pr, pull request"}
+			mapping.DefaultSynonyms = at
+			dir := t.TempDir()
+			ix, err := Open(dir, mapping)
+			assert.Nil(t, err)
+			for _, id := range sortedKeys(notes) {
+				assert.Nil(t, ix.Put(testDocument(t, id, notes[id])))
+			}
+			assert.Nil(t, ix.Close())
+
+			// The synonyms are kept with the index
+			ix, err = OpenReadOnly(dir)
+			assert.Nil(t, err)
+			assert.Equal(t, []string{"k8s.md"}, searchIDs(t, ix, "kubernetes", SearchOptions{}))
+			assert.Equal(t, []string{"k8s.md"}, searchIDs(t, ix, "k8s", SearchOptions{}))
+			assert.Equal(t, []string{"pr.md"}, searchIDs(t, ix, `"pr merged"`, SearchOptions{}))
+			assert.Equal(t, []string{"pr.md"}, searchIDs(t, ix, `"pull request merged"`, SearchOptions{}))
+			assert.Equal(t, []string{}, searchIDs(t, ix, `"pr request"`, SearchOptions{}))
+		})
+	}
+}
+
+func TestSearchSiblingFields(t *testing.T) {
+	mapping := DefaultMapping()
+	mapping.Fields = append(mapping.Fields,
+		analysis.PrefixField(FIELD_TITLE), analysis.PrefixField(markdown.FIELD_BODY), analysis.InfixField(markdown.FIELD_BODY))
+	dir := t.TempDir()
+	ix, err := Open(dir, mapping)
+	assert.Nil(t, err)
+	assert.Nil(t, ix.Put(testDocument(t, "k8s.md", "# Kubernetes\n\nUpgraded the cluster.\n")))
+	assert.Nil(t, ix.Put(testDocument(t, "etl.md", "# Pipelines\n\nReingestion of the clusters' logs.\n")))
+	assert.Nil(t, ix.Close())
+
+	ix, err = OpenReadOnly(dir)
+	assert.Nil(t, err)
+	// As you type
+	assert.Equal(t, []string{"k8s.md"}, searchIDs(t, ix, "title.prefix:kube", SearchOptions{}))
+	assert.Equal(t, []string{"k8s.md", "etl.md"}, searchIDs(t, ix, "body.prefix:clus", SearchOptions{}))
+	// Part of a word
+	assert.Equal(t, []string{"etl.md"}, searchIDs(t, ix, "body.infix:ingest", SearchOptions{}))
+	// Neither is searched unless asked for
+	assert.Equal(t, []string{}, searchIDs(t, ix, "kube", SearchOptions{}))
+	assert.Equal(t, []string{"k8s.md"}, searchIDs(t, ix, "kube", SearchOptions{Fields: []string{"title.prefix"}}))
+}
+
+func TestSearchPhonetic(t *testing.T) {
+	mapping := DefaultMapping()
+	mapping.Fields = append(mapping.Fields, analysis.PhoneticField(markdown.FIELD_BODY))
+	ix, err := Open(t.TempDir(), mapping)
+	assert.Nil(t, err)
+	defer ix.Close()
+	assert.Nil(t, ix.Put(testDocument(t, "a.md", "# Contacts\n\nCall Mark Shanahan about the budget.\n")))
+	assert.Nil(t, ix.Put(testDocument(t, "b.md", "# Contacts\n\nCall Mary about the roadmap.\n")))
+
+	assert.Equal(t, []string{"a.md"}, searchIDs(t, ix, "body.phonetic:shannahan", SearchOptions{}))
+	assert.Equal(t, []string{"a.md"}, searchIDs(t, ix, `body.phonetic:"marc shanahan"`, SearchOptions{}))
+	// Sound-alikes only match when asked for
+	assert.Equal(t, []string{}, searchIDs(t, ix, "shannahan", SearchOptions{}))
+}
+
+func sortedStrings(ss []string) []string {
+	sort.Strings(ss)
+	return ss
+}
+
+func TestSearchOccurs(t *testing.T) {
+	ix := testIndex(t, fruitNotes)
+
+	assert.Equal(t, []string{"apples.md", "pie.md"}, searchIDs(t, ix, "+pie apple -crumble", SearchOptions{}))
+	assert.Equal(t, []string{"pears.md", "apples.md"}, searchIDs(t, ix, "+green", SearchOptions{}))
+	assert.Equal(t, []string{"apples.md", "pie.md", "recipes.md"}, searchIDs(t, ix, "-tags:done", SearchOptions{}))
+	// Stopwords alone have no terms in an English field, so are left out
+	assert.Equal(t, []string{"pears.md"}, searchIDs(t, ix, "+title:the pears", SearchOptions{}))
+	assert.Equal(t, []string{}, searchIDs(t, ix, "the", SearchOptions{}))
+}
+
+func TestSearchFields(t *testing.T) {
+	ix := testIndex(t, fruitNotes)
+
+	assert.Equal(t, []string{"pears.md"}, searchIDs(t, ix, "title:pears", SearchOptions{}))
+	assert.Equal(t, []string{"apples.md"}, searchIDs(t, ix, "apples", SearchOptions{Fields: []string{FIELD_TITLE}}))
+	assert.Equal(t, []string{"pears.md"}, searchIDs(t, ix, "tags:done", SearchOptions{Fields: []string{FIELD_TITLE}}))
+}
+
+func TestSearchBoosts(t *testing.T) {
+	ix := testIndex(t, fruitNotes)
+
+	// recipes.md only has pie in its list
+	assert.Equal(t, []string{"pie.md", "apples.md", "recipes.md"}, searchIDs(t, ix, "pie", SearchOptions{Boosts: map[string]float64{"list": 0.1}}))
+	// A boost doesn't make a field searched
+	assert.Equal(t, []string{"pie.md", "apples.md"}, searchIDs(t, ix, "pie", SearchOptions{Fields: []string{"title", "body"}, Boosts: map[string]float64{"list": 10}}))
+}
+
+func TestSearchLimitOffset(t *testing.T) {
+	ix := testIndex(t, fruitNotes)
+	q, _ := ParseQuery("apples")
+
+	result, err := ix.Search(q, SearchOptions{Limit: 1, Offset: 1})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, result.Total)
+	assert.Len(t, result.Hits, 1)
+	assert.Equal(t, "recipes.md", result.Hits[0].ID)
+
+	result, err = ix.Search(q, SearchOptions{Offset: 5})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, result.Total)
+	assert.Empty(t, result.Hits)
+
+	_, err = ix.Search(q, SearchOptions{Offset: -1})
+	assert.ErrorContains(t, err, "can't be negative")
+	_, err = ix.Search(q, SearchOptions{Limit: -1})
+	assert.ErrorContains(t, err, "can't be negative")
+}
+
+func TestSearchIgnoresDeleted(t *testing.T) {
+	ix := testIndex(t, fruitNotes)
+	assert.Nil(t, ix.Commit())
+	_, err := ix.Delete("apples.md")
+	assert.Nil(t, err)
+	assert.Nil(t, ix.Put(testDocument(t, "pie.md", "# Baking\n\nBread.\n")))
+
+	assert.Equal(t, []string{"recipes.md"}, searchIDs(t, ix, "apple", SearchOptions{}))
+}
+
+func TestSearchExplain(t *testing.T) {
+	ix := testIndex(t, fruitNotes)
+	q, _ := ParseQuery("title:pears")
+
+	result, err := ix.Search(q, SearchOptions{Explain: true, BM25: BM25{K1: 1.5, B: 0.75}})
+
+	assert.Nil(t, err)
+	assert.Len(t, result.Hits, 1)
+	hit := result.Hits[0]
+	assert.Equal(t, map[string][]string{"title": {"pear"}}, hit.Matches)
+	e := hit.Explanation
+	assert.NotNil(t, e)
+	assert.Equal(t, hit.Score, e.Value)
+	assert.Equal(t, "weight(title:pear), computed as boost * idf * tf from:", e.Description)
+	assert.Len(t, e.Details, 3)
+	assert.InDelta(t, 1.2040, e.Details[1].Value, 0.0001) // log(1 + 3.5 / 1.5)
+	assert.InDelta(t, 0.4, e.Details[2].Value, 0.0001)    // 1 / (1 + 1.5)
+	assert.Equal(t, 1.5, e.Details[2].Details[1].Value)
+
+	result, err = ix.Search(q, SearchOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, result.Hits[0].Explanation)
+}
@@ -0,0 +1,224 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"mrshanahan.com/notes-indexer/pkg/markdown"
+)
+
+// DEFAULT_SNIPPET_SIZE is roughly how many bytes of text a snippet shows.
+const DEFAULT_SNIPPET_SIZE int = 160
+
+// The source fields a snippet is preferably taken from, best first, when
+// more than one has as many matches. Any others come after, by name.
+var snippetFields []string = []string{
+	markdown.FIELD_BODY,
+	markdown.FIELD_LIST,
+	markdown.FIELD_QUOTE,
+	markdown.FIELD_HEADER,
+	markdown.FIELD_CODE,
+	markdown.FIELD_LINK,
+}
+
+// Snippet is an excerpt of a document showing where it matched a search.
+// Highlights are the byte offsets in Text of each term that matched, along
+// with where the term is in the note itself if that's known.
+type Snippet struct {
+	Field      string      `json:"field"`
+	Text       string      `json:"text"`
+	Highlights []Highlight `json:"highlights"`
+}
+
+type Highlight struct {
+	Start  int              `json:"start"`
+	End    int              `json:"end"`
+	Source *markdown.MDSpan `json:"source,omitempty"`
+}
+
+// Marked returns the text of the snippet with each highlight between pre &
+// post, e.g. "<mark>" & "</mark>".
+func (s Snippet) Marked(pre, post string) string {
+	b := strings.Builder{}
+	last := 0
+	for _, h := range s.Highlights {
+		b.WriteString(s.Text[last:h.Start])
+		b.WriteString(pre)
+		b.WriteString(s.Text[h.Start:h.End])
+		b.WriteString(post)
+		last = h.End
+	}
+	b.WriteString(s.Text[last:])
+	return b.String()
+}
+
+// Snippet picks an excerpt of about size bytes from a hit, from the source
+// field where it matched the most distinct terms, and the part of that with
+// the most of them. Whitespace is collapsed so the excerpt fits on one line.
+// A hit that only matched in its title or tags (which are shown anyway) gets
+// the start of its body.
+func (ix *Index) Snippet(hit Hit, size int) Snippet {
+	if size <= 0 {
+		size = DEFAULT_SNIPPET_SIZE
+	}
+
+	// Source field -> the terms matched in each field built from it
+	matched := map[string]map[string]map[string]bool{}
+	for field, terms := range hit.Matches {
+		source := ix.mapping.SourceOf(field)
+		if hit.Doc.Fields[source] == "" {
+			continue
+		}
+		if matched[source] == nil {
+			matched[source] = map[string]map[string]bool{}
+		}
+		matched[source][field] = map[string]bool{}
+		for _, t := range terms {
+			matched[source][field][t] = true
+		}
+	}
+	source, best := "", 0
+	for _, f := range append(append([]string{}, snippetFields...), sortedKeys(matched)...) {
+		if n := countTerms(matched[f]); n > best && f != FIELD_TITLE && f != FIELD_TAGS {
+			source, best = f, n
+		}
+	}
+	if source == "" {
+		if hit.Doc.Fields[markdown.FIELD_BODY] == "" {
+			return Snippet{Field: FIELD_TITLE, Text: hit.Doc.Title, Highlights: []Highlight{}}
+		}
+		source = markdown.FIELD_BODY
+	}
+
+	text := hit.Doc.Fields[source]
+	highlights := []Highlight{}
+	terms := []string{}
+	analyzed, err := ix.mapping.Analyze(source, text)
+	if err == nil {
+		for field, tokens := range analyzed {
+			for _, t := range tokens {
+				if matched[source][field][t.Value] && t.End > t.Start {
+					h := Highlight{Start: t.Start, End: t.End}
+					if span, ok := hit.Doc.SourceSpan(source, t.Start, t.End); ok {
+						h.Source = &span
+					}
+					highlights = append(highlights, h)
+					terms = append(terms, t.Value)
+				}
+			}
+		}
+	}
+	return excerpt(source, text, highlights, terms, size)
+}
+
+func countTerms(fields map[string]map[string]bool) int {
+	n := 0
+	for _, terms := range fields {
+		n += len(terms)
+	}
+	return n
+}
+
+// Cuts the part of text with the most distinct terms highlighted in it.
+// terms[i] is the term highlights[i] is of.
+func excerpt(field, text string, highlights []Highlight, terms []string, size int) Snippet {
+	order := make([]int, len(highlights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return highlights[order[i]].Start < highlights[order[j]].Start })
+
+	start, end := 0, len(text)
+	if len(text) > size {
+		// Start a little before whichever highlight has the most distinct
+		// terms in the window after it
+		bestStart, bestCount := 0, 0
+		for i, h := range order {
+			distinct := map[string]bool{}
+			for _, o := range order[i:] {
+				if highlights[o].End > highlights[h].Start+size {
+					break
+				}
+				distinct[terms[o]] = true
+			}
+			if len(distinct) > bestCount {
+				bestStart, bestCount = highlights[h].Start, len(distinct)
+			}
+		}
+		start = bestStart - size/4
+		if start < 0 {
+			start = 0
+		}
+		end = start + size
+		if end > len(text) {
+			end, start = len(text), len(text)-size
+		}
+		start, end = wordStart(text, start), wordEnd(text, end)
+	}
+
+	snippet := Snippet{Field: field, Highlights: []Highlight{}}
+	prefix := ""
+	if start > 0 {
+		prefix = "…"
+	}
+	last := -1
+	for _, o := range order {
+		h := highlights[o]
+		if h.Start < start || h.End > end || h.Start < last {
+			continue
+		}
+		last = h.End
+		h.Start, h.End = h.Start-start+len(prefix), h.End-start+len(prefix)
+		snippet.Highlights = append(snippet.Highlights, h)
+	}
+	snippet.Text = prefix + collapseSpace(text[start:end])
+	if end < len(text) {
+		snippet.Text += "…"
+	}
+	return snippet
+}
+
+// Moves an offset forward to the start of a word, unless that's too far.
+func wordStart(text string, i int) int {
+	if i == 0 {
+		return 0
+	}
+	for j := i; j < len(text) && j < i+20; j++ {
+		if isSnippetSpace(text[j-1]) && !isSnippetSpace(text[j]) {
+			return j
+		}
+	}
+	for i < len(text) && !utf8.RuneStart(text[i]) {
+		i++
+	}
+	return i
+}
+
+// Moves an offset back to the end of a word, unless that's too far.
+func wordEnd(text string, i int) int {
+	if i == len(text) {
+		return i
+	}
+	for j := i; j > 0 && j > i-20; j-- {
+		if !isSnippetSpace(text[j-1]) && isSnippetSpace(text[j]) {
+			return j
+		}
+	}
+	for i > 0 && !utf8.RuneStart(text[i]) {
+		i--
+	}
+	return i
+}
+
+func isSnippetSpace(c byte) bool { return c == ' ' || c == '\t' || c == '\n' || c == '\r' }
+
+// Replaces line breaks & tabs with spaces, keeping every offset the same.
+func collapseSpace(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' || r == '\t' {
+			return ' '
+		}
+		return r
+	}, text)
+}
@@ -0,0 +1,78 @@
+package index
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mrshanahan.com/notes-indexer/pkg/markdown"
+)
+
+func TestSnippet(t *testing.T) {
+	ix := testIndex(t, fruitNotes)
+	q, _ := ParseQuery("green apple")
+	result, err := ix.Search(q, SearchOptions{})
+	assert.Nil(t, err)
+
+	snippet := ix.Snippet(result.Hits[0], 0)
+
+	assert.Equal(t, "apples.md", result.Hits[0].ID)
+	assert.Equal(t, markdown.FIELD_BODY, snippet.Field)
+	assert.Equal(t, "Red [apples] and [green] [apples] make a good pie.", snippet.Marked("[", "]"))
+}
+
+func TestSnippetSources(t *testing.T) {
+	content := "# Pie\n\nRed *apples* make\na good **pie**.\n"
+	// Sources are kept once committed
+	dir := t.TempDir()
+	ix, err := Open(dir, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, ix.Put(testDocument(t, "pie.md", content)))
+	assert.Nil(t, ix.Commit())
+	assert.Nil(t, ix.Close())
+	ix, err = OpenReadOnly(dir)
+	assert.Nil(t, err)
+	defer ix.Close()
+	q, _ := ParseQuery("apple pie")
+	result, err := ix.Search(q, SearchOptions{})
+	assert.Nil(t, err)
+
+	snippet := ix.Snippet(result.Hits[0], 0)
+
+	assert.Equal(t, "Red [apples] make a good [pie].", snippet.Marked("[", "]"))
+	sources := []string{}
+	for _, h := range snippet.Highlights {
+		if assert.NotNil(t, h.Source) {
+			sources = append(sources, fmt.Sprintf("%s %v", content[h.Source.Start.Offset:h.Source.End.Offset], h.Source.Start))
+		}
+	}
+	assert.Equal(t, []string{"apples 3:6", "pie 4:10"}, sources)
+}
+
+func TestSnippetFromTitleMatch(t *testing.T) {
+	ix := testIndex(t, fruitNotes)
+	q, _ := ParseQuery("title:baking")
+	result, err := ix.Search(q, SearchOptions{})
+	assert.Nil(t, err)
+
+	snippet := ix.Snippet(result.Hits[0], 0)
+
+	assert.Equal(t, markdown.FIELD_BODY, snippet.Field)
+	assert.Equal(t, "A pie crust needs butter. Apple pie is the best pie.", snippet.Marked("[", "]"))
+}
+
+func TestSnippetWindow(t *testing.T) {
+	body := strings.Repeat("filler words here. ", 10) + "the needle\nis found here" + strings.Repeat(" and more filler", 10)
+	ix := testIndex(t, map[string]string{"a.txt": ""})
+	doc, err := NewDocument("b.txt", DOC_TYPE_PLAIN, []byte(body))
+	assert.Nil(t, err)
+	assert.Nil(t, ix.Put(doc))
+	q, _ := ParseQuery("needle found")
+	result, err := ix.Search(q, SearchOptions{})
+	assert.Nil(t, err)
+
+	snippet := ix.Snippet(result.Hits[0], 60)
+
+	assert.Equal(t, "…here. the [needle] is [found] here and more filler and more…", snippet.Marked("[", "]"))
+}
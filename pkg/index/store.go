@@ -0,0 +1,275 @@
+package index
+
+import (
+	"bufio"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mrshanahan.com/notes-indexer/pkg/analysis"
+)
+
+// An index directory holds a manifest listing the segments of the last
+// commit, and a few files per segment:
+//
+//	segments.json  the manifest, along with anything set by SetMeta
+//	_N.docs        the segment's documents
+//	_N.post        its postings
+//	_N.len         the length of each field of each document
+//	_N_G.del       the documents deleted from it as of commit G, if any
+//
+// Everything but the manifest is gob-encoded. A commit writes new files and
+// then swaps in a new manifest, so a reader only ever sees whole commits.
+const (
+	MANIFEST_FILE string = "segments.json"
+	LOCK_FILE     string = "write.lock"
+
+	EXT_DOCS     string = ".docs"
+	EXT_POSTINGS string = ".post"
+	EXT_LENGTHS  string = ".len"
+	EXT_DELETES  string = ".del"
+
+	formatVersion int = 1
+)
+
+type manifest struct {
+	Version     int               `json:"version"`
+	Generation  int               `json:"generation"`
+	NextSegment int               `json:"next_segment"`
+	Mapping     *analysis.Mapping `json:"mapping"`
+	Segments    []manifestSegment `json:"segments"`
+	Meta        map[string]string `json:"meta,omitempty"`
+}
+
+type manifestSegment struct {
+	Name    string `json:"name"`
+	Docs    int    `json:"docs"`
+	Deletes string `json:"deletes,omitempty"`
+}
+
+// Exists reports whether dir holds an index.
+func Exists(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, MANIFEST_FILE))
+	return err == nil
+}
+
+func (ix *Index) manifest() manifest {
+	m := manifest{
+		Version:     formatVersion,
+		Generation:  ix.generation,
+		NextSegment: ix.nextSegment,
+		Mapping:     ix.mapping,
+		Segments:    []manifestSegment{},
+		Meta:        ix.meta,
+	}
+	for _, seg := range ix.segments {
+		m.Segments = append(m.Segments, manifestSegment{Name: seg.name, Docs: len(seg.docs), Deletes: seg.deletesFile})
+	}
+	return m
+}
+
+// Reads the index in dir as of its last commit. An index that doesn't exist
+// yet is empty, with no mapping.
+func load(dir string, readOnly bool) (*Index, error) {
+	for attempt := 1; ; attempt++ {
+		ix, err := loadManifest(dir, readOnly)
+		// A commit while the segments are being read can remove them, in
+		// which case there's a newer manifest to read instead
+		if errors.Is(err, fs.ErrNotExist) && attempt < 3 {
+			continue
+		}
+		return ix, err
+	}
+}
+
+func loadManifest(dir string, readOnly bool) (*Index, error) {
+	ix := &Index{dir: dir, readOnly: readOnly, segments: []*segment{}, ids: map[string]docRef{}, meta: map[string]string{}}
+	data, err := os.ReadFile(filepath.Join(dir, MANIFEST_FILE))
+	if errors.Is(err, fs.ErrNotExist) {
+		return ix, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := manifest{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid index manifest: %w", err)
+	}
+	if m.Version != formatVersion {
+		return nil, fmt.Errorf("unsupported index format version: %d", m.Version)
+	}
+
+	ix.mapping, ix.generation, ix.nextSegment = m.Mapping, m.Generation, m.NextSegment
+	if m.Meta != nil {
+		ix.meta = m.Meta
+	}
+	for _, ms := range m.Segments {
+		seg, err := readSegment(dir, ms)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read segment %s: %w", ms.Name, err)
+		}
+		ix.segments = append(ix.segments, seg)
+		for i, doc := range seg.docs {
+			if !seg.deleted[i] {
+				ix.ids[doc.ID] = docRef{seg, i}
+			}
+		}
+	}
+	return ix, nil
+}
+
+func readSegment(dir string, ms manifestSegment) (*segment, error) {
+	seg := newSegment(ms.Name)
+	seg.saved, seg.deletesFile = true, ms.Deletes
+	if err := readGob(filepath.Join(dir, ms.Name+EXT_DOCS), &seg.docs); err != nil {
+		return nil, err
+	}
+	if err := readGob(filepath.Join(dir, ms.Name+EXT_POSTINGS), &seg.postings); err != nil {
+		return nil, err
+	}
+	if err := readGob(filepath.Join(dir, ms.Name+EXT_LENGTHS), &seg.lengths); err != nil {
+		return nil, err
+	}
+	if len(seg.docs) != ms.Docs || len(seg.lengths) != ms.Docs {
+		return nil, fmt.Errorf("expected %d documents, found %d", ms.Docs, len(seg.docs))
+	}
+	// Gob doesn't tell empty slices from nil ones
+	for i := range seg.docs {
+		if seg.docs[i].Tags == nil {
+			seg.docs[i].Tags = []string{}
+		}
+		if seg.docs[i].Links == nil {
+			seg.docs[i].Links = []string{}
+		}
+	}
+	if ms.Deletes != "" {
+		deleted := []int{}
+		if err := readGob(filepath.Join(dir, ms.Deletes), &deleted); err != nil {
+			return nil, err
+		}
+		for _, d := range deleted {
+			seg.deleted[d] = true
+		}
+	}
+	return seg, nil
+}
+
+func writeSegment(dir string, seg *segment) error {
+	if err := writeGob(filepath.Join(dir, seg.name+EXT_DOCS), seg.docs); err != nil {
+		return err
+	}
+	if err := writeGob(filepath.Join(dir, seg.name+EXT_POSTINGS), seg.postings); err != nil {
+		return err
+	}
+	return writeGob(filepath.Join(dir, seg.name+EXT_LENGTHS), seg.lengths)
+}
+
+// Writes the deletions of a segment as of the given commit.
+func writeDeletes(dir string, seg *segment, generation int) error {
+	if len(seg.deleted) == 0 {
+		seg.deletesFile = ""
+		return nil
+	}
+	deleted := make([]int, 0, len(seg.deleted))
+	for d := range seg.deleted {
+		deleted = append(deleted, d)
+	}
+	sort.Ints(deleted)
+	name := fmt.Sprintf("%s_%d%s", seg.name, generation, EXT_DELETES)
+	if err := writeGob(filepath.Join(dir, name), deleted); err != nil {
+		return err
+	}
+	seg.deletesFile = name
+	return nil
+}
+
+func writeManifest(dir string, m manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, MANIFEST_FILE), func(f *os.File) error {
+		_, err := f.Write(append(data, '\n'))
+		return err
+	})
+}
+
+// Removes the segment files the manifest no longer refers to.
+func removeUnused(dir string, m manifest) error {
+	used := map[string]bool{}
+	for _, ms := range m.Segments {
+		used[ms.Name+EXT_DOCS], used[ms.Name+EXT_POSTINGS], used[ms.Name+EXT_LENGTHS] = true, true, true
+		used[ms.Deletes] = true
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if IsIndexFile(e.Name()) && !used[e.Name()] {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// IsIndexFile reports whether a file in an index directory is one of its
+// segment files.
+func IsIndexFile(name string) bool {
+	if !strings.HasPrefix(name, "_") {
+		return false
+	}
+	switch filepath.Ext(name) {
+	case EXT_DOCS, EXT_POSTINGS, EXT_LENGTHS, EXT_DELETES:
+		return true
+	}
+	return false
+}
+
+func readGob(path string, v any) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return gob.NewDecoder(bufio.NewReader(f)).Decode(v)
+}
+
+func writeGob(path string, v any) error {
+	return writeFile(path, func(f *os.File) error {
+		w := bufio.NewWriter(f)
+		if err := gob.NewEncoder(w).Encode(v); err != nil {
+			return err
+		}
+		return w.Flush()
+	})
+}
+
+// Writes a file by way of a temporary one, so it's never seen half-written.
+func writeFile(path string, write func(*os.File) error) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
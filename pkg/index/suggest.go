@@ -0,0 +1,70 @@
+package index
+
+import (
+	"sort"
+	"strings"
+
+	"mrshanahan.com/notes-indexer/pkg/markdown"
+)
+
+// The fields words are suggested from: the ones that say what a note is
+// about, rather than everything in it.
+var suggestFields []string = []string{FIELD_TITLE, FIELD_TAGS, markdown.FIELD_HEADER}
+
+// Suggestion is a completion of what's been typed into a search box, along
+// with how many documents have the word it completes.
+type Suggestion struct {
+	Text string `json:"text"`
+	Docs int    `json:"docs"`
+}
+
+// Suggest completes the last word of prefix with the terms indexed from the
+// titles, tags & headers of documents, found by scanning their postings. The
+// terms are as they're indexed, so stemmed where the field is analyzed as
+// English. The terms in the most documents come first, and ties are sorted.
+func (ix *Index) Suggest(prefix string, limit int) []Suggestion {
+	suggestions := []Suggestion{}
+	split := strings.LastIndexAny(prefix, " \t\n") + 1
+	before, word := prefix[:split], strings.ToLower(prefix[split:])
+	if word == "" {
+		return suggestions
+	}
+
+	ix.mu.RLock()
+	docs := map[string]int{}
+	for _, seg := range ix.segments {
+		// A document counts once for a term, however many fields it's in
+		seen := map[string]map[int]bool{}
+		for _, field := range suggestFields {
+			for term, ps := range seg.postings[field] {
+				if !strings.HasPrefix(term, word) {
+					continue
+				}
+				if seen[term] == nil {
+					seen[term] = map[int]bool{}
+				}
+				for _, p := range ps {
+					if !seg.deleted[p.Doc] && !seen[term][p.Doc] {
+						seen[term][p.Doc] = true
+						docs[term]++
+					}
+				}
+			}
+		}
+	}
+	ix.mu.RUnlock()
+
+	for term, n := range docs {
+		suggestions = append(suggestions, Suggestion{Text: before + term, Docs: n})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Docs != suggestions[j].Docs {
+			return suggestions[i].Docs > suggestions[j].Docs
+		}
+		return suggestions[i].Text < suggestions[j].Text
+	})
+	if limit > 0 && len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
@@ -0,0 +1,26 @@
+package index
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSuggest(t *testing.T) {
+	ix := testIndex(t, map[string]string{
+		"a.md": "# Apples\n\n## Apple varieties\n",
+		"b.md": "# Applesauce\n\nApplications aren't suggested from the body.\n",
+		"c.md": "---\ntags: [apple]\n---\n# Cider\n",
+		"d.md": "# Apple pie\n",
+	})
+
+	// Titles & headers are stemmed, while tags aren't
+	assert.Equal(t, []Suggestion{{"appl", 2}, {"apple", 1}, {"applesauc", 1}}, ix.Suggest("App", 0))
+	assert.Equal(t, []Suggestion{{"red appl", 2}}, ix.Suggest("red app", 1))
+	assert.Equal(t, []Suggestion{}, ix.Suggest("apples ", 0))
+	assert.Equal(t, []Suggestion{}, ix.Suggest("zz", 0))
+
+	_, err := ix.Delete("d.md")
+	assert.Nil(t, err)
+	assert.Equal(t, []Suggestion{{"appl", 1}}, ix.Suggest("appl", 1))
+}
@@ -0,0 +1,279 @@
+package index
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Ignore is a set of globs matching files to leave out of an index, as with
+// .gitignore: a glob with no slash in it matches any file or directory with
+// that name, and one with a slash matches paths from the root being indexed.
+// A trailing slash only matches directories. Globs are as for path.Match.
+type Ignore []string
+
+// DefaultIgnore leaves out hidden files & directories, like .git and the
+// index itself.
+var DefaultIgnore Ignore = Ignore{".*"}
+
+// Match reports whether a path relative to the root, using slashes, should be
+// ignored.
+func (ig Ignore) Match(rel string, dir bool) bool {
+	for _, glob := range ig {
+		if strings.HasSuffix(glob, "/") {
+			if !dir {
+				continue
+			}
+			glob = strings.TrimSuffix(glob, "/")
+		}
+		if strings.Contains(glob, "/") {
+			if ok, _ := path.Match(strings.TrimPrefix(glob, "/"), rel); ok {
+				return true
+			}
+			continue
+		}
+		if ok, _ := path.Match(glob, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPath reports whether a path relative to the root should be ignored
+// because it or any directory it's in should be.
+func (ig Ignore) MatchPath(rel string) bool {
+	dir := false
+	for p := rel; p != "." && p != "/"; p = path.Dir(p) {
+		if ig.Match(p, dir) {
+			return true
+		}
+		dir = true
+	}
+	return false
+}
+
+const (
+	FILE_ADDED     string = "added"
+	FILE_UPDATED   string = "updated"
+	FILE_UNCHANGED string = "unchanged"
+	FILE_SKIPPED   string = "skipped"
+	FILE_FAILED    string = "failed"
+)
+
+// Progress is reported after each file IndexDir looks at.
+type Progress struct {
+	Done   int
+	Total  int
+	Path   string
+	Status string
+	Err    error
+
+	// For a file that was indexed, any problems with it that didn't stop it
+	// being indexed. See Document.Warnings.
+	Warnings []string
+}
+
+type IndexDirOptions struct {
+	Ignore   Ignore
+	Progress func(Progress)
+}
+
+// Summary is what IndexDir did.
+type Summary struct {
+	Files     int
+	Added     int
+	Updated   int
+	Unchanged int
+	Skipped   int // Files that turned out not to be text
+	Failed    int
+	Deleted   int
+	Bytes     int64 // Of all the files read
+
+	Docs    int
+	Terms   int
+	Elapsed time.Duration
+}
+
+// IndexDir brings an index up to date with the notes under root, then commits
+// it. Each file is identified by its path relative to root, and is only
+// parsed & analyzed again if its content has changed since it was last
+// indexed. Documents whose files are gone are deleted.
+//
+// A file that can't be read or parsed is reported through opts.Progress and
+// counted as failed, rather than stopping the rest from being indexed; the
+// error returned is for the index itself. A file indexed despite problems,
+// like broken front matter, is reported with its warnings.
+func IndexDir(ix *Index, root string, opts IndexDirOptions) (Summary, error) {
+	return UpdatePaths(ix, root, []string{"."}, opts)
+}
+
+// UpdatePaths is IndexDir for only some paths under root, relative to it
+// with slashes, e.g. those a watch has seen change. A path can be a file or a
+// directory, which is updated as a whole, or one that's no longer there, in
+// which case the documents of it or of anything under it are deleted.
+func UpdatePaths(ix *Index, root string, paths []string, opts IndexDirOptions) (Summary, error) {
+	start := time.Now()
+	summary := Summary{}
+	files := []string{}
+	// Paths anything indexed under but not found again should be deleted
+	scopes := []string{}
+	for _, p := range paths {
+		p = path.Clean(p)
+		if p != "." && opts.Ignore.MatchPath(p) {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(root, filepath.FromSlash(p)))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			scopes = append(scopes, p)
+		case err != nil:
+			return summary, err
+		case info.IsDir():
+			found, err := findFiles(root, p, opts.Ignore)
+			if err != nil {
+				return summary, err
+			}
+			files = append(files, found...)
+			scopes = append(scopes, p)
+		case info.Mode().IsRegular() && IndexableName(p):
+			files = append(files, p)
+		default:
+			scopes = append(scopes, p)
+		}
+	}
+	files = uniqueSorted(files)
+	summary.Files = len(files)
+
+	seen := map[string]bool{}
+	for i, rel := range files {
+		status, size, warnings, err := indexFile(ix, root, rel)
+		summary.Bytes += size
+		switch status {
+		case FILE_ADDED:
+			summary.Added++
+		case FILE_UPDATED:
+			summary.Updated++
+		case FILE_UNCHANGED:
+			summary.Unchanged++
+		case FILE_SKIPPED:
+			summary.Skipped++
+		case FILE_FAILED:
+			summary.Failed++
+		}
+		if status != FILE_SKIPPED {
+			seen[rel] = true
+		}
+		if opts.Progress != nil {
+			opts.Progress(Progress{Done: i + 1, Total: len(files), Path: rel, Status: status, Err: err, Warnings: warnings})
+		}
+	}
+
+	for _, id := range ix.IDs() {
+		if seen[id] || !underAny(id, scopes) {
+			continue
+		}
+		if _, err := ix.Delete(id); err != nil {
+			return summary, err
+		}
+		summary.Deleted++
+	}
+	if err := ix.Commit(); err != nil {
+		return summary, err
+	}
+
+	stats := ix.Stats()
+	summary.Docs, summary.Terms = stats.Docs, stats.Terms
+	summary.Elapsed = time.Since(start)
+	return summary, nil
+}
+
+// Whether a path is any of dirs, or under one.
+func underAny(p string, dirs []string) bool {
+	for _, dir := range dirs {
+		if dir == "." || p == dir || strings.HasPrefix(p, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueSorted(ss []string) []string {
+	sort.Strings(ss)
+	unique := ss[:0]
+	for i, s := range ss {
+		if i == 0 || s != ss[i-1] {
+			unique = append(unique, s)
+		}
+	}
+	return unique
+}
+
+// Lists the files under dir (relative to root) that could be notes, relative
+// to root and sorted.
+func findFiles(root, dir string, ignore Ignore) ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(filepath.Join(root, filepath.FromSlash(dir)), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if ignore.Match(rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && IndexableName(rel) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// Indexes a single file if it's new or has changed, returning what became of
+// it along with its size and any warnings about its content.
+func indexFile(ix *Index, root, rel string) (string, int64, []string, error) {
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return FILE_FAILED, 0, nil, err
+	}
+	size := int64(len(content))
+
+	existing, exists := ix.Get(rel)
+	if exists && existing.Hash == Hash(content) {
+		return FILE_UNCHANGED, size, nil, nil
+	}
+	typ := DetectType(rel, content)
+	if typ == "" {
+		return FILE_SKIPPED, size, nil, nil
+	}
+	doc, err := NewDocument(rel, typ, content)
+	if err != nil {
+		return FILE_FAILED, size, nil, err
+	}
+	if info, err := os.Stat(path); err == nil {
+		doc.ModTime = info.ModTime()
+	}
+	replaced, err := ix.Replace(doc)
+	if err != nil {
+		return FILE_FAILED, size, nil, err
+	}
+	if replaced {
+		return FILE_UPDATED, size, doc.Warnings, nil
+	}
+	return FILE_ADDED, size, doc.Warnings, nil
+}
@@ -0,0 +1,200 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"mrshanahan.com/notes-indexer/pkg/markdown"
+)
+
+func writeNotes(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestIgnoreMatch(t *testing.T) {
+	ignore := Ignore{".*", "*.tmp", "drafts/", "/archive/*.md"}
+	tests := []struct {
+		path     string
+		dir      bool
+		expected bool
+	}{
+		{".git", true, true},
+		{"notes/.hidden.md", false, true},
+		{"notes/scratch.tmp", false, true},
+		{"drafts", true, true},
+		{"notes/drafts", true, true},
+		{"drafts", false, false},
+		{"archive/old.md", false, true},
+		{"notes/archive/old.md", false, false},
+		{"notes/today.md", false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			assert.Equal(t, test.expected, ignore.Match(test.path, test.dir))
+		})
+	}
+}
+
+func TestIndexDir(t *testing.T) {
+	root := t.TempDir()
+	writeNotes(t, root, map[string]string{
+		"a.md":            "# Apples\n",
+		"sub/b.txt":       "bananas\n",
+		"sub/c.html":      "<h1>Cherries</h1>",
+		"README":          "plain text\n",
+		"image.png":       "\x89PNG",
+		"blob":            "\x00\x01\x02",
+		"drafts/d.md":     "# Dates\n",
+		".notes-index/x":  "",
+		".hidden/e.md":    "# Elderberries\n",
+		"sub/scratch.tmp": "",
+	})
+	ix, err := Open(filepath.Join(root, ".notes-index"), nil)
+	assert.Nil(t, err)
+	defer ix.Close()
+
+	progress := []string{}
+	summary, err := IndexDir(ix, root, IndexDirOptions{
+		Ignore:   append(DefaultIgnore, "drafts/"),
+		Progress: func(p Progress) { progress = append(progress, p.Path+" "+p.Status) },
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"README added", "a.md added", "blob skipped", "sub/b.txt added", "sub/c.html added"}, progress)
+	assert.Equal(t, []string{"README", "a.md", "sub/b.txt", "sub/c.html"}, ix.IDs())
+	assert.Equal(t, 5, summary.Files)
+	assert.Equal(t, 4, summary.Added)
+	assert.Equal(t, 1, summary.Skipped)
+	assert.Equal(t, 4, summary.Docs)
+	assert.Equal(t, int64(48), summary.Bytes)
+	doc, _ := ix.Get("sub/c.html")
+	assert.Equal(t, "Cherries", doc.Title)
+}
+
+func TestIndexDirIncremental(t *testing.T) {
+	root := t.TempDir()
+	writeNotes(t, root, map[string]string{
+		"a.md": "# Apples\n",
+		"b.md": "# Bananas\n",
+		"c.md": "# Cherries\n",
+	})
+	dir := filepath.Join(root, ".notes-index")
+	ix, err := Open(dir, nil)
+	assert.Nil(t, err)
+	_, err = IndexDir(ix, root, IndexDirOptions{Ignore: DefaultIgnore})
+	assert.Nil(t, err)
+	assert.Nil(t, ix.Close())
+
+	writeNotes(t, root, map[string]string{"b.md": "# Blueberries\n", "d.md": "# Dates\n"})
+	assert.Nil(t, os.Remove(filepath.Join(root, "c.md")))
+	ix, err = Open(dir, nil)
+	assert.Nil(t, err)
+	defer ix.Close()
+
+	summary, err := IndexDir(ix, root, IndexDirOptions{Ignore: DefaultIgnore})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, summary.Added)
+	assert.Equal(t, 1, summary.Updated)
+	assert.Equal(t, 1, summary.Unchanged)
+	assert.Equal(t, 1, summary.Deleted)
+	assert.Equal(t, []string{"a.md", "b.md", "d.md"}, ix.IDs())
+	doc, _ := ix.Get("b.md")
+	assert.Equal(t, "Blueberries", doc.Title)
+}
+
+func TestIndexDirReportsWarnings(t *testing.T) {
+	root := t.TempDir()
+	writeNotes(t, root, map[string]string{
+		"a.md": "# Apples\n",
+		"b.md": "---\ntitle: Bananas\n---\nRipe\n",
+	})
+	ix, err := Open(filepath.Join(root, ".notes-index"), nil)
+	assert.Nil(t, err)
+	defer ix.Close()
+	_, err = IndexDir(ix, root, IndexDirOptions{Ignore: DefaultIgnore})
+	assert.Nil(t, err)
+
+	// Broken front matter doesn't stop the rest of the note being indexed,
+	// replacing what was there
+	writeNotes(t, root, map[string]string{"b.md": "---\ntitle: Bananas: week 3\n---\nOverripe\n"})
+	warnings := map[string][]string{}
+	summary, err := IndexDir(ix, root, IndexDirOptions{
+		Ignore: DefaultIgnore,
+		Progress: func(p Progress) {
+			assert.Nil(t, p.Err)
+			if len(p.Warnings) > 0 {
+				warnings[p.Path] = p.Warnings
+			}
+		},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, summary.Failed)
+	assert.Equal(t, 1, summary.Updated)
+	assert.Len(t, warnings, 1)
+	assert.Contains(t, warnings, "b.md")
+	doc, _ := ix.Get("b.md")
+	assert.Equal(t, "b", doc.Title)
+	assert.Equal(t, "Overripe", doc.Fields[markdown.FIELD_BODY])
+	assert.Equal(t, warnings["b.md"], doc.Warnings)
+}
+
+func TestIgnoreMatchPath(t *testing.T) {
+	ignore := Ignore{".*", "drafts/"}
+
+	assert.True(t, ignore.MatchPath(".git/HEAD"))
+	assert.True(t, ignore.MatchPath("notes/drafts/a.md"))
+	assert.True(t, ignore.MatchPath("notes/.a.md"))
+	assert.False(t, ignore.MatchPath("notes/drafts"))
+	assert.False(t, ignore.MatchPath("notes/a.md"))
+}
+
+func TestUpdatePaths(t *testing.T) {
+	root := t.TempDir()
+	writeNotes(t, root, map[string]string{
+		"a.md":       "# Apples\n",
+		"b.md":       "# Bananas\n",
+		"sub/c.md":   "# Cherries\n",
+		"sub/d.md":   "# Dates\n",
+		"other/e.md": "# Elderberries\n",
+	})
+	ix, err := Open(filepath.Join(root, ".notes-index"), nil)
+	assert.Nil(t, err)
+	defer ix.Close()
+	_, err = IndexDir(ix, root, IndexDirOptions{Ignore: DefaultIgnore})
+	assert.Nil(t, err)
+
+	// A file's changed, one's renamed, a directory's renamed and one removed
+	// from it, and one's been written that's ignored
+	writeNotes(t, root, map[string]string{"a.md": "# Apricots\n", ".x.md": "# X\n"})
+	assert.Nil(t, os.Rename(filepath.Join(root, "b.md"), filepath.Join(root, "bb.md")))
+	assert.Nil(t, os.Remove(filepath.Join(root, "sub", "d.md")))
+	assert.Nil(t, os.Rename(filepath.Join(root, "sub"), filepath.Join(root, "moved")))
+	// Changed, but not among the paths
+	writeNotes(t, root, map[string]string{"other/e.md": "# Eggplant\n"})
+
+	summary, err := UpdatePaths(ix, root, []string{"a.md", "b.md", "bb.md", "sub", "moved", ".x.md"}, IndexDirOptions{Ignore: DefaultIgnore})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 3, summary.Files)
+	assert.Equal(t, 2, summary.Added)
+	assert.Equal(t, 1, summary.Updated)
+	assert.Equal(t, 3, summary.Deleted)
+	assert.Equal(t, []string{"a.md", "bb.md", "moved/c.md", "other/e.md"}, ix.IDs())
+	doc, _ := ix.Get("a.md")
+	assert.Equal(t, "Apricots", doc.Title)
+	doc, _ = ix.Get("other/e.md")
+	assert.Equal(t, "Elderberries", doc.Title)
+
+	// Committed
+	ro, err := OpenReadOnly(ix.Dir())
+	assert.Nil(t, err)
+	assert.Equal(t, 4, ro.Len())
+}
@@ -0,0 +1,188 @@
+package lemmatizer
+
+import (
+	"bufio"
+	_ "embed"
+	"strings"
+)
+
+// Unlike the stemmer, the lemmatizer only ever returns real words: either a
+// lemma from the irregular-forms table, a rule-based candidate that appears
+// in the bundled dictionary, or the original word unchanged.
+
+//go:embed data/irregular.txt
+var irregularData string
+
+//go:embed data/words.txt
+var wordsData string
+
+var (
+	irregular map[string]string = loadPairs(irregularData)
+	words     map[string]bool   = loadWords(wordsData)
+)
+
+type suffixRule struct {
+	replacement string
+	undouble    bool
+}
+
+type ruleGroup struct {
+	suffix string
+	// Strict groups require the stripped stem to be a plausible word on its
+	// own, which keeps e.g. "thing" from becoming "the".
+	strict     bool
+	candidates []suffixRule
+}
+
+// Within a group the candidates are tried in order and the first one found in
+// the dictionary wins, which is why e.g. "hoped" tries "hope" before "hop",
+// and only falls back to undoubling ("hopped" -> "hop") when neither plain
+// form is a word.
+var rules []ruleGroup = []ruleGroup{
+	{"iest", false, []suffixRule{{"y", false}}},
+	{"ier", false, []suffixRule{{"y", false}}},
+	{"ies", false, []suffixRule{{"y", false}, {"ie", false}}},
+	{"ied", false, []suffixRule{{"y", false}, {"ie", false}}},
+	{"ves", false, []suffixRule{{"f", false}, {"fe", false}, {"ve", false}}},
+	{"sses", false, []suffixRule{{"ss", false}}},
+	{"ses", false, []suffixRule{{"se", false}, {"s", false}}},
+	{"shes", false, []suffixRule{{"sh", false}}},
+	{"ches", false, []suffixRule{{"ch", false}}},
+	{"xes", false, []suffixRule{{"x", false}}},
+	{"zes", false, []suffixRule{{"z", false}, {"ze", false}}},
+	{"oes", false, []suffixRule{{"o", false}, {"oe", false}}},
+	{"ed", true, []suffixRule{{"e", false}, {"", false}, {"", true}}},
+	{"ing", true, []suffixRule{{"e", false}, {"", false}, {"", true}}},
+	{"s", false, []suffixRule{{"", false}}},
+}
+
+const minStemLength int = 3
+
+// Lemmatize returns the dictionary form of a lowercase English word. Words
+// that are unknown, or that no rule can reduce to a known word, are returned
+// as-is.
+func Lemmatize(word string) string {
+	if lemma, ok := irregular[word]; ok {
+		return lemma
+	}
+	if base, ok := stripPossessive(word); ok {
+		return Lemmatize(base)
+	}
+	if !isAlphabetic(word) {
+		return word
+	}
+	for _, group := range rules {
+		if !strings.HasSuffix(word, group.suffix) {
+			continue
+		}
+		stem := word[:len(word)-len(group.suffix)]
+		if stem == "" {
+			// The word is nothing but the suffix, e.g. the "s" of "U.S."
+			continue
+		}
+		if group.strict && (len(stem) < minStemLength || !hasVowel(stem)) {
+			continue
+		}
+		if group.suffix == "s" && !canStripS(stem) {
+			continue
+		}
+		for _, rule := range group.candidates {
+			candidate := stem + rule.replacement
+			if rule.undouble {
+				if !endsInDoubleConsonant(stem) {
+					continue
+				}
+				candidate = stem[:len(stem)-1]
+			}
+			if len(candidate) < minStemLength || !hasVowel(candidate) {
+				continue
+			}
+			if lemma, ok := irregular[candidate]; ok {
+				return lemma
+			}
+			if words[candidate] {
+				return candidate
+			}
+		}
+	}
+	return word
+}
+
+// IsWord reports whether the word is in the bundled dictionary.
+func IsWord(word string) bool {
+	_, ok := irregular[word]
+	return ok || words[word]
+}
+
+func canStripS(stem string) bool {
+	// "glass", "status", "analysis" - none of these are plurals
+	last := stem[len(stem)-1]
+	return last != 's' && last != 'u' && last != 'i'
+}
+
+func stripPossessive(word string) (string, bool) {
+	if strings.HasSuffix(word, "'s") {
+		return word[:len(word)-2], len(word) > 2
+	}
+	if strings.HasSuffix(word, "'") {
+		return word[:len(word)-1], len(word) > 1
+	}
+	return word, false
+}
+
+func isAlphabetic(word string) bool {
+	if word == "" {
+		return false
+	}
+	for i := 0; i < len(word); i++ {
+		c := word[i]
+		if c < 'a' || c > 'z' {
+			return false
+		}
+	}
+	return true
+}
+
+func isVowel(c byte) bool {
+	return c == 'a' || c == 'e' || c == 'i' || c == 'o' || c == 'u' || c == 'y'
+}
+
+func hasVowel(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if isVowel(s[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func endsInDoubleConsonant(s string) bool {
+	n := len(s)
+	return n >= 2 && s[n-1] == s[n-2] && !isVowel(s[n-1])
+}
+
+func loadPairs(data string) map[string]string {
+	pairs := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		pairs[fields[0]] = fields[1]
+	}
+	return pairs
+}
+
+func loadWords(data string) map[string]bool {
+	ws := map[string]bool{}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ws[line] = true
+	}
+	return ws
+}
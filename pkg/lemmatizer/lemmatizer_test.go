@@ -0,0 +1,80 @@
+package lemmatizer
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLemmatize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// Irregular forms come straight from the bundled table
+		{"went", "go"},
+		{"mice", "mouse"},
+		{"children", "child"},
+		{"was", "be"},
+		{"better", "good"},
+		{"analyses", "analysis"},
+
+		// Regular inflections fall back to the rules
+		{"ponders", "ponder"},
+		{"pondered", "ponder"},
+		{"pondering", "ponder"},
+		{"generalizations", "generalization"},
+		{"cats", "cat"},
+		{"boxes", "box"},
+		{"churches", "church"},
+		{"glasses", "glass"},
+		{"houses", "house"},
+		{"flies", "fly"},
+		{"studied", "study"},
+		{"tied", "tie"},
+		{"happier", "happy"},
+		{"busiest", "busy"},
+		{"hoped", "hope"},
+		{"hopped", "hop"},
+		{"making", "make"},
+		{"running", "run"},
+		{"added", "add"},
+		{"played", "play"},
+		{"john's", "john"},
+
+		// Lemmas are left alone, even when they look inflected
+		{"ponder", "ponder"},
+		{"generalization", "generalization"},
+		{"thing", "thing"},
+		{"string", "string"},
+		{"news", "news"},
+		{"status", "status"},
+		{"analysis", "analysis"},
+		{"evening", "evening"},
+
+		// Unknown words are never mangled into non-words
+		{"kubernetes", "kubernetes"},
+		{"k8s", "k8s"},
+		{"", ""},
+
+		// Nothing but a suffix
+		{"s", "s"},
+		{"'s", "'s"},
+		{"u.s.", "u.s."},
+		{"ing", "ing"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			actual := Lemmatize(test.input)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestLemmatizeReturnsRealWords(t *testing.T) {
+	for _, input := range []string{"goes", "studies", "stopping", "ideas", "meetings", "issues"} {
+		actual := Lemmatize(input)
+		assert.True(t, IsWord(actual), "input: %s, lemma: %s", input, actual)
+	}
+}
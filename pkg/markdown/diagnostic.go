@@ -0,0 +1,91 @@
+package markdown
+
+import "fmt"
+
+type MDSeverity int
+
+const (
+	SEVERITY_INFO MDSeverity = iota
+	SEVERITY_WARNING
+	SEVERITY_ERROR
+)
+
+var mdSeverityName map[MDSeverity]string = map[MDSeverity]string{
+	SEVERITY_INFO:    "info",
+	SEVERITY_WARNING: "warning",
+	SEVERITY_ERROR:   "error",
+}
+
+func (s MDSeverity) String() string { return mdSeverityName[s] }
+
+type MDDiagnosticType int
+
+const (
+	DIAGNOSTIC_INVALID_TOKEN MDDiagnosticType = iota
+	DIAGNOSTIC_UNCLOSED_FENCE
+	DIAGNOSTIC_ORPHANED_INDENT
+	DIAGNOSTIC_UNMATCHED_EMPHASIS
+)
+
+var mdDiagnosticTypeName map[MDDiagnosticType]string = map[MDDiagnosticType]string{
+	DIAGNOSTIC_INVALID_TOKEN:      "invalid-token",
+	DIAGNOSTIC_UNCLOSED_FENCE:     "unclosed-fence",
+	DIAGNOSTIC_ORPHANED_INDENT:    "orphaned-indent",
+	DIAGNOSTIC_UNMATCHED_EMPHASIS: "unmatched-emphasis",
+}
+
+func (t MDDiagnosticType) String() string { return mdDiagnosticTypeName[t] }
+
+// MDDiagnostic is a problem found while parsing a document. Parsing carries
+// on past all of them, so they say where the tree might not be what the
+// author meant:
+//
+//   - Errors are tokens the parser can't make sense of, which are left out of
+//     the tree. Lex never produces these.
+//   - Warnings are markdown that's valid but probably a mistake, like a code
+//     fence that's never closed and so takes in the rest of the document.
+//   - Info is anything else worth tidying up, like emphasis that's shown
+//     as-is because it has nothing to pair with.
+type MDDiagnostic struct {
+	Type     MDDiagnosticType
+	Severity MDSeverity
+	Message  string
+	Span     MDSpan
+}
+
+func (d MDDiagnostic) String() string {
+	if d.Span.IsZero() {
+		return fmt.Sprintf("%v: %s (%v)", d.Severity, d.Message, d.Type)
+	}
+	return fmt.Sprintf("%v: %v: %s (%v)", d.Span.Start, d.Severity, d.Message, d.Type)
+}
+
+// Error makes a diagnostic usable as an error, which is how Parse reports the
+// first of SEVERITY_ERROR.
+func (d MDDiagnostic) Error() string { return d.String() }
+
+func invalidTokenDiagnostic(t MDToken, err error) MDDiagnostic {
+	return MDDiagnostic{Type: DIAGNOSTIC_INVALID_TOKEN, Severity: SEVERITY_ERROR, Message: err.Error(), Span: t.GetSpan()}
+}
+
+func unclosedFenceDiagnostic(fence MDCodeFenceToken) MDDiagnostic {
+	return MDDiagnostic{
+		Type:     DIAGNOSTIC_UNCLOSED_FENCE,
+		Severity: SEVERITY_WARNING,
+		Message:  fmt.Sprintf("code block opened with %q is never closed", fence.Fence),
+		Span:     fence.Span,
+	}
+}
+
+func orphanedIndentDiagnostic(message string, span MDSpan) MDDiagnostic {
+	return MDDiagnostic{Type: DIAGNOSTIC_ORPHANED_INDENT, Severity: SEVERITY_WARNING, Message: message, Span: span}
+}
+
+func unmatchedEmphasisDiagnostic(delim string, span MDSpan) MDDiagnostic {
+	return MDDiagnostic{
+		Type:     DIAGNOSTIC_UNMATCHED_EMPHASIS,
+		Severity: SEVERITY_INFO,
+		Message:  fmt.Sprintf("%q has nothing to pair with, so is shown as-is", delim),
+		Span:     span,
+	}
+}
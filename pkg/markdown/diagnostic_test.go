@@ -0,0 +1,87 @@
+package markdown
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseDiagnostics(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{
+			"clean",
+			"# Title\n\nSome *text* about snake_case\n\n```go\ncode\n```",
+			[]string{},
+		},
+		{
+			"unclosed-fence",
+			"Text\n\n```go\ncode",
+			[]string{"3:1: warning: code block opened with \"```\" is never closed (unclosed-fence)"},
+		},
+		{
+			"unclosed-fence-in-item",
+			"- ~~~\n  code\n\nText",
+			[]string{"1:3: warning: code block opened with \"~~~\" is never closed (unclosed-fence)"},
+		},
+		{
+			"orphaned-line",
+			"-   Item\n\n  More",
+			[]string{"3:3: warning: line is indented, but not far enough to be part of the list item above it (orphaned-indent)"},
+		},
+		{
+			"orphaned-marker",
+			"- Item\n      - Subitem",
+			[]string{"2:7: warning: list marker is indented too far to start a list item, so is text (orphaned-indent)"},
+		},
+		{
+			"unmatched-emphasis",
+			"Some *text and **more* text",
+			[]string{
+				"1:16: info: \"**\" has nothing to pair with, so is shown as-is (unmatched-emphasis)",
+			},
+		},
+		{
+			"unmatched-closer",
+			"Some text* and ~~more",
+			[]string{
+				"1:10: info: \"*\" has nothing to pair with, so is shown as-is (unmatched-emphasis)",
+				"1:16: info: \"~~\" has nothing to pair with, so is shown as-is (unmatched-emphasis)",
+			},
+		},
+		{
+			"in-order",
+			"- Some *text\n      - more",
+			[]string{
+				"1:8: info: \"*\" has nothing to pair with, so is shown as-is (unmatched-emphasis)",
+				"2:7: warning: list marker is indented too far to start a list item, so is text (orphaned-indent)",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(s *testing.T) {
+			_, diagnostics := ParseDiagnostics(Lex(test.text))
+			actual := []string{}
+			for _, d := range diagnostics {
+				actual = append(actual, d.String())
+			}
+			if !reflect.DeepEqual(test.expected, actual) {
+				s.Errorf("diagnostics were not equal - expected=%q, actual=%q", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseDiagnosticsKeepsTree(t *testing.T) {
+	actual, diagnostics := ParseDiagnostics(Lex("Some *text\n\n```\ncode"))
+	expected := tree(paragraph(text("Some *text")), codeBlock("```", "", false, "code"))
+	if !reflect.DeepEqual(expected, withoutSpans(actual)) {
+		t.Errorf("parses were not equal - expected=%v, actual=%v", expected, actual)
+	}
+	if len(diagnostics) != 2 {
+		t.Errorf("expected 2 diagnostics, found %v", diagnostics)
+	}
+}
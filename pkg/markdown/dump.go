@@ -0,0 +1,153 @@
+package markdown
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MDTreeNode describes any node of a syntax tree, block or inline, the same
+// way: its type, where it came from, whatever's particular to its type in
+// Attrs, and its text or children. It's for dumping a tree as text or JSON.
+type MDTreeNode struct {
+	Type     string         `json:"type"`
+	Span     MDSpan         `json:"span"`
+	Attrs    map[string]any `json:"attrs,omitempty"`
+	Text     string         `json:"text,omitempty"`
+	Children []MDTreeNode   `json:"children,omitempty"`
+}
+
+// TreeNodes describes the top-level nodes of a tree, and everything in them.
+func TreeNodes(tree MDSyntaxTree) []MDTreeNode {
+	return blockTreeNodes(tree.Children)
+}
+
+// DumpTree writes out a tree a node per line, with children indented under
+// their parents.
+func DumpTree(tree MDSyntaxTree) string {
+	sb := strings.Builder{}
+	dumpTreeNodes(&sb, TreeNodes(tree), 0)
+	return sb.String()
+}
+
+func dumpTreeNodes(sb *strings.Builder, nodes []MDTreeNode, depth int) {
+	for _, n := range nodes {
+		fmt.Fprintf(sb, "%s%s %v", strings.Repeat("  ", depth), n.Type, n.Span)
+		keys := make([]string, 0, len(n.Attrs))
+		for k := range n.Attrs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(sb, " %s=%v", k, n.Attrs[k])
+		}
+		if n.Text != "" {
+			fmt.Fprintf(sb, " %q", n.Text)
+		}
+		sb.WriteString("\n")
+		dumpTreeNodes(sb, n.Children, depth+1)
+	}
+}
+
+func blockTreeNodes(nodes []MDSyntaxNode) []MDTreeNode {
+	described := make([]MDTreeNode, 0, len(nodes))
+	for _, n := range nodes {
+		d := MDTreeNode{Type: n.GetType().String(), Span: n.GetSpan(), Attrs: map[string]any{}}
+		switch n := n.(type) {
+		case *MDParagraph:
+			d.Children = inlineTreeNodes(n.Content)
+		case *MDHeader:
+			d.Attrs["level"] = n.Level
+			d.Children = inlineTreeNodes(n.Content)
+		case *MDList:
+			d.Attrs["ordered"] = n.Ordered
+			if n.Ordered {
+				d.Attrs["start"] = n.Start
+			}
+			for _, item := range n.Items {
+				d.Children = append(d.Children, blockTreeNodes([]MDSyntaxNode{item})...)
+			}
+		case *MDListItem:
+			if n.Task {
+				d.Attrs["task"], d.Attrs["checked"] = true, n.Checked
+			}
+			d.Children = blockTreeNodes(n.Children)
+		case *MDBlockQuote:
+			d.Children = blockTreeNodes(n.Children)
+		case *MDTable:
+			alignments := make([]string, len(n.Alignments))
+			for i, a := range n.Alignments {
+				alignments[i] = a.String()
+			}
+			d.Attrs["alignments"] = alignments
+			d.Children = append(d.Children, tableRowTreeNode(n.Header, true))
+			for _, row := range n.Rows {
+				d.Children = append(d.Children, tableRowTreeNode(row, false))
+			}
+		case *MDCodeBlock:
+			d.Attrs["fence"], d.Attrs["closed"] = n.Fence, n.Closed
+			if n.Info != "" {
+				d.Attrs["info"] = n.Info
+			}
+			d.Text = n.Text()
+		}
+		if len(d.Attrs) == 0 {
+			d.Attrs = nil
+		}
+		described = append(described, d)
+	}
+	return described
+}
+
+func tableRowTreeNode(cells []MDTableCell, header bool) MDTreeNode {
+	row := MDTreeNode{Type: "TABLE_ROW"}
+	if header {
+		row.Attrs = map[string]any{"header": true}
+	}
+	for _, c := range cells {
+		row.Span = joinSpans(row.Span, c.Span)
+		row.Children = append(row.Children, MDTreeNode{Type: "TABLE_CELL", Span: c.Span, Children: inlineTreeNodes(c.Content)})
+	}
+	return row
+}
+
+func inlineTreeNodes(nodes []MDParagraphFormatNode) []MDTreeNode {
+	described := make([]MDTreeNode, 0, len(nodes))
+	for _, n := range nodes {
+		d := MDTreeNode{Type: n.GetFormatNodeType().String(), Span: n.GetSpan(), Attrs: map[string]any{}}
+		switch n := n.(type) {
+		case MDInlineFormatNode:
+			d.Children = inlineTreeNodes(n.Content)
+		case MDTextFormatNode:
+			d.Type, d.Text = "TEXT", n.Content
+		case MDEscapeFormatNode:
+			d.Text = n.Content
+		case MDLineBreakFormatNode:
+			d.Attrs["hard"] = n.Hard
+		case MDLinkFormatNode:
+			d.Attrs["url"] = n.URL
+			if n.Title != "" {
+				d.Attrs["title"] = n.Title
+			}
+			if n.Auto {
+				d.Attrs["auto"] = true
+			}
+			d.Children = inlineTreeNodes(n.Content)
+		case MDWikiLinkFormatNode:
+			d.Attrs["target"] = n.Target
+			if n.Heading != "" {
+				d.Attrs["heading"] = n.Heading
+			}
+			if n.Alias != "" {
+				d.Attrs["alias"] = n.Alias
+			}
+		case MDHashtagFormatNode:
+			d.Attrs["tag"] = n.Tag
+		}
+		if len(d.Attrs) == 0 {
+			d.Attrs = nil
+		}
+		described = append(described, d)
+	}
+	return described
+}
@@ -0,0 +1,46 @@
+package markdown
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDumpTree(t *testing.T) {
+	tree, err := Parse(Lex("# Hi *there*\n\n- [x] see [[Other|it]]\n\n```go\nx\n```\n"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := `HEADER 1:1-1:13 level=1
+  TEXT 1:3-1:6 "Hi "
+  FMT_ITALICS 1:6-1:13
+    TEXT 1:7-1:12 "there"
+LIST 3:1-3:23 ordered=false
+  LIST_ITEM 3:1-3:23 checked=true task=true
+    PARAGRAPH 3:7-3:23
+      TEXT 3:7-3:11 "see "
+      FMT_WIKI_LINK 3:11-3:23 alias=it target=Other
+CODE_BLOCK 5:1-7:4 closed=true fence=` + "```" + ` info=go "x"
+`
+	if actual := DumpTree(tree); actual != expected {
+		t.Errorf("unexpected tree:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
+
+func TestTreeNodesJSON(t *testing.T) {
+	tree, err := Parse(Lex("Some #tag"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	actual, err := json.Marshal(TreeNodes(tree))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `[{"type":"PARAGRAPH","span":{"start":{"offset":0,"line":1,"column":1},"end":{"offset":9,"line":1,"column":10}},"children":[` +
+		`{"type":"TEXT","span":{"start":{"offset":0,"line":1,"column":1},"end":{"offset":5,"line":1,"column":6}},"text":"Some "},` +
+		`{"type":"FMT_HASHTAG","span":{"start":{"offset":5,"line":1,"column":6},"end":{"offset":9,"line":1,"column":10}},"attrs":{"tag":"tag"}}]}]`
+	if string(actual) != expected {
+		t.Errorf("unexpected JSON:\n%s\nexpected:\n%s", actual, expected)
+	}
+}
@@ -0,0 +1,340 @@
+package markdown
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format renders a syntax tree back to markdown in a canonical style, so that
+// documents meaning the same thing come out the same:
+//
+//   - Blocks are separated by a single blank line, except where that would
+//     change the document, like between the items of a list.
+//   - List items use "-", or "N." numbered on from the list's start.
+//   - Italics are "*", bold "**", underline "__" and strikethrough "~~",
+//     except that italics inside italics alternate with "_". Formatting
+//     characters that aren't formatting anything are escaped.
+//   - Code blocks are fenced with backticks, long enough that no line of the
+//     code could close them, and are always closed.
+//   - Tables are written with a pipe at either end of every row.
+//
+// Parsing what Format returns gives back the same tree, bar any code blocks
+// that weren't closed, and formatting that again changes nothing. Front
+// matter isn't included - see FormatDocument.
+func Format(tree MDSyntaxTree) string {
+	lines := formatBlocks(tree.Children, false)
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// FormatDocument formats the markdown of a document, keeping any front matter
+// it has as-is.
+func FormatDocument(text string) (string, error) {
+	_, start, err := SplitFrontMatter(text)
+	if err != nil {
+		return "", err
+	}
+	tree, err := Parse(lexFrom(text, start))
+	if err != nil {
+		return "", err
+	}
+	return text[:start] + Format(tree), nil
+}
+
+// Formats blocks as lines, without line endings. inItem says whether they're
+// the children of a list item, where blank lines are kept to a minimum.
+func formatBlocks(ns []MDSyntaxNode, inItem bool) []string {
+	lines := []string{}
+	for i, n := range ns {
+		if i > 0 && !(inItem && ns[i-1].GetType() == SYNTAX_PARAGRAPH && n.GetType() == SYNTAX_LIST) {
+			lines = append(lines, "")
+		}
+		lines = append(lines, formatBlock(n)...)
+	}
+	return lines
+}
+
+func formatBlock(n MDSyntaxNode) []string {
+	switch n := n.(type) {
+	case *MDParagraph:
+		lines := strings.Split(formatInline(n.Content), "\n")
+		for i, line := range lines {
+			lines[i] = escapeBlockStart(line)
+		}
+		return lines
+	case *MDHeader:
+		return []string{strings.Repeat("#", n.Level) + " " + formatInline(n.Content)}
+	case *MDList:
+		return formatList(n)
+	case *MDListItem:
+		return formatItem(n, "-")
+	case *MDBlockQuote:
+		lines := formatBlocks(n.Children, false)
+		if len(lines) == 0 {
+			return []string{">"}
+		}
+		for i, line := range lines {
+			if line == "" {
+				lines[i] = ">"
+			} else {
+				lines[i] = "> " + line
+			}
+		}
+		return lines
+	case *MDCodeBlock:
+		return formatCodeBlock(n)
+	case *MDTable:
+		return formatTable(n)
+	}
+	return []string{}
+}
+
+func formatList(n *MDList) []string {
+	lines := []string{}
+	for i, item := range n.Items {
+		marker := "-"
+		if n.Ordered {
+			marker = fmt.Sprintf("%d.", n.Start+i)
+		}
+		lines = append(lines, formatItem(item, marker)...)
+	}
+	return lines
+}
+
+// Formats an item, indenting its lines to line up with its first.
+func formatItem(n *MDListItem, marker string) []string {
+	marker += " "
+	if n.Task && n.Checked {
+		marker += "[x] "
+	} else if n.Task {
+		marker += "[ ] "
+	}
+	indent := strings.Repeat(" ", len(marker))
+	if n.Task {
+		indent = strings.Repeat(" ", len(marker)-len("[ ] "))
+	}
+
+	lines := formatBlocks(n.Children, true)
+	if len(lines) == 0 {
+		// The space keeps the line ending from being taken as part of the
+		// marker
+		return []string{marker}
+	}
+	if !n.Task && taskIndicPatt.MatchString(lines[0]) {
+		// Text that would otherwise be taken for a task
+		lines[0] = "\\" + lines[0]
+	}
+	for i, line := range lines {
+		switch {
+		case i == 0:
+			lines[i] = marker + line
+		case line != "":
+			lines[i] = indent + line
+		}
+	}
+	return lines
+}
+
+func formatCodeBlock(n *MDCodeBlock) []string {
+	// Longer than any run of backticks a line of the code starts with
+	longest := 2
+	for _, line := range n.Lines {
+		trimmed := strings.TrimLeft(line.Content, " ")
+		if run := len(trimmed) - len(strings.TrimLeft(trimmed, "`")); run > longest {
+			longest = run
+		}
+	}
+	fence := strings.Repeat("`", longest+1)
+	if strings.Contains(n.Info, "`") {
+		// Only allowed after tildes
+		fence = "~~~"
+		for _, line := range n.Lines {
+			trimmed := strings.TrimLeft(line.Content, " ")
+			if run := len(trimmed) - len(strings.TrimLeft(trimmed, "~")); run >= len(fence) {
+				fence = strings.Repeat("~", run+1)
+			}
+		}
+	}
+
+	lines := []string{strings.TrimRight(fence+n.Info, " ")}
+	for _, line := range n.Lines {
+		lines = append(lines, line.Content)
+	}
+	return append(lines, fence)
+}
+
+var mdTableAlignmentDelim map[MDTableAlignment]string = map[MDTableAlignment]string{
+	TABLE_ALIGN_NONE:   "---",
+	TABLE_ALIGN_LEFT:   ":---",
+	TABLE_ALIGN_CENTER: ":---:",
+	TABLE_ALIGN_RIGHT:  "---:",
+}
+
+func formatTable(n *MDTable) []string {
+	row := func(cells []MDTableCell) string {
+		parts := make([]string, len(cells))
+		for i, c := range cells {
+			parts[i] = formatInline(c.Content)
+		}
+		return strings.TrimRight("| "+strings.Join(parts, " | ")+" |", " ")
+	}
+
+	delims := make([]string, len(n.Alignments))
+	for i, a := range n.Alignments {
+		delims[i] = mdTableAlignmentDelim[a]
+	}
+	lines := []string{row(n.Header), "|" + strings.Join(delims, "|") + "|"}
+	for _, cells := range n.Rows {
+		lines = append(lines, row(cells))
+	}
+	return lines
+}
+
+// Escapes the first character of a line of a paragraph if the line would
+// otherwise start a block of its own, e.g. "1. " in the middle of a sentence
+// that happened to wrap there.
+func escapeBlockStart(line string) string {
+	tokens := Lex(line)
+	if len(tokens) == 0 {
+		return line
+	}
+	switch tokens[0].GetType() {
+	case TOKEN_UNORDERED_LIST_INDIC, TOKEN_ORDERED_LIST_INDIC, TOKEN_HEADER_INDIC, TOKEN_QUOTE_INDIC,
+		TOKEN_EXPLICIT_CODEBLOCK_INDIC, TOKEN_TABLE_DELIM_ROW:
+		return "\\" + line
+	}
+	return line
+}
+
+var mdFormatNodeDelim map[MDParagraphFormatNodeType]string = map[MDParagraphFormatNodeType]string{
+	FORMAT_NODE_BOLD:          "**",
+	FORMAT_NODE_ITALICS:       "*",
+	FORMAT_NODE_UNDERLINE:     "__",
+	FORMAT_NODE_STRIKETHROUGH: "~~",
+}
+
+func formatInline(ns []MDParagraphFormatNode) string {
+	var sb strings.Builder
+	writeInline(&sb, ns, nil)
+	return sb.String()
+}
+
+// Writes inline content. outer is the delimiters of the formatting it's
+// inside of, innermost last.
+func writeInline(sb *strings.Builder, ns []MDParagraphFormatNode, outer []string) {
+	for _, n := range ns {
+		switch n := n.(type) {
+		case MDTextFormatNode:
+			sb.WriteString(escapeDelims(n.Content))
+		case MDEscapeFormatNode:
+			sb.WriteString("\\" + n.Content)
+		case MDLineBreakFormatNode:
+			if n.Hard {
+				sb.WriteString("\\")
+			}
+			sb.WriteString("\n")
+		case MDInlineFormatNode:
+			if n.Type == FORMAT_NODE_CODE {
+				writeCode(sb, PlainText(n.Content))
+				continue
+			}
+			delim := mdFormatNodeDelim[n.Type]
+			if n.Type == FORMAT_NODE_ITALICS && italicsNeedUnderscore(outer, n.Content) {
+				delim = "_"
+			}
+			sb.WriteString(delim)
+			writeInline(sb, n.Content, append(outer[:len(outer):len(outer)], delim))
+			sb.WriteString(delim)
+		case MDLinkFormatNode:
+			if n.Auto {
+				sb.WriteString("<" + n.URL + ">")
+				continue
+			}
+			sb.WriteString("[")
+			writeInline(sb, n.Content, outer)
+			sb.WriteString("](" + n.URL)
+			if n.Title != "" {
+				sb.WriteString(` "` + n.Title + `"`)
+			}
+			sb.WriteString(")")
+		case MDWikiLinkFormatNode:
+			sb.WriteString("[[" + n.Ref())
+			if n.Alias != "" {
+				sb.WriteString("|" + n.Alias)
+			}
+			sb.WriteString("]]")
+		case MDHashtagFormatNode:
+			sb.WriteString("#" + n.Tag)
+		}
+	}
+}
+
+// Whether italics inside of the formatting delimited by outer have to use
+// "_", since a "*" could pair up with the wrong delimiter. Italics alternate
+// with any italics they're inside of. Otherwise italics straight inside of
+// bold can't use "*", as in "**a*b*c**" the first "*" could close the bold,
+// and nor can italics with bold in them, as in "*a**b**c*" the "**" could
+// close the "*".
+func italicsNeedUnderscore(outer []string, content []MDParagraphFormatNode) bool {
+	for i := len(outer) - 1; i >= 0; i-- {
+		if outer[i] == "*" || outer[i] == "_" {
+			return outer[i] == "*"
+		}
+	}
+	if n := len(outer); n > 0 && outer[n-1] == "**" {
+		return true
+	}
+	if len(content) == 1 {
+		// "***a***" is fine
+		return false
+	}
+	for _, n := range content {
+		if f, ok := n.(MDInlineFormatNode); ok && f.Type == FORMAT_NODE_BOLD {
+			return true
+		}
+	}
+	return false
+}
+
+// Escapes the formatting characters in text. Since the text was parsed as
+// such, they didn't pair up with anything, but with emphasis normalized they
+// might. One on its own between spaces can't be a delimiter, so is left be.
+func escapeDelims(text string) string {
+	var sb strings.Builder
+	for i := 0; i < len(text); i++ {
+		if strings.IndexByte(INLINE_FORMAT_CHARS, text[i]) >= 0 {
+			spaced := i > 0 && text[i-1] == ' ' && i+1 < len(text) && text[i+1] == ' '
+			if !spaced {
+				sb.WriteByte('\\')
+			}
+		}
+		sb.WriteByte(text[i])
+	}
+	return sb.String()
+}
+
+// Writes a code span, delimited by a run of backticks that doesn't appear in
+// the code.
+func writeCode(sb *strings.Builder, code string) {
+	runs := map[int]bool{}
+	for i := 0; i < len(code); {
+		j := i
+		for j < len(code) && code[j] == '`' {
+			j++
+		}
+		if j > i {
+			runs[j-i] = true
+			i = j
+		} else {
+			i++
+		}
+	}
+	n := 1
+	for runs[n] {
+		n++
+	}
+	delim := strings.Repeat("`", n)
+	sb.WriteString(delim + code + delim)
+}
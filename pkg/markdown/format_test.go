@@ -0,0 +1,239 @@
+package markdown
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name           string
+		text           string
+		expectedFormat string
+	}{
+		{
+			"emphasis",
+			"_a_ __b__ ***c*** **d _e_** *__f__* **_g_** *_h_ i*",
+			"*a* __b__ ***c*** **d _e_** *__f__* **_g_** *_h_ i*\n",
+		},
+		{
+			"lists",
+			"-   a\n    - b\n- [X] c\n\n2. d\n2. e\n   continued\n\n\n7. f",
+			"- a\n  - b\n- [x] c\n\n2. d\n3. e\n   continued\n\n7. f\n",
+		},
+		{
+			"blocks",
+			"#   Title\nText\nmore text\\\n> quote\n> - item\n>\n>   ~~~ sh\n>   x\n\n|a|b|\n|:-:|--:|\n|1|",
+			"# Title\n\nText\nmore text\\\n\n> quote\n>\n> - item\n>\n>   ```sh\n>   x\n>   ```\n\n| a | b |\n|:---:|---:|\n| 1 |  |\n",
+		},
+		{
+			"code",
+			"``a`b`` and\n````\n```\nstill code\n````",
+			"``a`b`` and\n\n````\n```\nstill code\n````\n",
+		},
+		{
+			"escaped-block-starts",
+			"a\n     - b\n     1. c\n     # d\n\\> e",
+			"a\n\\- b\n\\1. c\n\\# d\n\\> e\n",
+		},
+		{
+			"not-tasks",
+			"-  [x] a\n- \\[ ] b",
+			"- \\[x] a\n- \\[ ] b\n",
+		},
+		{
+			"unpaired-delims",
+			"2 * 3 is *6 and snake_case",
+			"2 * 3 is \\*6 and snake\\_case\n",
+		},
+		{
+			"backticks-in-emphasis",
+			"**>```** *a`* __`b`__ c`",
+			"**>\\`\\`\\`** *a\\`* __`b`__ c\\`\n",
+		},
+		{
+			"code-line-break",
+			"`\\\nb`",
+			"`\\ b`\n",
+		},
+		{
+			"links",
+			"[*a*](http://x.y \"T\") https://z.org [[N#H|alias]] #tag/sub",
+			"[*a*](http://x.y \"T\") <https://z.org> [[N#H|alias]] #tag/sub\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(s *testing.T) {
+			tree, err := Parse(Lex(test.text))
+			if err != nil {
+				s.Fatalf("unexpected error: %v", err)
+			}
+			if actual := Format(tree); actual != test.expectedFormat {
+				s.Errorf("formats were not equal - expected=%q, actual=%q", test.expectedFormat, actual)
+			}
+		})
+	}
+}
+
+func TestFormatDocument(t *testing.T) {
+	text := "---\ntitle: Kept as-is\ntags:  [a,b]\n---\n*   one\n*   two"
+	expected := "---\ntitle: Kept as-is\ntags:  [a,b]\n---\n- one\n- two\n"
+	actual, err := FormatDocument(strings.Replace(text, "*   ", "-   ", -1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual != expected {
+		t.Errorf("formats were not equal - expected=%q, actual=%q", expected, actual)
+	}
+}
+
+// A random markdown document, built from the kinds of things notes have in
+// them along with the odd stray formatting character.
+type mdDocument string
+
+func (mdDocument) Generate(r *rand.Rand, size int) reflect.Value {
+	var sb strings.Builder
+	for i := 0; i < 1+r.Intn(6); i++ {
+		if i > 0 {
+			sb.WriteString(pick(r, "\n", "\n\n", "\n\n\n"))
+		}
+		writeRandomBlock(&sb, r, "", 0)
+	}
+	return reflect.ValueOf(mdDocument(sb.String()))
+}
+
+func writeRandomBlock(sb *strings.Builder, r *rand.Rand, indent string, depth int) {
+	n := 7
+	if depth > 2 {
+		n = 1
+	}
+	switch r.Intn(n) {
+	case 0:
+		for i := 0; i < 1+r.Intn(3); i++ {
+			if i > 0 {
+				sb.WriteString(pick(r, "\n", "\\\n") + indent + pick(r, "", "", "   ", "     "))
+			}
+			writeRandomLine(sb, r)
+		}
+	case 1:
+		sb.WriteString(strings.Repeat("#", 1+r.Intn(3)) + pick(r, " ", "   "))
+		writeRandomLine(sb, r)
+	case 2, 3:
+		ordered, start := r.Intn(2) == 0, r.Intn(12)
+		for i := 0; i < 1+r.Intn(3); i++ {
+			if i > 0 {
+				sb.WriteString("\n" + indent)
+			}
+			marker := "- "
+			if ordered {
+				marker = fmt.Sprintf("%d. ", start+r.Intn(2))
+			}
+			sb.WriteString(marker + pick(r, "", "", "[ ] ", "[x] "))
+			writeRandomBlock(sb, r, indent+strings.Repeat(" ", len(marker)), depth+1)
+			if r.Intn(3) == 0 {
+				sb.WriteString(pick(r, "\n", "\n\n") + indent + strings.Repeat(" ", len(marker)))
+				writeRandomBlock(sb, r, indent+strings.Repeat(" ", len(marker)), depth+1)
+			}
+		}
+	case 4:
+		sb.WriteString("> ")
+		writeRandomBlock(sb, r, indent+"> ", depth+1)
+	case 5:
+		fence := pick(r, "```", "~~~", "````")
+		sb.WriteString(fence + pick(r, "", "go", " sh x") + "\n")
+		for i := 0; i < r.Intn(3); i++ {
+			sb.WriteString(indent + pick(r, "", "  x := *y", "# not a header", "```", "- no list") + "\n")
+		}
+		if r.Intn(4) > 0 {
+			sb.WriteString(indent + fence)
+		}
+	case 6:
+		cols := 1 + r.Intn(3)
+		writeRandomRow(sb, r, cols)
+		sb.WriteString("\n" + indent)
+		for i := 0; i < cols; i++ {
+			sb.WriteString("|" + pick(r, "---", ":--", "--:", ":-:"))
+		}
+		sb.WriteString("|")
+		for i := 0; i < r.Intn(3); i++ {
+			sb.WriteString("\n" + indent)
+			writeRandomRow(sb, r, 1+r.Intn(cols))
+		}
+	}
+}
+
+func writeRandomRow(sb *strings.Builder, r *rand.Rand, cols int) {
+	for i := 0; i < cols; i++ {
+		sb.WriteString("| ")
+		writeRandomLine(sb, r)
+		sb.WriteString(" ")
+	}
+	sb.WriteString("|")
+}
+
+var randomInline []string = []string{
+	"word", "two words", "*italic*", "_italic_", "**bold**", "__underline__", "~~struck~~", "***both***",
+	"**bold *and italic***", "`code`", "``co`de``", "[link](http://x.org/a \"Title\")", "[*fancy* link](y)",
+	"https://bare.dev/a_b", "<http://x.y>", "[[Note]]", "[[Note#Part|alias]]", "#tag", "#nested/tag",
+	"\\*escaped\\*", "2 * 3", "snake_case", "a*b*c", "*", "_", "[", "]", "#", "|", "1.", "- ", "> ",
+}
+
+// What goes inside of emphasis: code, and backticks that aren't code, right
+// up against the delimiters or not.
+var randomEmphasized []string = []string{
+	"word", "two words", "`code`", "``co`de``", "`", "```", ">```", "a`", "`a", "\\`",
+}
+
+func writeRandomLine(sb *strings.Builder, r *rand.Rand) {
+	for i := 0; i < 1+r.Intn(5); i++ {
+		if i > 0 {
+			sb.WriteString(pick(r, " ", " ", ", "))
+		}
+		if r.Intn(4) > 0 {
+			sb.WriteString(pick(r, randomInline...))
+			continue
+		}
+		delim := pick(r, "*", "_", "**", "__", "~~")
+		sb.WriteString(delim)
+		for j := 0; j < 1+r.Intn(2); j++ {
+			sb.WriteString(pick(r, randomEmphasized...))
+		}
+		sb.WriteString(delim)
+	}
+}
+
+func pick(r *rand.Rand, choices ...string) string {
+	return choices[r.Intn(len(choices))]
+}
+
+func TestFormatIsIdempotent(t *testing.T) {
+	formatted := func(text string) (string, MDSyntaxTree) {
+		tree, err := Parse(Lex(text))
+		if err != nil {
+			t.Fatalf("unexpected error parsing %q: %v", text, err)
+		}
+		return Format(tree), tree
+	}
+
+	property := func(doc mdDocument) bool {
+		once, tree := formatted(string(doc))
+		twice, formattedTree := formatted(once)
+		if once != twice {
+			t.Logf("formatting %q again changed it - once=%q, twice=%q", doc, once, twice)
+			return false
+		}
+		if expected, actual := RenderHTML(tree), RenderHTML(formattedTree); expected != actual {
+			t.Logf("formatting %q as %q changed it - expected=%q, actual=%q", doc, once, expected, actual)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(property, &quick.Config{MaxCount: 2000, Rand: rand.New(rand.NewSource(1))}); err != nil {
+		t.Error(err)
+	}
+}
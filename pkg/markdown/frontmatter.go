@@ -0,0 +1,276 @@
+package markdown
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"mrshanahan.com/notes-indexer/internal/toml"
+)
+
+const (
+	FRONT_MATTER_YAML string = "yaml"
+	FRONT_MATTER_TOML string = "toml"
+)
+
+// MDMetadata is the front matter of a note. Fields holds every key as
+// decoded; the well-known ones are also pulled out into typed fields, with
+// some leeway in how they're written (e.g. tags as a list or as a
+// comma-separated string).
+type MDMetadata struct {
+	Format string
+	Fields map[string]any
+
+	Title   string
+	Author  string
+	Tags    []string
+	Created time.Time
+	Updated time.Time
+}
+
+var (
+	titleKeys   []string = []string{"title"}
+	authorKeys  []string = []string{"author", "authors"}
+	tagKeys     []string = []string{"tags", "tag", "keywords"}
+	createdKeys []string = []string{"date", "created"}
+	updatedKeys []string = []string{"updated", "modified", "lastmod"}
+
+	frontMatterDelims map[string]string = map[string]string{
+		"---": FRONT_MATTER_YAML,
+		"+++": FRONT_MATTER_TOML,
+	}
+
+	tagSeparatorPatt *regexp.Regexp = regexp.MustCompile(`\s*,\s*`)
+
+	metadataTimeLayouts []string = []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02 15:04",
+		"2006-01-02",
+	}
+)
+
+// SplitFrontMatter looks for a front matter block at the very start of text:
+// YAML between "---" lines or TOML between "+++" lines. It returns the decoded
+// metadata (nil if there is no block) along with the offset the markdown
+// starts at. A block that is never closed, or that doesn't decode to a
+// mapping of keys to values (e.g. a paragraph between two thematic breaks),
+// isn't front matter.
+func SplitFrontMatter(text string) (*MDMetadata, int, error) {
+	start := 0
+	if strings.HasPrefix(text, "\ufeff") {
+		start = len("\ufeff")
+	}
+	first, bodyStart := nextLine(text, start)
+	format, ok := frontMatterDelims[strings.TrimRight(first, " \t")]
+	if !ok {
+		return nil, 0, nil
+	}
+
+	for cur := bodyStart; cur < len(text); {
+		line, next := nextLine(text, cur)
+		trimmed := strings.TrimRight(line, " \t")
+		if trimmed == first || (format == FRONT_MATTER_YAML && trimmed == "...") {
+			meta, err := decodeFrontMatter(format, text[bodyStart:cur])
+			if meta == nil && err == nil {
+				return nil, 0, nil
+			}
+			return meta, next, err
+		}
+		cur = next
+	}
+	return nil, 0, nil
+}
+
+// Returns the line starting at start, without its line ending, and the
+// offset of the line after it.
+func nextLine(text string, start int) (string, int) {
+	end := strings.IndexByte(text[start:], '\n')
+	if end < 0 {
+		return text[start:], len(text)
+	}
+	return strings.TrimSuffix(text[start:start+end], "\r"), start + end + 1
+}
+
+// Returns nil metadata, and no error, if the block isn't a mapping.
+func decodeFrontMatter(format, block string) (*MDMetadata, error) {
+	fields := map[string]any{}
+	var err error
+	switch format {
+	case FRONT_MATTER_YAML:
+		var doc yaml.Node
+		if err = yaml.Unmarshal([]byte(block), &doc); err == nil && len(doc.Content) > 0 {
+			if doc.Content[0].Kind != yaml.MappingNode {
+				return nil, nil
+			}
+			err = doc.Content[0].Decode(&fields)
+		}
+	case FRONT_MATTER_TOML:
+		fields, err = toml.Parse(block)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s front matter: %w", format, err)
+	}
+	if fields == nil {
+		fields = map[string]any{}
+	}
+
+	meta := &MDMetadata{Format: format, Fields: fields}
+	meta.Title, _ = meta.GetString(titleKeys...)
+	if authors, ok := meta.GetStrings(authorKeys...); ok {
+		meta.Author = strings.Join(authors, ", ")
+	}
+	if tags, ok := meta.GetStrings(tagKeys...); ok {
+		if v, _ := meta.Get(tagKeys...); isString(v) {
+			tags = splitTags(tags[0])
+		}
+		meta.Tags = normalizeTags(tags)
+	}
+	meta.Created, _ = meta.GetTime(createdKeys...)
+	meta.Updated, _ = meta.GetTime(updatedKeys...)
+	return meta, nil
+}
+
+// Get returns the value of the first of keys that is set, ignoring case.
+func (m *MDMetadata) Get(keys ...string) (any, bool) {
+	for _, k := range keys {
+		if v, ok := m.Fields[k]; ok {
+			return v, true
+		}
+		for fk, v := range m.Fields {
+			if strings.EqualFold(fk, k) {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// GetString returns a scalar value as a string.
+func (m *MDMetadata) GetString(keys ...string) (string, bool) {
+	v, ok := m.Get(keys...)
+	if !ok {
+		return "", false
+	}
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case time.Time:
+		return v.Format(time.RFC3339), true
+	case nil, []any, map[string]any:
+		return "", false
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// GetStrings returns a list of scalars as strings. A single scalar is
+// returned as a list of one.
+func (m *MDMetadata) GetStrings(keys ...string) ([]string, bool) {
+	v, ok := m.Get(keys...)
+	if !ok {
+		return nil, false
+	}
+	list, isList := v.([]any)
+	if !isList {
+		s, ok := m.GetString(keys...)
+		if !ok {
+			return nil, false
+		}
+		return []string{s}, true
+	}
+	ss := []string{}
+	for _, x := range list {
+		switch x := x.(type) {
+		case nil, []any, map[string]any:
+			continue
+		case string:
+			ss = append(ss, x)
+		default:
+			ss = append(ss, fmt.Sprint(x))
+		}
+	}
+	return ss, true
+}
+
+// GetTime returns a date or date-time value, which may also be written as a
+// string.
+func (m *MDMetadata) GetTime(keys ...string) (time.Time, bool) {
+	v, ok := m.Get(keys...)
+	if !ok {
+		return time.Time{}, false
+	}
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		for _, layout := range metadataTimeLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// Tags written as a single string are separated by commas, or by spaces if
+// there aren't any: "a, b" and "#a #b" are both two tags.
+func splitTags(s string) []string {
+	if strings.Contains(s, ",") {
+		return tagSeparatorPatt.Split(s, -1)
+	}
+	return strings.Fields(s)
+}
+
+// Drops any leading '#' & duplicates. Nested tags keep their path, so
+// "#project/notes" is "project/notes".
+func normalizeTags(tags []string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+func isString(v any) bool {
+	_, ok := v.(string)
+	return ok
+}
+
+// ParseDocument parses a whole note: its front matter, if it has any, and
+// then the markdown following it.
+func ParseDocument(text string) (MDSyntaxTree, error) {
+	meta, start, metaErr := SplitFrontMatter(text)
+	tree, err := Parse(lexFrom(text, start))
+	tree.Meta = meta
+	if err != nil {
+		return tree, err
+	}
+	return tree, metaErr
+}
+
+// LexDocument lexes the markdown of a whole note, after any front matter,
+// with spans relative to the whole of text. The front matter is returned
+// along with the tokens, the same as ParseDocument does.
+func LexDocument(text string) ([]MDToken, *MDMetadata, error) {
+	meta, start, err := SplitFrontMatter(text)
+	return lexFrom(text, start), meta, err
+}
+
+// ParseDocumentDiagnostics parses a whole note like ParseDocument, also
+// returning the diagnostics for its markdown. The error is only for the front
+// matter.
+func ParseDocumentDiagnostics(text string) (MDSyntaxTree, []MDDiagnostic, error) {
+	meta, start, err := SplitFrontMatter(text)
+	tree, diagnostics := ParseDiagnostics(lexFrom(text, start))
+	tree.Meta = meta
+	return tree, diagnostics, err
+}
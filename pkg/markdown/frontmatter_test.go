@@ -0,0 +1,145 @@
+package markdown
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		expectedStart int
+		expectedMeta  bool
+	}{
+		{"none", "# Just a note", 0, false},
+		{"yaml", "---\ntitle: Note\n---\n# Body", 20, true},
+		{"yaml-dots", "---\ntitle: Note\n...\n# Body", 20, true},
+		{"toml", "+++\ntitle = \"Note\"\n+++\r\n# Body", 24, true},
+		{"unclosed", "---\ntitle: Note\n# Body", 0, false},
+		{"not-at-start", "\n---\ntitle: Note\n---\n", 0, false},
+		{"empty", "---\n---\nBody", 8, true},
+		{"not-a-mapping", "---\nJust a paragraph\n---\n# Body", 0, false},
+		{"yaml-list", "---\n- one\n- two\n---\n", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(s *testing.T) {
+			meta, start, err := SplitFrontMatter(test.text)
+			if err != nil {
+				s.Fatalf("unexpected error: %v", err)
+			}
+			if start != test.expectedStart {
+				s.Errorf("expected markdown to start at %d, got %d", test.expectedStart, start)
+			}
+			if (meta != nil) != test.expectedMeta {
+				s.Errorf("expected metadata=%v, got %v", test.expectedMeta, meta)
+			}
+		})
+	}
+}
+
+func TestParseDocumentYaml(t *testing.T) {
+	doc := `---
+title: Weekly sync
+Author: Mark Shanahan
+tags: [meeting, "#project/notes", meeting]
+date: 2024-03-01
+updated: "2024-03-04 09:30"
+attendees:
+  - Ana
+  - Raj
+---
+# Agenda
+- Budget`
+
+	tree, err := ParseDocument(doc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	meta := tree.Meta
+	if meta.Format != FRONT_MATTER_YAML || meta.Title != "Weekly sync" || meta.Author != "Mark Shanahan" {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+	if !reflect.DeepEqual([]string{"meeting", "project/notes"}, meta.Tags) {
+		t.Errorf("unexpected tags: %v", meta.Tags)
+	}
+	if !meta.Created.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected created date: %v", meta.Created)
+	}
+	if !meta.Updated.Equal(time.Date(2024, 3, 4, 9, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected updated date: %v", meta.Updated)
+	}
+	if attendees, _ := meta.GetStrings("attendees"); !reflect.DeepEqual([]string{"Ana", "Raj"}, attendees) {
+		t.Errorf("unexpected attendees: %v", attendees)
+	}
+
+	expected := []MDSyntaxNode{header(1, text("Agenda")), ulist(item(paragraph(text("Budget"))))}
+	if !reflect.DeepEqual(expected, withoutSpans(tree.Children)) {
+		t.Errorf("unexpected body: %v", tree.Children)
+	}
+}
+
+func TestParseDocumentToml(t *testing.T) {
+	tree, err := ParseDocument("+++\ntitle = \"Runbook\"\ntags = \"ops, on-call\"\ndate = 2024-03-01T10:00:00Z\n+++\nBody")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	meta := tree.Meta
+	if meta.Format != FRONT_MATTER_TOML || meta.Title != "Runbook" {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+	if !reflect.DeepEqual([]string{"ops", "on-call"}, meta.Tags) {
+		t.Errorf("unexpected tags: %v", meta.Tags)
+	}
+	if !meta.Created.Equal(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected created date: %v", meta.Created)
+	}
+}
+
+func TestParseDocumentInvalidFrontMatter(t *testing.T) {
+	tree, err := ParseDocument("---\ntitle: [unclosed\n---\nBody")
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if tree.Meta != nil {
+		t.Errorf("expected no metadata, got %v", tree.Meta)
+	}
+	// The markdown is still parsed, without the broken block
+	if !reflect.DeepEqual([]MDSyntaxNode{paragraph(text("Body"))}, withoutSpans(tree.Children)) {
+		t.Errorf("unexpected body: %v", tree.Children)
+	}
+}
+
+func TestParseDocumentThematicBreaks(t *testing.T) {
+	// Not front matter, so left as markdown
+	tree, err := ParseDocument("---\nSome text\n---\nMore")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tree.Meta != nil {
+		t.Errorf("expected no metadata, got %v", tree.Meta)
+	}
+	if len(tree.Children) == 0 || tree.Children[0].GetSpan().Start.Offset != 0 {
+		t.Errorf("expected the markdown to start at the first line, got %v", tree.Children)
+	}
+}
+
+func TestLexDocument(t *testing.T) {
+	tokens, meta, err := LexDocument("---\ntitle: Note\n---\n# Hi\n")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta == nil || meta.Title != "Note" {
+		t.Errorf("unexpected metadata: %v", meta)
+	}
+	if len(tokens) == 0 || tokens[0].GetType() != TOKEN_HEADER_INDIC {
+		t.Fatalf("expected the front matter to be skipped, got %v", tokens)
+	}
+	if start := tokens[0].GetSpan().Start; start != (MDPosition{Offset: 20, Line: 4, Column: 1}) {
+		t.Errorf("expected spans relative to the whole document, got %v", start)
+	}
+}
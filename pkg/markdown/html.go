@@ -0,0 +1,282 @@
+package markdown
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RenderHTML renders a syntax tree as HTML, following the CommonMark
+// reference renderer where the two have anything in common.
+//
+// The text each of highlight covers is wrapped in <mark> tags, e.g. to show
+// search hits found with MDTextSegment.SourceSpan. A highlight that crosses
+// formatting is split up into a <mark> per piece of text, so tags are always
+// properly nested. Text that doesn't map back to the document exactly, like
+// an escaped character or a wiki-link, is highlighted as a whole if any of it
+// is.
+func RenderHTML(tree MDSyntaxTree, highlight ...MDSpan) string {
+	r := &mdHTMLRenderer{highlight: highlight}
+	r.blocks(tree.Children, false)
+	return r.sb.String()
+}
+
+type mdHTMLRenderer struct {
+	sb        strings.Builder
+	highlight []MDSpan
+}
+
+// Starts a new line, unless the output is already at the start of one.
+func (r *mdHTMLRenderer) cr() {
+	if s := r.sb.String(); s != "" && s[len(s)-1] != '\n' {
+		r.sb.WriteByte('\n')
+	}
+}
+
+// Renders blocks. In a tight list the paragraphs of an item aren't wrapped in
+// <p> tags.
+func (r *mdHTMLRenderer) blocks(ns []MDSyntaxNode, tight bool) {
+	for _, n := range ns {
+		switch n := n.(type) {
+		case *MDParagraph:
+			if tight {
+				r.inline(n.Content)
+				continue
+			}
+			r.cr()
+			r.sb.WriteString("<p>")
+			r.inline(n.Content)
+			r.sb.WriteString("</p>\n")
+		case *MDHeader:
+			r.cr()
+			fmt.Fprintf(&r.sb, "<h%d>", n.Level)
+			r.inline(n.Content)
+			fmt.Fprintf(&r.sb, "</h%d>\n", n.Level)
+		case *MDList:
+			r.list(n)
+		case *MDListItem:
+			r.item(n, false)
+		case *MDBlockQuote:
+			r.cr()
+			r.sb.WriteString("<blockquote>\n")
+			r.blocks(n.Children, false)
+			r.cr()
+			r.sb.WriteString("</blockquote>\n")
+		case *MDCodeBlock:
+			r.cr()
+			if lang := n.Language(); lang != "" {
+				fmt.Fprintf(&r.sb, `<pre><code class="language-%s">`, escapeHTML(lang))
+			} else {
+				r.sb.WriteString("<pre><code>")
+			}
+			for _, line := range n.Lines {
+				r.text(line.Content, line.Span)
+				r.sb.WriteByte('\n')
+			}
+			r.sb.WriteString("</code></pre>\n")
+		case *MDTable:
+			r.table(n)
+		}
+	}
+}
+
+func (r *mdHTMLRenderer) list(n *MDList) {
+	r.cr()
+	tag := "ul"
+	if n.Ordered {
+		tag = "ol"
+	}
+	if n.Ordered && n.Start != 1 {
+		fmt.Fprintf(&r.sb, "<ol start=\"%d\">\n", n.Start)
+	} else {
+		fmt.Fprintf(&r.sb, "<%s>\n", tag)
+	}
+	tight := isTight(n)
+	for _, item := range n.Items {
+		r.item(item, tight)
+	}
+	r.cr()
+	fmt.Fprintf(&r.sb, "</%s>\n", tag)
+}
+
+func (r *mdHTMLRenderer) item(n *MDListItem, tight bool) {
+	r.cr()
+	r.sb.WriteString("<li>")
+	if n.Task {
+		if n.Checked {
+			r.sb.WriteString(`<input checked="" disabled="" type="checkbox" /> `)
+		} else {
+			r.sb.WriteString(`<input disabled="" type="checkbox" /> `)
+		}
+	}
+	r.blocks(n.Children, tight)
+	r.sb.WriteString("</li>\n")
+}
+
+// Blank lines always start a new list, so the only way a list can be loose is
+// if an item has more than one paragraph.
+func isTight(n *MDList) bool {
+	for _, item := range n.Items {
+		paragraphs := 0
+		for _, c := range item.Children {
+			if c.GetType() == SYNTAX_PARAGRAPH {
+				paragraphs++
+			}
+		}
+		if paragraphs > 1 {
+			return false
+		}
+	}
+	return true
+}
+
+var mdTableAlignmentAttr map[MDTableAlignment]string = map[MDTableAlignment]string{
+	TABLE_ALIGN_NONE:   "",
+	TABLE_ALIGN_LEFT:   ` align="left"`,
+	TABLE_ALIGN_CENTER: ` align="center"`,
+	TABLE_ALIGN_RIGHT:  ` align="right"`,
+}
+
+func (r *mdHTMLRenderer) table(n *MDTable) {
+	row := func(cells []MDTableCell, tag string) {
+		r.sb.WriteString("<tr>\n")
+		for i, c := range cells {
+			fmt.Fprintf(&r.sb, "<%s%s>", tag, mdTableAlignmentAttr[n.Alignments[i]])
+			r.inline(c.Content)
+			fmt.Fprintf(&r.sb, "</%s>\n", tag)
+		}
+		r.sb.WriteString("</tr>\n")
+	}
+
+	r.cr()
+	r.sb.WriteString("<table>\n<thead>\n")
+	row(n.Header, "th")
+	r.sb.WriteString("</thead>\n")
+	if len(n.Rows) > 0 {
+		r.sb.WriteString("<tbody>\n")
+		for _, cells := range n.Rows {
+			row(cells, "td")
+		}
+		r.sb.WriteString("</tbody>\n")
+	}
+	r.sb.WriteString("</table>\n")
+}
+
+var mdFormatNodeTag map[MDParagraphFormatNodeType]string = map[MDParagraphFormatNodeType]string{
+	FORMAT_NODE_BOLD:          "strong",
+	FORMAT_NODE_ITALICS:       "em",
+	FORMAT_NODE_UNDERLINE:     "u",
+	FORMAT_NODE_CODE:          "code",
+	FORMAT_NODE_STRIKETHROUGH: "del",
+}
+
+func (r *mdHTMLRenderer) inline(ns []MDParagraphFormatNode) {
+	for _, n := range ns {
+		switch n := n.(type) {
+		case MDTextFormatNode:
+			r.text(n.Content, n.Span)
+		case MDEscapeFormatNode:
+			r.text(n.Content, n.Span)
+		case MDLineBreakFormatNode:
+			if n.Hard {
+				r.sb.WriteString("<br />")
+			}
+			r.sb.WriteByte('\n')
+		case MDInlineFormatNode:
+			tag := mdFormatNodeTag[n.Type]
+			fmt.Fprintf(&r.sb, "<%s>", tag)
+			r.inline(n.Content)
+			fmt.Fprintf(&r.sb, "</%s>", tag)
+		case MDLinkFormatNode:
+			fmt.Fprintf(&r.sb, `<a href="%s"`, escapeHTML(normalizeURL(n.URL)))
+			if n.Title != "" {
+				fmt.Fprintf(&r.sb, ` title="%s"`, escapeHTML(n.Title))
+			}
+			r.sb.WriteString(">")
+			r.inline(n.Content)
+			r.sb.WriteString("</a>")
+		case MDWikiLinkFormatNode:
+			fmt.Fprintf(&r.sb, `<a class="wiki-link" href="%s">`, escapeHTML(normalizeURL(n.Ref())))
+			r.text(n.Text(), n.Span)
+			r.sb.WriteString("</a>")
+		case MDHashtagFormatNode:
+			r.sb.WriteString(`<span class="hashtag">`)
+			r.text("#"+n.Tag, n.Span)
+			r.sb.WriteString("</span>")
+		}
+	}
+}
+
+// Writes text from span of the document, marking any highlighted parts.
+func (r *mdHTMLRenderer) text(text string, span MDSpan) {
+	if len(r.highlight) == 0 || span.src == nil {
+		r.sb.WriteString(escapeHTML(text))
+		return
+	}
+	if len(text) != span.to-span.from {
+		// Only the whole of the text can be mapped back
+		r.marked(text, r.highlighted(span.Start.Offset, span.End.Offset))
+		return
+	}
+
+	// Each byte of the text comes from a single byte of the document
+	mark := func(i int) bool {
+		offset := span.src.offsets[span.from+i]
+		return r.highlighted(offset, offset+1)
+	}
+	start := 0
+	for i := 1; i <= len(text); i++ {
+		if i < len(text) && mark(i) == mark(start) {
+			continue
+		}
+		r.marked(text[start:i], mark(start))
+		start = i
+	}
+}
+
+func (r *mdHTMLRenderer) marked(text string, on bool) {
+	if on {
+		r.sb.WriteString("<mark>" + escapeHTML(text) + "</mark>")
+	} else {
+		r.sb.WriteString(escapeHTML(text))
+	}
+}
+
+// Whether any highlight overlaps offsets start to end of the document.
+func (r *mdHTMLRenderer) highlighted(start, end int) bool {
+	for _, h := range r.highlight {
+		if h.Start.Offset < end && start < h.End.Offset {
+			return true
+		}
+	}
+	return false
+}
+
+var htmlEscaper *strings.Replacer = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+func escapeHTML(s string) string { return htmlEscaper.Replace(s) }
+
+// Percent-encodes the characters of a URL that can't appear in one as-is,
+// leaving any that are already encoded alone.
+func normalizeURL(url string) string {
+	const hex = "0123456789ABCDEF"
+	var sb strings.Builder
+	for i := 0; i < len(url); i++ {
+		c := url[i]
+		switch {
+		case c == '%' && i+2 < len(url) && isHex(url[i+1]) && isHex(url[i+2]):
+			sb.WriteByte(c)
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			strings.IndexByte("-._~:/?#[]@!$&'()*+,;=", c) >= 0:
+			sb.WriteByte(c)
+		default:
+			sb.WriteByte('%')
+			sb.WriteByte(hex[c>>4])
+			sb.WriteByte(hex[c&0xf])
+		}
+	}
+	return sb.String()
+}
+
+func isHex(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
@@ -0,0 +1,117 @@
+package markdown
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestRenderHTML(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "html", "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".md")
+		t.Run(name, func(s *testing.T) {
+			text, err := os.ReadFile(file)
+			if err != nil {
+				s.Fatal(err)
+			}
+			tree, err := Parse(Lex(string(text)))
+			if err != nil {
+				s.Fatalf("unexpected error: %v", err)
+			}
+			actual := RenderHTML(tree)
+
+			golden := strings.TrimSuffix(file, ".md") + ".html"
+			if *update {
+				if err := os.WriteFile(golden, []byte(actual), 0644); err != nil {
+					s.Fatal(err)
+				}
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				s.Fatal(err)
+			}
+			if string(expected) != actual {
+				s.Errorf("HTML was not equal - expected:\n%s\nactual:\n%s", expected, actual)
+			}
+		})
+	}
+}
+
+func TestRenderHTMLHighlight(t *testing.T) {
+	tests := []struct {
+		name         string
+		text         string
+		terms        []string
+		expectedHTML string
+	}{
+		{
+			"text",
+			"Find the needle in the haystack",
+			[]string{"needle", "haystack"},
+			"<p>Find the <mark>needle</mark> in the <mark>haystack</mark></p>\n",
+		},
+		{
+			"across-formatting",
+			"A **bold move** here",
+			[]string{"bold move"},
+			"<p>A <strong><mark>bold move</mark></strong> here</p>\n",
+		},
+		{
+			"partly-formatted",
+			"un**fold**ing & <more>",
+			[]string{"un**fold**ing", "<more>"},
+			"<p><mark>un</mark><strong><mark>fold</mark></strong><mark>ing</mark> &amp; <mark>&lt;more&gt;</mark></p>\n",
+		},
+		{
+			"links-and-code",
+			"See [the map](http://x.org/map) and `map()`\n```\nmap\n```",
+			[]string{"map"},
+			"<p>See <a href=\"http://x.org/map\">the <mark>map</mark></a> and <code><mark>map</mark>()</code></p>\n<pre><code><mark>map</mark>\n</code></pre>\n",
+		},
+		{
+			"whole-nodes",
+			"[[Map note|maps]] and \\*map\\*",
+			[]string{"map"},
+			"<p><a class=\"wiki-link\" href=\"Map%20note\"><mark>maps</mark></a> and *<mark>map</mark>*</p>\n",
+		},
+		{
+			"tabs-and-crlf",
+			"- a\tmap\r\n  more",
+			[]string{"map", "more"},
+			"<ul>\n<li>a    <mark>map</mark>\n<mark>more</mark></li>\n</ul>\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(s *testing.T) {
+			tree, err := Parse(Lex(test.text))
+			if err != nil {
+				s.Fatalf("unexpected error: %v", err)
+			}
+			highlight := []MDSpan{}
+			for _, term := range test.terms {
+				for i := 0; i < len(test.text); {
+					j := strings.Index(test.text[i:], term)
+					if j < 0 {
+						break
+					}
+					start := MDPosition{Offset: i + j}
+					end := MDPosition{Offset: i + j + len(term)}
+					highlight = append(highlight, MDSpan{Start: start, End: end})
+					i += j + len(term)
+				}
+			}
+			if actual := RenderHTML(tree, highlight...); actual != test.expectedHTML {
+				s.Errorf("HTML was not equal - expected=%q, actual=%q", test.expectedHTML, actual)
+			}
+		})
+	}
+}
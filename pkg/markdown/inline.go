@@ -0,0 +1,487 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+type mdInlineItemType int
+
+const (
+	inlineText mdInlineItemType = iota
+	inlineEscape
+	inlineBreak
+	inlineDelim
+	inlineNode
+	inlineLinkStart
+	inlineLinkEnd
+)
+
+// One piece of a paragraph's inline content. Format tokens are split into one
+// delimiter item per run of the same character, so e.g. the end token "**~~"
+// closes bold and then strikethrough.
+type mdInlineItem struct {
+	typ  mdInlineItemType
+	text string
+	span MDSpan
+
+	// Line breaks only
+	hard bool
+
+	// Wiki-links, hashtags & autolinks only, which are complete nodes by
+	// themselves
+	node MDParagraphFormatNode
+
+	// Link ends only - the "](url)"
+	url   string
+	title string
+
+	// Delimiters only
+	delim    byte
+	count    int
+	canOpen  bool
+	canClose bool
+}
+
+// A delimiter waiting to be closed, along with everything parsed since.
+type mdInlineFrame struct {
+	delim   byte
+	count   int
+	span    MDSpan // Of the delimiter
+	content []MDParagraphFormatNode
+
+	// Whether the delimiter was in the middle of a word, as in "snake_case",
+	// where it's usually not meant as formatting at all
+	mid bool
+
+	// How many frames of each format delimiter are open, up to & including
+	// this one, since the innermost link. This lets findOpener give up
+	// without searching the whole stack.
+	open [len(formatDelims)]int
+}
+
+// The delimiter characters of formatting, as opposed to code & links.
+const formatDelims string = "*_~"
+
+// Pushes a frame, counting it as open.
+func pushFrame(stack []*mdInlineFrame, f *mdInlineFrame) []*mdInlineFrame {
+	if f.delim != '[' {
+		f.open = stack[len(stack)-1].open
+	}
+	if i := strings.IndexByte(formatDelims, f.delim); i >= 0 {
+		f.open[i]++
+	}
+	return append(stack, f)
+}
+
+// Parses the inline content of a paragraph (or header) given as its lines.
+//
+// Delimiters are matched with a stack: a closing delimiter closes the nearest
+// open one of the same character, and any opened in between that are still
+// open become literal text, since formatting can nest but not overlap:
+//
+//	*foo bar **bing bang* boom baz** -> ITALICS(foo bar **bing bang) boom baz**
+//
+// Code spans are matched first and their content is never formatted. Links
+// are matched like delimiters, except that formatting can't span their ends.
+//
+// Emphasis delimiters that end up as text are reported, unless they were in
+// the middle of a word.
+func parseInline(lines [][]MDToken) ([]MDParagraphFormatNode, []MDDiagnostic) {
+	items := []mdInlineItem{}
+	for i, line := range lines {
+		if i > 0 {
+			// Soft breaks are placed at the end of the line, taking up no space
+			brk := mdInlineItem{typ: inlineBreak, span: endOf(lineSpan(lines[i-1]))}
+			if n := len(items); n > 0 && items[n-1].typ == inlineEscape && items[n-1].text == "" {
+				// A backslash at the end of the line forces a line break
+				brk.hard, brk.span = true, items[n-1].span
+				items = items[:n-1]
+			}
+			items = append(items, brk)
+		}
+		items = append(items, inlineItems(line)...)
+	}
+
+	diagnostics := []MDDiagnostic{}
+	stack := []*mdInlineFrame{{}}
+	top := func() *mdInlineFrame { return stack[len(stack)-1] }
+	unwind := func(to int) {
+		popped := unwindFrames(&stack, to)
+		for i := len(popped) - 1; i >= 0; i-- {
+			if f := popped[i]; isFormatDelim(f.delim) && !f.mid {
+				diagnostics = append(diagnostics, unmatchedEmphasisDiagnostic(strings.Repeat(string(f.delim), f.count), f.span))
+			}
+		}
+	}
+
+	for i := 0; i < len(items); i++ {
+		item := items[i]
+		switch item.typ {
+		case inlineText:
+			top().content = appendText(top().content, item.text, item.span)
+		case inlineEscape:
+			if item.text == "" {
+				// Escaping whitespace (or nothing) leaves the backslash as-is
+				top().content = appendText(top().content, "\\", item.span)
+			} else {
+				top().content = append(top().content, MDEscapeFormatNode{Content: item.text, Span: item.span})
+			}
+		case inlineBreak:
+			top().content = append(top().content, MDLineBreakFormatNode{Hard: item.hard, Span: item.span})
+		case inlineNode:
+			top().content = append(top().content, item.node)
+		case inlineLinkStart:
+			stack = pushFrame(stack, &mdInlineFrame{delim: '[', count: 1, span: item.span})
+		case inlineLinkEnd:
+			f := len(stack) - 1
+			for f > 0 && stack[f].delim != '[' {
+				f--
+			}
+			if f == 0 {
+				top().content = appendText(top().content, item.text, item.span)
+				continue
+			}
+			unwind(f)
+			opener := stack[f]
+			stack = stack[:f]
+			top().content = append(top().content, MDLinkFormatNode{
+				URL:     item.url,
+				Title:   item.title,
+				Content: mergeText(opener.content),
+				Span:    joinSpans(opener.span, item.span),
+			})
+		case inlineDelim:
+			if item.delim == '`' {
+				if end := findCodeEnd(items, i); end > 0 {
+					text := MDTextFormatNode{Content: codeText(items[i+1 : end]), Span: joinSpans(endOf(item.span), startOf(items[end].span))}
+					top().content = append(top().content, MDInlineFormatNode{
+						Type:    FORMAT_NODE_CODE,
+						Content: []MDParagraphFormatNode{text},
+						Span:    joinSpans(item.span, items[end].span),
+					})
+					i = end
+				} else {
+					top().content = appendText(top().content, item.text, item.span)
+				}
+				continue
+			}
+			if !isFormatDelim(item.delim) {
+				top().content = appendText(top().content, item.text, item.span)
+				continue
+			}
+
+			remaining := item.count
+			for remaining > 0 && item.canClose {
+				f := findOpener(stack, item.delim, remaining)
+				if f == 0 {
+					break
+				}
+				unwind(f)
+
+				opener := stack[f]
+				use := opener.count
+				if remaining < use {
+					use = remaining
+				}
+				stack = stack[:f]
+				// The innermost delimiters are the ones that pair up
+				used := item.count - remaining
+				open, close := opener.span.sub(opener.count-use, opener.count), item.span.sub(used, used+use)
+				node := formatNode(opener.delim, use, mergeText(opener.content), open, close)
+				if opener.count > use {
+					// The rest of the opener can still be closed, as in
+					// "***a** b*"
+					rest := opener.count - use
+					stack = pushFrame(stack, &mdInlineFrame{
+						delim:   opener.delim,
+						count:   rest,
+						span:    opener.span.sub(0, rest),
+						content: []MDParagraphFormatNode{node},
+						mid:     opener.mid,
+					})
+				} else {
+					top().content = append(top().content, node)
+				}
+				remaining -= use
+			}
+
+			if remaining > 0 {
+				rest := item.span.sub(item.count-remaining, item.count)
+				if item.canOpen {
+					stack = pushFrame(stack, &mdInlineFrame{delim: item.delim, count: remaining, span: rest, mid: item.canClose})
+				} else {
+					text := strings.Repeat(string(item.delim), remaining)
+					top().content = appendText(top().content, text, rest)
+					diagnostics = append(diagnostics, unmatchedEmphasisDiagnostic(text, rest))
+				}
+			}
+		}
+	}
+
+	unwind(0)
+	return mergeText(stack[0].content), diagnostics
+}
+
+// Turns a line of tokens into inline items. The tokens have to have been
+// checked with checkToken already.
+func inlineItems(line []MDToken) []mdInlineItem {
+	items := []mdInlineItem{}
+	for i := 0; i < len(line); i++ {
+		switch t := line[i].(type) {
+		case MDTextToken:
+			if t.Content != "" {
+				items = append(items, mdInlineItem{typ: inlineText, text: t.Content, span: t.Span})
+			}
+		case MDEscapeToken:
+			items = append(items, mdInlineItem{typ: inlineEscape, text: t.Content, span: t.Span})
+		case MDWikiLinkToken:
+			node := MDWikiLinkFormatNode{Target: t.Target, Heading: t.Heading, Alias: t.Alias, Span: t.Span}
+			items = append(items, mdInlineItem{typ: inlineNode, text: t.Content, span: t.Span, node: node})
+		case MDHashtagToken:
+			node := MDHashtagFormatNode{Tag: t.Tag, Span: t.Span}
+			items = append(items, mdInlineItem{typ: inlineNode, text: t.Content, span: t.Span, node: node})
+		case MDAutolinkToken:
+			text := MDTextFormatNode{Content: t.URL, Span: t.Span}
+			if t.URL != t.Content {
+				text.Span = t.Span.sub(1, len(t.Content)-1)
+			}
+			node := MDLinkFormatNode{URL: t.URL, Auto: true, Content: []MDParagraphFormatNode{text}, Span: t.Span}
+			items = append(items, mdInlineItem{typ: inlineNode, text: t.Content, span: t.Span, node: node})
+		case MDSimpleToken:
+			switch {
+			case t.Type == TOKEN_INLINE_LINK_DESC_START:
+				items = append(items, mdInlineItem{typ: inlineLinkStart, text: "[", span: t.Span})
+			case t.Type == TOKEN_INLINE_LINK_DESC_END && isLinkEnd(line[i:]):
+				url, title := linkDestination(line[i+2].(MDTextToken).Content)
+				items = append(items, mdInlineItem{
+					typ:   inlineLinkEnd,
+					text:  tokenLiteral(line[i]) + tokenLiteral(line[i+1]) + tokenLiteral(line[i+2]) + tokenLiteral(line[i+3]),
+					span:  joinSpans(t.Span, line[i+3].GetSpan()),
+					url:   url,
+					title: title,
+				})
+				i += 3
+			default:
+				items = append(items, mdInlineItem{typ: inlineText, text: tokenLiteral(t), span: t.Span})
+			}
+		case MDInlineFormatToken:
+			canOpen := t.Type == TOKEN_INLINE_FORMAT_START || t.Type == TOKEN_INLINE_FORMAT_MID
+			canClose := t.Type == TOKEN_INLINE_FORMAT_END || t.Type == TOKEN_INLINE_FORMAT_MID
+			start := 0
+			for _, run := range splitRuns(t.Content) {
+				span := t.Span.sub(start, start+len(run))
+				start += len(run)
+				if run[0] == '~' && len(run) != 2 {
+					// Only "~~" is strikethrough
+					items = append(items, mdInlineItem{typ: inlineText, text: run, span: span})
+					continue
+				}
+				items = append(items, mdInlineItem{
+					typ:      inlineDelim,
+					text:     run,
+					span:     span,
+					delim:    run[0],
+					count:    len(run),
+					canOpen:  canOpen,
+					canClose: canClose,
+				})
+			}
+		default:
+			// Block indicators that didn't start a block are just text
+			items = append(items, mdInlineItem{typ: inlineText, text: tokenLiteral(t), span: t.GetSpan()})
+		}
+	}
+	return items
+}
+
+// Returns the index of the frame a closing delimiter should close, or 0 if
+// there isn't one. An opener of the same length is preferred, so in
+//
+//	*foo bar **bing bang* boom baz**
+//
+// the single '*' closes the single '*' rather than half of the "**".
+func findOpener(stack []*mdInlineFrame, delim byte, count int) int {
+	// Can't close anything outside of a link from inside it, so only the
+	// frames open since the innermost link are candidates
+	open := stack[len(stack)-1].open[strings.IndexByte(formatDelims, delim)]
+	nearest := 0
+	for f := len(stack) - 1; f > 0 && open > 0; f-- {
+		if stack[f].delim != delim {
+			continue
+		}
+		if stack[f].count == count {
+			return f
+		}
+		if nearest == 0 {
+			nearest = f
+		}
+		open--
+	}
+	return nearest
+}
+
+// Reports whether tokens starts with the "](url)" ending a link.
+func isLinkEnd(tokens []MDToken) bool {
+	if len(tokens) < 4 {
+		return false
+	}
+	_, isText := tokens[2].(MDTextToken)
+	return tokens[0].GetType() == TOKEN_INLINE_LINK_DESC_END &&
+		tokens[1].GetType() == TOKEN_INLINE_LINK_URL_START &&
+		isText &&
+		tokens[3].GetType() == TOKEN_INLINE_LINK_URL_END
+}
+
+var linkDestinationPatt *regexp.Regexp = regexp.MustCompile(`^(\S*)(?:\s+"(.*)")?$`)
+
+// Splits a link destination into its URL & optional title.
+func linkDestination(dest string) (string, string) {
+	m := linkDestinationPatt.FindStringSubmatch(strings.TrimSpace(dest))
+	if m == nil {
+		return dest, ""
+	}
+	return m[1], m[2]
+}
+
+func isFormatDelim(c byte) bool {
+	return strings.IndexByte(formatDelims, c) >= 0
+}
+
+// Builds the node for text wrapped in count delimiter characters, given the
+// spans of the opening & closing delimiters. Following
+// markdown_element_notes.md, three or more is italics + bold when odd and just
+// bold when even; "__" is underline rather than bold. "~~" is strikethrough.
+func formatNode(delim byte, count int, content []MDParagraphFormatNode, open, close MDSpan) MDParagraphFormatNode {
+	span := joinSpans(open, close)
+	if delim == '~' {
+		return MDInlineFormatNode{Type: FORMAT_NODE_STRIKETHROUGH, Content: content, Span: span}
+	}
+	strong := FORMAT_NODE_BOLD
+	if delim == '_' {
+		strong = FORMAT_NODE_UNDERLINE
+	}
+	switch {
+	case count == 1:
+		return MDInlineFormatNode{Type: FORMAT_NODE_ITALICS, Content: content, Span: span}
+	case count%2 == 0:
+		return MDInlineFormatNode{Type: strong, Content: content, Span: span}
+	default:
+		// The italics take the outermost delimiter on either side
+		inner := MDInlineFormatNode{Type: strong, Content: content, Span: joinSpans(open.sub(1, count), close.sub(0, count-1))}
+		return MDInlineFormatNode{Type: FORMAT_NODE_ITALICS, Content: []MDParagraphFormatNode{inner}, Span: span}
+	}
+}
+
+// Finds the delimiter closing the code span opened at items[start], which has
+// to be a run of the same number of backticks.
+func findCodeEnd(items []mdInlineItem, start int) int {
+	open := items[start]
+	if !open.canOpen {
+		return -1
+	}
+	for j := start + 1; j < len(items); j++ {
+		if items[j].typ == inlineDelim && items[j].delim == '`' && items[j].count == open.count && items[j].canClose {
+			return j
+		}
+	}
+	return -1
+}
+
+func codeText(items []mdInlineItem) string {
+	var sb strings.Builder
+	for _, item := range items {
+		switch item.typ {
+		case inlineBreak:
+			// A backslash is just a backslash in code
+			if item.hard {
+				sb.WriteString("\\")
+			}
+			sb.WriteString(" ")
+		case inlineEscape:
+			sb.WriteString("\\" + item.text)
+		default:
+			sb.WriteString(item.text)
+		}
+	}
+	return sb.String()
+}
+
+// Pops the frames above stack[to], turning their delimiters back into text,
+// and returns them outermost first. They're unwound together so that each
+// one's content is only moved once, however deeply they're nested.
+func unwindFrames(stack *[]*mdInlineFrame, to int) []*mdInlineFrame {
+	s := *stack
+	parent := s[to]
+	for _, f := range s[to+1:] {
+		parent.content = appendText(parent.content, strings.Repeat(string(f.delim), f.count), f.span)
+		parent.content = append(parent.content, f.content...)
+	}
+	*stack = s[:to+1]
+	return s[to+1:]
+}
+
+// Appends text. Adjacent text nodes are merged by mergeText once the content
+// is complete, rather than here, so that a long run of text isn't copied
+// every time a piece is added to it.
+func appendText(ns []MDParagraphFormatNode, text string, span MDSpan) []MDParagraphFormatNode {
+	if text == "" {
+		return ns
+	}
+	return append(ns, MDTextFormatNode{Content: text, Span: span})
+}
+
+// Merges each run of adjacent text nodes into one, in place.
+func mergeText(ns []MDParagraphFormatNode) []MDParagraphFormatNode {
+	merged := ns[:0]
+	for i := 0; i < len(ns); i++ {
+		t, ok := ns[i].(MDTextFormatNode)
+		if !ok {
+			merged = append(merged, ns[i])
+			continue
+		}
+		j := i + 1
+		for j < len(ns) {
+			if _, ok := ns[j].(MDTextFormatNode); !ok {
+				break
+			}
+			j++
+		}
+		if j-i > 1 {
+			var sb strings.Builder
+			for _, n := range ns[i:j] {
+				sb.WriteString(n.(MDTextFormatNode).Content)
+			}
+			t = MDTextFormatNode{Content: sb.String(), Span: joinSpans(t.Span, ns[j-1].(MDTextFormatNode).Span)}
+		}
+		merged = append(merged, t)
+		i = j - 1
+	}
+	return merged
+}
+
+// Returns the span covering a line of tokens.
+func lineSpan(line []MDToken) MDSpan {
+	if len(line) == 0 {
+		return MDSpan{}
+	}
+	return joinSpans(line[0].GetSpan(), line[len(line)-1].GetSpan())
+}
+
+// Returns the empty spans at the start & end of s.
+func startOf(s MDSpan) MDSpan { return s.sub(0, 0) }
+
+func endOf(s MDSpan) MDSpan { return s.sub(s.to-s.from, s.to-s.from) }
+
+// Splits e.g. "~~**" into "~~" and "**".
+func splitRuns(s string) []string {
+	runs := []string{}
+	start := 0
+	for i := 1; i <= len(s); i++ {
+		if i == len(s) || s[i] != s[start] {
+			runs = append(runs, s[start:i])
+			start = i
+		}
+	}
+	return runs
+}
@@ -16,6 +16,9 @@ import (
 // ORDERED_LIST_INDIC
 // HEADER_INDIC(N)
 // EXPLICIT_CODEBLOCK_INDIC
+// QUOTE_INDIC
+// TASK_INDIC
+// TABLE_DELIM_ROW
 
 // INLINE_BOLD_INDIC
 // INLINE_ITALICS_INDIC
@@ -28,6 +31,12 @@ import (
 // INLINE_LINK_URL_START
 // INLINE_LINK_URL_END
 
+// TABLE_PIPE
+
+// WIKI_LINK
+// HASHTAG
+// AUTOLINK
+
 type MDTokenType int
 
 const (
@@ -43,6 +52,9 @@ const (
 	TOKEN_ORDERED_LIST_INDIC
 	TOKEN_HEADER_INDIC // Requires (n)
 	TOKEN_EXPLICIT_CODEBLOCK_INDIC
+	TOKEN_QUOTE_INDIC // One per nesting level, so ">>" is two of these
+	TOKEN_TASK_INDIC
+	TOKEN_TABLE_DELIM_ROW
 
 	TOKEN_INLINE_FORMAT_START
 	TOKEN_INLINE_FORMAT_MID
@@ -66,6 +78,12 @@ const (
 	TOKEN_INLINE_LINK_URL_END
 
 	TOKEN_SPECIAL_CHAR_ESCAPE
+
+	TOKEN_TABLE_PIPE
+
+	TOKEN_WIKI_LINK
+	TOKEN_HASHTAG
+	TOKEN_AUTOLINK
 )
 
 var mdTokenTypeName map[MDTokenType]string = map[MDTokenType]string{
@@ -77,6 +95,9 @@ var mdTokenTypeName map[MDTokenType]string = map[MDTokenType]string{
 	TOKEN_ORDERED_LIST_INDIC:       "ORDERED_LIST_INDIC",
 	TOKEN_HEADER_INDIC:             "HEADER_INDIC",
 	TOKEN_EXPLICIT_CODEBLOCK_INDIC: "EXPLICIT_CODEBLOCK_INDIC",
+	TOKEN_QUOTE_INDIC:              "QUOTE_INDIC",
+	TOKEN_TASK_INDIC:               "TASK_INDIC",
+	TOKEN_TABLE_DELIM_ROW:          "TABLE_DELIM_ROW",
 	TOKEN_INLINE_FORMAT_START:      "INLINE_FORMAT_START",
 	TOKEN_INLINE_FORMAT_MID:        "INLINE_FORMAT_MID",
 	TOKEN_INLINE_FORMAT_END:        "INLINE_FORMAT_END",
@@ -85,6 +106,10 @@ var mdTokenTypeName map[MDTokenType]string = map[MDTokenType]string{
 	TOKEN_INLINE_LINK_URL_START:    "INLINE_LINK_URL_START",
 	TOKEN_INLINE_LINK_URL_END:      "INLINE_LINK_URL_END",
 	TOKEN_SPECIAL_CHAR_ESCAPE:      "SPECIAL_CHAR_ESCAPE",
+	TOKEN_TABLE_PIPE:               "TABLE_PIPE",
+	TOKEN_WIKI_LINK:                "WIKI_LINK",
+	TOKEN_HASHTAG:                  "HASHTAG",
+	TOKEN_AUTOLINK:                 "AUTOLINK",
 }
 
 func (t MDTokenType) String() string {
@@ -93,16 +118,22 @@ func (t MDTokenType) String() string {
 
 type MDToken interface {
 	GetType() MDTokenType
+
+	// GetSpan returns where the token came from in the text given to Lex.
+	GetSpan() MDSpan
 }
 
 type MDSimpleToken struct {
 	Type MDTokenType
+	Span MDSpan
 }
 
 // TODO: Should these be on the pointer instead of the plain type? Should it depend on the token type?
 
 func (t MDSimpleToken) GetType() MDTokenType { return t.Type }
 
+func (t MDSimpleToken) GetSpan() MDSpan { return t.Span }
+
 func (t MDSimpleToken) String() string {
 	return t.Type.String()
 }
@@ -110,67 +141,185 @@ func (t MDSimpleToken) String() string {
 type MDInlineFormatToken struct {
 	Type    MDTokenType
 	Content string
+	Span    MDSpan
 }
 
 func (t MDInlineFormatToken) GetType() MDTokenType { return t.Type }
 
+func (t MDInlineFormatToken) GetSpan() MDSpan { return t.Span }
+
 func (t MDInlineFormatToken) String() string {
 	return fmt.Sprintf("%v(%s)", t.Type, t.Content)
 }
 
 type MDTextToken struct {
 	Content string
+	Span    MDSpan
 }
 
 func (t MDTextToken) GetType() MDTokenType { return TOKEN_TEXT }
 
+func (t MDTextToken) GetSpan() MDSpan { return t.Span }
+
 func (t MDTextToken) String() string { return fmt.Sprintf("%v(%s)", t.GetType(), t.Content) }
 
 type MDHeaderIndicToken struct {
 	Count   int
 	Content string
+	Span    MDSpan
 }
 
 func (t MDHeaderIndicToken) GetType() MDTokenType { return TOKEN_HEADER_INDIC }
 
+func (t MDHeaderIndicToken) GetSpan() MDSpan { return t.Span }
+
 func (t MDHeaderIndicToken) String() string {
 	return fmt.Sprintf("HEADER(%s)", strings.Repeat("#", t.Count))
 }
 
 type MDOrderedListIndicToken struct {
 	Content string
+	Span    MDSpan
 }
 
 func (t MDOrderedListIndicToken) GetType() MDTokenType { return TOKEN_ORDERED_LIST_INDIC }
 
+func (t MDOrderedListIndicToken) GetSpan() MDSpan { return t.Span }
+
 func (t MDOrderedListIndicToken) String() string { return fmt.Sprintf("LIST(%s)", t.Content) }
 
 type MDUnorderedListIndicToken struct {
 	Content string
+	Span    MDSpan
 }
 
 func (t MDUnorderedListIndicToken) GetType() MDTokenType { return TOKEN_UNORDERED_LIST_INDIC }
 
+func (t MDUnorderedListIndicToken) GetSpan() MDSpan { return t.Span }
+
 func (t MDUnorderedListIndicToken) String() string { return fmt.Sprintf("LIST(%s)", t.Content) }
 
+type MDQuoteIndicToken struct {
+	Content string
+	Span    MDSpan
+}
+
+func (t MDQuoteIndicToken) GetType() MDTokenType { return TOKEN_QUOTE_INDIC }
+
+func (t MDQuoteIndicToken) GetSpan() MDSpan { return t.Span }
+
+func (t MDQuoteIndicToken) String() string { return fmt.Sprintf("QUOTE(%s)", t.Content) }
+
+// MDCodeFenceToken is a line opening or closing a fenced code block, e.g.
+// "```go". Info is whatever follows the fence, which for an opening fence is
+// usually the language.
+type MDCodeFenceToken struct {
+	Fence   string
+	Info    string
+	Content string
+	Span    MDSpan
+}
+
+func (t MDCodeFenceToken) GetType() MDTokenType { return TOKEN_EXPLICIT_CODEBLOCK_INDIC }
+
+func (t MDCodeFenceToken) GetSpan() MDSpan { return t.Span }
+
+func (t MDCodeFenceToken) String() string { return fmt.Sprintf("FENCE(%s)", t.Content) }
+
+// MDTaskIndicToken is the "[ ]" or "[x]" following a list indicator that
+// makes the item a task.
+type MDTaskIndicToken struct {
+	Checked bool
+	Content string
+	Span    MDSpan
+}
+
+func (t MDTaskIndicToken) GetType() MDTokenType { return TOKEN_TASK_INDIC }
+
+func (t MDTaskIndicToken) GetSpan() MDSpan { return t.Span }
+
+func (t MDTaskIndicToken) String() string { return fmt.Sprintf("TASK(%s)", t.Content) }
+
+// MDTableDelimRowToken is a line like "| --- | :-: |", which makes the line
+// above it a table header. The whole line is a single token.
+type MDTableDelimRowToken struct {
+	Content string
+	Span    MDSpan
+}
+
+func (t MDTableDelimRowToken) GetType() MDTokenType { return TOKEN_TABLE_DELIM_ROW }
+
+func (t MDTableDelimRowToken) GetSpan() MDSpan { return t.Span }
+
+func (t MDTableDelimRowToken) String() string { return fmt.Sprintf("TABLE_DELIM(%s)", t.Content) }
+
 type MDLeadingSpaceToken struct {
 	Count int
+	Span  MDSpan
 }
 
 func (t MDLeadingSpaceToken) GetType() MDTokenType { return TOKEN_LEADING_SPACE }
 
+func (t MDLeadingSpaceToken) GetSpan() MDSpan { return t.Span }
+
 func (t MDLeadingSpaceToken) String() string {
 	return fmt.Sprintf("%v(%s)", t.GetType(), strings.Repeat(" ", t.Count))
 }
 
 type MDEscapeToken struct {
 	Content string
+	Span    MDSpan
 }
 
 func (t MDEscapeToken) GetType() MDTokenType { return TOKEN_SPECIAL_CHAR_ESCAPE }
 
+func (t MDEscapeToken) GetSpan() MDSpan { return t.Span }
+
 func (t MDEscapeToken) String() string { return fmt.Sprintf("ESCAPED(%s)", t.Content) }
 
+// MDWikiLinkToken is a whole "[[Target#Heading|Alias]]" reference to another
+// note; the heading & alias are both optional.
+type MDWikiLinkToken struct {
+	Target  string
+	Heading string
+	Alias   string
+	Content string
+	Span    MDSpan
+}
+
+func (t MDWikiLinkToken) GetType() MDTokenType { return TOKEN_WIKI_LINK }
+
+func (t MDWikiLinkToken) GetSpan() MDSpan { return t.Span }
+
+func (t MDWikiLinkToken) String() string { return fmt.Sprintf("WIKI_LINK(%s)", t.Content) }
+
+// MDHashtagToken is a "#tag" starting a word. Tags can be nested with '/', as
+// in "#project/notes".
+type MDHashtagToken struct {
+	Tag     string
+	Content string
+	Span    MDSpan
+}
+
+func (t MDHashtagToken) GetType() MDTokenType { return TOKEN_HASHTAG }
+
+func (t MDHashtagToken) GetSpan() MDSpan { return t.Span }
+
+func (t MDHashtagToken) String() string { return fmt.Sprintf("HASHTAG(%s)", t.Tag) }
+
+// MDAutolinkToken is a URL in the text, either bare or in angle brackets.
+type MDAutolinkToken struct {
+	URL     string
+	Content string
+	Span    MDSpan
+}
+
+func (t MDAutolinkToken) GetType() MDTokenType { return TOKEN_AUTOLINK }
+
+func (t MDAutolinkToken) GetSpan() MDSpan { return t.Span }
+
+func (t MDAutolinkToken) String() string { return fmt.Sprintf("AUTOLINK(%s)", t.URL) }
+
 const (
 	INLINE_FORMAT_CHARS string = "*_~`"
 	SPECIAL_CHARS       string = `\\\[\]()`
@@ -194,7 +343,6 @@ func GetSpecialCharTokenType(b byte) MDTokenType {
 }
 
 // TODO:
-// - Links ([...](...))
 // - a/b/c, A/B/C, i/ii/iii, etc. for lists
 // - Escape at end of line forces new line (instead of concatenating e.g. two paragraphs)
 // - Integration of HTML elements
@@ -227,64 +375,293 @@ var (
 	// it is followed by another '*'.
 	inlineFormattingPattStr string = fmt.Sprintf("(\\s|^)([%[1]s]+)\\S|\\S([%[1]s]+)(\\s|$)|\\S([%[1]s]+)\\S", INLINE_FORMAT_CHARS)
 
-	inlineCharPatt *regexp.Regexp = regexp.MustCompile(fmt.Sprintf("(\\\\([^\\s])?)|(%s)", inlineFormattingPattStr))
+	// "[[Target#Heading|Alias]]" - none of the parts can contain brackets
+	wikiLinkPattStr string = `\[\[([^\[\]|#]+)(#([^\[\]|]*))?(\|([^\[\]]*))?\]\]`
+
+	// There's no lookbehind, so the whitespace before a hashtag is matched as
+	// well. Only tags with a letter in them count, so "#1" isn't a tag.
+	hashtagPattStr string = `(\s|^)(#([\p{L}\p{N}_-]+(/[\p{L}\p{N}_-]+)*))`
+
+	// "[description](destination "title")". The description is lexed like any
+	// other inline content, but the destination isn't.
+	linkPattStr string = `\[([^\[\]\n]*)\]\(([^()\s]*(?:\s+"[^"\n]*")?)\)`
+
+	// Punctuation at the end of a bare URL is assumed to belong to the
+	// sentence around it.
+	autolinkPattStr string = `<(https?://[^\s<>]+)>|https?://[^\s<>]*[^\s<>.,;:!?'")\]]`
+
+	inlineCharPatt *regexp.Regexp = regexp.MustCompile(fmt.Sprintf("(\\\\([^\\s])?)|(%s)|(%s)|(\\|)|(%s)|%s|(%s)", linkPattStr, inlineFormattingPattStr, wikiLinkPattStr, hashtagPattStr, autolinkPattStr))
 
 	specialCharGroup int = 1
 
 	specialCharEscapedGroup int = 2
 
-	inlineFormattingGroup int = 3
+	// Links have to come before formatting, which could otherwise match at the
+	// same place, e.g. "[*styled*](...)".
+	linkGroup int = 3
+
+	linkDescGroup int = 4
+
+	linkDestGroup int = 5
+
+	inlineFormattingGroup int = 6
+
+	inlineFormatStartGroup int = 8
+
+	inlineFormatEndGroup int = 9
+
+	inlineFormatMidGroup int = 11
 
-	inlineFormatStartGroup int = 5
+	tablePipeGroup int = 12
 
-	inlineFormatEndGroup int = 6
+	wikiLinkGroup int = 13
 
-	inlineFormatMidGroup int = 8
+	wikiLinkTargetGroup int = 14
 
-	unorderedListIndicPatt *regexp.Regexp = regexp.MustCompile(`^-\s`)
+	wikiLinkHeadingGroup int = 16
 
-	orderedListIndicPatt *regexp.Regexp = regexp.MustCompile(`^\d+\.\s`)
+	wikiLinkAliasGroup int = 18
 
-	headerIndicPatt *regexp.Regexp = regexp.MustCompile(`^(#+)\s`)
+	hashtagGroup int = 20
 
-	leadingWhitespacePatt *regexp.Regexp = regexp.MustCompile(`^\s+`)
+	hashtagTagGroup int = 21
+
+	autolinkGroup int = 23
+
+	autolinkBracketedGroup int = 24
+
+	hashtagLetterPatt *regexp.Regexp = regexp.MustCompile(`\pL`)
+
+	// Wiki-links & hashtags end in a non-space character, which the format
+	// patterns above need to see to find a closing delimiter straight after
+	// them - so those delimiters are matched separately.
+	trailingFormatPatt *regexp.Regexp = regexp.MustCompile(fmt.Sprintf("^([%s]+)(\\S)?", INLINE_FORMAT_CHARS))
+
+	// The same goes for an escaped character, except that backticks are left
+	// to inlineCharPatt: a run after an escape can still open a code span, but
+	// shouldn't close one, as the escape would have been part of the code.
+	escapedTrailingFormatPatt *regexp.Regexp = regexp.MustCompile(`^([*_~]+)(\S)?`)
+
+	unorderedListIndicPatt *regexp.Regexp = regexp.MustCompile(`^-([^\S\n]|$)`)
+
+	orderedListIndicPatt *regexp.Regexp = regexp.MustCompile(`^\d+\.([^\S\n]|$)`)
+
+	headerIndicPatt *regexp.Regexp = regexp.MustCompile(`^(#+)([^\S\n]|$)`)
+
+	// Only the '>' and one optional space belong to the indicator, so a nested
+	// quote like ">> text" comes out as two of them.
+	quoteIndicPatt *regexp.Regexp = regexp.MustCompile(`^> ?`)
+
+	taskIndicPatt *regexp.Regexp = regexp.MustCompile(`^\[([ xX])\]( |$)`)
+
+	// At least one pipe is required, so e.g. "---" on its own isn't a row
+	tableDelimRowPatt *regexp.Regexp = regexp.MustCompile(`^(\|?[ ]*:?-+:?[ ]*(\|[ ]*:?-+:?[ ]*)+\|?|\|[ ]*:?-+:?[ ]*\|?)[ ]*$`)
+
+	// The info string of a backtick fence can't have backticks in it, or the
+	// line could just as well be inline code
+	codeFencePatt *regexp.Regexp = regexp.MustCompile("^(?:(`{3,})([^`]*)|(~{3,})(.*))$")
+
+	leadingWhitespacePatt *regexp.Regexp = regexp.MustCompile(`^[^\S\n]+`)
 
 	endOfLinePatt *regexp.Regexp = regexp.MustCompile("(?m)^.*$")
 )
 
+// Lex splits a document into tokens, each with the span of the original text
+// it came from.
 func Lex(text string) []MDToken {
+	return lexFrom(text, 0)
+}
+
+// Lexes text[start:], keeping spans relative to the whole of text - so e.g. a
+// document's front matter can be skipped without throwing off the positions
+// of everything after it.
+func lexFrom(text string, start int) []MDToken {
 	// Standard preprocessing - CRLF-to-LF for simplicity, but the tabs-to-four-spaces
 	// appears to be standard behavior for Markdown parsers. We'll follow it here
-	// as well b/c it makes things sooo much easier.
+	// as well b/c it makes things sooo much easier. The source map keeps track of
+	// where everything was beforehand.
 	//
 	// TODO: Should we also replace '\r' with '\n'? That's standard for other formats but I don't
 	//       know if it also is for Markdown.
-	text = strings.ReplaceAll(text, "\r\n", "\n")
-	text = strings.ReplaceAll(text, "\t", "    ")
+	text, src := newSourceMap(text, start)
 
 	bytes := []byte(text)
 	tokens := []MDToken{} // TODO: better initial capacity
 
+	// Text tokens are everywhere, so a shorthand for them
+	textToken := func(from, to int) MDTextToken {
+		return MDTextToken{Content: string(bytes[from:to]), Span: src.span(from, to)}
+	}
+
+	// Inline content is lexed a line at a time - or for the description of a
+	// link, just that part of the line
+	var lexInline func(cur, lineEnd int)
+	lexInline = func(cur, lineEnd int) {
+		for cur < lineEnd {
+			m := inlineCharPatt.FindSubmatchIndex(bytes[cur:lineEnd])
+			if m == nil {
+				tokens = append(tokens, textToken(cur, lineEnd))
+				cur = lineEnd
+			} else if m[specialCharGroup*2] >= 0 {
+				startidx, endidx := specialCharGroup*2, specialCharGroup*2+1
+				var escaped string
+				if m[specialCharEscapedGroup*2] >= 0 {
+					escaped = string(bytes[cur+m[specialCharEscapedGroup*2] : cur+m[specialCharEscapedGroup*2+1]])
+				}
+				escapeToken := MDEscapeToken{Content: escaped, Span: src.span(cur+m[startidx], cur+m[endidx])}
+
+				// Only create text token if we have non-empty text to add
+				if m[startidx] > 0 {
+					tokens = append(tokens, textToken(cur, cur+m[startidx]))
+				}
+				tokens = append(tokens, escapeToken)
+				cur += m[endidx]
+				if escaped != "" {
+					cur += lexTrailingFormat(escapedTrailingFormatPatt, bytes, cur, lineEnd, src, &tokens)
+				}
+			} else if m[tablePipeGroup*2] >= 0 {
+				startidx, endidx := tablePipeGroup*2, tablePipeGroup*2+1
+				if m[startidx] > 0 {
+					tokens = append(tokens, textToken(cur, cur+m[startidx]))
+				}
+				tokens = append(tokens, MDSimpleToken{Type: TOKEN_TABLE_PIPE, Span: src.span(cur+m[startidx], cur+m[endidx])})
+				cur += m[endidx]
+			} else if m[wikiLinkGroup*2] >= 0 {
+				startidx, endidx := wikiLinkGroup*2, wikiLinkGroup*2+1
+				if m[startidx] > 0 {
+					tokens = append(tokens, textToken(cur, cur+m[startidx]))
+				}
+				group := func(g int) string {
+					if m[g*2] < 0 {
+						return ""
+					}
+					return strings.TrimSpace(string(bytes[cur+m[g*2] : cur+m[g*2+1]]))
+				}
+				token := MDWikiLinkToken{
+					Target:  group(wikiLinkTargetGroup),
+					Heading: group(wikiLinkHeadingGroup),
+					Alias:   group(wikiLinkAliasGroup),
+					Content: string(bytes[cur+m[startidx] : cur+m[endidx]]),
+					Span:    src.span(cur+m[startidx], cur+m[endidx]),
+				}
+				tokens = append(tokens, token)
+				cur += m[endidx]
+				cur += lexTrailingFormat(trailingFormatPatt, bytes, cur, lineEnd, src, &tokens)
+			} else if m[hashtagGroup*2] >= 0 {
+				startidx, endidx := hashtagGroup*2, hashtagGroup*2+1
+				content := string(bytes[cur+m[startidx] : cur+m[endidx]])
+				if !hashtagLetterPatt.MatchString(content) {
+					// Not a tag, but still has to be consumed
+					tokens = append(tokens, textToken(cur, cur+m[endidx]))
+					cur += m[endidx]
+					continue
+				}
+				if m[startidx] > 0 {
+					tokens = append(tokens, textToken(cur, cur+m[startidx]))
+				}
+				tag := string(bytes[cur+m[hashtagTagGroup*2] : cur+m[hashtagTagGroup*2+1]])
+				tokens = append(tokens, MDHashtagToken{Tag: tag, Content: content, Span: src.span(cur+m[startidx], cur+m[endidx])})
+				cur += m[endidx]
+				cur += lexTrailingFormat(trailingFormatPatt, bytes, cur, lineEnd, src, &tokens)
+			} else if m[linkGroup*2] >= 0 {
+				startidx, endidx := linkGroup*2, linkGroup*2+1
+				if m[startidx] > 0 {
+					tokens = append(tokens, textToken(cur, cur+m[startidx]))
+				}
+				descFrom, descTo := cur+m[linkDescGroup*2], cur+m[linkDescGroup*2+1]
+				destFrom, destTo := cur+m[linkDestGroup*2], cur+m[linkDestGroup*2+1]
+				linkEnd := cur + m[endidx]
+				tokens = append(tokens, MDSimpleToken{Type: TOKEN_INLINE_LINK_DESC_START, Span: src.span(descFrom-1, descFrom)})
+				lexInline(descFrom, descTo)
+				tokens = append(tokens,
+					MDSimpleToken{Type: TOKEN_INLINE_LINK_DESC_END, Span: src.span(descTo, descTo+1)},
+					MDSimpleToken{Type: TOKEN_INLINE_LINK_URL_START, Span: src.span(destFrom-1, destFrom)},
+					textToken(destFrom, destTo),
+					MDSimpleToken{Type: TOKEN_INLINE_LINK_URL_END, Span: src.span(destTo, linkEnd)},
+				)
+				cur = linkEnd
+				cur += lexTrailingFormat(trailingFormatPatt, bytes, cur, lineEnd, src, &tokens)
+			} else if m[autolinkGroup*2] >= 0 {
+				startidx, endidx := autolinkGroup*2, autolinkGroup*2+1
+				if m[startidx] > 0 {
+					tokens = append(tokens, textToken(cur, cur+m[startidx]))
+				}
+				content := string(bytes[cur+m[startidx] : cur+m[endidx]])
+				url := content
+				if m[autolinkBracketedGroup*2] >= 0 {
+					url = string(bytes[cur+m[autolinkBracketedGroup*2] : cur+m[autolinkBracketedGroup*2+1]])
+				}
+				tokens = append(tokens, MDAutolinkToken{URL: url, Content: content, Span: src.span(cur+m[startidx], cur+m[endidx])})
+				cur += m[endidx]
+				cur += lexTrailingFormat(trailingFormatPatt, bytes, cur, lineEnd, src, &tokens)
+			} else {
+				var typ MDTokenType
+				var startidx, endidx int
+				if m[inlineFormatStartGroup*2] >= 0 { // start
+					typ = TOKEN_INLINE_FORMAT_START
+					startidx, endidx = inlineFormatStartGroup*2, inlineFormatStartGroup*2+1
+				} else if m[inlineFormatEndGroup*2] >= 0 { // end
+					typ = TOKEN_INLINE_FORMAT_END
+					startidx, endidx = inlineFormatEndGroup*2, inlineFormatEndGroup*2+1
+				} else { // mid
+					typ = TOKEN_INLINE_FORMAT_MID
+					startidx, endidx = inlineFormatMidGroup*2, inlineFormatMidGroup*2+1
+				}
+				chr := string(bytes[cur+m[startidx] : cur+m[endidx]])
+				fmtToken := MDInlineFormatToken{Type: typ, Content: chr, Span: src.span(cur+m[startidx], cur+m[endidx])}
+
+				tokens = append(tokens, textToken(cur, cur+m[startidx]))
+				tokens = append(tokens, fmtToken)
+				cur += m[endidx]
+			}
+		}
+	}
+
 	cur := 0
 	for cur < len(bytes) {
 		if bytes[cur] == '\n' {
-			token := MDSimpleToken{TOKEN_NL}
+			token := MDSimpleToken{Type: TOKEN_NL, Span: src.span(cur, cur+1)}
 			tokens = append(tokens, token)
 			cur++
 		} else if m := leadingWhitespacePatt.FindIndex(bytes[cur:]); m != nil {
-			token := MDLeadingSpaceToken{m[1] - m[0]}
+			token := MDLeadingSpaceToken{Count: m[1] - m[0], Span: src.span(cur+m[0], cur+m[1])}
+			tokens = append(tokens, token)
+			cur += m[1]
+		} else if m := codeFencePatt.FindSubmatchIndex(restOfLine(bytes, cur)); m != nil {
+			fence, info := m[2:4], m[4:6]
+			if fence[0] < 0 {
+				fence, info = m[6:8], m[8:10]
+			}
+			token := MDCodeFenceToken{
+				Fence:   string(bytes[cur+fence[0] : cur+fence[1]]),
+				Info:    strings.TrimSpace(string(bytes[cur+info[0] : cur+info[1]])),
+				Content: string(bytes[cur+m[0] : cur+m[1]]),
+				Span:    src.span(cur+m[0], cur+m[1]),
+			}
+			tokens = append(tokens, token)
+			cur += m[1]
+		} else if m := tableDelimRowPatt.FindIndex(restOfLine(bytes, cur)); m != nil {
+			token := MDTableDelimRowToken{Content: string(bytes[cur+m[0] : cur+m[1]]), Span: src.span(cur+m[0], cur+m[1])}
+			tokens = append(tokens, token)
+			cur += m[1]
+		} else if m := taskIndicPatt.FindSubmatchIndex(restOfLine(bytes, cur)); m != nil && followsListIndic(tokens) {
+			token := MDTaskIndicToken{Checked: bytes[cur+m[2]] != ' ', Content: string(bytes[cur+m[0] : cur+m[1]]), Span: src.span(cur+m[0], cur+m[1])}
+			tokens = append(tokens, token)
+			cur += m[1]
+		} else if m := unorderedListIndicPatt.FindIndex(restOfLine(bytes, cur)); m != nil {
+			token := MDUnorderedListIndicToken{Content: string(bytes[cur+m[0] : cur+m[1]]), Span: src.span(cur+m[0], cur+m[1])}
 			tokens = append(tokens, token)
 			cur += m[1]
-		} else if m := unorderedListIndicPatt.FindIndex(bytes[cur:]); m != nil {
-			token := MDUnorderedListIndicToken{string(bytes[cur+m[0] : cur+m[1]])}
+		} else if m := orderedListIndicPatt.FindIndex(restOfLine(bytes, cur)); m != nil {
+			token := MDOrderedListIndicToken{Content: string(bytes[cur+m[0] : cur+m[1]]), Span: src.span(cur+m[0], cur+m[1])}
 			tokens = append(tokens, token)
 			cur += m[1]
-		} else if m := orderedListIndicPatt.FindIndex(bytes[cur:]); m != nil {
-			token := MDOrderedListIndicToken{string(bytes[cur+m[0] : cur+m[1]])}
+		} else if m := quoteIndicPatt.FindIndex(bytes[cur:]); m != nil {
+			token := MDQuoteIndicToken{Content: string(bytes[cur+m[0] : cur+m[1]]), Span: src.span(cur+m[0], cur+m[1])}
 			tokens = append(tokens, token)
 			cur += m[1]
-		} else if m := headerIndicPatt.FindSubmatchIndex(bytes[cur:]); m != nil {
-			token := MDHeaderIndicToken{m[3] - m[2], string(bytes[cur+m[0] : cur+m[1]])}
+		} else if m := headerIndicPatt.FindSubmatchIndex(restOfLine(bytes, cur)); m != nil {
+			token := MDHeaderIndicToken{Count: m[3] - m[2], Content: string(bytes[cur+m[0] : cur+m[1]]), Span: src.span(cur+m[0], cur+m[1])}
 			tokens = append(tokens, token)
 			cur += m[1]
 		} else {
@@ -292,58 +669,48 @@ func Lex(text string) []MDToken {
 			m := endOfLinePatt.FindIndex(bytes[cur:])
 			lineEnd := cur + m[1]
 
-			for cur < lineEnd {
-				m := inlineCharPatt.FindSubmatchIndex(bytes[cur:lineEnd])
-				if m == nil {
-					text := string(bytes[cur:lineEnd])
-					tokens = append(tokens, MDTextToken{text})
-					cur = lineEnd
-				} else if m[specialCharGroup*2] >= 0 {
-					startidx, endidx := specialCharGroup*2, specialCharGroup*2+1
-					var escaped string
-					if m[specialCharEscapedGroup*2] >= 0 {
-						escaped = string(bytes[cur+m[specialCharEscapedGroup*2] : cur+m[specialCharEscapedGroup*2+1]])
-					}
-					escapeToken := MDEscapeToken{escaped}
+			lexInline(cur, lineEnd)
+			cur = lineEnd
+		}
+	}
 
-					// Only create text token if we have non-empty text to add
-					if m[startidx] > 0 {
-						textToken := MDTextToken{string(bytes[cur : cur+m[startidx]])}
-						tokens = append(tokens, textToken)
-					}
-					tokens = append(tokens, escapeToken)
-					cur += m[endidx]
-				} else {
-					var fmtToken MDInlineFormatToken
-					var textToken MDTextToken
-					if m[inlineFormatStartGroup*2] >= 0 { // start
-						startidx, endidx := inlineFormatStartGroup*2, inlineFormatStartGroup*2+1
-						chr := string(bytes[cur+m[startidx] : cur+m[endidx]])
-						fmtToken = MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, chr}
-						textToken = MDTextToken{string(bytes[cur : cur+m[startidx]])}
-						cur += m[endidx]
-					} else if m[inlineFormatEndGroup*2] >= 0 { // end
-						startidx, endidx := inlineFormatEndGroup*2, inlineFormatEndGroup*2+1
-						chr := string(bytes[cur+m[startidx] : cur+m[endidx]])
-						fmtToken = MDInlineFormatToken{TOKEN_INLINE_FORMAT_END, chr}
-						textToken = MDTextToken{string(bytes[cur : cur+m[startidx]])}
-						cur += m[endidx]
-					} else { // mid
-						startidx, endidx := inlineFormatMidGroup*2, inlineFormatMidGroup*2+1
-						chr := string(bytes[cur+m[startidx] : cur+m[endidx]])
-						fmtToken = MDInlineFormatToken{TOKEN_INLINE_FORMAT_MID, chr}
-						textToken = MDTextToken{string(bytes[cur : cur+m[startidx]])}
-						cur += m[endidx]
-					}
+	return tokens
+}
 
-					tokens = append(tokens, textToken)
-					tokens = append(tokens, fmtToken)
-				}
-			}
+// Lexes the format delimiters (if any) at bytes[cur:], which directly follow
+// a non-space character, using patt to match them. Returns the number of
+// bytes consumed.
+//
+// Backticks can always open a code span, whatever they follow.
+func lexTrailingFormat(patt *regexp.Regexp, bytes []byte, cur, lineEnd int, src *mdSourceMap, tokens *[]MDToken) int {
+	m := patt.FindSubmatchIndex(bytes[cur:lineEnd])
+	if m == nil {
+		return 0
+	}
+	typ := TOKEN_INLINE_FORMAT_END
+	if m[4] >= 0 || bytes[cur] == '`' {
+		typ = TOKEN_INLINE_FORMAT_MID
+	}
+	*tokens = append(*tokens, MDInlineFormatToken{Type: typ, Content: string(bytes[cur+m[2] : cur+m[3]]), Span: src.span(cur+m[2], cur+m[3])})
+	return m[3]
+}
+
+func restOfLine(bytes []byte, cur int) []byte {
+	line := bytes[cur:]
+	for i, b := range line {
+		if b == '\n' {
+			return line[:i]
 		}
 	}
+	return line
+}
 
-	return tokens
+func followsListIndic(tokens []MDToken) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+	typ := tokens[len(tokens)-1].GetType()
+	return typ == TOKEN_UNORDERED_LIST_INDIC || typ == TOKEN_ORDERED_LIST_INDIC
 }
 
 var LINE_SPLIT_PATT *regexp.Regexp = regexp.MustCompile("\r?\n")
@@ -14,223 +14,333 @@ func TestLex(t *testing.T) {
 		{
 			"basic",
 			"This is a test",
-			[]MDToken{MDTextToken{"This is a test"}},
+			[]MDToken{MDTextToken{Content: "This is a test"}},
 		},
 		{
 			"leading space",
 			"    This is a test",
 			[]MDToken{
-				MDLeadingSpaceToken{4},
-				MDTextToken{"This is a test"},
+				MDLeadingSpaceToken{Count: 4},
+				MDTextToken{Content: "This is a test"},
 			},
 		},
 		{
 			"leading-tabs",
 			"\t  This is a test",
 			[]MDToken{
-				MDLeadingSpaceToken{6},
-				MDTextToken{"This is a test"},
+				MDLeadingSpaceToken{Count: 6},
+				MDTextToken{Content: "This is a test"},
 			},
 		},
 		{
 			"newlines",
 			"This is\na test\r\nof many things\n\nand various trials\n\r\n\n",
 			[]MDToken{
-				MDTextToken{"This is"},
-				MDSimpleToken{TOKEN_NL},
-				MDTextToken{"a test"},
-				MDSimpleToken{TOKEN_NL},
-				MDTextToken{"of many things"},
-				MDSimpleToken{TOKEN_NL},
-				MDSimpleToken{TOKEN_NL},
-				MDTextToken{"and various trials"},
-				MDSimpleToken{TOKEN_NL},
-				MDSimpleToken{TOKEN_NL},
-				MDSimpleToken{TOKEN_NL},
+				MDTextToken{Content: "This is"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDTextToken{Content: "a test"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDTextToken{Content: "of many things"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDTextToken{Content: "and various trials"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDSimpleToken{Type: TOKEN_NL},
 			},
 		},
 		{
 			"list-basic",
 			"- Initial list item\n    - Nested list item\n        2. Ordered item under that",
 			[]MDToken{
-				MDUnorderedListIndicToken{"- "},
-				MDTextToken{"Initial list item"},
-				MDSimpleToken{TOKEN_NL},
-				MDLeadingSpaceToken{4},
-				MDUnorderedListIndicToken{"- "},
-				MDTextToken{"Nested list item"},
-				MDSimpleToken{TOKEN_NL},
-				MDLeadingSpaceToken{8},
-				MDOrderedListIndicToken{"2. "},
-				MDTextToken{"Ordered item under that"},
+				MDUnorderedListIndicToken{Content: "- "},
+				MDTextToken{Content: "Initial list item"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDLeadingSpaceToken{Count: 4},
+				MDUnorderedListIndicToken{Content: "- "},
+				MDTextToken{Content: "Nested list item"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDLeadingSpaceToken{Count: 8},
+				MDOrderedListIndicToken{Content: "2. "},
+				MDTextToken{Content: "Ordered item under that"},
 			},
 		},
 		{
 			"list-preserve-spaces",
 			"-   We keep the spaces\n 1.   In our lists",
 			[]MDToken{
-				MDUnorderedListIndicToken{"- "}, MDLeadingSpaceToken{2}, MDTextToken{"We keep the spaces"},
-				MDSimpleToken{TOKEN_NL},
-				MDLeadingSpaceToken{1}, MDOrderedListIndicToken{"1. "}, MDLeadingSpaceToken{2}, MDTextToken{"In our lists"},
+				MDUnorderedListIndicToken{Content: "- "}, MDLeadingSpaceToken{Count: 2}, MDTextToken{Content: "We keep the spaces"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDLeadingSpaceToken{Count: 1}, MDOrderedListIndicToken{Content: "1. "}, MDLeadingSpaceToken{Count: 2}, MDTextToken{Content: "In our lists"},
 			},
 		},
 		{
 			"no-inline-list",
 			"- This is a list with a - hyphen in it -",
 			[]MDToken{
-				MDUnorderedListIndicToken{"- "},
-				MDTextToken{"This is a list with a - hyphen in it -"},
+				MDUnorderedListIndicToken{Content: "- "},
+				MDTextToken{Content: "This is a list with a - hyphen in it -"},
 			},
 		},
 		{
 			"inline",
 			"This is a **cool** paragraph, which has *many* things, such as __underlines__ and ~~strikethroughs~~. For example, **this bold is *also italicized***",
 			[]MDToken{
-				MDTextToken{"This is a "},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "**"},
-				MDTextToken{"cool"},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_END, "**"},
-				MDTextToken{" paragraph, which has "},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "*"},
-				MDTextToken{"many"},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_END, "*"},
-				MDTextToken{" things, such as "},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "__"},
-				MDTextToken{"underlines"},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_END, "__"},
-				MDTextToken{" and "},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "~~"},
-				MDTextToken{"strikethroughs"},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_MID, "~~"},
-				MDTextToken{". For example, "},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "**"},
-				MDTextToken{"this bold is "},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "*"},
-				MDTextToken{"also italicized"},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_END, "***"},
+				MDTextToken{Content: "This is a "},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "**"},
+				MDTextToken{Content: "cool"},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "**"},
+				MDTextToken{Content: " paragraph, which has "},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "*"},
+				MDTextToken{Content: "many"},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "*"},
+				MDTextToken{Content: " things, such as "},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "__"},
+				MDTextToken{Content: "underlines"},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "__"},
+				MDTextToken{Content: " and "},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "~~"},
+				MDTextToken{Content: "strikethroughs"},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_MID, Content: "~~"},
+				MDTextToken{Content: ". For example, "},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "**"},
+				MDTextToken{Content: "this bold is "},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "*"},
+				MDTextToken{Content: "also italicized"},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "***"},
 			},
 		},
 		{
 			"inline-format-with-list",
 			"- This list has *several inline elements*.\n    - It has ~~several~~ a few things.",
 			[]MDToken{
-				MDUnorderedListIndicToken{"- "},
-				MDTextToken{"This list has "},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "*"},
-				MDTextToken{"several inline elements"},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_MID, "*"},
-				MDTextToken{"."},
-				MDSimpleToken{TOKEN_NL},
-				MDLeadingSpaceToken{4},
-				MDUnorderedListIndicToken{"- "},
-				MDTextToken{"It has "},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "~~"},
-				MDTextToken{"several"},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_END, "~~"},
-				MDTextToken{" a few things."},
+				MDUnorderedListIndicToken{Content: "- "},
+				MDTextToken{Content: "This list has "},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "*"},
+				MDTextToken{Content: "several inline elements"},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_MID, Content: "*"},
+				MDTextToken{Content: "."},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDLeadingSpaceToken{Count: 4},
+				MDUnorderedListIndicToken{Content: "- "},
+				MDTextToken{Content: "It has "},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "~~"},
+				MDTextToken{Content: "several"},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "~~"},
+				MDTextToken{Content: " a few things."},
 			},
 		},
 		{
 			"inline-format-heterogeneous",
 			"We have *several nested types `of elements`* at the ~~**same time**~~",
 			[]MDToken{
-				MDTextToken{"We have "},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "*"},
-				MDTextToken{"several nested types "},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "`"},
-				MDTextToken{"of elements"},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_END, "`*"},
-				MDTextToken{" at the "},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "~~**"},
-				MDTextToken{"same time"},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_END, "**~~"},
+				MDTextToken{Content: "We have "},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "*"},
+				MDTextToken{Content: "several nested types "},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "`"},
+				MDTextToken{Content: "of elements"},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "`*"},
+				MDTextToken{Content: " at the "},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "~~**"},
+				MDTextToken{Content: "same time"},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "**~~"},
 			},
 		},
 		{
 			"inline-without-correct-spaces-ignored",
 			"These * formatting elements will be ignored. ~",
 			[]MDToken{
-				MDTextToken{"These * formatting elements will be ignored. ~"},
+				MDTextToken{Content: "These * formatting elements will be ignored. ~"},
 			},
 		},
 		{
 			"inline-recognizes-multiple-end",
 			"This **has nested *formatting.***",
 			[]MDToken{
-				MDTextToken{"This "},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "**"},
-				MDTextToken{"has nested "},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "*"},
-				MDTextToken{"formatting."},
-				MDInlineFormatToken{TOKEN_INLINE_FORMAT_END, "***"},
+				MDTextToken{Content: "This "},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "**"},
+				MDTextToken{Content: "has nested "},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "*"},
+				MDTextToken{Content: "formatting."},
+				MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "***"},
 			},
 		},
 		{
 			"header",
 			"# This is a basic header\nThis one is not\n##   and this one is a header again\n#but this one is not\n# - And this is not a list!\n## But we do keep *processing* inline elements",
 			[]MDToken{
-				MDHeaderIndicToken{1, "# "}, MDTextToken{"This is a basic header"},
-				MDSimpleToken{TOKEN_NL},
-				MDTextToken{"This one is not"},
-				MDSimpleToken{TOKEN_NL},
-				MDHeaderIndicToken{2, "## "}, MDLeadingSpaceToken{2}, MDTextToken{"and this one is a header again"},
-				MDSimpleToken{TOKEN_NL},
-				MDTextToken{"#but this one is not"},
-				MDSimpleToken{TOKEN_NL},
-				MDHeaderIndicToken{1, "# "}, MDUnorderedListIndicToken{"- "}, MDTextToken{"And this is not a list!"},
-				MDSimpleToken{TOKEN_NL},
-				MDHeaderIndicToken{2, "## "}, MDTextToken{"But we do keep "}, MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "*"}, MDTextToken{"processing"}, MDInlineFormatToken{TOKEN_INLINE_FORMAT_END, "*"}, MDTextToken{" inline elements"},
+				MDHeaderIndicToken{Count: 1, Content: "# "}, MDTextToken{Content: "This is a basic header"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDTextToken{Content: "This one is not"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDHeaderIndicToken{Count: 2, Content: "## "}, MDLeadingSpaceToken{Count: 2}, MDTextToken{Content: "and this one is a header again"},
+				MDSimpleToken{Type: TOKEN_NL},
+				// Not a header, but it is a hashtag
+				MDHashtagToken{Tag: "but", Content: "#but"}, MDTextToken{Content: " this one is not"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDHeaderIndicToken{Count: 1, Content: "# "}, MDUnorderedListIndicToken{Content: "- "}, MDTextToken{Content: "And this is not a list!"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDHeaderIndicToken{Count: 2, Content: "## "}, MDTextToken{Content: "But we do keep "}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "*"}, MDTextToken{Content: "processing"}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "*"}, MDTextToken{Content: " inline elements"},
 			},
 		},
 		{
 			"mixed-formatting-ordering",
 			"Standard *formatting* line\n    - Plain list item with _formatting_\n # Header with leading space\n  ## Header with **formatting**\n- # List item with header and **formatting**\n 1. Same with **ordered** list\n# - Header ignores rest of list but *not formatting*",
 			[]MDToken{
-				MDTextToken{"Standard "}, MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "*"}, MDTextToken{"formatting"}, MDInlineFormatToken{TOKEN_INLINE_FORMAT_END, "*"}, MDTextToken{" line"},
-				MDSimpleToken{TOKEN_NL},
-				MDLeadingSpaceToken{4}, MDUnorderedListIndicToken{"- "}, MDTextToken{"Plain list item with "}, MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "_"}, MDTextToken{"formatting"}, MDInlineFormatToken{TOKEN_INLINE_FORMAT_END, "_"},
-				MDSimpleToken{TOKEN_NL},
-				MDLeadingSpaceToken{1}, MDHeaderIndicToken{1, "# "}, MDTextToken{"Header with leading space"},
-				MDSimpleToken{TOKEN_NL},
-				MDLeadingSpaceToken{2}, MDHeaderIndicToken{2, "## "}, MDTextToken{"Header with "}, MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "**"}, MDTextToken{"formatting"}, MDInlineFormatToken{TOKEN_INLINE_FORMAT_END, "**"},
-				MDSimpleToken{TOKEN_NL},
-				MDUnorderedListIndicToken{"- "}, MDHeaderIndicToken{1, "# "}, MDTextToken{"List item with header and "}, MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "**"}, MDTextToken{"formatting"}, MDInlineFormatToken{TOKEN_INLINE_FORMAT_END, "**"},
-				MDSimpleToken{TOKEN_NL},
-				MDLeadingSpaceToken{1}, MDOrderedListIndicToken{"1. "}, MDTextToken{"Same with "}, MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "**"}, MDTextToken{"ordered"}, MDInlineFormatToken{TOKEN_INLINE_FORMAT_END, "**"}, MDTextToken{" list"},
-				MDSimpleToken{TOKEN_NL},
-				MDHeaderIndicToken{1, "# "}, MDUnorderedListIndicToken{"- "}, MDTextToken{"Header ignores rest of list but "}, MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "*"}, MDTextToken{"not formatting"}, MDInlineFormatToken{TOKEN_INLINE_FORMAT_END, "*"},
+				MDTextToken{Content: "Standard "}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "*"}, MDTextToken{Content: "formatting"}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "*"}, MDTextToken{Content: " line"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDLeadingSpaceToken{Count: 4}, MDUnorderedListIndicToken{Content: "- "}, MDTextToken{Content: "Plain list item with "}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "_"}, MDTextToken{Content: "formatting"}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "_"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDLeadingSpaceToken{Count: 1}, MDHeaderIndicToken{Count: 1, Content: "# "}, MDTextToken{Content: "Header with leading space"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDLeadingSpaceToken{Count: 2}, MDHeaderIndicToken{Count: 2, Content: "## "}, MDTextToken{Content: "Header with "}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "**"}, MDTextToken{Content: "formatting"}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "**"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDUnorderedListIndicToken{Content: "- "}, MDHeaderIndicToken{Count: 1, Content: "# "}, MDTextToken{Content: "List item with header and "}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "**"}, MDTextToken{Content: "formatting"}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "**"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDLeadingSpaceToken{Count: 1}, MDOrderedListIndicToken{Content: "1. "}, MDTextToken{Content: "Same with "}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "**"}, MDTextToken{Content: "ordered"}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "**"}, MDTextToken{Content: " list"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDHeaderIndicToken{Count: 1, Content: "# "}, MDUnorderedListIndicToken{Content: "- "}, MDTextToken{Content: "Header ignores rest of list but "}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "*"}, MDTextToken{Content: "not formatting"}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "*"},
 			},
 		},
 		{
 			"escape-inline",
 			"This is an escape\\* line\nAs is ~~The last one\\~\\~ here\\\\.\nBut we don't get any escaped chars for whitespace\\ or end of line.\\\nOr end of text.\\",
 			[]MDToken{
-				MDTextToken{"This is an escape"}, MDEscapeToken{"*"}, MDTextToken{" line"},
-				MDSimpleToken{TOKEN_NL},
-				MDTextToken{"As is "}, MDInlineFormatToken{TOKEN_INLINE_FORMAT_START, "~~"}, MDTextToken{"The last one"}, MDEscapeToken{"~"}, MDEscapeToken{"~"}, MDTextToken{" here"}, MDEscapeToken{"\\"}, MDTextToken{"."},
-				MDSimpleToken{TOKEN_NL},
-				MDTextToken{"But we don't get any escaped chars for whitespace"}, MDEscapeToken{""}, MDTextToken{" or end of line."}, MDEscapeToken{""},
-				MDSimpleToken{TOKEN_NL},
-				MDTextToken{"Or end of text."}, MDEscapeToken{""},
+				MDTextToken{Content: "This is an escape"}, MDEscapeToken{Content: "*"}, MDTextToken{Content: " line"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDTextToken{Content: "As is "}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "~~"}, MDTextToken{Content: "The last one"}, MDEscapeToken{Content: "~"}, MDEscapeToken{Content: "~"}, MDTextToken{Content: " here"}, MDEscapeToken{Content: "\\"}, MDTextToken{Content: "."},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDTextToken{Content: "But we don't get any escaped chars for whitespace"}, MDEscapeToken{Content: ""}, MDTextToken{Content: " or end of line."}, MDEscapeToken{Content: ""},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDTextToken{Content: "Or end of text."}, MDEscapeToken{Content: ""},
 			},
 		},
 		{
 			"escape-structural-elements",
 			"\\- This won't be a list\n    \\- Neither will this\n1\\. Nor this\n\\1. And this neither\nAnd this\\nwon't be a newline\n\\# And this won't be a header\n\\### And neither will this",
 			[]MDToken{
-				MDEscapeToken{"-"}, MDTextToken{" This won't be a list"},
-				MDSimpleToken{TOKEN_NL},
-				MDLeadingSpaceToken{4}, MDEscapeToken{"-"}, MDTextToken{" Neither will this"},
-				MDSimpleToken{TOKEN_NL},
-				MDTextToken{"1"}, MDEscapeToken{"."}, MDTextToken{" Nor this"},
-				MDSimpleToken{TOKEN_NL},
-				MDEscapeToken{"1"}, MDTextToken{". And this neither"},
-				MDSimpleToken{TOKEN_NL},
-				MDTextToken{"And this"}, MDEscapeToken{"n"}, MDTextToken{"won't be a newline"},
-				MDSimpleToken{TOKEN_NL},
-				MDEscapeToken{"#"}, MDTextToken{" And this won't be a header"},
-				MDSimpleToken{TOKEN_NL},
-				MDEscapeToken{"#"}, MDTextToken{"## And neither will this"},
+				MDEscapeToken{Content: "-"}, MDTextToken{Content: " This won't be a list"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDLeadingSpaceToken{Count: 4}, MDEscapeToken{Content: "-"}, MDTextToken{Content: " Neither will this"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDTextToken{Content: "1"}, MDEscapeToken{Content: "."}, MDTextToken{Content: " Nor this"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDEscapeToken{Content: "1"}, MDTextToken{Content: ". And this neither"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDTextToken{Content: "And this"}, MDEscapeToken{Content: "n"}, MDTextToken{Content: "won't be a newline"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDEscapeToken{Content: "#"}, MDTextToken{Content: " And this won't be a header"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDEscapeToken{Content: "#"}, MDTextToken{Content: "## And neither will this"},
+			},
+		},
+		{
+			"quote",
+			"> Quoted text\n>> Nested *quote*\n> > Also nested\n>No space\nNot a > quote",
+			[]MDToken{
+				MDQuoteIndicToken{Content: "> "}, MDTextToken{Content: "Quoted text"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDQuoteIndicToken{Content: ">"}, MDQuoteIndicToken{Content: "> "}, MDTextToken{Content: "Nested "}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "*"}, MDTextToken{Content: "quote"}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "*"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDQuoteIndicToken{Content: "> "}, MDQuoteIndicToken{Content: "> "}, MDTextToken{Content: "Also nested"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDQuoteIndicToken{Content: ">"}, MDTextToken{Content: "No space"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDTextToken{Content: "Not a > quote"},
+			},
+		},
+		{
+			"quote-in-list",
+			"- > Quoted item\n  > - List in quote",
+			[]MDToken{
+				MDUnorderedListIndicToken{Content: "- "}, MDQuoteIndicToken{Content: "> "}, MDTextToken{Content: "Quoted item"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDLeadingSpaceToken{Count: 2}, MDQuoteIndicToken{Content: "> "}, MDUnorderedListIndicToken{Content: "- "}, MDTextToken{Content: "List in quote"},
+			},
+		},
+		{
+			"task-list",
+			"- [ ] Open task\n- [x] Done task\n1. [X] Ordered\n[ ] Not a task",
+			[]MDToken{
+				MDUnorderedListIndicToken{Content: "- "}, MDTaskIndicToken{Checked: false, Content: "[ ] "}, MDTextToken{Content: "Open task"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDUnorderedListIndicToken{Content: "- "}, MDTaskIndicToken{Checked: true, Content: "[x] "}, MDTextToken{Content: "Done task"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDOrderedListIndicToken{Content: "1. "}, MDTaskIndicToken{Checked: true, Content: "[X] "}, MDTextToken{Content: "Ordered"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDTextToken{Content: "[ ] Not a task"},
+			},
+		},
+		{
+			"table",
+			"| Name | Value |\n|:-----|------:|\n| a \\| b | `1` |",
+			[]MDToken{
+				MDSimpleToken{Type: TOKEN_TABLE_PIPE}, MDTextToken{Content: " Name "}, MDSimpleToken{Type: TOKEN_TABLE_PIPE}, MDTextToken{Content: " Value "}, MDSimpleToken{Type: TOKEN_TABLE_PIPE},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDTableDelimRowToken{Content: "|:-----|------:|"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDSimpleToken{Type: TOKEN_TABLE_PIPE}, MDTextToken{Content: " a "}, MDEscapeToken{Content: "|"}, MDTextToken{Content: " b "}, MDSimpleToken{Type: TOKEN_TABLE_PIPE},
+				MDTextToken{Content: " "}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "`"}, MDTextToken{Content: "1"}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "`"}, MDTextToken{Content: " "}, MDSimpleToken{Type: TOKEN_TABLE_PIPE},
+			},
+		},
+		{
+			"wiki-links",
+			"See [[Note Title]] and [[ Other note #Setup | the setup ]], not [[]] or [single]",
+			[]MDToken{
+				MDTextToken{Content: "See "}, MDWikiLinkToken{Target: "Note Title", Heading: "", Alias: "", Content: "[[Note Title]]"},
+				MDTextToken{Content: " and "}, MDWikiLinkToken{Target: "Other note", Heading: "Setup", Alias: "the setup", Content: "[[ Other note #Setup | the setup ]]"},
+				MDTextToken{Content: ", not [[]] or [single]"},
+			},
+		},
+		{
+			"links",
+			"A [*styled* link](http://x.com/a_b \"Title\") and <https://y.org>, https://z.net/p_q.",
+			[]MDToken{
+				MDTextToken{Content: "A "},
+				MDSimpleToken{Type: TOKEN_INLINE_LINK_DESC_START},
+				MDTextToken{Content: ""}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "*"},
+				MDTextToken{Content: "styled"}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "*"},
+				MDTextToken{Content: " link"},
+				MDSimpleToken{Type: TOKEN_INLINE_LINK_DESC_END},
+				MDSimpleToken{Type: TOKEN_INLINE_LINK_URL_START},
+				MDTextToken{Content: "http://x.com/a_b \"Title\""},
+				MDSimpleToken{Type: TOKEN_INLINE_LINK_URL_END},
+				MDTextToken{Content: " and "}, MDAutolinkToken{URL: "https://y.org", Content: "<https://y.org>"},
+				MDTextToken{Content: ", "}, MDAutolinkToken{URL: "https://z.net/p_q", Content: "https://z.net/p_q"},
+				MDTextToken{Content: "."},
+			},
+		},
+		{
+			"hashtags",
+			"#todo for #project/notes-app, not issue#3 or #42\n\\#escaped",
+			[]MDToken{
+				MDHashtagToken{Tag: "todo", Content: "#todo"},
+				MDTextToken{Content: " for "}, MDHashtagToken{Tag: "project/notes-app", Content: "#project/notes-app"},
+				MDTextToken{Content: ", not issue#3 or #42"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDEscapeToken{Content: "#"}, MDTextToken{Content: "escaped"},
+			},
+		},
+		{
+			"code-fences",
+			"```go run\n  ~~~~\n```not `a fence`",
+			[]MDToken{
+				MDCodeFenceToken{Fence: "```", Info: "go run", Content: "```go run"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDLeadingSpaceToken{Count: 2}, MDCodeFenceToken{Fence: "~~~~", Content: "~~~~"},
+				MDSimpleToken{Type: TOKEN_NL},
+				MDTextToken{Content: ""}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "```"},
+				MDTextToken{Content: "not "}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_START, Content: "`"},
+				MDTextToken{Content: "a fence"}, MDInlineFormatToken{Type: TOKEN_INLINE_FORMAT_END, Content: "`"},
+			},
+		},
+		{
+			"blank-line-with-spaces",
+			"a\n  \nb",
+			[]MDToken{
+				MDTextToken{Content: "a"}, MDSimpleToken{Type: TOKEN_NL},
+				MDLeadingSpaceToken{Count: 2}, MDSimpleToken{Type: TOKEN_NL},
+				MDTextToken{Content: "b"},
 			},
 		},
 	}
@@ -238,7 +348,7 @@ func TestLex(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(s *testing.T) {
 			actualLex := Lex(test.text)
-			if !reflect.DeepEqual(test.expectedLex, actualLex) {
+			if !reflect.DeepEqual(test.expectedLex, withoutSpans(actualLex)) {
 				s.Errorf("lexes were not equal - expected=%v, actual=%v", test.expectedLex, actualLex)
 			}
 		})
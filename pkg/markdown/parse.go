@@ -1,14 +1,38 @@
 package markdown
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
 
 type MDSyntaxNodeType int
 
 const (
 	SYNTAX_NONE MDSyntaxNodeType = iota
 	SYNTAX_PARAGRAPH
+	SYNTAX_HEADER
+	SYNTAX_LIST
+	SYNTAX_LIST_ITEM
+	SYNTAX_QUOTE
+	SYNTAX_TABLE
+	SYNTAX_CODE_BLOCK
 )
 
+var mdSyntaxNodeTypeName map[MDSyntaxNodeType]string = map[MDSyntaxNodeType]string{
+	SYNTAX_NONE:       "NONE",
+	SYNTAX_PARAGRAPH:  "PARAGRAPH",
+	SYNTAX_HEADER:     "HEADER",
+	SYNTAX_LIST:       "LIST",
+	SYNTAX_LIST_ITEM:  "LIST_ITEM",
+	SYNTAX_QUOTE:      "QUOTE",
+	SYNTAX_TABLE:      "TABLE",
+	SYNTAX_CODE_BLOCK: "CODE_BLOCK",
+}
+
+func (t MDSyntaxNodeType) String() string { return mdSyntaxNodeTypeName[t] }
+
 type MDParagraphFormatNodeType int
 
 const (
@@ -17,45 +41,229 @@ const (
 	FORMAT_NODE_ITALICS
 	FORMAT_NODE_UNDERLINE
 	FORMAT_NODE_CODE
+	FORMAT_NODE_STRIKETHROUGH
+	FORMAT_NODE_ESCAPE
+	FORMAT_NODE_LINE_BREAK
+	FORMAT_NODE_WIKI_LINK
+	FORMAT_NODE_HASHTAG
+	FORMAT_NODE_LINK
 )
 
 var mdFormatNodeTypeName map[MDParagraphFormatNodeType]string = map[MDParagraphFormatNodeType]string{
-	FORMAT_NODE_NONE:      "FMT_NONE",
-	FORMAT_NODE_BOLD:      "FMT_BOLD",
-	FORMAT_NODE_ITALICS:   "FMT_ITALICS",
-	FORMAT_NODE_UNDERLINE: "FMT_UNDERLINE",
-	FORMAT_NODE_CODE:      "FMT_CODE",
+	FORMAT_NODE_NONE:          "FMT_NONE",
+	FORMAT_NODE_BOLD:          "FMT_BOLD",
+	FORMAT_NODE_ITALICS:       "FMT_ITALICS",
+	FORMAT_NODE_UNDERLINE:     "FMT_UNDERLINE",
+	FORMAT_NODE_CODE:          "FMT_CODE",
+	FORMAT_NODE_STRIKETHROUGH: "FMT_STRIKETHROUGH",
+	FORMAT_NODE_ESCAPE:        "FMT_ESCAPE",
+	FORMAT_NODE_LINE_BREAK:    "FMT_LINE_BREAK",
+	FORMAT_NODE_WIKI_LINK:     "FMT_WIKI_LINK",
+	FORMAT_NODE_HASHTAG:       "FMT_HASHTAG",
+	FORMAT_NODE_LINK:          "FMT_LINK",
 }
 
 func (t MDParagraphFormatNodeType) String() string { return mdFormatNodeTypeName[t] }
 
 type MDSyntaxNode interface {
 	GetType() MDSyntaxNodeType
+
+	// GetSpan returns the part of the document the node was parsed from,
+	// including any block indicators.
+	GetSpan() MDSpan
 }
 
 type MDParagraph struct {
 	Content []MDParagraphFormatNode
+
+	Span MDSpan
 }
 
 func (n MDParagraph) String() string { return fmt.Sprintf("P(%v)", n.Content) }
 
 func (n *MDParagraph) GetType() MDSyntaxNodeType { return SYNTAX_PARAGRAPH }
 
+func (n *MDParagraph) GetSpan() MDSpan { return n.Span }
+
+type MDHeader struct {
+	Level   int
+	Content []MDParagraphFormatNode
+
+	Span MDSpan
+}
+
+func (n MDHeader) String() string { return fmt.Sprintf("H%d(%v)", n.Level, n.Content) }
+
+func (n *MDHeader) GetType() MDSyntaxNodeType { return SYNTAX_HEADER }
+
+func (n *MDHeader) GetSpan() MDSpan { return n.Span }
+
+// MDList is a run of list items of the same kind. Start is the number of the
+// first item of an ordered list; following items are numbered from there,
+// whatever numbers they were written with.
+type MDList struct {
+	Ordered bool
+	Start   int
+	Items   []*MDListItem
+
+	Span MDSpan
+}
+
+func (n MDList) String() string {
+	if n.Ordered {
+		return fmt.Sprintf("OL%d(%v)", n.Start, n.Items)
+	}
+	return fmt.Sprintf("UL(%v)", n.Items)
+}
+
+func (n *MDList) GetType() MDSyntaxNodeType { return SYNTAX_LIST }
+
+func (n *MDList) GetSpan() MDSpan { return n.Span }
+
+// MDListItem is an item of a list. Items written as "- [ ] ..." or
+// "- [x] ..." are tasks, and Checked says whether they've been done.
+type MDListItem struct {
+	Children []MDSyntaxNode
+	Task     bool
+	Checked  bool
+
+	Span MDSpan
+}
+
+func (n MDListItem) String() string {
+	switch {
+	case n.Task && n.Checked:
+		return fmt.Sprintf("LI[x](%v)", n.Children)
+	case n.Task:
+		return fmt.Sprintf("LI[ ](%v)", n.Children)
+	}
+	return fmt.Sprintf("LI(%v)", n.Children)
+}
+
+func (n *MDListItem) GetType() MDSyntaxNodeType { return SYNTAX_LIST_ITEM }
+
+func (n *MDListItem) GetSpan() MDSpan { return n.Span }
+
+// MDBlockQuote holds the blocks quoted at one level. Nested quotes (">>") are
+// MDBlockQuotes among its children.
+type MDBlockQuote struct {
+	Children []MDSyntaxNode
+
+	Span MDSpan
+}
+
+func (n MDBlockQuote) String() string { return fmt.Sprintf("QUOTE(%v)", n.Children) }
+
+func (n *MDBlockQuote) GetType() MDSyntaxNodeType { return SYNTAX_QUOTE }
+
+func (n *MDBlockQuote) GetSpan() MDSpan { return n.Span }
+
+type MDTableAlignment int
+
+const (
+	TABLE_ALIGN_NONE MDTableAlignment = iota
+	TABLE_ALIGN_LEFT
+	TABLE_ALIGN_CENTER
+	TABLE_ALIGN_RIGHT
+)
+
+var mdTableAlignmentName map[MDTableAlignment]string = map[MDTableAlignment]string{
+	TABLE_ALIGN_NONE:   "NONE",
+	TABLE_ALIGN_LEFT:   "LEFT",
+	TABLE_ALIGN_CENTER: "CENTER",
+	TABLE_ALIGN_RIGHT:  "RIGHT",
+}
+
+func (a MDTableAlignment) String() string { return mdTableAlignmentName[a] }
+
+type MDTableCell struct {
+	Content []MDParagraphFormatNode
+
+	Span MDSpan
+}
+
+func (c MDTableCell) String() string { return fmt.Sprintf("CELL(%v)", c.Content) }
+
+// Text returns the cell's content without any formatting.
+func (c MDTableCell) Text() string { return PlainText(c.Content) }
+
+// MDTable is a GitHub-flavored pipe table. Every row has one cell per column,
+// padded or cut down to the number of columns in the header.
+type MDTable struct {
+	Alignments []MDTableAlignment
+	Header     []MDTableCell
+	Rows       [][]MDTableCell
+
+	Span MDSpan
+}
+
+func (n MDTable) String() string { return fmt.Sprintf("TABLE(%v, %v)", n.Header, n.Rows) }
+
+func (n *MDTable) GetType() MDSyntaxNodeType { return SYNTAX_TABLE }
+
+func (n *MDTable) GetSpan() MDSpan { return n.Span }
+
+// MDCodeBlock is a fenced code block. Info is whatever followed the opening
+// fence, usually the language; Lines are kept exactly as written, minus as
+// much indentation as the opening fence had. A block left open runs to the
+// end of its container, and isn't Closed.
+type MDCodeBlock struct {
+	Fence  string
+	Info   string
+	Lines  []MDTextFormatNode
+	Closed bool
+
+	Span MDSpan
+}
+
+func (n MDCodeBlock) String() string { return fmt.Sprintf("CODE(%s, %v)", n.Info, n.Lines) }
+
+func (n *MDCodeBlock) GetType() MDSyntaxNodeType { return SYNTAX_CODE_BLOCK }
+
+func (n *MDCodeBlock) GetSpan() MDSpan { return n.Span }
+
+// Text returns the code in the block.
+func (n MDCodeBlock) Text() string {
+	lines := make([]string, len(n.Lines))
+	for i, l := range n.Lines {
+		lines[i] = l.Content
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Language returns the first word of the block's info string.
+func (n MDCodeBlock) Language() string {
+	if fields := strings.Fields(n.Info); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
 type MDParagraphFormatNode interface {
 	GetFormatNodeType() MDParagraphFormatNodeType
+
+	// GetSpan returns the part of the document the node was parsed from,
+	// including any delimiters.
+	GetSpan() MDSpan
 }
 
 type MDInlineFormatNode struct {
 	Type    MDParagraphFormatNodeType
-	Content MDParagraphFormatNode
+	Content []MDParagraphFormatNode
+
+	Span MDSpan
 }
 
 func (n MDInlineFormatNode) String() string { return fmt.Sprintf("%v(%v)", n.Type, n.Content) }
 
 func (n MDInlineFormatNode) GetFormatNodeType() MDParagraphFormatNodeType { return n.Type }
 
+func (n MDInlineFormatNode) GetSpan() MDSpan { return n.Span }
+
 type MDTextFormatNode struct {
 	Content string
+
+	Span MDSpan
 }
 
 func (n MDTextFormatNode) String() string {
@@ -64,23 +272,265 @@ func (n MDTextFormatNode) String() string {
 
 func (n MDTextFormatNode) GetFormatNodeType() MDParagraphFormatNodeType { return FORMAT_NODE_NONE }
 
+func (n MDTextFormatNode) GetSpan() MDSpan { return n.Span }
+
+// MDEscapeFormatNode is a backslash-escaped character, kept apart from the
+// surrounding text so renderers can decide how to show it.
+type MDEscapeFormatNode struct {
+	Content string
+
+	Span MDSpan
+}
+
+func (n MDEscapeFormatNode) String() string { return fmt.Sprintf("ESCAPED(%s)", n.Content) }
+
+func (n MDEscapeFormatNode) GetFormatNodeType() MDParagraphFormatNodeType { return FORMAT_NODE_ESCAPE }
+
+func (n MDEscapeFormatNode) GetSpan() MDSpan { return n.Span }
+
+// MDLineBreakFormatNode separates the lines of a paragraph. Hard breaks come
+// from a backslash at the end of a line and should be kept when rendering;
+// soft breaks are equivalent to a space.
+type MDLineBreakFormatNode struct {
+	Hard bool
+
+	Span MDSpan
+}
+
+func (n MDLineBreakFormatNode) String() string {
+	if n.Hard {
+		return "BR(hard)"
+	}
+	return "BR"
+}
+
+func (n MDLineBreakFormatNode) GetFormatNodeType() MDParagraphFormatNodeType {
+	return FORMAT_NODE_LINE_BREAK
+}
+
+func (n MDLineBreakFormatNode) GetSpan() MDSpan { return n.Span }
+
+// MDLinkFormatNode is a "[description](URL "title")" link, or a URL in the
+// text (Auto), whose content is then just the URL.
+type MDLinkFormatNode struct {
+	URL     string
+	Title   string
+	Auto    bool
+	Content []MDParagraphFormatNode
+
+	Span MDSpan
+}
+
+func (n MDLinkFormatNode) String() string { return fmt.Sprintf("LINK(%v, %s)", n.Content, n.URL) }
+
+func (n MDLinkFormatNode) GetFormatNodeType() MDParagraphFormatNodeType { return FORMAT_NODE_LINK }
+
+func (n MDLinkFormatNode) GetSpan() MDSpan { return n.Span }
+
+// MDWikiLinkFormatNode is a "[[Target#Heading|Alias]]" reference to another
+// note, where the heading & alias are optional.
+type MDWikiLinkFormatNode struct {
+	Target  string
+	Heading string
+	Alias   string
+
+	Span MDSpan
+}
+
+func (n MDWikiLinkFormatNode) String() string { return fmt.Sprintf("WIKI_LINK(%s)", n.Ref()) }
+
+func (n MDWikiLinkFormatNode) GetFormatNodeType() MDParagraphFormatNodeType {
+	return FORMAT_NODE_WIKI_LINK
+}
+
+func (n MDWikiLinkFormatNode) GetSpan() MDSpan { return n.Span }
+
+// Ref returns what the link points to, e.g. "Note#Heading".
+func (n MDWikiLinkFormatNode) Ref() string {
+	if n.Heading == "" {
+		return n.Target
+	}
+	return n.Target + "#" + n.Heading
+}
+
+// Text returns what the link is shown as: its alias if it has one, or else
+// what it points to.
+func (n MDWikiLinkFormatNode) Text() string {
+	if n.Alias != "" {
+		return n.Alias
+	}
+	if n.Heading == "" {
+		return n.Target
+	}
+	return n.Target + " > " + n.Heading
+}
+
+// MDHashtagFormatNode is an inline "#tag". Tag doesn't include the '#'.
+type MDHashtagFormatNode struct {
+	Tag string
+
+	Span MDSpan
+}
+
+func (n MDHashtagFormatNode) String() string { return fmt.Sprintf("HASHTAG(%s)", n.Tag) }
+
+func (n MDHashtagFormatNode) GetFormatNodeType() MDParagraphFormatNodeType {
+	return FORMAT_NODE_HASHTAG
+}
+
+func (n MDHashtagFormatNode) GetSpan() MDSpan { return n.Span }
+
+// TagPath returns a nested tag along with every tag it's nested in, so
+// "project/notes" gives "project" & "project/notes". This is what a note
+// should be faceted under.
+func TagPath(tag string) []string {
+	path := []string{}
+	for i := 0; i < len(tag); i++ {
+		if tag[i] == '/' {
+			path = append(path, tag[:i])
+		}
+	}
+	return append(path, tag)
+}
+
 type MDSyntaxTree struct {
 	Children []MDSyntaxNode
+
+	// Meta is the document's front matter, or nil if it has none. Only
+	// ParseDocument looks for front matter.
+	Meta *MDMetadata
 }
 
 func (t MDSyntaxTree) String() string { return fmt.Sprintf("TREE(%v)", t.Children) }
 
-type mdParseState struct {
-	curNode           MDSyntaxNode
-	curProcessingType MDSyntaxNodeType
-	prevWasNL         bool
+// Walk calls f for every node in the tree, parents before their children.
+// If f returns false the children of that node are skipped.
+func (t MDSyntaxTree) Walk(f func(MDSyntaxNode) bool) {
+	walkNodes(t.Children, f)
 }
 
-func initState() mdParseState {
-	return mdParseState{
-		curNode:           nil,
-		curProcessingType: SYNTAX_NONE,
-		prevWasNL:         false,
+// Tasks returns every task list item in the tree, checked or not.
+func (t MDSyntaxTree) Tasks() []*MDListItem {
+	tasks := []*MDListItem{}
+	t.Walk(func(n MDSyntaxNode) bool {
+		if item, ok := n.(*MDListItem); ok && item.Task {
+			tasks = append(tasks, item)
+		}
+		return true
+	})
+	return tasks
+}
+
+// WalkInline calls f for the inline content of every paragraph, header &
+// table cell in the tree, parents before their children. If f returns false
+// the children of that node are skipped.
+func (t MDSyntaxTree) WalkInline(f func(MDParagraphFormatNode) bool) {
+	t.Walk(func(n MDSyntaxNode) bool {
+		switch n := n.(type) {
+		case *MDParagraph:
+			walkInlineNodes(n.Content, f)
+		case *MDHeader:
+			walkInlineNodes(n.Content, f)
+		case *MDTable:
+			for _, c := range n.Header {
+				walkInlineNodes(c.Content, f)
+			}
+			for _, row := range n.Rows {
+				for _, c := range row {
+					walkInlineNodes(c.Content, f)
+				}
+			}
+		}
+		return true
+	})
+}
+
+// Links returns every wiki-link in the tree, in order.
+func (t MDSyntaxTree) Links() []MDWikiLinkFormatNode {
+	links := []MDWikiLinkFormatNode{}
+	t.WalkInline(func(n MDParagraphFormatNode) bool {
+		if link, ok := n.(MDWikiLinkFormatNode); ok {
+			links = append(links, link)
+		}
+		return true
+	})
+	return links
+}
+
+// Tags returns the tags from the front matter followed by any hashtags in
+// the text, without duplicates.
+func (t MDSyntaxTree) Tags() []string {
+	tags := []string{}
+	if t.Meta != nil {
+		tags = append(tags, t.Meta.Tags...)
+	}
+	t.WalkInline(func(n MDParagraphFormatNode) bool {
+		if tag, ok := n.(MDHashtagFormatNode); ok {
+			tags = append(tags, tag.Tag)
+		}
+		return true
+	})
+	return normalizeTags(tags)
+}
+
+// PlainText returns inline content as text, dropping any formatting. Escaped
+// characters are unescaped and line breaks become spaces.
+func PlainText(ns []MDParagraphFormatNode) string {
+	var sb strings.Builder
+	writePlainText(&sb, ns)
+	return sb.String()
+}
+
+func writePlainText(sb *strings.Builder, ns []MDParagraphFormatNode) {
+	for _, n := range ns {
+		switch n := n.(type) {
+		case MDTextFormatNode:
+			sb.WriteString(n.Content)
+		case MDEscapeFormatNode:
+			sb.WriteString(n.Content)
+		case MDLineBreakFormatNode:
+			sb.WriteString(" ")
+		case MDInlineFormatNode:
+			writePlainText(sb, n.Content)
+		case MDLinkFormatNode:
+			writePlainText(sb, n.Content)
+		case MDWikiLinkFormatNode:
+			sb.WriteString(n.Text())
+		case MDHashtagFormatNode:
+			sb.WriteString("#" + n.Tag)
+		}
+	}
+}
+
+func walkInlineNodes(ns []MDParagraphFormatNode, f func(MDParagraphFormatNode) bool) {
+	for _, n := range ns {
+		if !f(n) {
+			continue
+		}
+		switch n := n.(type) {
+		case MDInlineFormatNode:
+			walkInlineNodes(n.Content, f)
+		case MDLinkFormatNode:
+			walkInlineNodes(n.Content, f)
+		}
+	}
+}
+
+func walkNodes(ns []MDSyntaxNode, f func(MDSyntaxNode) bool) {
+	for _, n := range ns {
+		if !f(n) {
+			continue
+		}
+		switch n := n.(type) {
+		case *MDList:
+			for _, item := range n.Items {
+				walkNodes([]MDSyntaxNode{item}, f)
+			}
+		case *MDListItem:
+			walkNodes(n.Children, f)
+		case *MDBlockQuote:
+			walkNodes(n.Children, f)
+		}
 	}
 }
 
@@ -96,85 +546,706 @@ func unknownTokenTypeError(t MDTokenType) error {
 	return fmt.Errorf("unknown token type: %v", t)
 }
 
-// func Parse(tokens []MDToken) (MDSyntaxTree, error) {
-// 	ns := []MDSyntaxNode{}
-// 	state := initState()
-// 	for _, t := range tokens {
-// 		if state.curProcessingType == SYNTAX_NONE {
-// 			typ := t.GetType()
-// 			switch typ {
-// 			case TOKEN_NL:
-// 				continue
-// 			case TOKEN_TEXT:
-// 				t, ok := t.(MDTextToken)
-// 				if !ok {
-// 					return MDSyntaxTree{ns}, tokenTypeMismatchError(typ)
-// 				}
-// 				var p MDSyntaxNode = MDParagraph{[]MDParagraphFormatNode{MDTextFormatNode(t)}}
-// 				state.curNode = &p
-// 			case TOKEN_LEADING_SPACE:
-// 				// TODO: Deal with leading space
-// 				continue
-// 			case TOKEN_INLINE_FORMAT_START:
-// 				// TODO: Deal with inline formatting
-// 				continue
-// 			case TOKEN_INLINE_FORMAT_MID:
-// 			case TOKEN_INLINE_FORMAT_END:
-// 				return MDSyntaxTree{ns}, invalidTokenError(typ)
-// 			case TOKEN_INLINE_LINK_DESC_START:
-// 			case TOKEN_INLINE_LINK_DESC_END:
-// 			case TOKEN_INLINE_LINK_URL_START:
-// 			case TOKEN_INLINE_LINK_URL_END:
-// 			case TOKEN_UNORDERED_LIST_INDIC:
-// 			case TOKEN_ORDERED_LIST_INDIC:
-// 			case TOKEN_HEADER_INDIC:
-// 			case TOKEN_EXPLICIT_CODEBLOCK_INDIC:
-// 			case TOKEN_SPECIAL_CHAR_ESCAPE:
-// 				// TODO: Deal with all this shit
-// 				continue
-// 			default:
-// 				return MDSyntaxTree{ns}, unknownTokenTypeError(typ)
-// 			}
-// 		} else if state.curProcessingType == SYNTAX_PARAGRAPH {
-// 			typ := t.GetType()
-// 			switch typ {
-// 			case TOKEN_NL:
-// 				state.prevWasNL = true
-// 				continue
-// 			case TOKEN_TEXT:
-// 				t, ok := t.(MDTextToken)
-// 				if !ok {
-// 					return MDSyntaxTree{ns}, tokenTypeMismatchError(typ)
-// 				}
-// 				curNode := state.curNode
-// 				curPNode := (*curNode).(MDParagraph)
-// 				newContent = curPNode.Content
-// 				var p MDSyntaxNode = MDParagraph{[]MDParagraphFormatNode{MDTextFormatNode(t)}}
-// 				state.curNode = &p
-// 			case TOKEN_LEADING_SPACE:
-// 				// TODO: Deal with leading space
-// 				continue
-// 			case TOKEN_INLINE_FORMAT_START:
-// 				// TODO: Deal with inline formatting
-// 				continue
-// 			case TOKEN_INLINE_FORMAT_MID:
-// 			case TOKEN_INLINE_FORMAT_END:
-// 				return MDSyntaxTree{ns}, invalidTokenError(typ)
-// 			case TOKEN_INLINE_LINK_DESC_START:
-// 			case TOKEN_INLINE_LINK_DESC_END:
-// 			case TOKEN_INLINE_LINK_URL_START:
-// 			case TOKEN_INLINE_LINK_URL_END:
-// 			case TOKEN_UNORDERED_LIST_INDIC:
-// 			case TOKEN_ORDERED_LIST_INDIC:
-// 			case TOKEN_HEADER_INDIC:
-// 			case TOKEN_EXPLICIT_CODEBLOCK_INDIC:
-// 			case TOKEN_SPECIAL_CHAR_ESCAPE:
-// 				// TODO: Deal with all this shit
-// 				continue
-// 			default:
-// 				return MDSyntaxTree{ns}, unknownTokenTypeError(typ)
-// 		}
-// 	}
-
-// 	return MDSyntaxTree{ns}, nil
-// }
+// Parse builds the syntax tree for a lexed document.
+//
+// Blocks are parsed a line at a time, keeping a stack of open containers
+// (block quotes & list items). Each line first has to continue the open
+// containers - a quote needs its '>', a list item needs the line indented to
+// where the item's content starts - and any that aren't continued are closed,
+// unless the line is a "lazy" continuation of an open paragraph:
+//
+//	> This line is quoted,
+//	and so is this one.
+//
+// Inline content is parsed once its paragraph or header is complete, since
+// formatting can span lines.
+//
+// The whole document is always parsed. The error returned is the first
+// diagnostic of SEVERITY_ERROR, if there is one; see ParseDiagnostics for the
+// rest.
+func Parse(tokens []MDToken) (MDSyntaxTree, error) {
+	tree, diagnostics := ParseDiagnostics(tokens)
+	for _, d := range diagnostics {
+		if d.Severity == SEVERITY_ERROR {
+			return tree, d
+		}
+	}
+	return tree, nil
+}
+
+// ParseDiagnostics parses a document like Parse, also returning all the
+// problems found along the way in the order they appear in the document.
+func ParseDiagnostics(tokens []MDToken) (MDSyntaxTree, []MDDiagnostic) {
+	p := newBlockParser()
+	line := []MDToken{}
+	for _, t := range tokens {
+		if t.GetType() == TOKEN_NL {
+			p.addLine(line)
+			line = []MDToken{}
+			continue
+		}
+		line = append(line, t)
+	}
+	p.addLine(line)
+	p.closeLeaf()
+
+	// Inline content is only parsed at the end of its block, so its
+	// diagnostics can come after those of later lines
+	sort.SliceStable(p.diagnostics, func(i, j int) bool {
+		return p.diagnostics[i].Span.Start.Offset < p.diagnostics[j].Span.Start.Offset
+	})
+	return p.tree(), p.diagnostics
+}
+
+type mdContainer struct {
+	typ      MDSyntaxNodeType // SYNTAX_NONE for the document itself
+	children *[]MDSyntaxNode
+
+	// List items only: the column the item's content starts at, which later
+	// lines have to be indented to in order to belong to the item.
+	contentCol int
+}
+
+type mdBlockParser struct {
+	root MDSyntaxTree
+	open []*mdContainer
+
+	// Lines of the paragraph at the end of the innermost open container, if
+	// one is still being added to.
+	paragraph      *MDParagraph
+	paragraphLines [][]MDToken
+
+	// Likewise the table being added to, if any
+	table *MDTable
+
+	// And the code block, along with the fence that opened it and how far
+	// that was indented from where its container's content starts
+	code       *MDCodeBlock
+	codeFence  MDCodeFenceToken
+	codeIndent int
+
+	prevBlank bool
+
+	diagnostics []MDDiagnostic
+}
+
+func newBlockParser() *mdBlockParser {
+	p := &mdBlockParser{}
+	p.open = []*mdContainer{{typ: SYNTAX_NONE, children: &p.root.Children}}
+	return p
+}
+
+func (p *mdBlockParser) tree() MDSyntaxTree {
+	finishSpans(p.root.Children)
+	return p.root
+}
+
+// Containers only know where they start until they're complete; this extends
+// them to the end of their last child.
+func finishSpans(ns []MDSyntaxNode) {
+	for _, n := range ns {
+		switch n := n.(type) {
+		case *MDList:
+			for _, item := range n.Items {
+				finishSpans([]MDSyntaxNode{item})
+			}
+			n.Span = joinSpans(n.Items[0].Span, n.Items[len(n.Items)-1].Span)
+		case *MDListItem:
+			if len(n.Children) > 0 {
+				finishSpans(n.Children)
+				n.Span = joinSpans(n.Span, n.Children[len(n.Children)-1].GetSpan())
+			}
+		case *MDBlockQuote:
+			if len(n.Children) > 0 {
+				finishSpans(n.Children)
+				n.Span = joinSpans(n.Span, n.Children[len(n.Children)-1].GetSpan())
+			}
+		}
+	}
+}
+
+// A token at the start of a line, along with the column it starts at.
+type mdPrefixToken struct {
+	token MDToken
+	col   int
+}
+
+// Splits a line into its leading block indicators and the inline content that
+// follows them. Leading spaces only move the column along.
+func splitLinePrefix(line []MDToken) ([]mdPrefixToken, []MDToken, int) {
+	prefix := []mdPrefixToken{}
+	col := 0
+	for i, t := range line {
+		switch t := t.(type) {
+		case MDLeadingSpaceToken:
+			col += t.Count
+		case MDQuoteIndicToken, MDUnorderedListIndicToken, MDOrderedListIndicToken, MDHeaderIndicToken,
+			MDTaskIndicToken, MDTableDelimRowToken, MDCodeFenceToken:
+			prefix = append(prefix, mdPrefixToken{t, col})
+			col += len(tokenLiteral(t))
+		default:
+			return prefix, line[i:], col
+		}
+	}
+	return prefix, []MDToken{}, col
+}
+
+func (p *mdBlockParser) addLine(line []MDToken) {
+	valid := make([]MDToken, 0, len(line))
+	for _, t := range line {
+		if err := checkToken(t); err != nil {
+			p.report(invalidTokenDiagnostic(t, err))
+			continue
+		}
+		valid = append(valid, t)
+	}
+	line = valid
+
+	prefix, rest, restCol := splitLinePrefix(line)
+	blank := len(prefix) == 0 && isBlank(rest)
+
+	// Continue as many open containers as this line allows
+	i, base := 0, 0
+	matched := 1
+	for ; matched < len(p.open); matched++ {
+		c := p.open[matched]
+		if c.typ == SYNTAX_QUOTE {
+			if i < len(prefix) && prefix[i].token.GetType() == TOKEN_QUOTE_INDIC && prefix[i].col-base <= 3 {
+				base = prefix[i].col + len(tokenLiteral(prefix[i].token))
+				i++
+				continue
+			}
+			break
+		}
+		// List item
+		if i == len(prefix) && isBlank(rest) {
+			base = c.contentCol
+			continue
+		}
+		col := restCol
+		if i < len(prefix) {
+			col = prefix[i].col
+		}
+		if col < c.contentCol {
+			break
+		}
+		base = c.contentCol
+	}
+
+	if p.code != nil {
+		if matched == len(p.open) {
+			p.addCodeLine(line, prefix[i:], base)
+			return
+		}
+		// The code block's container has ended, so the block has too
+		p.endCode()
+	}
+
+	// New blocks can only start within three columns of the containing block;
+	// anything indented further is just text.
+	starts := i < len(prefix) && prefix[i].col-base <= 3
+	if i < len(prefix) && !starts && isListIndic(prefix[i].token) {
+		p.report(orphanedIndentDiagnostic("list marker is indented too far to start a list item, so is text", prefix[i].token.GetSpan()))
+	}
+
+	if matched < len(p.open) {
+		if p.paragraph != nil && !starts && !isBlank(rest) {
+			// Lazy continuation - the line belongs to the open paragraph even
+			// though it doesn't continue all of its containers
+			p.paragraphLines = append(p.paragraphLines, p.literalLine(prefix[i:], rest))
+			p.prevBlank = false
+			return
+		}
+		if p.open[matched].typ == SYNTAX_LIST_ITEM && !isBlank(rest) && !(starts && isListIndic(prefix[i].token)) {
+			col, first := restCol, rest[0]
+			if i < len(prefix) {
+				col, first = prefix[i].col, prefix[i].token
+			}
+			if col > base {
+				p.report(orphanedIndentDiagnostic("line is indented, but not far enough to be part of the list item above it", first.GetSpan()))
+			}
+		}
+		p.closeLeaf()
+		p.open = p.open[:matched]
+	}
+
+	for starts && i < len(prefix) && prefix[i].col-base <= 3 {
+		pt := prefix[i]
+		switch t := pt.token.(type) {
+		case MDQuoteIndicToken:
+			p.closeLeaf()
+			q := &MDBlockQuote{Span: t.Span}
+			p.appendBlock(q)
+			p.open = append(p.open, &mdContainer{typ: SYNTAX_QUOTE, children: &q.Children})
+			base = pt.col + len(t.Content)
+			i++
+		case MDUnorderedListIndicToken, MDOrderedListIndicToken:
+			p.closeLeaf()
+			item := p.openListItem(t)
+			end := pt.col + len(tokenLiteral(t))
+			next := restCol
+			if i+1 < len(prefix) {
+				next = prefix[i+1].col
+			}
+			// Content starts after the spaces following the marker, unless
+			// there are so many that they can't be part of it
+			contentCol := end
+			if next-end <= 3 && !(i+1 == len(prefix) && isBlank(rest)) {
+				contentCol = next
+			}
+			p.open = append(p.open, &mdContainer{typ: SYNTAX_LIST_ITEM, children: &item.Children, contentCol: contentCol})
+			base = contentCol
+			i++
+			if i < len(prefix) {
+				if task, ok := prefix[i].token.(MDTaskIndicToken); ok {
+					item.Task, item.Checked = true, task.Checked
+					item.Span = joinSpans(item.Span, task.Span)
+					i++
+				}
+			}
+		case MDHeaderIndicToken:
+			p.closeLeaf()
+			line := p.literalLine(prefix[i+1:], rest)
+			content := p.inline([][]MDToken{line})
+			p.appendBlock(&MDHeader{Level: t.Count, Content: content, Span: joinSpans(t.Span, lineSpan(line))})
+			p.prevBlank = false
+			return
+		case MDCodeFenceToken:
+			p.closeLeaf()
+			p.code = &MDCodeBlock{Fence: t.Fence, Info: t.Info, Lines: []MDTextFormatNode{}, Span: t.Span}
+			p.codeFence = t
+			p.codeIndent = pt.col - base
+			p.appendBlock(p.code)
+			p.prevBlank = false
+			return
+		case MDTableDelimRowToken:
+			if p.startTable(t) {
+				p.prevBlank = false
+				return
+			}
+			// Not a table after all, so the row is just text
+			starts = false
+		default:
+			starts = false
+		}
+	}
+
+	if i == len(prefix) && isBlank(rest) {
+		// Either a blank line or one that only opens blocks, like an empty
+		// list item - both end the paragraph
+		p.closeLeaf()
+		p.prevBlank = blank
+		return
+	}
+
+	text := p.literalLine(prefix[i:], rest)
+	if p.table != nil {
+		p.table.Rows = append(p.table.Rows, p.tableCells(text, len(p.table.Alignments)))
+		p.table.Span = joinSpans(p.table.Span, lineSpan(text))
+		return
+	}
+	if p.paragraph == nil {
+		p.paragraph = &MDParagraph{}
+		p.appendBlock(p.paragraph)
+	}
+	p.paragraphLines = append(p.paragraphLines, text)
+	p.prevBlank = false
+}
+
+func (p *mdBlockParser) innermost() *mdContainer { return p.open[len(p.open)-1] }
+
+func (p *mdBlockParser) report(d MDDiagnostic) { p.diagnostics = append(p.diagnostics, d) }
+
+// Parses inline content, keeping its diagnostics with the rest.
+func (p *mdBlockParser) inline(lines [][]MDToken) []MDParagraphFormatNode {
+	content, diagnostics := parseInline(lines)
+	p.diagnostics = append(p.diagnostics, diagnostics...)
+	return content
+}
+
+func (p *mdBlockParser) appendBlock(n MDSyntaxNode) {
+	c := p.innermost()
+	*c.children = append(*c.children, n)
+}
+
+// Adds a new item for the given indicator, continuing the list the container
+// ends with if the item is of the same kind. A blank line before the item
+// always starts a new list.
+func (p *mdBlockParser) openListItem(indic MDToken) *MDListItem {
+	ordered := indic.GetType() == TOKEN_ORDERED_LIST_INDIC
+	c := p.innermost()
+	var list *MDList
+	if n := len(*c.children); n > 0 && !p.prevBlank {
+		if l, ok := (*c.children)[n-1].(*MDList); ok && l.Ordered == ordered {
+			list = l
+		}
+	}
+	if list == nil {
+		list = &MDList{Ordered: ordered}
+		if ordered {
+			list.Start = listNumber(indic)
+		}
+		p.appendBlock(list)
+	}
+	item := &MDListItem{Span: indic.GetSpan()}
+	list.Items = append(list.Items, item)
+	p.prevBlank = false
+	return item
+}
+
+// Adds a line to the open code block, or closes it if the line is a fence
+// like the one that opened it. prefix is what's left of the line's prefix
+// once its containers are taken off, and base is where their content starts.
+func (p *mdBlockParser) addCodeLine(line []MDToken, prefix []mdPrefixToken, base int) {
+	p.prevBlank = false
+	if len(prefix) > 0 && prefix[0].col-base <= 3 {
+		if fence, ok := prefix[0].token.(MDCodeFenceToken); ok && closesFence(p.code.Fence, fence) {
+			p.code.Closed = true
+			p.code.Span = joinSpans(p.code.Span, fence.Span)
+			p.code = nil
+			return
+		}
+	}
+
+	var sb strings.Builder
+	for _, t := range line {
+		sb.WriteString(tokenLiteral(t))
+	}
+	text := sb.String()
+
+	// Take off the containers' indicators, then as much indentation as the
+	// opening fence had
+	col := base
+	if col > len(text) {
+		col = len(text)
+	}
+	for n := 0; n < p.codeIndent && col < len(text) && text[col] == ' '; n++ {
+		col++
+	}
+	span := lineSpan(line).sub(col, len(text))
+	p.code.Lines = append(p.code.Lines, MDTextFormatNode{Content: text[col:], Span: span})
+	p.code.Span = joinSpans(p.code.Span, span)
+}
+
+// Whether fence closes a block opened with open: it has to be made of the
+// same character, be at least as long, and have nothing after it.
+func closesFence(open string, fence MDCodeFenceToken) bool {
+	return fence.Fence[0] == open[0] && len(fence.Fence) >= len(open) && fence.Info == ""
+}
+
+// Finishes the paragraph, table or code block being added to, if there is
+// one.
+func (p *mdBlockParser) closeLeaf() {
+	p.table = nil
+	p.endCode()
+	if p.paragraph == nil {
+		return
+	}
+	p.paragraph.Content = p.inline(p.paragraphLines)
+	p.paragraph.Span = joinSpans(lineSpan(p.paragraphLines[0]), lineSpan(p.paragraphLines[len(p.paragraphLines)-1]))
+	p.paragraph = nil
+	p.paragraphLines = nil
+}
+
+// Ends the code block being added to, if there is one. Closing fences end
+// code blocks as they're found, so any still open never had one.
+func (p *mdBlockParser) endCode() {
+	if p.code != nil {
+		p.report(unclosedFenceDiagnostic(p.codeFence))
+		p.code = nil
+	}
+}
+
+// Turns the last line of the open paragraph into the header of a table, if
+// it agrees with the delimiter row under it on the number of columns. Any
+// lines before it stay a paragraph of their own.
+func (p *mdBlockParser) startTable(delim MDTableDelimRowToken) bool {
+	if p.paragraph == nil {
+		return false
+	}
+	last := p.paragraphLines[len(p.paragraphLines)-1]
+	alignments := tableAlignments(delim.Content)
+	if !hasPipe(last) || len(splitCells(last)) != len(alignments) {
+		return false
+	}
+
+	header := p.tableCells(last, len(alignments))
+	table := &MDTable{Alignments: alignments, Header: header, Rows: [][]MDTableCell{}, Span: joinSpans(lineSpan(last), delim.Span)}
+	if len(p.paragraphLines) == 1 {
+		c := p.innermost()
+		(*c.children)[len(*c.children)-1] = table
+		p.paragraph, p.paragraphLines = nil, nil
+	} else {
+		p.paragraphLines = p.paragraphLines[:len(p.paragraphLines)-1]
+		p.closeLeaf()
+		p.appendBlock(table)
+	}
+	p.table = table
+	return true
+}
+
+func hasPipe(line []MDToken) bool {
+	for _, t := range line {
+		if t.GetType() == TOKEN_TABLE_PIPE {
+			return true
+		}
+	}
+	return false
+}
+
+func tableAlignments(delim string) []MDTableAlignment {
+	alignments := []MDTableAlignment{}
+	for _, col := range strings.Split(strings.Trim(strings.TrimSpace(delim), "|"), "|") {
+		col = strings.TrimSpace(col)
+		left, right := strings.HasPrefix(col, ":"), strings.HasSuffix(col, ":")
+		switch {
+		case left && right:
+			alignments = append(alignments, TABLE_ALIGN_CENTER)
+		case left:
+			alignments = append(alignments, TABLE_ALIGN_LEFT)
+		case right:
+			alignments = append(alignments, TABLE_ALIGN_RIGHT)
+		default:
+			alignments = append(alignments, TABLE_ALIGN_NONE)
+		}
+	}
+	return alignments
+}
+
+// Parses a row of a table into exactly n cells.
+func (p *mdBlockParser) tableCells(line []MDToken, n int) []MDTableCell {
+	cells := make([]MDTableCell, n)
+	for i := range cells {
+		cells[i].Content = []MDParagraphFormatNode{}
+	}
+	for i, tokens := range splitCells(line) {
+		if i == n {
+			break
+		}
+		trimmed := trimTokens(tokens)
+		cells[i].Content = p.inline([][]MDToken{trimmed})
+		cells[i].Span = lineSpan(trimmed)
+	}
+	return cells
+}
+
+// Splits a row at its pipes. The pipes at either end of the row are optional.
+func splitCells(line []MDToken) [][]MDToken {
+	line = trimTokens(line)
+	if len(line) > 0 && line[0].GetType() == TOKEN_TABLE_PIPE {
+		line = line[1:]
+	}
+	if n := len(line); n > 0 && line[n-1].GetType() == TOKEN_TABLE_PIPE {
+		line = line[:n-1]
+	}
+	cells := [][]MDToken{{}}
+	for _, t := range line {
+		if t.GetType() == TOKEN_TABLE_PIPE {
+			cells = append(cells, []MDToken{})
+			continue
+		}
+		cells[len(cells)-1] = append(cells[len(cells)-1], t)
+	}
+	return cells
+}
+
+// Trims the spaces at either end of a run of tokens.
+func trimTokens(tokens []MDToken) []MDToken {
+	trimmed := []MDToken{}
+	for _, t := range tokens {
+		if text, ok := t.(MDTextToken); ok && len(trimmed) == 0 {
+			n := len(text.Content)
+			if text.Content = strings.TrimLeft(text.Content, " "); text.Content == "" {
+				continue
+			}
+			text.Span = text.Span.sub(n-len(text.Content), n)
+			t = text
+		}
+		trimmed = append(trimmed, t)
+	}
+	for len(trimmed) > 0 {
+		text, ok := trimmed[len(trimmed)-1].(MDTextToken)
+		if !ok {
+			break
+		}
+		if text.Content = strings.TrimRight(text.Content, " "); text.Content != "" {
+			text.Span = text.Span.sub(0, len(text.Content))
+			trimmed[len(trimmed)-1] = text
+			break
+		}
+		trimmed = trimmed[:len(trimmed)-1]
+	}
+	return trimmed
+}
+
+// Turns block indicators that don't start a block back into text, ahead of
+// the rest of the line.
+func (p *mdBlockParser) literalLine(prefix []mdPrefixToken, rest []MDToken) []MDToken {
+	if len(prefix) == 0 {
+		return rest
+	}
+	line := []MDToken{}
+	for j, pt := range prefix {
+		if j > 0 {
+			if gap := pt.col - (prefix[j-1].col + len(tokenLiteral(prefix[j-1].token))); gap > 0 {
+				span := joinSpans(endOf(prefix[j-1].token.GetSpan()), startOf(pt.token.GetSpan()))
+				line = append(line, MDTextToken{Content: strings.Repeat(" ", gap), Span: span})
+			}
+		}
+		if delim, ok := pt.token.(MDTableDelimRowToken); ok {
+			line = append(line, splitDelimRow(delim)...)
+			continue
+		}
+		line = append(line, MDTextToken{Content: tokenLiteral(pt.token), Span: pt.token.GetSpan()})
+	}
+	return append(line, rest...)
+}
+
+// Splits a table delimiter row that isn't one after all back into text &
+// pipes, so it can still be a row of a table.
+func splitDelimRow(t MDTableDelimRowToken) []MDToken {
+	tokens := []MDToken{}
+	start := 0
+	for i := 0; i <= len(t.Content); i++ {
+		if i < len(t.Content) && t.Content[i] != '|' {
+			continue
+		}
+		if i > start {
+			tokens = append(tokens, MDTextToken{Content: t.Content[start:i], Span: t.Span.sub(start, i)})
+		}
+		if i < len(t.Content) {
+			tokens = append(tokens, MDSimpleToken{Type: TOKEN_TABLE_PIPE, Span: t.Span.sub(i, i+1)})
+		}
+		start = i + 1
+	}
+	return tokens
+}
+
+func listNumber(t MDToken) int {
+	indic, ok := t.(MDOrderedListIndicToken)
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(indic.Content), ".")))
+	if err != nil {
+		return 1
+	}
+	return n
+}
+
+func isListIndic(t MDToken) bool {
+	return t.GetType() == TOKEN_UNORDERED_LIST_INDIC || t.GetType() == TOKEN_ORDERED_LIST_INDIC
+}
+
+func isBlank(tokens []MDToken) bool {
+	for _, t := range tokens {
+		switch t := t.(type) {
+		case MDLeadingSpaceToken:
+			continue
+		case MDTextToken:
+			if strings.TrimSpace(t.Content) != "" {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the source text of a token.
+func tokenLiteral(t MDToken) string {
+	switch t := t.(type) {
+	case MDTextToken:
+		return t.Content
+	case MDLeadingSpaceToken:
+		return strings.Repeat(" ", t.Count)
+	case MDUnorderedListIndicToken:
+		return t.Content
+	case MDOrderedListIndicToken:
+		return t.Content
+	case MDHeaderIndicToken:
+		return t.Content
+	case MDQuoteIndicToken:
+		return t.Content
+	case MDTaskIndicToken:
+		return t.Content
+	case MDTableDelimRowToken:
+		return t.Content
+	case MDCodeFenceToken:
+		return t.Content
+	case MDInlineFormatToken:
+		return t.Content
+	case MDEscapeToken:
+		return "\\" + t.Content
+	case MDWikiLinkToken:
+		return t.Content
+	case MDHashtagToken:
+		return t.Content
+	case MDAutolinkToken:
+		return t.Content
+	case MDSimpleToken:
+		switch t.Type {
+		case TOKEN_NL:
+			return "\n"
+		case TOKEN_TABLE_PIPE:
+			return "|"
+		case TOKEN_INLINE_LINK_DESC_START:
+			return "["
+		case TOKEN_INLINE_LINK_DESC_END:
+			return "]"
+		case TOKEN_INLINE_LINK_URL_START:
+			return "("
+		case TOKEN_INLINE_LINK_URL_END:
+			return ")"
+		}
+	}
+	return ""
+}
+
+// Makes sure a token is one the parser knows how to handle, and that its Go
+// type agrees with its token type.
+func checkToken(t MDToken) error {
+	typ := t.GetType()
+	var ok bool
+	switch typ {
+	case TOKEN_TEXT:
+		_, ok = t.(MDTextToken)
+	case TOKEN_LEADING_SPACE:
+		_, ok = t.(MDLeadingSpaceToken)
+	case TOKEN_UNORDERED_LIST_INDIC:
+		_, ok = t.(MDUnorderedListIndicToken)
+	case TOKEN_ORDERED_LIST_INDIC:
+		_, ok = t.(MDOrderedListIndicToken)
+	case TOKEN_HEADER_INDIC:
+		_, ok = t.(MDHeaderIndicToken)
+	case TOKEN_QUOTE_INDIC:
+		_, ok = t.(MDQuoteIndicToken)
+	case TOKEN_TASK_INDIC:
+		_, ok = t.(MDTaskIndicToken)
+	case TOKEN_TABLE_DELIM_ROW:
+		_, ok = t.(MDTableDelimRowToken)
+	case TOKEN_EXPLICIT_CODEBLOCK_INDIC:
+		_, ok = t.(MDCodeFenceToken)
+	case TOKEN_TABLE_PIPE, TOKEN_INLINE_LINK_DESC_START, TOKEN_INLINE_LINK_DESC_END, TOKEN_INLINE_LINK_URL_START, TOKEN_INLINE_LINK_URL_END:
+		_, ok = t.(MDSimpleToken)
+	case TOKEN_INLINE_FORMAT_START, TOKEN_INLINE_FORMAT_MID, TOKEN_INLINE_FORMAT_END:
+		_, ok = t.(MDInlineFormatToken)
+	case TOKEN_SPECIAL_CHAR_ESCAPE:
+		_, ok = t.(MDEscapeToken)
+	case TOKEN_WIKI_LINK:
+		_, ok = t.(MDWikiLinkToken)
+	case TOKEN_HASHTAG:
+		_, ok = t.(MDHashtagToken)
+	case TOKEN_AUTOLINK:
+		_, ok = t.(MDAutolinkToken)
+	case TOKEN_NONE:
+		return invalidTokenError(typ)
+	default:
+		return unknownTokenTypeError(typ)
+	}
+	if !ok {
+		return tokenTypeMismatchError(typ)
+	}
+	return nil
+}
@@ -1,49 +1,534 @@
 package markdown
 
-// func TestParse(t *testing.T) {
-// 	tests := []struct {
-// 		name          string
-// 		tokens        []MDToken
-// 		expectedParse MDSyntaxTree
-// 		expectedError error
-// 	}{
-// 		{
-// 			"plaintext",
-// 			[]MDToken{MDTextToken{"This is a test"}},
-// 			MDSyntaxTree{[]MDSyntaxNode{paragraph(text("This is a test"))}},
-// 			nil,
-// 		},
-// 		{
-// 			"multiple-lines-one-paragraph",
-// 			[]MDToken{MDTextToken{"This is a test"}, MDSimpleToken{TOKEN_NL}, MDTextToken{"and so is this"}},
-// 			MDSyntaxTree{[]MDSyntaxNode{paragraph(text("This is a test and so is this"))}},
-// 			nil,
-// 		},
-// 		{
-// 			"multiple-paragraphs",
-// 			[]MDToken{MDTextToken{"This is a test"}, MDSimpleToken{TOKEN_NL}, MDSimpleToken{TOKEN_NL}, MDTextToken{"But this is a new paragraph"}},
-// 			MDSyntaxTree{[]MDSyntaxNode{paragraph(text("This is a test"), text("But this is a new paragraph"))}},
-// 			nil,
-// 		},
-// 	}
-
-// 	for _, test := range tests {
-// 		t.Run(test.name, func(s *testing.T) {
-// 			actualParse, actualError := Parse(test.tokens)
-// 			if !reflect.DeepEqual(test.expectedParse, actualParse) {
-// 				s.Errorf("parses were not equal - expected=%v, actual=%v", test.expectedParse, actualParse)
-// 			}
-// 			if !reflect.DeepEqual(test.expectedError, actualError) {
-// 				s.Errorf("parses did not have same error - expected=%v, actual=%v", test.expectedError, actualError)
-// 			}
-// 		})
-// 	}
-// }
+import (
+	"reflect"
+	"testing"
+)
+
+// One past the last token type
+var unknownTokenType MDTokenType = MDTokenType(len(mdTokenTypeName))
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name          string
+		tokens        []MDToken
+		expectedParse MDSyntaxTree
+		expectedError error
+	}{
+		{
+			"plaintext",
+			[]MDToken{MDTextToken{Content: "This is a test"}},
+			tree(paragraph(text("This is a test"))),
+			nil,
+		},
+		{
+			"multiple-lines-one-paragraph",
+			[]MDToken{MDTextToken{Content: "This is a test"}, MDSimpleToken{Type: TOKEN_NL}, MDTextToken{Content: "and so is this"}},
+			tree(paragraph(text("This is a test"), softBreak(), text("and so is this"))),
+			nil,
+		},
+		{
+			"multiple-paragraphs",
+			[]MDToken{MDTextToken{Content: "This is a test"}, MDSimpleToken{Type: TOKEN_NL}, MDSimpleToken{Type: TOKEN_NL}, MDTextToken{Content: "But this is a new paragraph"}},
+			tree(paragraph(text("This is a test")), paragraph(text("But this is a new paragraph"))),
+			nil,
+		},
+		{
+			"mismatched-token",
+			[]MDToken{MDSimpleToken{Type: TOKEN_TEXT}},
+			tree(),
+			invalidTokenDiagnostic(MDSimpleToken{Type: TOKEN_TEXT}, tokenTypeMismatchError(TOKEN_TEXT)),
+		},
+		{
+			"unknown-token",
+			[]MDToken{MDSimpleToken{Type: unknownTokenType}},
+			tree(),
+			invalidTokenDiagnostic(MDSimpleToken{Type: unknownTokenType}, unknownTokenTypeError(unknownTokenType)),
+		},
+		{
+			"invalid-token-skipped",
+			[]MDToken{MDTextToken{Content: "This is "}, MDSimpleToken{Type: unknownTokenType}, MDTextToken{Content: "a test"}},
+			tree(paragraph(text("This is a test"))),
+			invalidTokenDiagnostic(MDSimpleToken{Type: unknownTokenType}, unknownTokenTypeError(unknownTokenType)),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(s *testing.T) {
+			actualParse, actualError := Parse(test.tokens)
+			if !reflect.DeepEqual(test.expectedParse, withoutSpans(actualParse)) {
+				s.Errorf("parses were not equal - expected=%v, actual=%v", test.expectedParse, actualParse)
+			}
+			if !reflect.DeepEqual(test.expectedError, actualError) {
+				s.Errorf("parses did not have same error - expected=%v, actual=%v", test.expectedError, actualError)
+			}
+		})
+	}
+}
+
+func TestParseText(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		expectedParse MDSyntaxTree
+	}{
+		{
+			"headers",
+			"# Header *one*\nText\n## - Not a list",
+			tree(
+				header(1, text("Header "), italics(text("one"))),
+				paragraph(text("Text")),
+				header(2, text("- Not a list")),
+			),
+		},
+		{
+			"inline-nesting",
+			"This **has nested *formatting.*** and `code *stays* raw`",
+			tree(paragraph(
+				text("This "),
+				bold(text("has nested "), italics(text("formatting."))),
+				text(" and "),
+				code("code *stays* raw"),
+			)),
+		},
+		{
+			"inline-overlapping",
+			"*foo bar **bing bang* boom baz** bom",
+			tree(paragraph(italics(text("foo bar **bing bang")), text(" boom baz** bom"))),
+		},
+		{
+			"inline-unmatched",
+			"This *is not closed and __neither is this",
+			tree(paragraph(text("This *is not closed and __neither is this"))),
+		},
+		{
+			"escapes-and-breaks",
+			"An escaped \\* star\\\nand a hard break",
+			tree(paragraph(text("An escaped "), escaped("*"), text(" star"), hardBreak(), text("and a hard break"))),
+		},
+		{
+			"lists",
+			"- One\n- Two\n    - Nested\n- Three\ncontinued\n\n- New list",
+			tree(
+				ulist(
+					item(paragraph(text("One"))),
+					item(paragraph(text("Two")), ulist(item(paragraph(text("Nested"))))),
+					item(paragraph(text("Three"), softBreak(), text("continued"))),
+				),
+				ulist(item(paragraph(text("New list")))),
+			),
+		},
+		{
+			"ordered-list-start",
+			"3. Three\n1. Four",
+			tree(olist(3, item(paragraph(text("Three"))), item(paragraph(text("Four"))))),
+		},
+		{
+			"list-item-too-indented",
+			"- Test1\n      - Test2\n  - Test3",
+			tree(ulist(item(
+				paragraph(text("Test1"), softBreak(), text("- Test2")),
+				ulist(item(paragraph(text("Test3")))),
+			))),
+		},
+		{
+			"quote",
+			"> Quoted *text*\n>\n> Second paragraph",
+			tree(quote(
+				paragraph(text("Quoted "), italics(text("text"))),
+				paragraph(text("Second paragraph")),
+			)),
+		},
+		{
+			"quote-nested",
+			"> Outer\n>> Inner\n> > Still inner\n\nOutside",
+			tree(
+				quote(
+					paragraph(text("Outer")),
+					quote(paragraph(text("Inner"), softBreak(), text("Still inner"))),
+				),
+				paragraph(text("Outside")),
+			),
+		},
+		{
+			"quote-lazy-continuation",
+			"> This line is quoted,\nand so is this one.\n\nBut not this one.",
+			tree(
+				quote(paragraph(text("This line is quoted,"), softBreak(), text("and so is this one."))),
+				paragraph(text("But not this one.")),
+			),
+		},
+		{
+			"quote-ended-by-block",
+			"> Quoted\n- Not quoted",
+			tree(
+				quote(paragraph(text("Quoted"))),
+				ulist(item(paragraph(text("Not quoted")))),
+			),
+		},
+		{
+			"quote-in-list",
+			"- > Test\n  > test2\n  - Test3\n- # Header in list",
+			tree(ulist(
+				item(
+					quote(paragraph(text("Test"), softBreak(), text("test2"))),
+					ulist(item(paragraph(text("Test3")))),
+				),
+				item(header(1, text("Header in list"))),
+			)),
+		},
+		{
+			"list-in-quote",
+			"> - One\n> - Two",
+			tree(quote(ulist(item(paragraph(text("One"))), item(paragraph(text("Two")))))),
+		},
+		{
+			"strikethrough",
+			"Not ~this~ but ~~this~~, and ~~**this**~~",
+			tree(paragraph(
+				text("Not ~this~ but "),
+				strike(text("this")),
+				text(", and "),
+				strike(bold(text("this"))),
+			)),
+		},
+		{
+			"task-list",
+			"- [ ] Open\n- [x] Done\n- Not a task\n- [y] Nor this",
+			tree(ulist(
+				task(false, paragraph(text("Open"))),
+				task(true, paragraph(text("Done"))),
+				item(paragraph(text("Not a task"))),
+				item(paragraph(text("[y] Nor this"))),
+			)),
+		},
+		{
+			"table",
+			"| Name | *Value* | Notes |\n|:---|---:|:-:|\n| a \\| b | 1 |\nc | 2 | x | extra\n\nAfter",
+			tree(
+				&MDTable{
+					Alignments: []MDTableAlignment{TABLE_ALIGN_LEFT, TABLE_ALIGN_RIGHT, TABLE_ALIGN_CENTER},
+					Header:     cells(text("Name"), italics(text("Value")), text("Notes")),
+					Rows: [][]MDTableCell{
+						{{Content: []MDParagraphFormatNode{text("a "), escaped("|"), text(" b")}}, {Content: []MDParagraphFormatNode{text("1")}}, {Content: []MDParagraphFormatNode{}}},
+						cells(text("c"), text("2"), text("x")),
+					},
+				},
+				paragraph(text("After")),
+			),
+		},
+		{
+			"table-after-paragraph",
+			"Intro\na | b\n--|--",
+			tree(
+				paragraph(text("Intro")),
+				&MDTable{
+					Alignments: []MDTableAlignment{TABLE_ALIGN_NONE, TABLE_ALIGN_NONE},
+					Header:     cells(text("a"), text("b")),
+					Rows:       [][]MDTableCell{},
+				},
+			),
+		},
+		{
+			"table-column-mismatch",
+			"| a | b |\n|---|",
+			tree(paragraph(text("| a | b |"), softBreak(), text("|---|"))),
+		},
+		{
+			"links",
+			"[**Docs** *here](https://docs.dev \"The docs\") and* https://bare.dev/a_b, [not a link] (x)",
+			tree(paragraph(
+				MDLinkFormatNode{URL: "https://docs.dev", Title: "The docs", Content: []MDParagraphFormatNode{bold(text("Docs")), text(" *here")}},
+				text(" and* "),
+				autolink("https://bare.dev/a_b"),
+				text(", [not a link] (x)"),
+			)),
+		},
+		{
+			"wiki-links-and-hashtags",
+			"# Links for #work\nSee *[[Runbook#Deploys|deploys]]* and `[[Not a link]] #nor-a-tag`",
+			tree(
+				header(1, text("Links for "), hashtag("work")),
+				paragraph(
+					text("See "),
+					italics(wikiLink("Runbook", "Deploys", "deploys")),
+					text(" and "),
+					code("[[Not a link]] #nor-a-tag"),
+				),
+			),
+		},
+		{
+			"code-blocks",
+			"Text\n```go\n# not a header\n\n  *x* \\\n```\n- item\n\n  ~~~\n  a\n    b\n  ~~~~\n> ```\n> open\n\nafter",
+			tree(
+				paragraph(text("Text")),
+				codeBlock("```", "go", true, "# not a header", "", "  *x* \\"),
+				ulist(item(paragraph(text("item")), codeBlock("~~~", "", true, "a", "  b"))),
+				quote(codeBlock("```", "", false, "open")),
+				paragraph(text("after")),
+			),
+		},
+		{
+			"indented-code-fence",
+			"- a\n      ```\n  ```\n  b\n\n```\n```",
+			tree(
+				ulist(item(paragraph(text("a"), softBreak(), text("```")), codeBlock("```", "", false, "b", ""))),
+				codeBlock("```", "", true),
+			),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(s *testing.T) {
+			actualParse, actualError := Parse(Lex(test.text))
+			if actualError != nil {
+				s.Fatalf("unexpected error: %v", actualError)
+			}
+			if !reflect.DeepEqual(test.expectedParse, withoutSpans(actualParse)) {
+				s.Errorf("parses were not equal - expected=%v, actual=%v", test.expectedParse, actualParse)
+			}
+		})
+	}
+}
+
+func TestWalk(t *testing.T) {
+	tree, _ := Parse(Lex("Intro\n\n> Quote one\n\n- Item\n  > Quote two\n  > > Quote three"))
+
+	quotes := 0
+	tree.Walk(func(n MDSyntaxNode) bool {
+		if n.GetType() == SYNTAX_QUOTE {
+			quotes++
+		}
+		return true
+	})
+	if quotes != 3 {
+		t.Errorf("expected 3 quotes, found %d", quotes)
+	}
+
+	quotes = 0
+	tree.Walk(func(n MDSyntaxNode) bool {
+		if n.GetType() == SYNTAX_QUOTE {
+			quotes++
+			return false
+		}
+		return true
+	})
+	if quotes != 2 {
+		t.Errorf("expected 2 top-level quotes, found %d", quotes)
+	}
+}
+
+func TestTasks(t *testing.T) {
+	text := "- [ ] Write *tests*\n- [x] Ship it\n    - [ ] Nested\n- Plain"
+	tree, _ := Parse(Lex(text))
+
+	tasks := tree.Tasks()
+	if len(tasks) != 3 {
+		t.Fatalf("expected 3 tasks, found %d", len(tasks))
+	}
+	open, spanned := []string{}, []string{}
+	for _, task := range tasks {
+		spanned = append(spanned, text[task.Span.Start.Offset:task.Span.End.Offset])
+		if !task.Checked {
+			open = append(open, PlainText(task.Children[0].(*MDParagraph).Content))
+		}
+	}
+	if !reflect.DeepEqual([]string{"Write tests", "Nested"}, open) {
+		t.Errorf("unexpected open tasks: %v", open)
+	}
+	// Each task spans all of its content, not just its indicator
+	expectedSpanned := []string{"- [ ] Write *tests*", "- [x] Ship it\n    - [ ] Nested", "- [ ] Nested"}
+	if !reflect.DeepEqual(expectedSpanned, spanned) {
+		t.Errorf("unexpected task spans: %q", spanned)
+	}
+}
+
+func TestLinksAndTags(t *testing.T) {
+	tree, _ := ParseDocument("---\ntags: [meeting]\n---\n# Sync #meeting\n- Follow up on [[Budget]] #project/q3\n\n| Owner | Ref |\n|---|---|\n| #ana | [[Budget#Totals]] |")
+
+	expectedLinks := []MDWikiLinkFormatNode{{Target: "Budget"}, {Target: "Budget", Heading: "Totals"}}
+	if links := withoutSpans(tree.Links()); !reflect.DeepEqual(expectedLinks, links) {
+		t.Errorf("unexpected links: %v", links)
+	}
+	if tags := tree.Tags(); !reflect.DeepEqual([]string{"meeting", "project/q3", "ana"}, tags) {
+		t.Errorf("unexpected tags: %v", tags)
+	}
+}
+
+func TestWikiLinkText(t *testing.T) {
+	tests := []struct {
+		link         MDWikiLinkFormatNode
+		expectedRef  string
+		expectedText string
+	}{
+		{MDWikiLinkFormatNode{Target: "Note"}, "Note", "Note"},
+		{MDWikiLinkFormatNode{Target: "Note", Heading: "Heading"}, "Note#Heading", "Note > Heading"},
+		{MDWikiLinkFormatNode{Target: "Note", Heading: "Heading", Alias: "alias"}, "Note#Heading", "alias"},
+	}
+	for _, test := range tests {
+		if test.link.Ref() != test.expectedRef || test.link.Text() != test.expectedText {
+			t.Errorf("unexpected ref/text for %v: %s, %s", test.link, test.link.Ref(), test.link.Text())
+		}
+	}
+}
+
+func TestTagPath(t *testing.T) {
+	if path := TagPath("project/notes/app"); !reflect.DeepEqual([]string{"project", "project/notes", "project/notes/app"}, path) {
+		t.Errorf("unexpected path: %v", path)
+	}
+	if path := TagPath("todo"); !reflect.DeepEqual([]string{"todo"}, path) {
+		t.Errorf("unexpected path: %v", path)
+	}
+}
+
+func TestTableCellText(t *testing.T) {
+	tree, _ := Parse(Lex("| **Host** | Port |\n|---|---|\n| `db-1` | 5432 |"))
+
+	table := tree.Children[0].(*MDTable)
+	if table.Header[0].Text() != "Host" || table.Rows[0][0].Text() != "db-1" || table.Rows[0][1].Text() != "5432" {
+		t.Errorf("unexpected cell text: %v", table)
+	}
+}
+
+// Returns a copy of v with every span unset, so trees & tokens can be
+// compared without spelling out where everything is.
+func withoutSpans[T any](v T) T {
+	return clearSpans(reflect.ValueOf(v)).Interface().(T)
+}
+
+func clearSpans(v reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+		p := reflect.New(v.Type().Elem())
+		p.Elem().Set(clearSpans(v.Elem()))
+		return p
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		i := reflect.New(v.Type()).Elem()
+		i.Set(clearSpans(v.Elem()))
+		return i
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		s := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			s.Index(i).Set(clearSpans(v.Index(i)))
+		}
+		return s
+	case reflect.Struct:
+		if v.Type() == reflect.TypeOf(MDSpan{}) {
+			return reflect.Zero(v.Type())
+		}
+		s := reflect.New(v.Type()).Elem()
+		s.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if s.Field(i).CanSet() {
+				s.Field(i).Set(clearSpans(v.Field(i)))
+			}
+		}
+		return s
+	}
+	return v
+}
+
+func tree(ns ...MDSyntaxNode) MDSyntaxTree {
+	if len(ns) == 0 {
+		return MDSyntaxTree{}
+	}
+	return MDSyntaxTree{Children: ns}
+}
 
 func text(c string) MDParagraphFormatNode {
-	return MDTextFormatNode{c}
+	return MDTextFormatNode{Content: c}
+}
+
+func escaped(c string) MDParagraphFormatNode {
+	return MDEscapeFormatNode{Content: c}
+}
+
+func softBreak() MDParagraphFormatNode {
+	return MDLineBreakFormatNode{Hard: false}
+}
+
+func hardBreak() MDParagraphFormatNode {
+	return MDLineBreakFormatNode{Hard: true}
+}
+
+func format(typ MDParagraphFormatNodeType) func(...MDParagraphFormatNode) MDParagraphFormatNode {
+	return func(ns ...MDParagraphFormatNode) MDParagraphFormatNode {
+		return MDInlineFormatNode{Type: typ, Content: ns}
+	}
+}
+
+var (
+	bold    = format(FORMAT_NODE_BOLD)
+	italics = format(FORMAT_NODE_ITALICS)
+	strike  = format(FORMAT_NODE_STRIKETHROUGH)
+)
+
+func code(c string) MDParagraphFormatNode {
+	return MDInlineFormatNode{Type: FORMAT_NODE_CODE, Content: []MDParagraphFormatNode{text(c)}}
+}
+
+func wikiLink(target, heading, alias string) MDParagraphFormatNode {
+	return MDWikiLinkFormatNode{Target: target, Heading: heading, Alias: alias}
+}
+
+func autolink(url string) MDParagraphFormatNode {
+	return MDLinkFormatNode{URL: url, Auto: true, Content: []MDParagraphFormatNode{text(url)}}
+}
+
+func hashtag(tag string) MDParagraphFormatNode {
+	return MDHashtagFormatNode{Tag: tag}
+}
+
+func paragraph(ns ...MDParagraphFormatNode) *MDParagraph {
+	return &MDParagraph{Content: ns}
+}
+
+func header(level int, ns ...MDParagraphFormatNode) *MDHeader {
+	return &MDHeader{Level: level, Content: ns}
+}
+
+func ulist(items ...*MDListItem) *MDList {
+	return &MDList{Items: items}
+}
+
+func olist(start int, items ...*MDListItem) *MDList {
+	return &MDList{Ordered: true, Start: start, Items: items}
+}
+
+func item(ns ...MDSyntaxNode) *MDListItem {
+	return &MDListItem{Children: ns}
+}
+
+func task(checked bool, ns ...MDSyntaxNode) *MDListItem {
+	return &MDListItem{Children: ns, Task: true, Checked: checked}
+}
+
+// One cell per node
+func cells(ns ...MDParagraphFormatNode) []MDTableCell {
+	cs := make([]MDTableCell, len(ns))
+	for i, n := range ns {
+		cs[i] = MDTableCell{Content: []MDParagraphFormatNode{n}}
+	}
+	return cs
+}
+
+func codeBlock(fence, info string, closed bool, lines ...string) *MDCodeBlock {
+	n := &MDCodeBlock{Fence: fence, Info: info, Lines: []MDTextFormatNode{}, Closed: closed}
+	for _, l := range lines {
+		n.Lines = append(n.Lines, MDTextFormatNode{Content: l})
+	}
+	return n
 }
 
-func paragraph(ns ...MDParagraphFormatNode) MDParagraph {
-	return MDParagraph{ns}
+func quote(ns ...MDSyntaxNode) *MDBlockQuote {
+	return &MDBlockQuote{Children: ns}
 }
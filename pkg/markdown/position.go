@@ -0,0 +1,129 @@
+package markdown
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// MDPosition is a location in the original text of a document, before any
+// preprocessing. Lines & columns start at 1; columns count characters, with a
+// tab counting as one.
+type MDPosition struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func (p MDPosition) String() string { return fmt.Sprintf("%d:%d", p.Line, p.Column) }
+
+// MDSpan is the part of the original text a token or node came from. End is
+// exclusive.
+type MDSpan struct {
+	Start MDPosition `json:"start"`
+	End   MDPosition `json:"end"`
+
+	// Where the span is in the preprocessed text, which is what token content
+	// comes from. Keeping these means part of a token, like a single run of
+	// format characters, can still be mapped back to the original text.
+	from, to int
+	src      *mdSourceMap
+}
+
+func (s MDSpan) String() string { return fmt.Sprintf("%v-%v", s.Start, s.End) }
+
+// IsZero reports whether the span is unset, e.g. on a hand-built token.
+func (s MDSpan) IsZero() bool { return s == MDSpan{} }
+
+// Returns the span of bytes i to j of the preprocessed text s covers.
+func (s MDSpan) sub(i, j int) MDSpan {
+	if s.src == nil {
+		return MDSpan{}
+	}
+	return s.src.span(s.from+i, s.from+j)
+}
+
+// Returns the span from the start of a to the end of b. Either may be unset.
+func joinSpans(a, b MDSpan) MDSpan {
+	switch {
+	case a.IsZero():
+		return b
+	case b.IsZero():
+		return a
+	}
+	return MDSpan{Start: a.Start, End: b.End, from: a.from, to: b.to, src: a.src}
+}
+
+// Maps offsets in the preprocessed text Lex works on back to the original:
+// CRLF becomes LF and tabs become four spaces, so neither offsets nor
+// lengths carry over as-is.
+type mdSourceMap struct {
+	original string
+
+	// The original offset of each byte of the preprocessed text, plus one
+	// for its end. Each of the spaces a tab turns into maps to the tab.
+	offsets []int
+
+	lineStarts []int
+
+	// The number of characters before each byte of the original, plus one
+	// for its end, so a column is a subtraction rather than a count from
+	// the start of its line. Bytes within a character share its count.
+	runes []int
+}
+
+// Preprocesses original[start:], returning the text to lex along with the
+// map back to original.
+func newSourceMap(original string, start int) (string, *mdSourceMap) {
+	m := &mdSourceMap{original: original, offsets: make([]int, 0, len(original)-start+1), lineStarts: []int{0}, runes: make([]int, len(original)+1)}
+	for i := 0; i < len(original); i++ {
+		if original[i] == '\n' {
+			m.lineStarts = append(m.lineStarts, i+1)
+		}
+	}
+	n := 0
+	for i := 0; i < len(original); n++ {
+		_, size := utf8.DecodeRuneInString(original[i:])
+		for end := i + size; i < end; i++ {
+			m.runes[i] = n
+		}
+	}
+	m.runes[len(original)] = n
+
+	var sb strings.Builder
+	sb.Grow(len(original) - start)
+	for i := start; i < len(original); i++ {
+		switch {
+		case original[i] == '\r' && i+1 < len(original) && original[i+1] == '\n':
+			// The LF stands in for the whole line ending
+			sb.WriteByte('\n')
+			m.offsets = append(m.offsets, i)
+			i++
+		case original[i] == '\t':
+			sb.WriteString("    ")
+			m.offsets = append(m.offsets, i, i, i, i)
+		default:
+			sb.WriteByte(original[i])
+			m.offsets = append(m.offsets, i)
+		}
+	}
+	m.offsets = append(m.offsets, len(original))
+	return sb.String(), m
+}
+
+func (m *mdSourceMap) span(from, to int) MDSpan {
+	return MDSpan{
+		Start: m.position(m.offsets[from]),
+		End:   m.position(m.offsets[to]),
+		from:  from,
+		to:    to,
+		src:   m,
+	}
+}
+
+func (m *mdSourceMap) position(offset int) MDPosition {
+	line := sort.Search(len(m.lineStarts), func(i int) bool { return m.lineStarts[i] > offset }) - 1
+	col := m.runes[offset] - m.runes[m.lineStarts[line]] + 1
+	return MDPosition{Offset: offset, Line: line + 1, Column: col}
+}
@@ -0,0 +1,125 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLexSpans(t *testing.T) {
+	text := "é *x*\r\n\t- a\tb\r\n"
+	tests := []struct {
+		expectedText  string
+		expectedStart MDPosition
+		expectedEnd   MDPosition
+	}{
+		{"é ", MDPosition{0, 1, 1}, MDPosition{3, 1, 3}},
+		{"*", MDPosition{3, 1, 3}, MDPosition{4, 1, 4}},
+		{"x", MDPosition{4, 1, 4}, MDPosition{5, 1, 5}},
+		{"*", MDPosition{5, 1, 5}, MDPosition{6, 1, 6}},
+		{"\r\n", MDPosition{6, 1, 6}, MDPosition{8, 2, 1}},
+		{"\t", MDPosition{8, 2, 1}, MDPosition{9, 2, 2}},
+		{"- ", MDPosition{9, 2, 2}, MDPosition{11, 2, 4}},
+		{"a\tb", MDPosition{11, 2, 4}, MDPosition{14, 2, 7}},
+		{"\r\n", MDPosition{14, 2, 7}, MDPosition{16, 3, 1}},
+	}
+
+	tokens := Lex(text)
+	if len(tokens) != len(tests) {
+		t.Fatalf("expected %d tokens, got %v", len(tests), tokens)
+	}
+	for i, test := range tests {
+		span := tokens[i].GetSpan()
+		if actual := text[span.Start.Offset:span.End.Offset]; actual != test.expectedText {
+			t.Errorf("token %d (%v): expected text %q, got %q", i, tokens[i], test.expectedText, actual)
+		}
+		if span.Start != test.expectedStart || span.End != test.expectedEnd {
+			t.Errorf("token %d (%v): expected %v-%v, got %v", i, tokens[i], test.expectedStart, test.expectedEnd, span)
+		}
+	}
+}
+
+func TestParseSpans(t *testing.T) {
+	text := "---\ntitle: Spans\n---\n# Head *one*\r\n\r\n> - [ ] a **b\n>   c**\r\n\r\n|\tx\t| y |\n|---|---|\n| `z` |  w  |"
+	tree, err := ParseDocument(text)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	header := tree.Children[0].(*MDHeader)
+	quote := tree.Children[1].(*MDBlockQuote)
+	item := quote.Children[0].(*MDList).Items[0]
+	paragraph := item.Children[0].(*MDParagraph)
+	table := tree.Children[2].(*MDTable)
+
+	tests := []struct {
+		name         string
+		span         MDSpan
+		expectedText string
+		expectedLine int
+	}{
+		{"header", header.Span, "# Head *one*", 4},
+		{"italics", header.Content[1].GetSpan(), "*one*", 4},
+		{"italics-text", header.Content[1].(MDInlineFormatNode).Content[0].GetSpan(), "one", 4},
+		{"quote", quote.Span, "> - [ ] a **b\n>   c**", 6},
+		{"list", quote.Children[0].GetSpan(), "- [ ] a **b\n>   c**", 6},
+		{"item", item.Span, "- [ ] a **b\n>   c**", 6},
+		{"paragraph", paragraph.Span, "a **b\n>   c**", 6},
+		{"bold", paragraph.Content[1].GetSpan(), "**b\n>   c**", 6},
+		{"soft-break", paragraph.Content[1].(MDInlineFormatNode).Content[1].GetSpan(), "", 6},
+		{"table", table.Span, "|\tx\t| y |\n|---|---|\n| `z` |  w  |", 9},
+		{"header-cell", table.Header[0].Span, "x", 9},
+		{"header-cell-text", table.Header[0].Content[0].GetSpan(), "x", 9},
+		{"code", table.Rows[0][0].Content[0].GetSpan(), "`z`", 11},
+		{"code-text", table.Rows[0][0].Content[0].(MDInlineFormatNode).Content[0].GetSpan(), "z", 11},
+		{"cell", table.Rows[0][1].Span, "w", 11},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(s *testing.T) {
+			if actual := text[test.span.Start.Offset:test.span.End.Offset]; actual != test.expectedText {
+				s.Errorf("expected text %q, got %q", test.expectedText, actual)
+			}
+			if test.span.Start.Line != test.expectedLine {
+				s.Errorf("expected to start on line %d, got %v", test.expectedLine, test.span)
+			}
+		})
+	}
+}
+
+func TestFormatSpansSplitDelimiters(t *testing.T) {
+	// The "***" closing the italics is split between the bold & the italics
+	text := "*a **b***"
+	tree, _ := Parse(Lex(text))
+
+	italics := tree.Children[0].(*MDParagraph).Content[0]
+	bold := italics.(MDInlineFormatNode).Content[1]
+	for _, n := range []struct {
+		node         MDParagraphFormatNode
+		expectedText string
+	}{{italics, "*a **b***"}, {bold, "**b**"}} {
+		span := n.node.GetSpan()
+		if actual := text[span.Start.Offset:span.End.Offset]; actual != n.expectedText {
+			t.Errorf("expected %v to span %q, got %q", n.node, n.expectedText, actual)
+		}
+	}
+}
+
+func TestSpansLongLine(t *testing.T) {
+	// Thousands of unmatched delimiters on one line, each of which has a span
+	// & ends up as text, shouldn't take time quadratic in the line's length
+	text := "é " + strings.Repeat("*a ", 20000) + "end"
+	tree, _ := Parse(Lex(text))
+
+	content := tree.Children[0].(*MDParagraph).Content
+	if len(content) != 1 {
+		t.Fatalf("expected the line to be one text node, got %d nodes", len(content))
+	}
+	if actual := content[0].(MDTextFormatNode).Content; actual != text {
+		t.Errorf("unexpected text %q", actual)
+	}
+	// "é" is two bytes but one column
+	expectedEnd := MDPosition{Offset: len(text), Line: 1, Column: len(text)}
+	if actual := content[0].GetSpan().End; actual != expectedEnd {
+		t.Errorf("expected the text to end at %+v, got %+v", expectedEnd, actual)
+	}
+}
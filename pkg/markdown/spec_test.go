@@ -0,0 +1,178 @@
+package markdown
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var specFailures = flag.Bool("spec.failures", false, "log the CommonMark spec examples that fail")
+
+// An example from the CommonMark spec. testdata/commonmark/spec.json is the
+// spec's examples as shipped with github.com/yuin/goldmark v1.8.2.
+type specExample struct {
+	Markdown string `json:"markdown"`
+	HTML     string `json:"html"`
+	Example  int    `json:"example"`
+	Section  string `json:"section"`
+}
+
+// A way this dialect deliberately differs from CommonMark, and the examples
+// of the spec it gives different results for. An example can be allowed by
+// number or by its whole section.
+type specDeviation struct {
+	reason   string
+	sections []string
+	examples []int
+}
+
+var specDeviations []specDeviation = []specDeviation{
+	{
+		// See markdown_element_notes.md: punctuation counts as part of a word,
+		// and "_" can format the middle of one like "*" can
+		reason: "only whitespace separates words when pairing emphasis",
+		examples: []int{
+			352, 354, 359, 360, 361, 362, 363, 368, 369, 372, 373, 374, 375, 376,
+			380, 385, 386, 387, 388, 392, 393, 398, 399, 400, 401, 402,
+		},
+	},
+	{
+		reason:   `"__" is underline rather than bold`,
+		examples: []int{382, 389, 390, 403, 406, 424, 425, 426, 456, 458, 462, 470},
+	},
+	{
+		reason:   "indented code blocks aren't supported, so indentation never starts code",
+		sections: []string{"Indented code blocks"},
+		examples: []int{
+			1, 2, 3, 5, 6, 7, 8, 18, 36, 48, 69, 85, 100, 183, 184, 191, 211, 225,
+			231, 236, 252, 253, 254, 257, 264, 270, 271, 272, 273, 274, 286, 287,
+			288, 289, 290, 309, 313,
+		},
+	},
+	{
+		reason:   "a blank line between items ends a list rather than making it loose",
+		examples: []int{306, 311, 314, 326},
+	},
+}
+
+// Runs the examples of the CommonMark spec through Lex, Parse and RenderHTML,
+// reporting how many of each section pass. Examples that fail are fine unless
+// they're covered by a deviation; what's checked is that the number passing
+// doesn't go down from testdata/commonmark/conformance.txt. Run with -update
+// to record a higher number, and -spec.failures to see what's failing.
+func TestCommonMarkSpec(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "commonmark", "spec.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	examples := []specExample{}
+	if err := json.Unmarshal(data, &examples); err != nil {
+		t.Fatal(err)
+	}
+
+	deviations := map[int]string{}
+	for _, d := range specDeviations {
+		for _, e := range examples {
+			if containsString(d.sections, e.Section) {
+				deviations[e.Example] = d.reason
+			}
+		}
+		for _, n := range d.examples {
+			deviations[n] = d.reason
+		}
+	}
+
+	type sectionResult struct {
+		passed, failed, deviated int
+	}
+	sections := []string{}
+	results := map[string]*sectionResult{}
+	for _, e := range examples {
+		result, ok := results[e.Section]
+		if !ok {
+			sections = append(sections, e.Section)
+			result = &sectionResult{}
+			results[e.Section] = result
+		}
+		actual, err := renderSpecExample(e.Markdown)
+		switch {
+		case err == nil && actual == e.HTML:
+			result.passed++
+		case deviations[e.Example] != "":
+			result.deviated++
+		default:
+			result.failed++
+			if *specFailures {
+				t.Logf("example %d (%s) failed:\n%s\nexpected:\n%s\nactual:\n%s",
+					e.Example, e.Section, e.Markdown, e.HTML, describeSpecResult(actual, err))
+			}
+		}
+	}
+
+	passed, total := 0, 0
+	for _, section := range sections {
+		r := results[section]
+		t.Logf("%-40s %3d/%-3d passed, %d deviating", section, r.passed, r.passed+r.failed, r.deviated)
+		passed += r.passed
+		total += r.passed + r.failed
+	}
+	t.Logf("conformance: %d/%d examples passed (%.1f%%), %d deviating",
+		passed, total, 100*float64(passed)/float64(total), len(examples)-total)
+
+	conformance := filepath.Join("testdata", "commonmark", "conformance.txt")
+	if *update {
+		if err := os.WriteFile(conformance, []byte(fmt.Sprintf("%d\n", passed)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorded, err := os.ReadFile(conformance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := strconv.Atoi(strings.TrimSpace(string(recorded)))
+	if err != nil {
+		t.Fatalf("could not read %s: %v", conformance, err)
+	}
+	switch {
+	case passed < expected:
+		t.Errorf("conformance went down - expected %d examples to pass, but %d did", expected, passed)
+	case passed > expected:
+		t.Logf("conformance went up from %d - run with -update to record it", expected)
+	}
+}
+
+// Renders an example, treating a panic as an error so that one bad example
+// doesn't stop the rest.
+func renderSpecExample(text string) (html string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	tree, err := Parse(Lex(text))
+	if err != nil {
+		return "", err
+	}
+	return RenderHTML(tree), nil
+}
+
+func describeSpecResult(html string, err error) string {
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return html
+}
+
+func containsString(ss []string, s string) bool {
+	for _, t := range ss {
+		if t == s {
+			return true
+		}
+	}
+	return false
+}
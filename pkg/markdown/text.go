@@ -0,0 +1,246 @@
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Fields text is extracted under - see TextSegments.
+const (
+	FIELD_BODY   string = "body"
+	FIELD_HEADER string = "header"
+	FIELD_LIST   string = "list"
+	FIELD_QUOTE  string = "quote"
+	FIELD_LINK   string = "link"
+	FIELD_CODE   string = "code"
+)
+
+// MDTextSegment is a run of a document's text, with the markdown syntax taken
+// out, that all belongs to the same field.
+type MDTextSegment struct {
+	Field string
+	Text  string
+	Span  MDSpan
+
+	pieces []mdTextPiece
+}
+
+// A part of a segment's text that came from a single place in the document.
+type mdTextPiece struct {
+	start int // In the segment's text
+	text  string
+	span  MDSpan
+
+	// Whether text is exactly what's at span in the preprocessed document, so
+	// parts of it can be mapped back as well. Unescaped characters & the like
+	// can only be mapped back as a whole.
+	exact bool
+}
+
+// SourceSpan maps bytes start to end of the segment's text back to where they
+// came from in the document, e.g. to find where a token from
+// tokenizer.OffsetTokenizer came from.
+func (s MDTextSegment) SourceSpan(start, end int) MDSpan {
+	var span MDSpan
+	for _, p := range s.pieces {
+		pEnd := p.start + len(p.text)
+		if pEnd <= start || p.start >= end {
+			continue
+		}
+		part := p.span
+		if p.exact {
+			from, to := start-p.start, end-p.start
+			if from < 0 {
+				from = 0
+			}
+			if to > len(p.text) {
+				to = len(p.text)
+			}
+			part = p.span.sub(from, to)
+		}
+		span = joinSpans(span, part)
+	}
+	return span
+}
+
+// Bare URLs are dropped from the text, along with link destinations.
+var textURLPatt *regexp.Regexp = regexp.MustCompile(`https?://\S+`)
+
+// TextSegments extracts the text of a document for indexing: escapes are
+// decoded, formatting & URLs are dropped, and each block's text is split up
+// by which field it belongs to. Each segment can be passed straight to a
+// tokenizer.Tokenizer.
+//
+// A header's text goes under FIELD_HEADER, and the text of a list item or
+// block quote under FIELD_LIST or FIELD_QUOTE, whichever is innermost; the
+// rest is FIELD_BODY. Code & link text take precedence over all of these, so
+// a link in a header is FIELD_LINK and a code block in a list is FIELD_CODE.
+func TextSegments(tree MDSyntaxTree) []MDTextSegment {
+	e := &mdTextExtractor{segments: []MDTextSegment{}}
+	e.blocks(tree.Children, FIELD_BODY)
+	return e.segments
+}
+
+type mdTextExtractor struct {
+	segments []MDTextSegment
+
+	// The segment being added to, if any
+	current *MDTextSegment
+}
+
+func (e *mdTextExtractor) blocks(ns []MDSyntaxNode, field string) {
+	for _, n := range ns {
+		switch n := n.(type) {
+		case *MDParagraph:
+			e.inline(n.Content, field)
+		case *MDHeader:
+			e.inline(n.Content, FIELD_HEADER)
+		case *MDList:
+			for _, item := range n.Items {
+				e.blocks(item.Children, FIELD_LIST)
+			}
+		case *MDListItem:
+			e.blocks(n.Children, FIELD_LIST)
+		case *MDBlockQuote:
+			e.blocks(n.Children, FIELD_QUOTE)
+		case *MDCodeBlock:
+			e.end()
+			for i, line := range n.Lines {
+				if i > 0 {
+					e.add(FIELD_CODE, mdTextPiece{text: "\n"})
+				}
+				e.add(FIELD_CODE, mdTextPiece{text: line.Content, span: line.Span, exact: true})
+			}
+			e.end()
+		case *MDTable:
+			for _, c := range n.Header {
+				e.inline(c.Content, field)
+			}
+			for _, row := range n.Rows {
+				for _, c := range row {
+					e.inline(c.Content, field)
+				}
+			}
+		}
+	}
+}
+
+// MDSourceRun maps bytes Start to End of a segment's text back to Span in the
+// document. An exact run is the very same bytes as the document has at Span,
+// all on one line, so any part of it maps back as well; any other run can
+// only be mapped back as a whole.
+type MDSourceRun struct {
+	Start int
+	End   int
+	Span  MDSpan
+	Exact bool
+}
+
+// SourceRuns breaks the segment's text up into runs that each map back to
+// the document in one go, so parts of it can still be mapped back once the
+// segment itself is gone, e.g. after it's been stored.
+func (s MDTextSegment) SourceRuns() []MDSourceRun {
+	runs := []MDSourceRun{}
+	for _, p := range s.pieces {
+		if !p.exact || p.span.src == nil {
+			runs = append(runs, MDSourceRun{Start: p.start, End: p.start + len(p.text), Span: p.span})
+			continue
+		}
+		// Each byte either lines up with a byte of the original or doesn't,
+		// like the spaces a tab becomes or a line ending, and a run is all of
+		// one or the other
+		offsets, at := p.span.src.offsets, p.span.from
+		linear := func(i int) bool {
+			j := at + i
+			return offsets[j+1] == offsets[j]+1 && (j == 0 || offsets[j-1] != offsets[j]) && p.text[i] != '\n'
+		}
+		from := 0
+		for i := 1; i <= len(p.text); i++ {
+			if i < len(p.text) && linear(i) == linear(from) {
+				continue
+			}
+			runs = append(runs, MDSourceRun{Start: p.start + from, End: p.start + i, Span: p.span.sub(from, i), Exact: linear(from)})
+			from = i
+		}
+	}
+	return runs
+}
+
+// Adds the text of a block's inline content. Blocks never share a segment.
+func (e *mdTextExtractor) inline(ns []MDParagraphFormatNode, field string) {
+	e.end()
+	e.nodes(ns, field)
+	e.end()
+}
+
+func (e *mdTextExtractor) nodes(ns []MDParagraphFormatNode, field string) {
+	for _, n := range ns {
+		switch n := n.(type) {
+		case MDTextFormatNode:
+			e.text(field, n.Content, n.Span)
+		case MDEscapeFormatNode:
+			e.add(field, mdTextPiece{text: n.Content, span: n.Span})
+		case MDLineBreakFormatNode:
+			e.add(field, mdTextPiece{text: " ", span: n.Span})
+		case MDHashtagFormatNode:
+			e.add(field, mdTextPiece{text: "#" + n.Tag, span: n.Span, exact: true})
+		case MDWikiLinkFormatNode:
+			e.add(FIELD_LINK, mdTextPiece{text: n.Text(), span: n.Span})
+		case MDLinkFormatNode:
+			if !n.Auto {
+				e.nodes(n.Content, FIELD_LINK)
+			}
+		case MDInlineFormatNode:
+			if n.Type == FORMAT_NODE_CODE {
+				e.add(FIELD_CODE, mdTextPiece{text: PlainText(n.Content), span: n.Content[0].GetSpan(), exact: true})
+			} else {
+				e.nodes(n.Content, field)
+			}
+		}
+	}
+}
+
+// Adds text, minus any URLs in it.
+func (e *mdTextExtractor) text(field, text string, span MDSpan) {
+	cur := 0
+	for _, m := range textURLPatt.FindAllStringIndex(text, -1) {
+		if m[0] > cur {
+			e.add(field, mdTextPiece{text: text[cur:m[0]], span: span.sub(cur, m[0]), exact: true})
+		}
+		cur = m[1]
+	}
+	if cur < len(text) {
+		e.add(field, mdTextPiece{text: text[cur:], span: span.sub(cur, len(text)), exact: true})
+	}
+}
+
+func (e *mdTextExtractor) add(field string, p mdTextPiece) {
+	if p.text == "" {
+		return
+	}
+	if p.exact && len(p.text) != p.span.to-p.span.from {
+		// e.g. code spanning lines, which has to be mapped back as a whole
+		p.exact = false
+	}
+	if e.current != nil && e.current.Field != field {
+		e.end()
+	}
+	if e.current == nil {
+		e.current = &MDTextSegment{Field: field}
+	}
+	p.start = len(e.current.Text)
+	e.current.Text += p.text
+	e.current.Span = joinSpans(e.current.Span, p.span)
+	e.current.pieces = append(e.current.pieces, p)
+}
+
+// Finishes the current segment, if there is one.
+func (e *mdTextExtractor) end() {
+	if e.current == nil {
+		return
+	}
+	if strings.TrimSpace(e.current.Text) != "" {
+		e.segments = append(e.segments, *e.current)
+	}
+	e.current = nil
+}
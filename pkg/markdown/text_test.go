@@ -0,0 +1,125 @@
+package markdown
+
+import (
+	"reflect"
+	"testing"
+
+	"mrshanahan.com/notes-indexer/pkg/tokenizer"
+)
+
+func TestTextSegments(t *testing.T) {
+	tests := []struct {
+		name             string
+		text             string
+		expectedSegments []MDTextSegment
+	}{
+		{
+			"formatting",
+			"Some **bold**, _italic_ and \\*escaped\\* text\nover two lines",
+			[]MDTextSegment{{Field: FIELD_BODY, Text: "Some bold, italic and *escaped* text over two lines"}},
+		},
+		{
+			"fields",
+			"# A *header*\n- Item with `code()`\n  > Quoted [link text](http://example.com) here\n\n| Cell | [[Note#Part]] |\n|---|---|",
+			[]MDTextSegment{
+				{Field: FIELD_HEADER, Text: "A header"},
+				{Field: FIELD_LIST, Text: "Item with "},
+				{Field: FIELD_CODE, Text: "code()"},
+				{Field: FIELD_QUOTE, Text: "Quoted "},
+				{Field: FIELD_LINK, Text: "link text"},
+				{Field: FIELD_QUOTE, Text: " here"},
+				{Field: FIELD_BODY, Text: "Cell"},
+				{Field: FIELD_LINK, Text: "Note > Part"},
+			},
+		},
+		{
+			"urls",
+			"See https://example.com/a_b or <http://x.org> for #more-info",
+			[]MDTextSegment{{Field: FIELD_BODY, Text: "See  or  for #more-info"}},
+		},
+		{
+			"tasks",
+			"- [x] Done\n- [ ] To do",
+			[]MDTextSegment{{Field: FIELD_LIST, Text: "Done"}, {Field: FIELD_LIST, Text: "To do"}},
+		},
+		{
+			"code-blocks",
+			"Run:\n```sh\nmake all\n\nmake test\n```",
+			[]MDTextSegment{{Field: FIELD_BODY, Text: "Run:"}, {Field: FIELD_CODE, Text: "make all\n\nmake test"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(s *testing.T) {
+			tree, err := Parse(Lex(test.text))
+			if err != nil {
+				s.Fatalf("unexpected error: %v", err)
+			}
+			actual := []MDTextSegment{}
+			for _, segment := range TextSegments(tree) {
+				actual = append(actual, MDTextSegment{Field: segment.Field, Text: segment.Text})
+			}
+			if !reflect.DeepEqual(test.expectedSegments, actual) {
+				s.Errorf("segments were not equal - expected=%+v, actual=%+v", test.expectedSegments, actual)
+			}
+		})
+	}
+}
+
+func TestTextSegmentSourceSpans(t *testing.T) {
+	text := "Un**fold**ing\tthe \\*map\\* of `the\r\nworld`"
+	tree, _ := Parse(Lex(text))
+	segments := TextSegments(tree)
+
+	tok := tokenizer.NewDefault().(tokenizer.OffsetTokenizer)
+	sources := []string{}
+	for _, segment := range segments {
+		_, offsets, err := tok.TokenizeWithOffsets(segment.Text)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, o := range offsets {
+			span := segment.SourceSpan(o.Start, o.End)
+			sources = append(sources, text[span.Start.Offset:span.End.Offset])
+		}
+	}
+
+	// Unescaped text can only be mapped back as a whole
+	expected := []string{"Un**fold**ing", "the", "\\*map\\*", "of", "the", "world"}
+	if !reflect.DeepEqual(expected, sources) {
+		t.Errorf("unexpected sources - expected=%q, actual=%q", expected, sources)
+	}
+}
+
+func TestTextSegmentSourceRuns(t *testing.T) {
+	text := "# Notes\r\n\r\n- a\tlist *item*\r\n  that wraps\r\n"
+	tree, _ := ParseDocument(text)
+
+	type run struct {
+		Text   string
+		Source string
+		Line   int
+		Column int
+		Exact  bool
+	}
+	runs := []run{}
+	for _, segment := range TextSegments(tree) {
+		for _, r := range segment.SourceRuns() {
+			runs = append(runs, run{segment.Text[r.Start:r.End], text[r.Span.Start.Offset:r.Span.End.Offset], r.Span.Start.Line, r.Span.Start.Column, r.Exact})
+		}
+	}
+
+	// Runs are cut at tabs & line endings, which don't map back byte for byte
+	expected := []run{
+		{"Notes", "Notes", 1, 3, true},
+		{"a", "a", 3, 3, true},
+		{"    ", "\t", 3, 4, false},
+		{"list ", "list ", 3, 5, true},
+		{"item", "item", 3, 11, true},
+		{" ", "", 3, 16, false},
+		{"that wraps", "that wraps", 4, 3, true},
+	}
+	if !reflect.DeepEqual(expected, runs) {
+		t.Errorf("unexpected runs - expected=%+v, actual=%+v", expected, runs)
+	}
+}
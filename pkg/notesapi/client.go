@@ -0,0 +1,152 @@
+// Package notesapi syncs notes from notes-api into an index. It expects two
+// endpoints of it:
+//
+//	GET /notes?limit=&page=&updated_since=&since_revision=&include_deleted=true
+//
+// which lists notes changed since the given point, oldest first, as
+//
+//	{"notes": [{"id": ..., "title": ..., "updated_at": ..., "revision": ..., "deleted": ...}], "next_page": ...}
+//
+// with next_page being empty on the last page, and
+//
+//	GET /notes/{id}/content
+//
+// which returns a note's markdown as-is.
+package notesapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DEFAULT_PAGE_SIZE int = 100
+
+// Note is a note as it's listed, without its content. Revision is only set
+// by a notes-api that keeps count of its changes; Deleted by one that keeps
+// track of deleted notes.
+type Note struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Revision  int64     `json:"revision,omitempty"`
+	Deleted   bool      `json:"deleted,omitempty"`
+}
+
+// UnmarshalJSON takes IDs as either strings or numbers.
+func (n *Note) UnmarshalJSON(data []byte) error {
+	type note Note
+	raw := struct {
+		note
+		ID json.RawMessage `json:"id"`
+	}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*n = Note(raw.note)
+	id := strings.TrimSpace(string(raw.ID))
+	if strings.HasPrefix(id, `"`) {
+		return json.Unmarshal(raw.ID, &n.ID)
+	}
+	n.ID = id
+	return nil
+}
+
+type Page struct {
+	Notes    []Note `json:"notes"`
+	NextPage string `json:"next_page"`
+}
+
+// Since is the point a listing starts from: notes changed after a revision if
+// Revision is set, otherwise those updated at or after UpdatedAt. The zero
+// value lists every note.
+type Since struct {
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+	Revision  int64     `json:"revision,omitempty"`
+}
+
+func (s Since) IsZero() bool { return s.UpdatedAt.IsZero() && s.Revision == 0 }
+
+type Client struct {
+	BaseURL string
+
+	// Sent as a bearer token, if set
+	Token string
+
+	// Zero means DEFAULT_PAGE_SIZE
+	PageSize int
+
+	// Nil means http.DefaultClient
+	HTTP *http.Client
+}
+
+// List fetches a page of the notes changed since a given point. page is the
+// NextPage of the page before, or "" for the first.
+func (c *Client) List(ctx context.Context, since Since, page string) (Page, error) {
+	params := url.Values{}
+	pageSize := c.PageSize
+	if pageSize == 0 {
+		pageSize = DEFAULT_PAGE_SIZE
+	}
+	params.Set("limit", strconv.Itoa(pageSize))
+	params.Set("include_deleted", "true")
+	if page != "" {
+		params.Set("page", page)
+	}
+	if since.Revision > 0 {
+		params.Set("since_revision", strconv.FormatInt(since.Revision, 10))
+	} else if !since.UpdatedAt.IsZero() {
+		params.Set("updated_since", since.UpdatedAt.Format(time.RFC3339Nano))
+	}
+
+	body, err := c.get(ctx, "/notes?"+params.Encode())
+	if err != nil {
+		return Page{}, err
+	}
+	defer body.Close()
+	p := Page{}
+	if err := json.NewDecoder(body).Decode(&p); err != nil {
+		return Page{}, fmt.Errorf("invalid listing of notes: %w", err)
+	}
+	return p, nil
+}
+
+// Content fetches the content of a note.
+func (c *Client) Content(ctx context.Context, id string) ([]byte, error) {
+	body, err := c.get(ctx, "/notes/"+url.PathEscape(id)+"/content")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func (c *Client) get(ctx context.Context, path string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(c.BaseURL, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("GET %s: %s: %s", req.URL.Path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,232 @@
+package notesapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"mrshanahan.com/notes-indexer/pkg/index"
+)
+
+// DEFAULT_ID_PREFIX is what the IDs of notes are prefixed with in the index,
+// to keep them apart from documents indexed from elsewhere.
+const DEFAULT_ID_PREFIX string = "notes-api/"
+
+// The index metadata the high-water mark of syncs is kept under, suffixed
+// with the ID prefix so different sources are tracked separately.
+const META_SINCE string = "notesapi.since:"
+
+type SyncOptions struct {
+	// Zero means DEFAULT_ID_PREFIX
+	IDPrefix string
+
+	// Sync every note, rather than only those changed since the last sync.
+	// Notes that weren't listed are deleted, which catches deletions by a
+	// notes-api that doesn't report them.
+	Full bool
+
+	// Called after each note synced, if set
+	Progress func(Note, string)
+}
+
+const (
+	NOTE_ADDED     string = "added"
+	NOTE_UPDATED   string = "updated"
+	NOTE_UNCHANGED string = "unchanged"
+	NOTE_DELETED   string = "deleted"
+	NOTE_FAILED    string = "failed"
+)
+
+type SyncSummary struct {
+	Pages     int
+	Listed    int
+	Added     int
+	Updated   int
+	Unchanged int
+	Deleted   int
+	Failed    int   // Notes that couldn't be indexed, and were passed over
+	Since     Since // The high-water mark after the sync
+	Elapsed   time.Duration
+
+	// Why each note that failed did, and any problems with notes that were
+	// synced anyway, like broken front matter. Each names its note.
+	Errors   []error
+	Warnings []string
+}
+
+// Sync brings an index up to date with notes-api, then commits it along with
+// how far it got. Unless it's a full sync, only the notes changed since the
+// last one are listed, and their content fetched.
+//
+// A note whose content can't be indexed is counted as failed and passed
+// over, so it's only tried again once it changes. If a sync fails part way,
+// e.g. as notes-api can't be reached, whatever it synced is committed but the
+// high-water mark isn't moved, so the next one lists the same notes again
+// and only fetches those that weren't synced.
+func Sync(ctx context.Context, c *Client, ix *index.Index, opts SyncOptions) (SyncSummary, error) {
+	start := time.Now()
+	if opts.IDPrefix == "" {
+		opts.IDPrefix = DEFAULT_ID_PREFIX
+	}
+	summary := SyncSummary{}
+	since := Since{}
+	if !opts.Full {
+		var err error
+		if since, err = loadSince(ix, opts.IDPrefix); err != nil {
+			return summary, err
+		}
+	}
+	summary.Since = since
+
+	seen := map[string]bool{}
+	err := func() error {
+		page := ""
+		for {
+			p, err := c.List(ctx, since, page)
+			if err != nil {
+				return err
+			}
+			summary.Pages++
+			for _, note := range p.Notes {
+				status, warnings, err := syncNote(ctx, c, ix, opts.IDPrefix, note)
+				if err != nil && status != NOTE_FAILED {
+					return fmt.Errorf("failed to sync note %s: %w", note.ID, err)
+				}
+				if err != nil {
+					summary.Errors = append(summary.Errors, fmt.Errorf("failed to index note %s: %w", note.ID, err))
+				}
+				for _, w := range warnings {
+					summary.Warnings = append(summary.Warnings, fmt.Sprintf("note %s: %s", note.ID, w))
+				}
+				summary.Listed++
+				seen[opts.IDPrefix+note.ID] = true
+				switch status {
+				case NOTE_ADDED:
+					summary.Added++
+				case NOTE_UPDATED:
+					summary.Updated++
+				case NOTE_UNCHANGED:
+					summary.Unchanged++
+				case NOTE_DELETED:
+					summary.Deleted++
+				case NOTE_FAILED:
+					summary.Failed++
+				}
+				summary.Since = advance(summary.Since, note)
+				if opts.Progress != nil {
+					opts.Progress(note, status)
+				}
+			}
+			if p.NextPage == "" {
+				return nil
+			}
+			page = p.NextPage
+		}
+	}()
+
+	if err == nil && opts.Full {
+		for _, id := range ix.IDs() {
+			if strings.HasPrefix(id, opts.IDPrefix) && !seen[id] {
+				if _, err := ix.Delete(id); err != nil {
+					return summary, err
+				}
+				summary.Deleted++
+			}
+		}
+	}
+	if err == nil {
+		err = saveSince(ix, opts.IDPrefix, summary.Since)
+	} else {
+		summary.Since = since
+	}
+	if commitErr := ix.Commit(); commitErr != nil && err == nil {
+		err = commitErr
+	}
+	summary.Elapsed = time.Since(start)
+	return summary, err
+}
+
+// Brings one listed note up to date in the index, returning any warnings
+// about its content. A note that can't be indexed is NOTE_FAILED, along with
+// why; any other error means the sync can't go on.
+func syncNote(ctx context.Context, c *Client, ix *index.Index, prefix string, note Note) (string, []string, error) {
+	id := prefix + note.ID
+	existing, exists := ix.Get(id)
+	if note.Deleted {
+		if _, err := ix.Delete(id); err != nil {
+			return "", nil, err
+		}
+		if !exists {
+			return NOTE_UNCHANGED, nil, nil
+		}
+		return NOTE_DELETED, nil, nil
+	}
+	// Listings by updated_at include the notes updated at exactly the last
+	// high-water mark, which have usually been synced already, and a sync
+	// that failed part way lists notes again
+	if exists && !note.UpdatedAt.IsZero() && existing.ModTime.Equal(note.UpdatedAt) {
+		return NOTE_UNCHANGED, nil, nil
+	}
+
+	content, err := c.Content(ctx, note.ID)
+	if err != nil {
+		return "", nil, err
+	}
+	if !utf8.Valid(content) {
+		return NOTE_FAILED, nil, fmt.Errorf("content isn't UTF-8 text")
+	}
+	doc, err := index.NewDocument(id, index.DOC_TYPE_MARKDOWN, content)
+	if err != nil {
+		return NOTE_FAILED, nil, err
+	}
+	if note.Title != "" {
+		doc.Title, doc.Fields[index.FIELD_TITLE] = note.Title, note.Title
+	}
+	doc.ModTime = note.UpdatedAt
+	replaced, err := ix.Replace(doc)
+	if err != nil {
+		return "", nil, err
+	}
+	if replaced {
+		return NOTE_UPDATED, doc.Warnings, nil
+	}
+	return NOTE_ADDED, doc.Warnings, nil
+}
+
+// Moves the high-water mark past a note that's been synced. Listings are
+// oldest first, but this doesn't rely on it.
+func advance(since Since, note Note) Since {
+	if note.Revision > since.Revision {
+		since.Revision = note.Revision
+	}
+	if note.UpdatedAt.After(since.UpdatedAt) {
+		since.UpdatedAt = note.UpdatedAt
+	}
+	return since
+}
+
+func loadSince(ix *index.Index, prefix string) (Since, error) {
+	since := Since{}
+	value := ix.Meta(META_SINCE + prefix)
+	if value == "" {
+		return since, nil
+	}
+	if err := json.Unmarshal([]byte(value), &since); err != nil {
+		return since, fmt.Errorf("invalid high-water mark of last sync: %w", err)
+	}
+	return since, nil
+}
+
+func saveSince(ix *index.Index, prefix string, since Since) error {
+	if since.IsZero() {
+		return nil
+	}
+	value, err := json.Marshal(since)
+	if err != nil {
+		return err
+	}
+	return ix.SetMeta(META_SINCE+prefix, string(value))
+}
@@ -0,0 +1,335 @@
+package notesapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mrshanahan.com/notes-indexer/pkg/index"
+)
+
+type fakeNote struct {
+	Note
+	content string
+}
+
+// A notes-api that keeps notes in memory, and counts the requests it gets.
+type fakeNotesAPI struct {
+	mu       sync.Mutex
+	notes    map[string]*fakeNote
+	revision int64
+	now      time.Time
+
+	// Whether to report revisions & deleted notes
+	revisions  bool
+	tombstones bool
+
+	lists    []string // Query strings of listings
+	fetches  []string // IDs of notes fetched
+	failNote string   // Fails to fetch the content of this note
+}
+
+func newFakeNotesAPI() *fakeNotesAPI {
+	return &fakeNotesAPI{notes: map[string]*fakeNote{}, now: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC), tombstones: true}
+}
+
+func (f *fakeNotesAPI) put(id, title, content string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.revision++
+	f.now = f.now.Add(time.Minute)
+	f.notes[id] = &fakeNote{Note{ID: id, Title: title, UpdatedAt: f.now, Revision: f.revision}, content}
+}
+
+func (f *fakeNotesAPI) delete(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.revision++
+	f.now = f.now.Add(time.Minute)
+	if f.tombstones {
+		n := f.notes[id]
+		n.Deleted, n.UpdatedAt, n.Revision, n.content = true, f.now, f.revision, ""
+	} else {
+		delete(f.notes, id)
+	}
+}
+
+func (f *fakeNotesAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/notes/") && strings.HasSuffix(r.URL.Path, "/content") {
+		id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/notes/"), "/content")
+		f.fetches = append(f.fetches, id)
+		n, ok := f.notes[id]
+		if !ok || n.Deleted || id == f.failNote {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(n.content))
+		return
+	}
+	if r.URL.Path != "/notes" {
+		http.NotFound(w, r)
+		return
+	}
+
+	f.lists = append(f.lists, r.URL.RawQuery)
+	q := r.URL.Query()
+	since, _ := time.Parse(time.RFC3339Nano, q.Get("updated_since"))
+	sinceRevision, _ := strconv.ParseInt(q.Get("since_revision"), 10, 64)
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	offset, _ := strconv.Atoi(q.Get("page"))
+
+	listed := []Note{}
+	for _, n := range f.notes {
+		if n.UpdatedAt.Before(since) || (sinceRevision > 0 && n.Revision <= sinceRevision) {
+			continue
+		}
+		if n.Deleted && q.Get("include_deleted") != "true" {
+			continue
+		}
+		note := n.Note
+		if !f.revisions {
+			note.Revision = 0
+		}
+		listed = append(listed, note)
+	}
+	sort.Slice(listed, func(i, j int) bool { return listed[i].UpdatedAt.Before(listed[j].UpdatedAt) })
+
+	page := Page{Notes: []Note{}}
+	if offset < len(listed) {
+		listed = listed[offset:]
+		if len(listed) > limit {
+			listed = listed[:limit]
+			page.NextPage = strconv.Itoa(offset + limit)
+		}
+		page.Notes = listed
+	}
+	json.NewEncoder(w).Encode(page)
+}
+
+func (f *fakeNotesAPI) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lists, f.fetches = nil, nil
+}
+
+func testSync(t *testing.T) (*fakeNotesAPI, *Client, *index.Index) {
+	api := newFakeNotesAPI()
+	ts := httptest.NewServer(api)
+	ix, err := index.Open(t.TempDir(), nil)
+	assert.Nil(t, err)
+	t.Cleanup(func() {
+		ix.Close()
+		ts.Close()
+	})
+	return api, &Client{BaseURL: ts.URL + "/", Token: "secret", PageSize: 2, HTTP: ts.Client()}, ix
+}
+
+func TestSync(t *testing.T) {
+	api, client, ix := testSync(t)
+	api.put("1", "Groceries", "- eggs\n- milk\n")
+	api.put("2", "", "# Trip\n\nPack the #camera\n")
+	api.put("3", "Ideas", "An indexer for notes\n")
+
+	statuses := []string{}
+	summary, err := Sync(context.Background(), client, ix, SyncOptions{
+		Progress: func(n Note, status string) { statuses = append(statuses, n.ID+" "+status) },
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1 added", "2 added", "3 added"}, statuses)
+	assert.Equal(t, 2, summary.Pages)
+	assert.Equal(t, 3, summary.Added)
+	assert.Equal(t, api.now, summary.Since.UpdatedAt)
+	assert.Equal(t, []string{"1", "2", "3"}, api.fetches)
+	assert.Equal(t, []string{"notes-api/1", "notes-api/2", "notes-api/3"}, ix.IDs())
+	doc, _ := ix.Get("notes-api/1")
+	assert.Equal(t, "Groceries", doc.Title)
+	assert.Equal(t, api.notes["1"].UpdatedAt, doc.ModTime)
+	doc, _ = ix.Get("notes-api/2")
+	assert.Equal(t, "Trip", doc.Title)
+	assert.Equal(t, []string{"camera"}, doc.Tags)
+
+	// The high-water mark is committed along with the notes
+	ro, err := index.OpenReadOnly(ix.Dir())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, ro.Len())
+	since, err := loadSince(ro, DEFAULT_ID_PREFIX)
+	assert.Nil(t, err)
+	assert.Equal(t, api.now, since.UpdatedAt)
+}
+
+func TestSyncIncremental(t *testing.T) {
+	api, client, ix := testSync(t)
+	api.put("1", "Groceries", "- eggs\n")
+	api.put("2", "Trip", "camera\n")
+	api.put("3", "Ideas", "indexer\n")
+	_, err := Sync(context.Background(), client, ix, SyncOptions{})
+	assert.Nil(t, err)
+	mark := api.now
+	api.reset()
+
+	api.put("1", "Groceries", "- eggs\n- bread\n")
+	api.delete("2")
+	api.put("4", "Books", "to read\n")
+	summary, err := Sync(context.Background(), client, ix, SyncOptions{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "include_deleted=true&limit=2&updated_since="+strings.ReplaceAll(mark.Format(time.RFC3339Nano), ":", "%3A"), api.lists[0])
+	// Note 3 was updated at exactly the last mark, so is listed again but not
+	// fetched
+	assert.Equal(t, []string{"1", "4"}, api.fetches)
+	assert.Equal(t, 4, summary.Listed)
+	assert.Equal(t, 1, summary.Added)
+	assert.Equal(t, 1, summary.Updated)
+	assert.Equal(t, 1, summary.Unchanged)
+	assert.Equal(t, 1, summary.Deleted)
+	assert.Equal(t, []string{"notes-api/1", "notes-api/3", "notes-api/4"}, ix.IDs())
+	doc, _ := ix.Get("notes-api/1")
+	assert.Contains(t, doc.Fields["list"], "bread")
+
+	api.reset()
+	summary, err = Sync(context.Background(), client, ix, SyncOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, api.fetches)
+	assert.Equal(t, 1, summary.Unchanged)
+}
+
+func TestSyncByRevision(t *testing.T) {
+	api, client, ix := testSync(t)
+	api.revisions = true
+	api.put("1", "Groceries", "eggs\n")
+	api.put("2", "Trip", "camera\n")
+	_, err := Sync(context.Background(), client, ix, SyncOptions{})
+	assert.Nil(t, err)
+	api.reset()
+
+	api.put("2", "Trip", "camera & tripod\n")
+	summary, err := Sync(context.Background(), client, ix, SyncOptions{})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "include_deleted=true&limit=2&since_revision=2", api.lists[0])
+	assert.Equal(t, []string{"2"}, api.fetches)
+	assert.Equal(t, 1, summary.Updated)
+	assert.Equal(t, int64(3), summary.Since.Revision)
+}
+
+func TestSyncFullDeletesUnlisted(t *testing.T) {
+	api, client, ix := testSync(t)
+	api.tombstones = false
+	api.put("1", "Groceries", "eggs\n")
+	api.put("2", "Trip", "camera\n")
+	other, _ := index.NewDocument("local.md", index.DOC_TYPE_MARKDOWN, []byte("# Local\n"))
+	assert.Nil(t, ix.Put(other))
+	_, err := Sync(context.Background(), client, ix, SyncOptions{})
+	assert.Nil(t, err)
+	api.reset()
+
+	api.delete("2")
+	summary, err := Sync(context.Background(), client, ix, SyncOptions{})
+	assert.Nil(t, err)
+	// Without tombstones an incremental sync can't tell
+	assert.Equal(t, 0, summary.Deleted)
+
+	summary, err = Sync(context.Background(), client, ix, SyncOptions{Full: true})
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, summary.Deleted)
+	assert.Equal(t, 1, summary.Unchanged)
+	assert.Empty(t, api.fetches)
+	assert.Equal(t, []string{"local.md", "notes-api/1"}, ix.IDs())
+}
+
+func TestSyncFailurePartWay(t *testing.T) {
+	api, client, ix := testSync(t)
+	api.put("1", "Groceries", "eggs\n")
+	api.put("2", "Trip", "camera\n")
+	api.put("3", "Ideas", "indexer\n")
+	api.failNote = "3"
+
+	summary, err := Sync(context.Background(), client, ix, SyncOptions{})
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "failed to sync note 3: GET /notes/3/content: 404 Not Found: not found")
+	assert.Equal(t, 2, summary.Added)
+	assert.True(t, summary.Since.IsZero())
+	// What was synced is committed, but not the mark
+	ro, err := index.OpenReadOnly(ix.Dir())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, ro.Len())
+	assert.Equal(t, "", ro.Meta(META_SINCE+DEFAULT_ID_PREFIX))
+
+	api.failNote = ""
+	api.reset()
+	summary, err = Sync(context.Background(), client, ix, SyncOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"3"}, api.fetches)
+	assert.Equal(t, 2, summary.Unchanged)
+}
+
+func TestSyncPassesOverUnparseableNotes(t *testing.T) {
+	api, client, ix := testSync(t)
+	api.put("1", "Groceries", "eggs\n")
+	api.put("2", "Photo", "\xff\xd8\xff\xe0")
+	api.put("3", "", "---\ntitle: Notes: week 3\n---\nindexer\n")
+
+	statuses := []string{}
+	summary, err := Sync(context.Background(), client, ix, SyncOptions{
+		Progress: func(n Note, status string) { statuses = append(statuses, n.ID+" "+status) },
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1 added", "2 failed", "3 added"}, statuses)
+	assert.Equal(t, 1, summary.Failed)
+	if assert.Len(t, summary.Errors, 1) {
+		assert.Equal(t, "failed to index note 2: content isn't UTF-8 text", summary.Errors[0].Error())
+	}
+	if assert.Len(t, summary.Warnings, 1) {
+		assert.Contains(t, summary.Warnings[0], "note 3: invalid yaml front matter")
+	}
+	assert.Equal(t, []string{"notes-api/1", "notes-api/3"}, ix.IDs())
+	// The mark moves past the failed note, so it isn't fetched again until
+	// it changes
+	ro, err := index.OpenReadOnly(ix.Dir())
+	assert.Nil(t, err)
+	since, err := loadSince(ro, DEFAULT_ID_PREFIX)
+	assert.Nil(t, err)
+	assert.Equal(t, api.now, since.UpdatedAt)
+
+	api.reset()
+	summary, err = Sync(context.Background(), client, ix, SyncOptions{})
+	assert.Nil(t, err)
+	assert.Empty(t, api.fetches)
+	assert.Equal(t, 0, summary.Failed)
+}
+
+func TestClientErrors(t *testing.T) {
+	_, client, ix := testSync(t)
+	client.Token = "wrong"
+
+	_, err := Sync(context.Background(), client, ix, SyncOptions{})
+
+	assert.EqualError(t, err, "GET /notes: 401 Unauthorized: unauthorized")
+}
+
+func TestNoteNumericID(t *testing.T) {
+	n := Note{}
+
+	assert.Nil(t, json.Unmarshal([]byte(`{"id": 42, "title": "x", "updated_at": "2024-03-01T09:00:00Z"}`), &n))
+
+	assert.Equal(t, Note{ID: "42", Title: "x", UpdatedAt: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)}, n)
+}
@@ -0,0 +1,595 @@
+package phonetic
+
+import "strings"
+
+const doubleMetaphoneMaxLength int = 4
+
+// DoubleMetaphone returns the primary and alternate Double Metaphone codes
+// for a word, each truncated to four characters. The alternate code differs
+// from the primary one only for words with more than one plausible
+// pronunciation (e.g. "Smith" -> "SM0", "XMT").
+//
+// This follows Lawrence Philips' reference implementation.
+func DoubleMetaphone(word string) (string, string) {
+	dm := newDoubleMetaphone(word)
+	if dm.length == 0 {
+		return "", ""
+	}
+	dm.encode()
+	return truncate(dm.primary.String(), doubleMetaphoneMaxLength), truncate(dm.alternate.String(), doubleMetaphoneMaxLength)
+}
+
+type doubleMetaphone struct {
+	word          []rune
+	length        int
+	last          int
+	slavoGermanic bool
+	primary       strings.Builder
+	alternate     strings.Builder
+}
+
+func newDoubleMetaphone(word string) *doubleMetaphone {
+	w := []rune(strings.ToUpper(strings.TrimSpace(word)))
+	upper := string(w)
+	return &doubleMetaphone{
+		// Padded so that lookahead never runs off the end
+		word:   append(w, []rune("     ")...),
+		length: len(w),
+		last:   len(w) - 1,
+		slavoGermanic: strings.ContainsAny(upper, "WK") ||
+			strings.Contains(upper, "CZ") || strings.Contains(upper, "WITZ"),
+	}
+}
+
+func (dm *doubleMetaphone) add(codes ...string) {
+	main, alt := codes[0], codes[0]
+	if len(codes) > 1 {
+		alt = codes[1]
+	}
+	dm.primary.WriteString(main)
+	dm.alternate.WriteString(alt)
+}
+
+func (dm *doubleMetaphone) at(i int) rune {
+	if i < 0 || i >= len(dm.word) {
+		return 0
+	}
+	return dm.word[i]
+}
+
+// stringAt reports whether any of options occurs at start.
+func (dm *doubleMetaphone) stringAt(start, length int, options ...string) bool {
+	if start < 0 || start+length > len(dm.word) {
+		return false
+	}
+	s := string(dm.word[start : start+length])
+	for _, o := range options {
+		if s == o {
+			return true
+		}
+	}
+	return false
+}
+
+func (dm *doubleMetaphone) isVowel(i int) bool {
+	if i < 0 || i >= dm.length {
+		return false
+	}
+	return strings.ContainsRune("AEIOUY", dm.word[i])
+}
+
+func (dm *doubleMetaphone) isGermanic() bool {
+	return dm.stringAt(0, 4, "VAN ", "VON ") || dm.stringAt(0, 3, "SCH")
+}
+
+func (dm *doubleMetaphone) encode() {
+	current := 0
+
+	// Skip these when at the start of a word
+	if dm.stringAt(0, 2, "GN", "KN", "PN", "WR", "PS") {
+		current++
+	}
+	// Initial 'X' is pronounced 'Z', e.g. "Xavier"
+	if dm.at(0) == 'X' {
+		dm.add("S")
+		current++
+	}
+
+	for (dm.primary.Len() < doubleMetaphoneMaxLength || dm.alternate.Len() < doubleMetaphoneMaxLength) && current < dm.length {
+		switch dm.at(current) {
+		case 'A', 'E', 'I', 'O', 'U', 'Y':
+			// All initial vowels map to 'A'
+			if current == 0 {
+				dm.add("A")
+			}
+			current++
+		case 'B':
+			dm.add("P")
+			current += dm.skipDouble(current, 'B')
+		case 'Ç':
+			dm.add("S")
+			current++
+		case 'C':
+			current = dm.encodeC(current)
+		case 'D':
+			current = dm.encodeD(current)
+		case 'F':
+			dm.add("F")
+			current += dm.skipDouble(current, 'F')
+		case 'G':
+			current = dm.encodeG(current)
+		case 'H':
+			// Only kept if first & before a vowel, or between two vowels
+			if (current == 0 || dm.isVowel(current-1)) && dm.isVowel(current+1) {
+				dm.add("H")
+				current += 2
+			} else {
+				current++
+			}
+		case 'J':
+			current = dm.encodeJ(current)
+		case 'K':
+			dm.add("K")
+			current += dm.skipDouble(current, 'K')
+		case 'L':
+			current = dm.encodeL(current)
+		case 'M':
+			if (dm.stringAt(current-1, 3, "UMB") && (current+1 == dm.last || dm.stringAt(current+2, 2, "ER"))) || dm.at(current+1) == 'M' {
+				current += 2
+			} else {
+				current++
+			}
+			dm.add("M")
+		case 'N':
+			dm.add("N")
+			current += dm.skipDouble(current, 'N')
+		case 'Ñ':
+			dm.add("N")
+			current++
+		case 'P':
+			if dm.at(current+1) == 'H' {
+				dm.add("F")
+				current += 2
+				break
+			}
+			// Also accounts for "campbell" & "raspberry"
+			if dm.stringAt(current+1, 1, "P", "B") {
+				current += 2
+			} else {
+				current++
+			}
+			dm.add("P")
+		case 'Q':
+			dm.add("K")
+			current += dm.skipDouble(current, 'Q')
+		case 'R':
+			// French, e.g. "rogier", but not "hochmeier"
+			if current == dm.last && !dm.slavoGermanic && dm.stringAt(current-2, 2, "IE") && !dm.stringAt(current-4, 2, "ME", "MA") {
+				dm.add("", "R")
+			} else {
+				dm.add("R")
+			}
+			current += dm.skipDouble(current, 'R')
+		case 'S':
+			current = dm.encodeS(current)
+		case 'T':
+			current = dm.encodeT(current)
+		case 'V':
+			dm.add("F")
+			current += dm.skipDouble(current, 'V')
+		case 'W':
+			current = dm.encodeW(current)
+		case 'X':
+			// French, e.g. "breaux"
+			if !(current == dm.last && (dm.stringAt(current-3, 3, "IAU", "EAU") || dm.stringAt(current-2, 2, "AU", "OU"))) {
+				dm.add("KS")
+			}
+			if dm.stringAt(current+1, 1, "C", "X") {
+				current += 2
+			} else {
+				current++
+			}
+		case 'Z':
+			current = dm.encodeZ(current)
+		default:
+			current++
+		}
+	}
+}
+
+func (dm *doubleMetaphone) skipDouble(current int, c rune) int {
+	if dm.at(current+1) == c {
+		return 2
+	}
+	return 1
+}
+
+func (dm *doubleMetaphone) encodeC(current int) int {
+	// Various Germanic
+	if current > 1 && !dm.isVowel(current-2) && dm.stringAt(current-1, 3, "ACH") &&
+		dm.at(current+2) != 'I' && (dm.at(current+2) != 'E' || dm.stringAt(current-2, 6, "BACHER", "MACHER")) {
+		dm.add("K")
+		return current + 2
+	}
+	// Special case "caesar"
+	if current == 0 && dm.stringAt(current, 6, "CAESAR") {
+		dm.add("S")
+		return current + 2
+	}
+	// Italian "chianti"
+	if dm.stringAt(current, 4, "CHIA") {
+		dm.add("K")
+		return current + 2
+	}
+	if dm.stringAt(current, 2, "CH") {
+		// "michael"
+		if current > 0 && dm.stringAt(current, 4, "CHAE") {
+			dm.add("K", "X")
+			return current + 2
+		}
+		// Greek roots, e.g. "chemistry", "chorus"
+		if current == 0 && (dm.stringAt(current+1, 5, "HARAC", "HARIS") || dm.stringAt(current+1, 3, "HOR", "HYM", "HIA", "HEM")) &&
+			!dm.stringAt(0, 5, "CHORE") {
+			dm.add("K")
+			return current + 2
+		}
+		// Germanic, Greek, or otherwise "ch" for a "kh" sound
+		if dm.isGermanic() ||
+			// "architect" but not "arch", "orchestra", "orchid"
+			dm.stringAt(current-2, 6, "ORCHES", "ARCHIT", "ORCHID") ||
+			dm.stringAt(current+2, 1, "T", "S") ||
+			((dm.stringAt(current-1, 1, "A", "O", "U", "E") || current == 0) &&
+				// e.g. "wachtler", "wechsler", but not "tichner"
+				dm.stringAt(current+2, 1, "L", "R", "N", "M", "B", "H", "F", "V", "W", " ")) {
+			dm.add("K")
+		} else if current > 0 {
+			if dm.stringAt(0, 2, "MC") {
+				// e.g. "McHugh"
+				dm.add("K")
+			} else {
+				dm.add("X", "K")
+			}
+		} else {
+			dm.add("X")
+		}
+		return current + 2
+	}
+	// e.g. "czerny"
+	if dm.stringAt(current, 2, "CZ") && !dm.stringAt(current-2, 4, "WICZ") {
+		dm.add("S", "X")
+		return current + 2
+	}
+	// e.g. "focaccia"
+	if dm.stringAt(current+1, 3, "CIA") {
+		dm.add("X")
+		return current + 3
+	}
+	// Double 'C', but not e.g. "McClellan"
+	if dm.stringAt(current, 2, "CC") && !(current == 1 && dm.at(0) == 'M') {
+		// "bellocchio" but not "bacchus"
+		if dm.stringAt(current+2, 1, "I", "E", "H") && !dm.stringAt(current+2, 2, "HU") {
+			if (current == 1 && dm.at(current-1) == 'A') || dm.stringAt(current-1, 5, "UCCEE", "UCCES") {
+				// "accident", "accede", "succeed"
+				dm.add("KS")
+			} else {
+				// "bacci", "bertucci", other Italian
+				dm.add("X")
+			}
+			return current + 3
+		}
+		// Pierce's rule
+		dm.add("K")
+		return current + 2
+	}
+	if dm.stringAt(current, 2, "CK", "CG", "CQ") {
+		dm.add("K")
+		return current + 2
+	}
+	if dm.stringAt(current, 2, "CI", "CE", "CY") {
+		// Italian vs. English
+		if dm.stringAt(current, 3, "CIO", "CIE", "CIA") {
+			dm.add("S", "X")
+		} else {
+			dm.add("S")
+		}
+		return current + 2
+	}
+
+	dm.add("K")
+	// Names like "mac caffrey", "mac gregor"
+	if dm.stringAt(current+1, 2, " C", " Q", " G") {
+		return current + 3
+	}
+	if dm.stringAt(current+1, 1, "C", "K", "Q") && !dm.stringAt(current+1, 2, "CE", "CI") {
+		return current + 2
+	}
+	return current + 1
+}
+
+func (dm *doubleMetaphone) encodeD(current int) int {
+	if dm.stringAt(current, 2, "DG") {
+		if dm.stringAt(current+2, 1, "I", "E", "Y") {
+			// e.g. "edge"
+			dm.add("J")
+			return current + 3
+		}
+		// e.g. "edgar"
+		dm.add("TK")
+		return current + 2
+	}
+	dm.add("T")
+	if dm.stringAt(current, 2, "DT", "DD") {
+		return current + 2
+	}
+	return current + 1
+}
+
+func (dm *doubleMetaphone) encodeG(current int) int {
+	if dm.at(current+1) == 'H' {
+		if current > 0 && !dm.isVowel(current-1) {
+			dm.add("K")
+			return current + 2
+		}
+		// "ghislane", "ghiradelli"
+		if current == 0 {
+			if dm.at(current+2) == 'I' {
+				dm.add("J")
+			} else {
+				dm.add("K")
+			}
+			return current + 2
+		}
+		// Parker's rule (with some further refinements), e.g. "hugh", "bough", "broughton"
+		if (current > 1 && dm.stringAt(current-2, 1, "B", "H", "D")) ||
+			(current > 2 && dm.stringAt(current-3, 1, "B", "H", "D")) ||
+			(current > 3 && dm.stringAt(current-4, 1, "B", "H")) {
+			return current + 2
+		}
+		// e.g. "laugh", "McLaughlin", "cough", "gough", "rough", "tough"
+		if current > 2 && dm.at(current-1) == 'U' && dm.stringAt(current-3, 1, "C", "G", "L", "R", "T") {
+			dm.add("F")
+		} else if current > 0 && dm.at(current-1) != 'I' {
+			dm.add("K")
+		}
+		return current + 2
+	}
+
+	if dm.at(current+1) == 'N' {
+		if current == 1 && dm.isVowel(0) && !dm.slavoGermanic {
+			dm.add("KN", "N")
+		} else if !dm.stringAt(current+2, 2, "EY") && dm.at(current+1) != 'Y' && !dm.slavoGermanic {
+			// Not e.g. "cagney"
+			dm.add("N", "KN")
+		} else {
+			dm.add("KN")
+		}
+		return current + 2
+	}
+	// "tagliaro"
+	if dm.stringAt(current+1, 2, "LI") && !dm.slavoGermanic {
+		dm.add("KL", "L")
+		return current + 2
+	}
+	// -ges-, -gep-, -gel-, -gie- at the beginning
+	if current == 0 && (dm.at(current+1) == 'Y' ||
+		dm.stringAt(current+1, 2, "ES", "EP", "EB", "EL", "EY", "IB", "IL", "IN", "IE", "EI", "ER")) {
+		dm.add("K", "J")
+		return current + 2
+	}
+	// -ger-, -gy-
+	if (dm.stringAt(current+1, 2, "ER") || dm.at(current+1) == 'Y') &&
+		!dm.stringAt(0, 6, "DANGER", "RANGER", "MANGER") &&
+		!dm.stringAt(current-1, 1, "E", "I") && !dm.stringAt(current-1, 3, "RGY", "OGY") {
+		dm.add("K", "J")
+		return current + 2
+	}
+	// Italian, e.g. "biaggi"
+	if dm.stringAt(current+1, 1, "E", "I", "Y") || dm.stringAt(current-1, 4, "AGGI", "OGGI") {
+		if dm.isGermanic() || dm.stringAt(current+1, 2, "ET") {
+			// Obviously Germanic
+			dm.add("K")
+		} else if dm.stringAt(current+1, 4, "IER ") {
+			// Always soft with a French ending
+			dm.add("J")
+		} else {
+			dm.add("J", "K")
+		}
+		return current + 2
+	}
+
+	dm.add("K")
+	return current + dm.skipDouble(current, 'G')
+}
+
+func (dm *doubleMetaphone) encodeJ(current int) int {
+	// Obviously Spanish, "jose", "san jacinto"
+	if dm.stringAt(current, 4, "JOSE") || dm.stringAt(0, 4, "SAN ") {
+		if (current == 0 && dm.at(current+4) == ' ') || dm.stringAt(0, 4, "SAN ") {
+			dm.add("H")
+		} else {
+			dm.add("J", "H")
+		}
+		return current + 1
+	}
+
+	if current == 0 {
+		// "Yankelovich"/"Jankelowicz"
+		dm.add("J", "A")
+	} else if dm.isVowel(current-1) && !dm.slavoGermanic && (dm.at(current+1) == 'A' || dm.at(current+1) == 'O') {
+		// Spanish pronunciation of e.g. "bajador"
+		dm.add("J", "H")
+	} else if current == dm.last {
+		dm.add("J", "")
+	} else if !dm.stringAt(current+1, 1, "L", "T", "K", "S", "N", "M", "B", "Z") && !dm.stringAt(current-1, 1, "S", "K", "L") {
+		dm.add("J")
+	}
+	return current + dm.skipDouble(current, 'J')
+}
+
+func (dm *doubleMetaphone) encodeL(current int) int {
+	if dm.at(current+1) == 'L' {
+		// Spanish, e.g. "cabrillo", "gallegos"
+		if (current == dm.length-3 && dm.stringAt(current-1, 4, "ILLO", "ILLA", "ALLE")) ||
+			((dm.stringAt(dm.last-1, 2, "AS", "OS") || dm.stringAt(dm.last, 1, "A", "O")) && dm.stringAt(current-1, 4, "ALLE")) {
+			dm.add("L", "")
+			return current + 2
+		}
+		dm.add("L")
+		return current + 2
+	}
+	dm.add("L")
+	return current + 1
+}
+
+func (dm *doubleMetaphone) encodeS(current int) int {
+	// Special cases "island", "isle", "carlisle", "carlysle"
+	if dm.stringAt(current-1, 3, "ISL", "YSL") {
+		return current + 1
+	}
+	// Special case "sugar-"
+	if current == 0 && dm.stringAt(current, 5, "SUGAR") {
+		dm.add("X", "S")
+		return current + 1
+	}
+	if dm.stringAt(current, 2, "SH") {
+		if dm.stringAt(current+1, 4, "HEIM", "HOEK", "HOLM", "HOLZ") {
+			// Germanic
+			dm.add("S")
+		} else {
+			dm.add("X")
+		}
+		return current + 2
+	}
+	// Italian & Armenian
+	if dm.stringAt(current, 3, "SIO", "SIA") || dm.stringAt(current, 4, "SIAN") {
+		if !dm.slavoGermanic {
+			dm.add("S", "X")
+		} else {
+			dm.add("S")
+		}
+		return current + 3
+	}
+	// German & anglicisations, e.g. "smith" matches "schmidt", "snider"
+	// matches "schneider". Also -sz- in Slavic languages, although in
+	// Hungarian it's pronounced 's'.
+	if (current == 0 && dm.stringAt(current+1, 1, "M", "N", "L", "W")) || dm.stringAt(current+1, 1, "Z") {
+		dm.add("S", "X")
+		if dm.stringAt(current+1, 1, "Z") {
+			return current + 2
+		}
+		return current + 1
+	}
+	if dm.stringAt(current, 2, "SC") {
+		// Schlesinger's rule
+		if dm.at(current+2) == 'H' {
+			// Dutch origin, e.g. "school", "schooner"
+			if dm.stringAt(current+3, 2, "OO", "ER", "EN", "UY", "ED", "EM") {
+				// "schermerhorn", "schenker"
+				if dm.stringAt(current+3, 2, "ER", "EN") {
+					dm.add("X", "SK")
+				} else {
+					dm.add("SK")
+				}
+				return current + 3
+			}
+			if current == 0 && !dm.isVowel(3) && dm.at(3) != 'W' {
+				dm.add("X", "S")
+			} else {
+				dm.add("X")
+			}
+			return current + 3
+		}
+		if dm.stringAt(current+2, 1, "I", "E", "Y") {
+			dm.add("S")
+			return current + 3
+		}
+		dm.add("SK")
+		return current + 3
+	}
+
+	// French, e.g. "resnais", "artois"
+	if current == dm.last && dm.stringAt(current-2, 2, "AI", "OI") {
+		dm.add("", "S")
+	} else {
+		dm.add("S")
+	}
+	if dm.stringAt(current+1, 1, "S", "Z") {
+		return current + 2
+	}
+	return current + 1
+}
+
+func (dm *doubleMetaphone) encodeT(current int) int {
+	if dm.stringAt(current, 4, "TION") {
+		dm.add("X")
+		return current + 3
+	}
+	if dm.stringAt(current, 3, "TIA", "TCH") {
+		dm.add("X")
+		return current + 3
+	}
+	if dm.stringAt(current, 2, "TH") || dm.stringAt(current, 3, "TTH") {
+		// Special case "thomas", "thames", or Germanic
+		if dm.stringAt(current+2, 2, "OM", "AM") || dm.isGermanic() {
+			dm.add("T")
+		} else {
+			dm.add("0", "T")
+		}
+		return current + 2
+	}
+	dm.add("T")
+	if dm.stringAt(current+1, 1, "T", "D") {
+		return current + 2
+	}
+	return current + 1
+}
+
+func (dm *doubleMetaphone) encodeW(current int) int {
+	// Can also be in the middle of a word
+	if dm.stringAt(current, 2, "WR") {
+		dm.add("R")
+		return current + 2
+	}
+	if current == 0 && (dm.isVowel(current+1) || dm.stringAt(current, 2, "WH")) {
+		if dm.isVowel(current + 1) {
+			// "Wasserman" should match "Vasserman"
+			dm.add("A", "F")
+		} else {
+			// Need "Uomo" to match "Womo"
+			dm.add("A")
+		}
+	}
+	// "Arnow" should match "Arnoff"
+	if (current == dm.last && dm.isVowel(current-1)) ||
+		dm.stringAt(current-1, 5, "EWSKI", "EWSKY", "OWSKI", "OWSKY") || dm.stringAt(0, 3, "SCH") {
+		dm.add("", "F")
+		return current + 1
+	}
+	// Polish, e.g. "filipowicz"
+	if dm.stringAt(current, 4, "WICZ", "WITZ") {
+		dm.add("TS", "FX")
+		return current + 4
+	}
+	return current + 1
+}
+
+func (dm *doubleMetaphone) encodeZ(current int) int {
+	// Chinese pinyin, e.g. "zhao"
+	if dm.at(current+1) == 'H' {
+		dm.add("J")
+		return current + 2
+	}
+	if dm.stringAt(current+1, 2, "ZO", "ZI", "ZA") || (dm.slavoGermanic && current > 0 && dm.at(current-1) != 'T') {
+		dm.add("S", "TS")
+	} else {
+		dm.add("S")
+	}
+	return current + dm.skipDouble(current, 'Z')
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,151 @@
+package phonetic
+
+import "strings"
+
+const (
+	metaphoneMaxLength int = 4
+
+	frontVowels string = "EIY"
+
+	// Letters after which an H is silent (as part of CH, SH, PH, TH & GH)
+	varson string = "CSPTG"
+)
+
+// Metaphone returns Lawrence Philips' original Metaphone code for a word,
+// truncated to four characters. '0' stands for "th".
+func Metaphone(word string) string {
+	w := asciiLetters(word)
+
+	// Initial letter exceptions, which apply to one-letter words too
+	switch {
+	case strings.HasPrefix(w, "KN"), strings.HasPrefix(w, "GN"), strings.HasPrefix(w, "PN"):
+		w = w[1:]
+	case strings.HasPrefix(w, "AE"), strings.HasPrefix(w, "WR"):
+		w = w[1:]
+	case strings.HasPrefix(w, "WH"):
+		w = "W" + w[2:]
+	case strings.HasPrefix(w, "X"):
+		w = "S" + w[1:]
+	}
+
+	n := len(w)
+	at := func(i int) byte {
+		if i < 0 || i >= n {
+			return 0
+		}
+		return w[i]
+	}
+	vowelAt := func(i int) bool { return isVowel(at(i)) }
+	frontVowelAt := func(i int) bool { return at(i) != 0 && strings.IndexByte(frontVowels, at(i)) >= 0 }
+	matches := func(i int, s string) bool { return strings.HasPrefix(w[i:], s) }
+
+	var code strings.Builder
+	for i := 0; i < n && code.Len() < metaphoneMaxLength; i++ {
+		c := w[i]
+		// Duplicate letters are skipped, except for C
+		if c != 'C' && at(i-1) == c {
+			continue
+		}
+
+		switch c {
+		case 'A', 'E', 'I', 'O', 'U':
+			if i == 0 {
+				code.WriteByte(c)
+			}
+		case 'B':
+			// Silent in a trailing "MB"
+			if !(at(i-1) == 'M' && i == n-1) {
+				code.WriteByte('B')
+			}
+		case 'C':
+			switch {
+			case at(i-1) == 'S' && frontVowelAt(i+1):
+				// Silent in SCI, SCE & SCY
+			case matches(i, "CIA"):
+				code.WriteByte('X')
+			case frontVowelAt(i + 1):
+				code.WriteByte('S')
+			case at(i-1) == 'S' && at(i+1) == 'H':
+				code.WriteByte('K')
+			case at(i+1) == 'H':
+				if i == 0 && n >= 3 && vowelAt(2) {
+					code.WriteByte('K')
+				} else {
+					code.WriteByte('X')
+				}
+			default:
+				code.WriteByte('K')
+			}
+		case 'D':
+			if at(i+1) == 'G' && frontVowelAt(i+2) {
+				code.WriteByte('J')
+				i += 2
+			} else {
+				code.WriteByte('T')
+			}
+		case 'G':
+			switch {
+			case at(i+1) == 'H' && i+2 == n:
+				// Silent in a trailing GH
+			case at(i+1) == 'H' && i+2 < n && !vowelAt(i+2):
+				// ... or a GH before a consonant
+			case i > 0 && (matches(i, "GN") || matches(i, "GNED")):
+			case frontVowelAt(i + 1):
+				code.WriteByte('J')
+			default:
+				code.WriteByte('K')
+			}
+		case 'H':
+			if i < n-1 && !(i > 0 && strings.IndexByte(varson, at(i-1)) >= 0) && vowelAt(i+1) {
+				code.WriteByte('H')
+			}
+		case 'F', 'J', 'L', 'M', 'N', 'R':
+			code.WriteByte(c)
+		case 'K':
+			if at(i-1) != 'C' {
+				code.WriteByte('K')
+			}
+		case 'P':
+			if at(i+1) == 'H' {
+				code.WriteByte('F')
+			} else {
+				code.WriteByte('P')
+			}
+		case 'Q':
+			code.WriteByte('K')
+		case 'S':
+			if matches(i, "SH") || matches(i, "SIO") || matches(i, "SIA") {
+				code.WriteByte('X')
+			} else {
+				code.WriteByte('S')
+			}
+		case 'T':
+			switch {
+			case matches(i, "TIA") || matches(i, "TIO"):
+				code.WriteByte('X')
+			case matches(i, "TCH"):
+				// Silent
+			case matches(i, "TH"):
+				code.WriteByte('0')
+			default:
+				code.WriteByte('T')
+			}
+		case 'V':
+			code.WriteByte('F')
+		case 'W', 'Y':
+			if vowelAt(i + 1) {
+				code.WriteByte(c)
+			}
+		case 'X':
+			code.WriteString("KS")
+		case 'Z':
+			code.WriteByte('S')
+		}
+	}
+
+	s := code.String()
+	if len(s) > metaphoneMaxLength {
+		s = s[:metaphoneMaxLength]
+	}
+	return s
+}
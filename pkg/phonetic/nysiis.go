@@ -0,0 +1,97 @@
+package phonetic
+
+import "strings"
+
+// NYSIIS returns the New York State Identification and Intelligence System
+// code for a name, e.g. "Macintosh" -> "MCANT". The code isn't truncated; use
+// NYSIISN for the traditional six-character limit.
+func NYSIIS(name string) string {
+	w := asciiLetters(name)
+	if w == "" {
+		return ""
+	}
+
+	// Translate the first characters of the name
+	for _, r := range [][2]string{{"MAC", "MCC"}, {"KN", "NN"}, {"K", "C"}, {"PH", "FF"}, {"PF", "FF"}, {"SCH", "SSS"}} {
+		if strings.HasPrefix(w, r[0]) {
+			w = r[1] + w[len(r[0]):]
+			break
+		}
+	}
+	// ... and the last characters
+	for _, r := range [][2]string{{"EE", "Y"}, {"IE", "Y"}, {"DT", "D"}, {"RT", "D"}, {"RD", "D"}, {"NT", "D"}, {"ND", "D"}} {
+		if strings.HasSuffix(w, r[0]) {
+			w = w[:len(w)-len(r[0])] + r[1]
+			break
+		}
+	}
+
+	chars := []byte(w)
+	at := func(i int) byte {
+		if i >= len(chars) {
+			return ' '
+		}
+		return chars[i]
+	}
+
+	key := []byte{chars[0]}
+	for i := 1; i < len(chars); i++ {
+		// Transcoding may rewrite the following characters too (e.g. SCH ->
+		// SSS), which later iterations then see
+		copy(chars[i:], nysiisTranscode(chars[i-1], chars[i], at(i+1), at(i+2)))
+		if chars[i] != chars[i-1] {
+			key = append(key, chars[i])
+		}
+	}
+
+	if len(key) > 1 {
+		if key[len(key)-1] == 'S' {
+			key = key[:len(key)-1]
+		}
+		if len(key) > 2 && key[len(key)-2] == 'A' && key[len(key)-1] == 'Y' {
+			key = append(key[:len(key)-2], 'Y')
+		}
+		if key[len(key)-1] == 'A' {
+			key = key[:len(key)-1]
+		}
+	}
+	return string(key)
+}
+
+// NYSIISN returns the NYSIIS code truncated to n characters.
+func NYSIISN(name string, n int) string {
+	code := NYSIIS(name)
+	if len(code) > n {
+		return code[:n]
+	}
+	return code
+}
+
+func nysiisTranscode(prev, cur, next, afterNext byte) []byte {
+	switch {
+	case cur == 'E' && next == 'V':
+		return []byte("AF")
+	case isVowel(cur):
+		return []byte("A")
+	case cur == 'Q':
+		return []byte("G")
+	case cur == 'Z':
+		return []byte("S")
+	case cur == 'M':
+		return []byte("N")
+	case cur == 'K' && next == 'N':
+		return []byte("NN")
+	case cur == 'K':
+		return []byte("C")
+	case cur == 'S' && next == 'C' && afterNext == 'H':
+		return []byte("SSS")
+	case cur == 'P' && next == 'H':
+		return []byte("FF")
+	case cur == 'H' && (!isVowel(prev) || !isVowel(next)):
+		return []byte{prev}
+	case cur == 'W' && isVowel(prev):
+		return []byte{prev}
+	default:
+		return []byte{cur}
+	}
+}
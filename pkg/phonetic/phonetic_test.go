@@ -0,0 +1,161 @@
+package phonetic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSoundex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Robert", "R163"},
+		{"Rupert", "R163"},
+		{"Rubin", "R150"},
+		{"Ashcraft", "A261"}, // 'H' doesn't separate S & C
+		{"Ashcroft", "A261"},
+		{"Tymczak", "T522"}, // vowels do separate Z & K
+		{"Pfister", "P236"}, // P & F share a code with the first letter
+		{"Honeyman", "H555"},
+		{"Lee", "L000"},
+		{"Shanahan", "S550"},
+		{"Shannahan", "S550"},
+		{"o'brien", "O165"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			assert.Equal(t, test.expected, Soundex(test.input))
+		})
+	}
+}
+
+func TestMetaphone(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"howl", "HL"},
+		{"testing", "TSTN"},
+		{"The", "0"},
+		{"quick", "KK"},
+		{"brown", "BRN"},
+		{"fox", "FKS"},
+		{"jumped", "JMPT"},
+		{"over", "OFR"},
+		{"lazy", "LS"},
+		{"dogs", "TKS"},
+		{"Wright", "RT"},
+		{"Knight", "NT"},
+		{"White", "WT"},
+		{"Shanahan", "XNHN"},
+		{"Shannahan", "XNHN"},
+		{"x", "S"},
+		{"Xavier", "SFR"},
+		{"a", "A"},
+		{"b", "B"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			assert.Equal(t, test.expected, Metaphone(test.input))
+		})
+	}
+}
+
+func TestDoubleMetaphone(t *testing.T) {
+	tests := []struct {
+		input     string
+		primary   string
+		alternate string
+	}{
+		{"Smith", "SM0", "XMT"},
+		{"Schmidt", "XMT", "SMT"},
+		{"Jose", "HS", "HS"},
+		{"Xavier", "SF", "SFR"},
+		{"Michael", "MKL", "MXL"},
+		{"Caesar", "SSR", "SSR"},
+		{"Zhao", "J", "J"},
+		{"Dumb", "TM", "TM"},
+		{"Edge", "AJ", "AJ"},
+		{"Edgar", "ATKR", "ATKR"},
+		{"Filipowicz", "FLPT", "FLPF"},
+		{"Campbell", "KMPL", "KMPL"},
+		{"Raspberry", "RSPR", "RSPR"},
+		{"Orchestra", "ARKS", "ARKS"},
+		{"Chemistry", "KMST", "KMST"},
+		{"Wright", "RT", "RT"},
+		{"McHugh", "MK", "MK"},
+		{"Jankelowicz", "JNKL", "ANKL"},
+		{"Cabrillo", "KPRL", "KPR"},
+		{"Tagliaro", "TKLR", "TLR"},
+		{"Bacchus", "PKS", "PKS"},
+		{"Gallegos", "KLKS", "KKS"},
+		{"Womo", "AM", "FM"},
+		{"Arnow", "ARN", "ARNF"},
+		{"Ghislane", "JLN", "JLN"},
+		{"Laugh", "LF", "LF"},
+		{"Czerny", "SRN", "XRN"},
+		{"Schenker", "XNKR", "SKNK"},
+		{"Breaux", "PR", "PR"},
+		{"Shanahan", "XNHN", "XNHN"},
+		{"Shannahan", "XNHN", "XNHN"},
+		{"", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			primary, alternate := DoubleMetaphone(test.input)
+			assert.Equal(t, test.primary, primary)
+			assert.Equal(t, test.alternate, alternate)
+		})
+	}
+}
+
+func TestNYSIIS(t *testing.T) {
+	tests := []struct {
+		inputs   []string
+		expected string
+	}{
+		{[]string{"Brian", "Brown", "Brun"}, "BRAN"},
+		{[]string{"Capp", "Cope", "Copp", "Kipp"}, "CAP"},
+		{[]string{"Dane", "Dean", "Dionne"}, "DAN"},
+		{[]string{"Smith", "Schmit"}, "SNAT"},
+		{[]string{"Schmidt"}, "SNAD"},
+		{[]string{"Trueman", "Truman"}, "TRANAN"},
+		{[]string{"Kobwick"}, "CABWAC"},
+		{[]string{"Kocher"}, "CACAR"},
+		{[]string{"Fesca"}, "FASC"},
+		{[]string{"Shom"}, "SAN"},
+		{[]string{"Ohlo"}, "OL"},
+		{[]string{"Uhu"}, "UH"},
+		{[]string{"Um"}, "UN"},
+		{[]string{"Macintosh"}, "MCANT"},
+		{[]string{"Knuth"}, "NAT"},
+		{[]string{"Koehn"}, "CAN"},
+		{[]string{"Phillipson"}, "FALAPSAN"},
+		{[]string{"Pfeister"}, "FASTAR"},
+		{[]string{"Schoenhoeft"}, "SANAFT"},
+		{[]string{"McKee", "Mackie"}, "MCY"},
+		{[]string{"Heitschmidt"}, "HATSNAD"},
+		{[]string{"Bart"}, "BAD"},
+		{[]string{"Hurd", "Hunt"}, "HAD"},
+		{[]string{"Westerlund"}, "WASTARLAD"},
+		{[]string{"Everett"}, "EVARAT"},
+		{[]string{"Shanahan", "Shannahan"}, "SANAHAN"},
+		{[]string{""}, ""},
+	}
+
+	for _, test := range tests {
+		for _, input := range test.inputs {
+			t.Run(input, func(t *testing.T) {
+				assert.Equal(t, test.expected, NYSIIS(input))
+			})
+		}
+	}
+	assert.Equal(t, "WASTAR", NYSIISN("Westerlund", 6))
+}
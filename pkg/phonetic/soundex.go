@@ -0,0 +1,46 @@
+package phonetic
+
+import "strings"
+
+// Soundex codes for A-Z. '0' marks letters that aren't coded: vowels, plus
+// H, W & Y.
+const soundexCodes string = "01230120022455012623010202"
+
+// Soundex returns the American Soundex code of a word: its first letter
+// followed by three digits, e.g. "Robert" -> "R163". Non-letters are ignored.
+func Soundex(word string) string {
+	letters := asciiLetters(word)
+	if letters == "" {
+		return ""
+	}
+
+	code := []byte{letters[0]}
+	last := soundexCodes[letters[0]-'A']
+	for i := 1; i < len(letters) && len(code) < 4; i++ {
+		c := letters[i]
+		d := soundexCodes[c-'A']
+		if d != '0' && d != last {
+			code = append(code, d)
+		}
+		// H & W don't separate letters with the same code, but vowels do
+		if c != 'H' && c != 'W' {
+			last = d
+		}
+	}
+	return string(code) + strings.Repeat("0", 4-len(code))
+}
+
+// Uppercases the word and drops anything that isn't an ASCII letter.
+func asciiLetters(word string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(word) {
+		if r >= 'A' && r <= 'Z' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func isVowel(c byte) bool {
+	return c == 'A' || c == 'E' || c == 'I' || c == 'O' || c == 'U'
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"time"
+
+	"mrshanahan.com/notes-indexer/pkg/index"
+)
+
+// SearchHit is a search hit as it's returned, by the API & the search
+// command alike.
+type SearchHit struct {
+	Rank        int                 `json:"rank"`
+	Score       float64             `json:"score"`
+	Path        string              `json:"path"`
+	Title       string              `json:"title"`
+	Type        string              `json:"type"`
+	Tags        []string            `json:"tags"`
+	ModTime     time.Time           `json:"mod_time"`
+	Snippet     index.Snippet       `json:"snippet"`
+	Matches     map[string][]string `json:"matches"`
+	Explanation *index.Explanation  `json:"explanation,omitempty"`
+}
+
+type SearchResponse struct {
+	Query  string      `json:"query"`
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	TookMS float64     `json:"took_ms"`
+	Hits   []SearchHit `json:"hits"`
+}
+
+// NewSearchResponse builds the response to a search, with a snippet of each
+// hit.
+func NewSearchResponse(ix *index.Index, query string, offset int, result index.SearchResult) SearchResponse {
+	response := SearchResponse{
+		Query:  query,
+		Total:  result.Total,
+		Offset: offset,
+		TookMS: float64(result.Took.Microseconds()) / 1000,
+		Hits:   []SearchHit{},
+	}
+	for i, h := range result.Hits {
+		response.Hits = append(response.Hits, SearchHit{
+			Rank:        offset + i + 1,
+			Score:       h.Score,
+			Path:        h.ID,
+			Title:       h.Doc.Title,
+			Type:        h.Doc.Type,
+			Tags:        h.Doc.Tags,
+			ModTime:     h.Doc.ModTime,
+			Snippet:     ix.Snippet(h, index.DEFAULT_SNIPPET_SIZE),
+			Matches:     h.Matches,
+			Explanation: h.Explanation,
+		})
+	}
+	return response
+}
@@ -0,0 +1,364 @@
+// Package server serves an index over HTTP, as a JSON API:
+//
+//	GET    /notes/{id}   the document with the given ID
+//	PUT    /notes/{id}   add or replace a note, given {"content": ..., "type": ...}
+//	DELETE /notes/{id}   delete a note
+//	GET    /search       search with a query string: ?q=...&limit=&offset=&fields=&explain=
+//	POST   /search       search with a SearchRequest, e.g. to use the JSON query DSL
+//	GET    /suggest      complete a search: ?prefix=...&limit=
+//	GET    /stats        what's in the index
+//
+// IDs can have slashes in them, as paths do. Errors are returned as
+// {"error": ...} with a 4xx or 5xx status.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mrshanahan.com/notes-indexer/pkg/index"
+)
+
+const (
+	DEFAULT_REQUEST_TIMEOUT  time.Duration = 10 * time.Second
+	DEFAULT_SHUTDOWN_TIMEOUT time.Duration = 10 * time.Second
+	DEFAULT_MAX_BODY         int64         = 10 << 20
+	DEFAULT_LIMIT            int           = 10
+)
+
+type Options struct {
+	// How long a request has to be handled in, read & written in. Zero means
+	// DEFAULT_REQUEST_TIMEOUT.
+	RequestTimeout time.Duration
+
+	// How long to wait for requests to finish when shutting down. Zero means
+	// DEFAULT_SHUTDOWN_TIMEOUT.
+	ShutdownTimeout time.Duration
+
+	// The most a request's body can be, in bytes. Zero means
+	// DEFAULT_MAX_BODY.
+	MaxBody int64
+
+	// How searches are scored, as in index.SearchOptions
+	BM25   index.BM25
+	Boosts map[string]float64
+
+	// Where to log errors, if anywhere
+	Logger *log.Logger
+}
+
+// Server handles requests against an index, which it has to be able to write
+// to. Each change is committed before it's responded to, so is durable once
+// acknowledged. It's safe for concurrent use, as the index is.
+type Server struct {
+	ix      *index.Index
+	opts    Options
+	handler http.Handler
+}
+
+func New(ix *index.Index, opts Options) *Server {
+	if opts.RequestTimeout == 0 {
+		opts.RequestTimeout = DEFAULT_REQUEST_TIMEOUT
+	}
+	if opts.ShutdownTimeout == 0 {
+		opts.ShutdownTimeout = DEFAULT_SHUTDOWN_TIMEOUT
+	}
+	if opts.MaxBody == 0 {
+		opts.MaxBody = DEFAULT_MAX_BODY
+	}
+	s := &Server{ix: ix, opts: opts}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/notes/", s.handleNote)
+	mux.HandleFunc("/search", s.handleSearch)
+	mux.HandleFunc("/suggest", s.handleSuggest)
+	mux.HandleFunc("/stats", s.handleStats)
+	s.handler = http.TimeoutHandler(mux, opts.RequestTimeout, `{"error":"request timed out"}`)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.opts.MaxBody)
+	s.handler.ServeHTTP(w, r)
+}
+
+// Serve handles requests on l until ctx is done, then waits for those in
+// progress to finish (up to Options.ShutdownTimeout) before returning.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	srv := &http.Server{
+		Handler:           s,
+		ReadHeaderTimeout: s.opts.RequestTimeout,
+		ReadTimeout:       s.opts.RequestTimeout,
+		// Long enough for the handler to time out & say so first
+		WriteTimeout: s.opts.RequestTimeout + time.Second,
+		IdleTimeout:  2 * s.opts.RequestTimeout,
+		ErrorLog:     s.opts.Logger,
+	}
+	errs := make(chan error, 1)
+	go func() { errs <- srv.Serve(l) }()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.opts.ShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// NoteRequest is the body of a request to add or replace a note. Without a
+// Type, it's worked out from the note's ID & content, and defaults to
+// markdown.
+type NoteRequest struct {
+	Content string    `json:"content"`
+	Type    string    `json:"type,omitempty"`
+	ModTime time.Time `json:"mod_time,omitempty"`
+}
+
+type NoteResponse struct {
+	ID      string `json:"id"`
+	Created bool   `json:"created"`
+
+	// Problems with the note that didn't stop it being indexed
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func (s *Server) handleNote(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/notes/")
+	if id == "" {
+		s.writeError(w, http.StatusNotFound, "missing note ID")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		doc, ok := s.ix.Get(id)
+		if !ok {
+			s.writeError(w, http.StatusNotFound, fmt.Sprintf("no note %s", id))
+			return
+		}
+		s.writeJSON(w, http.StatusOK, doc)
+
+	case http.MethodPut:
+		req := NoteRequest{}
+		if !s.readJSON(w, r, &req) {
+			return
+		}
+		typ := req.Type
+		if typ == "" {
+			typ = index.DetectType(id, []byte(req.Content))
+		}
+		if typ == "" {
+			typ = index.DOC_TYPE_MARKDOWN
+		}
+		if typ != index.DOC_TYPE_MARKDOWN && typ != index.DOC_TYPE_PLAIN && typ != index.DOC_TYPE_HTML {
+			s.writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid note type: %s", typ))
+			return
+		}
+		doc, err := index.NewDocument(id, typ, []byte(req.Content))
+		if err != nil {
+			s.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		doc.ModTime = req.ModTime
+		existed, err := s.ix.Replace(doc)
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if err := s.ix.Commit(); err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		status := http.StatusOK
+		if !existed {
+			status = http.StatusCreated
+		}
+		s.writeJSON(w, status, NoteResponse{ID: id, Created: !existed, Warnings: doc.Warnings})
+
+	case http.MethodDelete:
+		deleted, err := s.ix.Delete(id)
+		if err == nil && deleted {
+			err = s.ix.Commit()
+		}
+		if err != nil {
+			s.writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !deleted {
+			s.writeError(w, http.StatusNotFound, fmt.Sprintf("no note %s", id))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		s.methodNotAllowed(w, "GET, PUT, DELETE")
+	}
+}
+
+// SearchRequest is the body of a POST to /search. It has either a query
+// string in Q, or a query in the JSON query DSL (see index.Query) in Query.
+type SearchRequest struct {
+	Q       string       `json:"q,omitempty"`
+	Query   *index.Query `json:"query,omitempty"`
+	Limit   int          `json:"limit,omitempty"`
+	Offset  int          `json:"offset,omitempty"`
+	Fields  []string     `json:"fields,omitempty"`
+	Explain bool         `json:"explain,omitempty"`
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	req := SearchRequest{Limit: DEFAULT_LIMIT}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		values := r.URL.Query()
+		req.Q = values.Get("q")
+		var err error
+		if req.Limit, err = intParam(values.Get("limit"), DEFAULT_LIMIT); err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid limit: "+err.Error())
+			return
+		}
+		if req.Offset, err = intParam(values.Get("offset"), 0); err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid offset: "+err.Error())
+			return
+		}
+		if fields := values.Get("fields"); fields != "" {
+			req.Fields = strings.Split(fields, ",")
+		}
+		req.Explain = values.Get("explain") == "true" || values.Get("explain") == "1"
+	case http.MethodPost:
+		if !s.readJSON(w, r, &req) {
+			return
+		}
+	default:
+		s.methodNotAllowed(w, "GET, POST")
+		return
+	}
+
+	var q index.Query
+	switch {
+	case req.Query != nil && req.Q != "":
+		s.writeError(w, http.StatusBadRequest, "expected only one of q and query")
+		return
+	case req.Query != nil:
+		q = *req.Query
+	default:
+		var err error
+		if q, err = index.ParseQuery(req.Q); err != nil {
+			s.writeError(w, http.StatusBadRequest, "invalid query: "+err.Error())
+			return
+		}
+	}
+	if req.Limit < 0 || req.Offset < 0 {
+		s.writeError(w, http.StatusBadRequest, "limit and offset can't be negative")
+		return
+	}
+
+	result, err := s.ix.Search(q, index.SearchOptions{
+		Limit:   req.Limit,
+		Offset:  req.Offset,
+		Fields:  req.Fields,
+		Boosts:  s.opts.Boosts,
+		BM25:    s.opts.BM25,
+		Explain: req.Explain,
+	})
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, NewSearchResponse(s.ix, q.String(), req.Offset, result))
+}
+
+type SuggestResponse struct {
+	Suggestions []index.Suggestion `json:"suggestions"`
+}
+
+func (s *Server) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		s.methodNotAllowed(w, "GET")
+		return
+	}
+	values := r.URL.Query()
+	limit, err := intParam(values.Get("limit"), DEFAULT_LIMIT)
+	if err != nil {
+		s.writeError(w, http.StatusBadRequest, "invalid limit: "+err.Error())
+		return
+	}
+	s.writeJSON(w, http.StatusOK, SuggestResponse{Suggestions: s.ix.Suggest(values.Get("prefix"), limit)})
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		s.methodNotAllowed(w, "GET")
+		return
+	}
+	s.writeJSON(w, http.StatusOK, s.ix.Stats())
+}
+
+func intParam(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// Decodes the body of a request, responding with an error if it can't.
+func (s *Server) readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		status := http.StatusBadRequest
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		s.writeError(w, status, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logf("failed to write response: %v", err)
+	}
+}
+
+func (s *Server) writeError(w http.ResponseWriter, status int, message string) {
+	if status >= http.StatusInternalServerError {
+		s.logf("error: %s", message)
+	}
+	s.writeJSON(w, status, ErrorResponse{Error: message})
+}
+
+func (s *Server) methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	s.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+}
+
+func (s *Server) logf(format string, args ...any) {
+	if s.opts.Logger != nil {
+		s.opts.Logger.Printf(format, args...)
+	}
+}
@@ -0,0 +1,325 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"mrshanahan.com/notes-indexer/pkg/index"
+)
+
+func testServer(t *testing.T) (*httptest.Server, *index.Index) {
+	ix, err := index.Open(t.TempDir(), nil)
+	assert.Nil(t, err)
+	ts := httptest.NewServer(New(ix, Options{}))
+	t.Cleanup(func() {
+		ts.Close()
+		ix.Close()
+	})
+	return ts, ix
+}
+
+// Makes a request, decoding the JSON response into v if it's not nil.
+func request(t *testing.T, ts *httptest.Server, method, path string, body any, v any) int {
+	var r io.Reader
+	if s, ok := body.(string); ok {
+		r = strings.NewReader(s)
+	} else if body != nil {
+		data, err := json.Marshal(body)
+		assert.Nil(t, err)
+		r = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, ts.URL+path, r)
+	assert.Nil(t, err)
+	resp, err := ts.Client().Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	if v != nil {
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		assert.Nil(t, json.NewDecoder(resp.Body).Decode(v))
+	}
+	return resp.StatusCode
+}
+
+func putNote(t *testing.T, ts *httptest.Server, id, content string) {
+	status := request(t, ts, http.MethodPut, "/notes/"+id, NoteRequest{Content: content}, nil)
+	assert.Contains(t, []int{http.StatusOK, http.StatusCreated}, status)
+}
+
+func TestNotes(t *testing.T) {
+	ts, ix := testServer(t)
+
+	created := NoteResponse{}
+	status := request(t, ts, http.MethodPut, "/notes/work/todo.md", NoteRequest{Content: "# Todo\n\nShip the #indexer\n"}, &created)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, NoteResponse{ID: "work/todo.md", Created: true}, created)
+
+	status = request(t, ts, http.MethodPut, "/notes/work/todo.md", NoteRequest{Content: "# Done\n"}, &created)
+	assert.Equal(t, http.StatusOK, status)
+	assert.False(t, created.Created)
+
+	doc := index.Document{}
+	status = request(t, ts, http.MethodGet, "/notes/work/todo.md", nil, &doc)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Done", doc.Title)
+	assert.Equal(t, index.DOC_TYPE_MARKDOWN, doc.Type)
+
+	// Changes are committed before they're acknowledged
+	ro, err := index.OpenReadOnly(ix.Dir())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"work/todo.md"}, ro.IDs())
+
+	status = request(t, ts, http.MethodDelete, "/notes/work/todo.md", nil, nil)
+	assert.Equal(t, http.StatusNoContent, status)
+	errResp := ErrorResponse{}
+	status = request(t, ts, http.MethodDelete, "/notes/work/todo.md", nil, &errResp)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, "no note work/todo.md", errResp.Error)
+	status = request(t, ts, http.MethodGet, "/notes/work/todo.md", nil, &errResp)
+	assert.Equal(t, http.StatusNotFound, status)
+	assert.Equal(t, 0, ix.Len())
+}
+
+func TestNoteCreatedOnce(t *testing.T) {
+	ts, _ := testServer(t)
+
+	statuses := make(chan int, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(statuses); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- request(t, ts, http.MethodPut, "/notes/a.md", NoteRequest{Content: "# Apples\n"}, nil)
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	created := 0
+	for status := range statuses {
+		if status == http.StatusCreated {
+			created++
+		}
+	}
+	assert.Equal(t, 1, created)
+}
+
+func TestNoteWarnings(t *testing.T) {
+	ts, ix := testServer(t)
+
+	created := NoteResponse{}
+	status := request(t, ts, http.MethodPut, "/notes/week.md", NoteRequest{Content: "---\ntitle: Notes: week 3\n---\nShip it\n"}, &created)
+
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Len(t, created.Warnings, 1)
+	assert.Equal(t, []string{"week.md"}, ix.IDs())
+}
+
+func TestNoteErrors(t *testing.T) {
+	ts, _ := testServer(t)
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     any
+		status   int
+		expected string
+	}{
+		{"no-id", http.MethodPut, "/notes/", NoteRequest{Content: "x"}, http.StatusNotFound, "missing note ID"},
+		{"bad-json", http.MethodPut, "/notes/a.md", "{", http.StatusBadRequest, "invalid request body: unexpected EOF"},
+		{"unknown-field", http.MethodPut, "/notes/a.md", `{"body": "x"}`, http.StatusBadRequest, `invalid request body: json: unknown field "body"`},
+		{"bad-type", http.MethodPut, "/notes/a", NoteRequest{Content: "x", Type: "pdf"}, http.StatusBadRequest, "invalid note type: pdf"},
+		{"method", http.MethodPost, "/notes/a.md", NoteRequest{}, http.StatusMethodNotAllowed, "method not allowed"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errResp := ErrorResponse{}
+			status := request(t, ts, test.method, test.path, test.body, &errResp)
+
+			assert.Equal(t, test.status, status)
+			assert.Equal(t, test.expected, errResp.Error)
+		})
+	}
+}
+
+func TestNoteTooLarge(t *testing.T) {
+	ix, err := index.Open(t.TempDir(), nil)
+	assert.Nil(t, err)
+	defer ix.Close()
+	ts := httptest.NewServer(New(ix, Options{MaxBody: 64}))
+	defer ts.Close()
+
+	errResp := ErrorResponse{}
+	status := request(t, ts, http.MethodPut, "/notes/a.md", NoteRequest{Content: strings.Repeat("x", 100)}, &errResp)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, status)
+}
+
+func TestSearch(t *testing.T) {
+	ts, _ := testServer(t)
+	putNote(t, ts, "apples.md", "# Apples\n\nRed apples and green apples.\n")
+	putNote(t, ts, "pears.md", "# Pears\n\nPears are green. #done\n")
+	putNote(t, ts, "plain", "green things, in plain text")
+
+	result := SearchResponse{}
+	status := request(t, ts, http.MethodGet, "/search?q=green+-tags:done&limit=1", nil, &result)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 2, result.Total)
+	assert.Len(t, result.Hits, 1)
+	assert.Equal(t, "(green -tags:done)", result.Query)
+	assert.Equal(t, "apples.md", result.Hits[0].Path)
+	assert.Equal(t, 1, result.Hits[0].Rank)
+	assert.Equal(t, "Red apples and [green] apples.", result.Hits[0].Snippet.Marked("[", "]"))
+	if source := result.Hits[0].Snippet.Highlights[0].Source; assert.NotNil(t, source) {
+		assert.Equal(t, "3:16", source.Start.String())
+		assert.Equal(t, 25, source.Start.Offset)
+	}
+	assert.Nil(t, result.Hits[0].Explanation)
+
+	status = request(t, ts, http.MethodGet, "/search?q=green&offset=2&explain=true", nil, &result)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, result.Hits, 1)
+	assert.Equal(t, "plain", result.Hits[0].Path)
+	assert.Equal(t, 3, result.Hits[0].Rank)
+	assert.NotNil(t, result.Hits[0].Explanation)
+
+	dsl := `{"query": {"type": "bool", "must": [{"type": "match", "field": "title", "text": "pears"}]}, "fields": ["title"]}`
+	status = request(t, ts, http.MethodPost, "/search", dsl, &result)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 1, result.Total)
+	assert.Equal(t, "pears.md", result.Hits[0].Path)
+	assert.Equal(t, []string{"done"}, result.Hits[0].Tags)
+
+	status = request(t, ts, http.MethodPost, "/search", SearchRequest{Q: `"green apples"`}, &result)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 1, result.Total)
+}
+
+func TestSearchErrors(t *testing.T) {
+	ts, _ := testServer(t)
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     any
+		expected string
+	}{
+		{"empty", http.MethodGet, "/search", nil, "invalid query: empty query"},
+		{"syntax", http.MethodGet, "/search?q=%22unclosed", nil, "invalid query: unterminated quote at 0"},
+		{"limit", http.MethodGet, "/search?q=a&limit=x", nil, `invalid limit: strconv.Atoi: parsing "x": invalid syntax`},
+		{"negative", http.MethodGet, "/search?q=a&offset=-1", nil, "limit and offset can't be negative"},
+		{"both", http.MethodPost, "/search", `{"q": "a", "query": {"type": "match", "text": "a"}}`, "expected only one of q and query"},
+		{"dsl-type", http.MethodPost, "/search", `{"query": {"type": "fuzzy"}}`, "invalid request body: unknown query type: fuzzy"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			errResp := ErrorResponse{}
+			status := request(t, ts, test.method, test.path, test.body, &errResp)
+
+			assert.Equal(t, http.StatusBadRequest, status)
+			assert.Equal(t, test.expected, errResp.Error)
+		})
+	}
+}
+
+func TestSuggestAndStats(t *testing.T) {
+	ts, _ := testServer(t)
+	putNote(t, ts, "a.md", "# Apples\n")
+	putNote(t, ts, "b.md", "# Applesauce\n")
+	putNote(t, ts, "c.md", "# Apples again\n")
+
+	suggestions := SuggestResponse{}
+	status := request(t, ts, http.MethodGet, "/suggest?prefix=red+app&limit=5", nil, &suggestions)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []index.Suggestion{{Text: "red appl", Docs: 2}, {Text: "red applesauc", Docs: 1}}, suggestions.Suggestions)
+
+	stats := index.Stats{}
+	status = request(t, ts, http.MethodGet, "/stats", nil, &stats)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, 3, stats.Docs)
+	assert.Equal(t, 3, stats.Generation)
+	assert.Equal(t, 3, stats.Fields[index.FIELD_TITLE].Docs)
+
+	status = request(t, ts, http.MethodPost, "/stats", nil, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, status)
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	ts, ix := testServer(t)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				putNote(t, ts, fmt.Sprintf("%d-%d.md", i, j), fmt.Sprintf("# Note %d\n\nshared words %d\n", i, j))
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				result := SearchResponse{}
+				assert.Equal(t, http.StatusOK, request(t, ts, http.MethodGet, "/search?q=shared", nil, &result))
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 40, ix.Len())
+	result := SearchResponse{}
+	request(t, ts, http.MethodGet, "/search?q=shared&limit=0", nil, &result)
+	assert.Equal(t, 40, result.Total)
+}
+
+func TestServeShutsDownGracefully(t *testing.T) {
+	ix, err := index.Open(t.TempDir(), nil)
+	assert.Nil(t, err)
+	defer ix.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	srv := New(ix, Options{ShutdownTimeout: 5 * time.Second})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, l) }()
+
+	resp, err := http.Get("http://" + l.Addr().String() + "/stats")
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server didn't shut down")
+	}
+	_, err = http.Get("http://" + l.Addr().String() + "/stats")
+	assert.NotNil(t, err)
+}
+
+func TestRequestTimeout(t *testing.T) {
+	ix, err := index.Open(t.TempDir(), nil)
+	assert.Nil(t, err)
+	defer ix.Close()
+	srv := New(ix, Options{RequestTimeout: time.Nanosecond})
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/stats")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
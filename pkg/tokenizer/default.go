@@ -21,7 +21,12 @@ func NewDefaultWithSeparators(seps string) Tokenizer {
 }
 
 func (t *defaultTokenizer) Tokenize(text string) ([]Token, error) {
-	first, tokens, seps := -1, []Token{}, t.separators
+	tokens, _, err := t.TokenizeWithOffsets(text)
+	return tokens, err
+}
+
+func (t *defaultTokenizer) TokenizeWithOffsets(text string) ([]Token, []Offset, error) {
+	first, tokens, offsets, seps := -1, []Token{}, []Offset{}, t.separators
 	for i, r := range text {
 		issep := seps[r]
 		if !issep && first < 0 {
@@ -29,14 +34,16 @@ func (t *defaultTokenizer) Tokenize(text string) ([]Token, error) {
 		} else if issep && first >= 0 {
 			tok := strings.ToLower(text[first:i])
 			tokens = append(tokens, Token{tok, TOKEN_TYPE_GENERIC})
+			offsets = append(offsets, Offset{first, i})
 			first = -1
 		}
 	}
 	if first >= 0 {
 		tok := strings.ToLower(text[first:])
 		tokens = append(tokens, Token{tok, TOKEN_TYPE_GENERIC})
+		offsets = append(offsets, Offset{first, len(text)})
 	}
-	return tokens, nil
+	return tokens, offsets, nil
 }
 
 type set[T comparable] map[T]bool
@@ -0,0 +1,82 @@
+package tokenizer
+
+import (
+	"strings"
+)
+
+// nGramTokenizer splits text into words the same way the default tokenizer
+// does, then emits the character n-grams of each word instead of the word
+// itself. With edge set, only the n-grams anchored at the start of each word
+// are emitted, i.e. its prefixes.
+type nGramTokenizer struct {
+	words *defaultTokenizer
+	min   int
+	max   int
+	edge  bool
+}
+
+func NewNGram(min, max int) Tokenizer {
+	return &nGramTokenizer{
+		words: &defaultTokenizer{separators: convertSeparator(DefaultSeparators)},
+		min:   min,
+		max:   max,
+	}
+}
+
+func NewEdgeNGram(min, max int) Tokenizer {
+	return &nGramTokenizer{
+		words: &defaultTokenizer{separators: convertSeparator(DefaultSeparators)},
+		min:   min,
+		max:   max,
+		edge:  true,
+	}
+}
+
+func (t *nGramTokenizer) Tokenize(text string) ([]Token, error) {
+	tokens, _, err := t.TokenizeWithOffsets(text)
+	return tokens, err
+}
+
+func (t *nGramTokenizer) TokenizeWithOffsets(text string) ([]Token, []Offset, error) {
+	_, words, err := t.words.TokenizeWithOffsets(text)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, offsets := []Token{}, []Offset{}
+	for _, w := range words {
+		for _, g := range NGrams(text[w.Start:w.End], t.min, t.max, t.edge) {
+			start, end := w.Start+g.Start, w.Start+g.End
+			tokens = append(tokens, Token{strings.ToLower(text[start:end]), TOKEN_TYPE_GENERIC})
+			offsets = append(offsets, Offset{start, end})
+		}
+	}
+	return tokens, offsets, nil
+}
+
+// NGrams returns the byte ranges of every n-gram of word between min and max
+// runes long, ordered by start and then by length. With edge set, only
+// n-grams starting at the beginning of the word are returned.
+func NGrams(word string, min, max int, edge bool) []Offset {
+	if min < 1 {
+		min = 1
+	}
+
+	starts := []int{}
+	for i := range word {
+		starts = append(starts, i)
+	}
+	n := len(starts)
+	starts = append(starts, len(word))
+
+	grams := []Offset{}
+	for s := 0; s < n; s++ {
+		if edge && s > 0 {
+			break
+		}
+		for size := min; size <= max && s+size <= n; size++ {
+			grams = append(grams, Offset{starts[s], starts[s+size]})
+		}
+	}
+	return grams
+}
@@ -9,6 +9,11 @@ const (
 	TOKEN_TYPE_XML     = 1
 )
 
+var TokenTypeNames map[int]string = map[int]string{
+	TOKEN_TYPE_GENERIC: "generic",
+	TOKEN_TYPE_XML:     "xml",
+}
+
 type Token struct {
 	Value string
 	Type  int
@@ -17,3 +22,16 @@ type Token struct {
 type Tokenizer interface {
 	Tokenize(text string) ([]Token, error)
 }
+
+// Offset is the byte range [Start, End) that a token was read from.
+type Offset struct {
+	Start int
+	End   int
+}
+
+// OffsetTokenizer is a Tokenizer that can also report where in the original
+// text each token came from.
+type OffsetTokenizer interface {
+	Tokenizer
+	TokenizeWithOffsets(text string) ([]Token, []Offset, error)
+}
@@ -1,6 +1,7 @@
 package tokenizer
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -129,6 +130,51 @@ func TestNoSeparators(t *testing.T) {
 	assert.Equal(t, expected, actual)
 }
 
+func TestTokenizeWithOffsets(t *testing.T) {
+	tokenizer := NewDefault().(OffsetTokenizer)
+
+	text := "Héllo, wörld! (again)"
+	tokens, offsets, _ := tokenizer.TokenizeWithOffsets(text)
+
+	assert.Equal(t, fmap([]string{"héllo", "wörld", "again"}, genericToken), tokens)
+	assert.Equal(t, []Offset{{0, 6}, {8, 14}, {17, 22}}, offsets)
+	for i, o := range offsets {
+		assert.Equal(t, tokens[i].Value, strings.ToLower(text[o.Start:o.End]))
+	}
+}
+
+func TestXmlTokenizeWithOffsets(t *testing.T) {
+	tokenizer := NewXmlTokenizer().(OffsetTokenizer)
+
+	tokens, offsets, _ := tokenizer.TokenizeWithOffsets("a <b>test</b>")
+
+	assert.Equal(t, []Token{genericToken("a"), xmlToken("<b>"), genericToken("test"), xmlToken("</b>")}, tokens)
+	assert.Equal(t, []Offset{{0, 1}, {2, 5}, {5, 9}, {9, 13}}, offsets)
+}
+
+func TestNGramTokenization(t *testing.T) {
+	tokenizer := NewNGram(2, 3)
+
+	actual, offsets, _ := tokenizer.(OffsetTokenizer).TokenizeWithOffsets("Açaí x")
+
+	expected := fmap([]string{"aç", "aça", "ça", "çaí", "aí"}, genericToken)
+	assert.Equal(t, expected, actual)
+	assert.Equal(t, []Offset{{0, 3}, {0, 4}, {1, 4}, {1, 6}, {3, 6}}, offsets)
+
+	// No n-gram spans two words
+	actual, _ = NewNGram(3, 3).Tokenize("foo wo")
+	assert.Equal(t, fmap([]string{"foo"}, genericToken), actual)
+}
+
+func TestEdgeNGramTokenization(t *testing.T) {
+	tokenizer := NewEdgeNGram(1, 4)
+
+	actual, _ := tokenizer.Tokenize("Kubernetes, go")
+
+	expected := fmap([]string{"k", "ku", "kub", "kube", "g", "go"}, genericToken)
+	assert.Equal(t, expected, actual)
+}
+
 func fmap[T any, S any](ts []T, f func(T) S) []S {
 	ss := []S{}
 	for _, t := range ts {
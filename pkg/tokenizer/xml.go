@@ -69,25 +69,32 @@ var (
 )
 
 func (t *xmlTokenizer) Tokenize(text string) ([]Token, error) {
-	first, cur, tokens, seps := -1, 0, []Token{}, t.separators
+	tokens, _, err := t.TokenizeWithOffsets(text)
+	return tokens, err
+}
+
+func (t *xmlTokenizer) TokenizeWithOffsets(text string) ([]Token, []Offset, error) {
+	first, cur, tokens, offsets, seps := -1, 0, []Token{}, []Offset{}, t.separators
 	for cur < len(text) {
 		if loc := patt_XmlEnt.FindStringIndex(text[cur:]); len(loc) > 0 {
 			if first >= 0 {
 				tok := strings.ToLower(text[first:cur])
 				tokens = append(tokens, Token{tok, TOKEN_TYPE_GENERIC})
+				offsets = append(offsets, Offset{first, cur})
 				first = -1
 			}
 			idx, lng := loc[0], loc[1]
 			tok := text[cur+idx : cur+idx+lng]
 			tokens = append(tokens, Token{tok, TOKEN_TYPE_XML})
+			offsets = append(offsets, Offset{cur + idx, cur + idx + lng})
 			cur += idx + lng
 		} else {
 			r, rlen := utf8.DecodeRuneInString(text[cur:])
 			if r == utf8.RuneError {
 				if rlen > 0 {
-					return nil, fmt.Errorf("invalid UTF-8 rune at byte %d", cur)
+					return nil, nil, fmt.Errorf("invalid UTF-8 rune at byte %d", cur)
 				}
-				return nil, fmt.Errorf("unexpected end of input")
+				return nil, nil, fmt.Errorf("unexpected end of input")
 			}
 
 			issep := seps[r]
@@ -96,6 +103,7 @@ func (t *xmlTokenizer) Tokenize(text string) ([]Token, error) {
 			} else if issep && first >= 0 {
 				tok := strings.ToLower(text[first:cur])
 				tokens = append(tokens, Token{tok, TOKEN_TYPE_GENERIC})
+				offsets = append(offsets, Offset{first, cur})
 				first = -1
 			}
 			cur += rlen
@@ -104,8 +112,9 @@ func (t *xmlTokenizer) Tokenize(text string) ([]Token, error) {
 	if first >= 0 {
 		tok := strings.ToLower(text[first:])
 		tokens = append(tokens, Token{tok, TOKEN_TYPE_GENERIC})
+		offsets = append(offsets, Offset{first, len(text)})
 	}
-	return tokens, nil
+	return tokens, offsets, nil
 }
 
 type xmlTokenizer defaultTokenizer
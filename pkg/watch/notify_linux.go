@@ -0,0 +1,172 @@
+//go:build linux
+
+package watch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const watchMask uint32 = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// Finds changes with inotify, which has to watch each directory in the tree
+// separately, and new ones as they're created.
+type notifier struct {
+	root string
+	skip func(string, bool) bool
+	fd   int
+	file *os.File         // The same as fd, to read from
+	dirs map[int32]string // Watch descriptors to the directories they watch
+}
+
+func newNotifier(root string, skip func(string, bool) bool) (source, error) {
+	// Non-blocking so that reads go through the runtime's poller, and closing
+	// the file stops one in progress
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start inotify: %w", err)
+	}
+	n := &notifier{root: root, skip: skip, fd: fd, file: os.NewFile(uintptr(fd), "inotify"), dirs: map[int32]string{}}
+	if err := n.addTree("."); err != nil {
+		n.file.Close()
+		return nil, err
+	}
+	return n, nil
+}
+
+// Watches a directory and those under it, which are relative to the root.
+func (n *notifier) addTree(dir string) error {
+	return filepath.WalkDir(filepath.Join(n.root, filepath.FromSlash(dir)), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(n.root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && n.skip(rel, true) {
+			return filepath.SkipDir
+		}
+		wd, err := syscall.InotifyAddWatch(n.fd, p, watchMask|syscall.IN_ONLYDIR)
+		if err != nil {
+			if errors.Is(err, syscall.ENOENT) {
+				return filepath.SkipDir
+			}
+			if errors.Is(err, syscall.ENOSPC) {
+				return fmt.Errorf("failed to watch %s: too many watches (see fs.inotify.max_user_watches)", p)
+			}
+			return fmt.Errorf("failed to watch %s: %w", p, err)
+		}
+		n.dirs[int32(wd)] = rel
+		return nil
+	})
+}
+
+func (n *notifier) run(ctx context.Context, changes chan<- string) error {
+	go func() {
+		<-ctx.Done()
+		n.file.Close()
+	}()
+
+	buf := make([]byte, 64*1024)
+	for {
+		size, err := n.file.Read(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to read inotify events: %w", err)
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= size; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buf[nameStart:nameStart+int(event.Len)], "\x00"))
+			offset = nameStart + int(event.Len)
+
+			rel, err := n.handle(event.Wd, event.Mask, name)
+			if err != nil {
+				return err
+			}
+			if rel != "" && !send(ctx, changes, rel) {
+				return nil
+			}
+		}
+	}
+}
+
+// Keeps the watches up to date with an event, returning the path it's about
+// if it should be reported.
+func (n *notifier) handle(wd int32, mask uint32, name string) (string, error) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		// Some events were dropped, so anything could have changed
+		return ".", nil
+	}
+	dir, ok := n.dirs[wd]
+	if !ok {
+		return "", nil
+	}
+	if mask&syscall.IN_IGNORED != 0 {
+		// The directory's gone, and its parent reports that
+		delete(n.dirs, wd)
+		return "", nil
+	}
+	if name == "" {
+		// Events on the directory itself are reported by its parent, other
+		// than the root's
+		if dir == "." && mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF) != 0 {
+			return "", fmt.Errorf("%s was removed", n.root)
+		}
+		return "", nil
+	}
+
+	rel := path.Join(dir, name)
+	isDir := mask&syscall.IN_ISDIR != 0
+	if n.skip(rel, isDir) {
+		return "", nil
+	}
+	if isDir && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+		// Anything created in it before it was watched is found by looking at
+		// it as a whole
+		if err := n.addTree(rel); err != nil {
+			return "", err
+		}
+	}
+	if isDir && mask&(syscall.IN_MODIFY|syscall.IN_ATTRIB|syscall.IN_CLOSE_WRITE) != 0 {
+		return "", nil
+	}
+	if isDir && mask&syscall.IN_MOVED_FROM != 0 {
+		// Moved out of the tree, or elsewhere in it under a new name which is
+		// watched again as if created. The old watches stay until the
+		// directory's removed, but are for paths that no longer exist, so
+		// they're dropped.
+		n.removeTree(rel)
+	}
+	return rel, nil
+}
+
+// Stops watching a directory and those under it.
+func (n *notifier) removeTree(dir string) {
+	for wd, d := range n.dirs {
+		if d == dir || strings.HasPrefix(d, dir+"/") {
+			syscall.InotifyRmWatch(n.fd, uint32(wd))
+			delete(n.dirs, wd)
+		}
+	}
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package watch
+
+func newNotifier(root string, skip func(string, bool) bool) (source, error) {
+	return nil, ErrNotSupported
+}
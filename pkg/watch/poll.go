@@ -0,0 +1,108 @@
+package watch
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+type fileState struct {
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+// Finds changes by walking the tree every so often and comparing the size &
+// modification time of everything in it with the walk before.
+type poller struct {
+	root     string
+	skip     func(string, bool) bool
+	interval time.Duration
+}
+
+func newPoller(root string, skip func(string, bool) bool, interval time.Duration) *poller {
+	return &poller{root, skip, interval}
+}
+
+func (p *poller) run(ctx context.Context, changes chan<- string) error {
+	last, err := p.snapshot()
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		next, err := p.snapshot()
+		if err != nil {
+			return err
+		}
+		for rel, state := range next {
+			if prev, ok := last[rel]; !ok || (!state.dir && prev != state) {
+				if !send(ctx, changes, rel) {
+					return nil
+				}
+			}
+		}
+		for rel := range last {
+			if _, ok := next[rel]; !ok {
+				if !send(ctx, changes, rel) {
+					return nil
+				}
+			}
+		}
+		last = next
+	}
+}
+
+func (p *poller) snapshot() (map[string]fileState, error) {
+	states := map[string]fileState{}
+	err := filepath.WalkDir(p.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// Removed between listing its directory and getting to it
+			if path != p.root && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(p.root, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if p.skip(rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		states[rel] = fileState{info.Size(), info.ModTime(), d.IsDir()}
+		return nil
+	})
+	return states, err
+}
+
+func send(ctx context.Context, changes chan<- string, rel string) bool {
+	select {
+	case changes <- rel:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
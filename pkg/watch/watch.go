@@ -0,0 +1,130 @@
+// Package watch watches a directory tree for changes, reporting them in
+// batches once they've settled. It uses inotify where it can, and otherwise
+// polls.
+package watch
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+const (
+	DEFAULT_DEBOUNCE      time.Duration = 100 * time.Millisecond
+	DEFAULT_MAX_DELAY     time.Duration = 500 * time.Millisecond
+	DEFAULT_POLL_INTERVAL time.Duration = 500 * time.Millisecond
+)
+
+// ErrNotSupported is returned when there's no way to be notified of changes
+// on a platform, so they have to be polled for.
+var ErrNotSupported = errors.New("not supported on this platform")
+
+type Options struct {
+	// How long to wait for more changes after one before reporting them. Zero
+	// means DEFAULT_DEBOUNCE.
+	Debounce time.Duration
+
+	// The longest to hold changes back while they keep coming. Zero means
+	// DEFAULT_MAX_DELAY.
+	MaxDelay time.Duration
+
+	// Poll for changes even where they could be notified
+	Poll bool
+
+	// How often to poll. Zero means DEFAULT_POLL_INTERVAL.
+	PollInterval time.Duration
+
+	// Whether to leave out a path relative to the root, with slashes. Nothing
+	// under a directory left out is watched.
+	Skip func(rel string, dir bool) bool
+}
+
+// A source of changes, each the path relative to the root of a file or
+// directory that's been created, changed, removed or renamed. "." means
+// anything under the root could have changed.
+type source interface {
+	run(ctx context.Context, changes chan<- string) error
+}
+
+// Watch watches root until ctx is done or watching fails, calling onChange
+// with the paths that have changed since it was last called, relative to
+// root with slashes and sorted. A path that's been removed or renamed is
+// reported as well as what it was renamed to, and a directory may be
+// reported rather than what's in it, so either could be gone by the time
+// they're looked at.
+//
+// onChange is called from the goroutine Watch runs on, and changes that
+// happen while it runs are reported on the next call.
+func Watch(ctx context.Context, root string, opts Options, onChange func([]string)) error {
+	if opts.Debounce == 0 {
+		opts.Debounce = DEFAULT_DEBOUNCE
+	}
+	if opts.MaxDelay == 0 {
+		opts.MaxDelay = DEFAULT_MAX_DELAY
+	}
+	if opts.PollInterval == 0 {
+		opts.PollInterval = DEFAULT_POLL_INTERVAL
+	}
+	if opts.Skip == nil {
+		opts.Skip = func(string, bool) bool { return false }
+	}
+
+	var src source
+	if !opts.Poll {
+		var err error
+		if src, err = newNotifier(root, opts.Skip); err != nil && !errors.Is(err, ErrNotSupported) {
+			return err
+		}
+	}
+	if src == nil {
+		src = newPoller(root, opts.Skip, opts.PollInterval)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changes := make(chan string, 64)
+	done := make(chan error, 1)
+	go func() { done <- src.run(ctx, changes) }()
+
+	pending := map[string]bool{}
+	var first time.Time
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case p := <-changes:
+			if len(pending) == 0 {
+				first = time.Now()
+			}
+			pending[p] = true
+			wait := opts.Debounce
+			if left := opts.MaxDelay - time.Since(first); left < wait {
+				wait = left
+			}
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			timer.Reset(wait)
+		case <-timer.C:
+			paths := make([]string, 0, len(pending))
+			for p := range pending {
+				paths = append(paths, p)
+			}
+			sort.Strings(paths)
+			pending = map[string]bool{}
+			onChange(paths)
+		case err := <-done:
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
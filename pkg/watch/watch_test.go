@@ -0,0 +1,170 @@
+package watch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Starts watching a temporary directory, returning it and a channel of the
+// batches of changes reported.
+func testWatch(t *testing.T, opts Options, files map[string]string) (string, <-chan []string) {
+	root := t.TempDir()
+	for name, content := range files {
+		writeFile(t, root, name, content)
+	}
+	if opts.PollInterval == 0 {
+		opts.PollInterval = 20 * time.Millisecond
+	}
+	if opts.Debounce == 0 {
+		opts.Debounce = 50 * time.Millisecond
+	}
+	opts.Skip = func(rel string, dir bool) bool { return strings.HasPrefix(filepath.Base(rel), ".") }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	batches := make(chan []string, 16)
+	done := make(chan error, 1)
+	go func() { done <- Watch(ctx, root, opts, func(paths []string) { batches <- paths }) }()
+	t.Cleanup(func() {
+		cancel()
+		assert.Nil(t, <-done)
+	})
+	// Give it time to set up, and polling to take its first look
+	time.Sleep(50 * time.Millisecond)
+	return root, batches
+}
+
+func writeFile(t *testing.T, root, name, content string) {
+	p := filepath.Join(root, filepath.FromSlash(name))
+	assert.Nil(t, os.MkdirAll(filepath.Dir(p), 0755))
+	assert.Nil(t, os.WriteFile(p, []byte(content), 0644))
+}
+
+// Collects the paths reported until they include all of want, or it takes too
+// long.
+func waitFor(t *testing.T, batches <-chan []string, want ...string) []string {
+	t.Helper()
+	seen := map[string]bool{}
+	timeout := time.After(2 * time.Second)
+	for {
+		missing := false
+		for _, w := range want {
+			missing = missing || !seen[w]
+		}
+		if !missing {
+			break
+		}
+		select {
+		case batch := <-batches:
+			for _, p := range batch {
+				seen[p] = true
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %v, got %v", want, seen)
+		}
+	}
+	paths := []string{}
+	for p := range seen {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func forEachSource(t *testing.T, test func(t *testing.T, opts Options)) {
+	t.Run("notify", func(t *testing.T) { test(t, Options{}) })
+	t.Run("poll", func(t *testing.T) { test(t, Options{Poll: true}) })
+}
+
+func TestWatchChanges(t *testing.T) {
+	forEachSource(t, func(t *testing.T, opts Options) {
+		root, batches := testWatch(t, opts, map[string]string{"a.md": "a", "sub/b.md": "b"})
+
+		writeFile(t, root, "a.md", "changed")
+		writeFile(t, root, "c.md", "new")
+		assert.Nil(t, os.Remove(filepath.Join(root, "sub", "b.md")))
+
+		assert.Subset(t, waitFor(t, batches, "a.md", "c.md", "sub/b.md"), []string{"a.md", "c.md", "sub/b.md"})
+	})
+}
+
+func TestWatchRename(t *testing.T) {
+	forEachSource(t, func(t *testing.T, opts Options) {
+		root, batches := testWatch(t, opts, map[string]string{"a.md": "a"})
+
+		assert.Nil(t, os.Rename(filepath.Join(root, "a.md"), filepath.Join(root, "b.md")))
+
+		waitFor(t, batches, "a.md", "b.md")
+	})
+}
+
+func TestWatchNewDirectory(t *testing.T) {
+	forEachSource(t, func(t *testing.T, opts Options) {
+		root, batches := testWatch(t, opts, nil)
+
+		writeFile(t, root, "new/a.md", "a")
+		waitFor(t, batches, "new")
+		// Files in it are watched from then on
+		writeFile(t, root, "new/b.md", "b")
+		waitFor(t, batches, "new/b.md")
+	})
+}
+
+func TestWatchSkip(t *testing.T) {
+	forEachSource(t, func(t *testing.T, opts Options) {
+		root, batches := testWatch(t, opts, map[string]string{".git/HEAD": "x"})
+
+		writeFile(t, root, ".git/HEAD", "y")
+		writeFile(t, root, ".hidden.md", "y")
+		writeFile(t, root, "a.md", "a")
+
+		assert.Equal(t, []string{"a.md"}, waitFor(t, batches, "a.md"))
+	})
+}
+
+func TestWatchDebounce(t *testing.T) {
+	root, batches := testWatch(t, Options{Debounce: 100 * time.Millisecond, MaxDelay: time.Second}, nil)
+
+	for i := 0; i < 5; i++ {
+		writeFile(t, root, "a.md", strings.Repeat("a", i+1))
+		time.Sleep(10 * time.Millisecond)
+	}
+	writeFile(t, root, "b.md", "b")
+
+	select {
+	case batch := <-batches:
+		assert.Equal(t, []string{"a.md", "b.md"}, batch)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out")
+	}
+	select {
+	case batch := <-batches:
+		t.Fatalf("unexpected batch %v", batch)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestWatchMaxDelay(t *testing.T) {
+	root, batches := testWatch(t, Options{Debounce: 100 * time.Millisecond, MaxDelay: 150 * time.Millisecond}, nil)
+	start := time.Now()
+
+	// Changes keep coming more often than the debounce, but are still
+	// reported by the max delay
+	var elapsed time.Duration
+	for i := 0; elapsed == 0 && i < 50; i++ {
+		writeFile(t, root, "a.md", strings.Repeat("a", i+1))
+		select {
+		case <-batches:
+			elapsed = time.Since(start)
+		case <-time.After(20 * time.Millisecond):
+		}
+	}
+	assert.NotZero(t, elapsed)
+	assert.Less(t, elapsed, 500*time.Millisecond)
+}